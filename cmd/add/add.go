@@ -1,24 +1,125 @@
 package add
 
 import (
+	"strings"
+
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+	"github.com/csams/doit/pkg/tui/client"
 )
 
-func NewCommand() *cobra.Command {
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
 	cmd := &cobra.Command{
-		Args: cobra.ExactArgs(1),
-		Use:  "add",
-		RunE: addTask,
+		Args:  cobra.MinimumNArgs(1),
+		Use:   "add <description>",
+		Short: "Add a task to my list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return addTask(cmd, args, log, options)
+		},
 	}
 
 	cmd.Flags().StringP("due", "d", "", "due date")
+	cmd.Flags().String("repeat", "", "repeat the task daily, weekdays, weekly, monthly, yearly, every N days, or by an RRULE. needs a due date.")
 	cmd.Flags().StringP("priority", "p", "", "priority")
 	cmd.Flags().StringP("status", "s", "", "status")
 	cmd.Flags().StringSlice("tags", nil, "Comma separated list of tags")
+	cmd.Flags().String("assignee", "", "username of someone I share my list with to assign the task to")
+	cmd.Flags().String("parent", "", "id of the task to add this one as a subtask of")
+	cmd.Flags().Bool("auto-close", false, "close the task when all of its subtasks are closed")
+	cmd.Flags().StringSlice("checklist", nil, "Comma separated list of checklist items. Prefix an item with [x] if it's done.")
+	util.AddOutputFlag(cmd.Flags())
+
+	options.AddFlags(cmd.Flags())
 
 	return cmd
 }
 
-func addTask(cmd *cobra.Command, args []string) error {
-	return nil
+func addTask(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+
+	output, err := util.GetOutput(flags)
+	if err != nil {
+		return err
+	}
+
+	due, err := util.GetDue(flags)
+	if err != nil {
+		return err
+	}
+
+	priority, err := util.GetPriority(flags)
+	if err != nil {
+		return err
+	}
+
+	status, err := util.GetStatus(flags)
+	if err != nil {
+		return err
+	}
+
+	tags, err := util.GetTags(flags)
+	if err != nil {
+		return err
+	}
+
+	recurrence, err := flags.GetString("repeat")
+	if err != nil {
+		return err
+	}
+
+	parent, err := util.GetParent(flags)
+	if err != nil {
+		return err
+	}
+
+	autoClose, err := flags.GetBool("auto-close")
+	if err != nil {
+		return err
+	}
+
+	checklist, err := util.GetChecklist(flags)
+	if err != nil {
+		return err
+	}
+
+	task := &apis.Task{
+		Description: strings.Join(args, " "),
+		Due:         due,
+		Priority:    priority,
+		Status:      apis.Backlog,
+		Tags:        apis.NewTags(tags...),
+		Recurrence:  recurrence,
+		AutoClose:   autoClose,
+		Checklist:   checklist,
+	}
+	if parent != nil {
+		task.ParentId = *parent
+	}
+	if status != nil {
+		task.Status = *status
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	assignee, err := util.GetAssignee(flags, c, me.ID)
+	if err != nil {
+		return err
+	}
+	if assignee != nil {
+		task.AssigneeId = assignee.ID
+	}
+
+	created, err := client.Post(c, tui.TasksUrl(me.ID), task)
+	if err != nil {
+		return err
+	}
+
+	return util.PrintTask(cmd.OutOrStdout(), output, created)
 }
@@ -0,0 +1,87 @@
+package done
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+	"github.com/csams/doit/pkg/tui/client"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.MinimumNArgs(1),
+		Use:   "done <task id>...",
+		Short: "Mark tasks as done.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doneTasks(cmd, args, log, options)
+		},
+	}
+
+	util.AddForceFlag(cmd.Flags())
+	util.AddOutputFlag(cmd.Flags())
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func doneTasks(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	output, err := util.GetOutput(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	ids, err := util.GetTaskIds(args)
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	var updated []apis.Task
+	for _, id := range ids {
+		orig, err := util.GetTask(c, me.ID, id)
+		if err != nil {
+			return err
+		}
+		task := *orig
+
+		task.Status = apis.Done
+		task.State = apis.Closed
+
+		up, err := util.PatchTask(cmd.Flags(), c, orig, &task)
+		if err != nil {
+			return err
+		}
+		updated = append(updated, *up)
+
+		if orig.Status != apis.Done && up.Recurrence != "" {
+			if err := printNext(cmd.ErrOrStderr(), c, up); err != nil {
+				return err
+			}
+		}
+	}
+
+	return util.PrintTasks(cmd.OutOrStdout(), output, updated)
+}
+
+// printNext tells me about the task that completing a recurring task created.
+func printNext(w io.Writer, c client.Client, done *apis.Task) error {
+	query := apis.TaskQuery{Series: done.SeriesId, States: []apis.State{apis.Open}}
+	next, err := tui.ListTasks(c, done.OwnerId, query)
+	if err != nil {
+		return err
+	}
+	for _, t := range next {
+		fmt.Fprintf(w, "Task %d repeats as task %d, due %s\n", done.ID, t.ID, util.FormatDue(t.Due))
+	}
+	return nil
+}
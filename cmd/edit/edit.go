@@ -0,0 +1,183 @@
+package edit
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.ExactArgs(1),
+		Use:   "edit <task id>",
+		Short: "Change a task. Only the given flags are changed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editTask(cmd, args, log, options)
+		},
+	}
+
+	cmd.Flags().String("desc", "", "description")
+	cmd.Flags().StringP("due", "d", "", "due date. use none to clear it.")
+	cmd.Flags().String("repeat", "", "repeat the task daily, weekdays, weekly, monthly, yearly, every N days, or by an RRULE. use none to stop it.")
+	cmd.Flags().StringP("priority", "p", "", "priority")
+	cmd.Flags().StringP("status", "s", "", "status")
+	cmd.Flags().String("state", "", "state")
+	cmd.Flags().StringSlice("tags", nil, "Comma separated list of tags. Replaces the existing tags.")
+	cmd.Flags().Bool("private", false, "hide the task from users I share my list with")
+	cmd.Flags().String("assignee", "", "username of someone I share my list with to assign the task to")
+	cmd.Flags().String("parent", "", "id of the task to make this one a subtask of. use none to make it a top level task.")
+	cmd.Flags().Bool("auto-close", false, "close the task when all of its subtasks are closed")
+	cmd.Flags().StringSlice("checklist", nil, "Comma separated list of checklist items. Replaces the existing items.")
+	cmd.Flags().IntSlice("check", nil, "Comma separated list of checklist item numbers to mark done, starting at 1")
+	cmd.Flags().IntSlice("uncheck", nil, "Comma separated list of checklist item numbers to mark not done, starting at 1")
+	util.AddForceFlag(cmd.Flags())
+	util.AddOutputFlag(cmd.Flags())
+
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func editTask(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+
+	output, err := util.GetOutput(flags)
+	if err != nil {
+		return err
+	}
+
+	ids, err := util.GetTaskIds(args)
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	orig, err := util.GetTask(c, me.ID, ids[0])
+	if err != nil {
+		return err
+	}
+	task := *orig
+
+	if flags.Changed("desc") {
+		if task.Description, err = flags.GetString("desc"); err != nil {
+			return err
+		}
+	}
+
+	if flags.Changed("due") {
+		if due, _ := flags.GetString("due"); due == "none" {
+			task.Due = nil
+		} else if task.Due, err = util.GetDue(flags); err != nil {
+			return err
+		}
+	}
+
+	if flags.Changed("repeat") {
+		if task.Recurrence, err = flags.GetString("repeat"); err != nil {
+			return err
+		}
+		if task.Recurrence == "none" {
+			task.Recurrence = ""
+		}
+	}
+
+	if flags.Changed("priority") {
+		if task.Priority, err = util.GetPriority(flags); err != nil {
+			return err
+		}
+	}
+
+	if status, err := util.GetStatus(flags); err != nil {
+		return err
+	} else if status != nil {
+		task.Status = *status
+	}
+
+	if state, err := util.GetState(flags); err != nil {
+		return err
+	} else if state != nil {
+		task.State = *state
+	}
+
+	if flags.Changed("tags") {
+		tags, err := util.GetTags(flags)
+		if err != nil {
+			return err
+		}
+		task.Tags = apis.NewTags(tags...)
+	}
+
+	if flags.Changed("private") {
+		if task.Private, err = flags.GetBool("private"); err != nil {
+			return err
+		}
+	}
+
+	assignee, err := util.GetAssignee(flags, c, me.ID)
+	if err != nil {
+		return err
+	}
+	if assignee != nil {
+		task.AssigneeId = assignee.ID
+	}
+
+	if parent, err := util.GetParent(flags); err != nil {
+		return err
+	} else if parent != nil {
+		task.ParentId = *parent
+	}
+
+	if flags.Changed("auto-close") {
+		if task.AutoClose, err = flags.GetBool("auto-close"); err != nil {
+			return err
+		}
+	}
+
+	if flags.Changed("checklist") {
+		if task.Checklist, err = util.GetChecklist(flags); err != nil {
+			return err
+		}
+	}
+
+	if err := checkItems(flags, &task); err != nil {
+		return err
+	}
+
+	up, err := util.PatchTask(flags, c, orig, &task)
+	if err != nil {
+		return err
+	}
+
+	return util.PrintTask(cmd.OutOrStdout(), output, up)
+}
+
+// checkItems marks the checklist items given by the check and uncheck flags.
+// The task's checklist is copied so the original task isn't changed with it.
+func checkItems(flags *pflag.FlagSet, task *apis.Task) error {
+	marks := map[string]bool{"check": true, "uncheck": false}
+	checklist := append([]apis.ChecklistItem(nil), task.Checklist...)
+	for flag, done := range marks {
+		numbers, err := flags.GetIntSlice(flag)
+		if err != nil {
+			return err
+		}
+		for _, n := range numbers {
+			if n < 1 || n > len(checklist) {
+				return fmt.Errorf("task %d has no checklist item %d", task.ID, n)
+			}
+			checklist[n-1].Done = done
+		}
+	}
+	task.Checklist = checklist
+	return nil
+}
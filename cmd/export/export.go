@@ -0,0 +1,69 @@
+package export
+
+import (
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.MaximumNArgs(1),
+		Use:   "export [file]",
+		Short: "Export my tasks with their comments and annotations.",
+		Long: `Export my tasks with their comments and annotations to a file, or to
+standard out if there isn't one. The format is json unless --format is set or
+the file ends in .csv, .txt, or .ics, which are csv, todo.txt, and ical. The
+taskwarrior format can be read by task import, and the ical format by calendar
+apps that show to-dos.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportTasks(cmd, args, log, options)
+		},
+	}
+
+	cmd.Flags().String("format", "", "json, csv, todotxt, taskwarrior, or ical")
+	cmd.Flags().String("columns", "", "Comma separated list of csv columns")
+
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func exportTasks(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+
+	var file string
+	if len(args) > 0 {
+		file = args[0]
+	}
+
+	format, err := util.GetFormat(flags, file)
+	if err != nil {
+		return err
+	}
+
+	columns, err := flags.GetString("columns")
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	data, err := tui.ExportTasks(c, me.ID, format, columns)
+	if err != nil {
+		return err
+	}
+
+	if file == "" || file == "-" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
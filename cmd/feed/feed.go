@@ -0,0 +1,174 @@
+package feed
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "feed",
+		Short: "Manage calendar feeds of my tasks.",
+		Long: `Calendar feeds let calendar apps subscribe to my tasks as iCalendar to-dos.
+Anyone with a feed's URL can read it, so delete feeds that are no longer used.`,
+	}
+
+	cmd.AddCommand(newCreateCommand(log, options))
+	cmd.AddCommand(newListCommand(log, options))
+	cmd.AddCommand(newDeleteCommand(log, options))
+	return cmd
+}
+
+func newCreateCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "create",
+		Short: "Make a calendar feed and print its URL.",
+		Long: `Make a calendar feed of my tasks with due dates, or of a saved view with
+--view, and print the URL to subscribe to. The URL can't be shown again.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createFeed(cmd, log, options)
+		},
+	}
+
+	cmd.Flags().String("view", "", "name of the saved view to make a feed of")
+	cmd.Flags().String("name", "", "name of the feed. defaults to the view's name or my username")
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func createFeed(cmd *cobra.Command, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+	viewName, err := flags.GetString("view")
+	if err != nil {
+		return err
+	}
+	name, err := flags.GetString("name")
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	feed := &apis.Feed{OwnerId: me.ID, Name: name}
+	if viewName != "" {
+		views, err := tui.ListViews(c, me.ID)
+		if err != nil {
+			return err
+		}
+		for _, v := range views {
+			if v.Name == viewName {
+				feed.ViewId = v.ID
+			}
+		}
+		if feed.ViewId == 0 {
+			return fmt.Errorf("no view named %q", viewName)
+		}
+	}
+
+	feed, err = tui.CreateFeed(c, feed)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), strings.TrimSuffix(options.Address, "/")+feed.URL)
+	return err
+}
+
+func newListCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:    cobra.NoArgs,
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List my calendar feeds.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listFeeds(cmd, log, options)
+		},
+	}
+
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func listFeeds(cmd *cobra.Command, log logr.Logger, options *tui.Options) error {
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	feeds, err := tui.ListFeeds(c, me.ID)
+	if err != nil {
+		return err
+	}
+	return printFeeds(cmd.OutOrStdout(), feeds)
+}
+
+func printFeeds(w io.Writer, feeds []apis.Feed) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tVIEW\tCREATED\tLAST FETCHED")
+	for _, f := range feeds {
+		fetched := "never"
+		if f.FetchedAt != nil {
+			fetched = util.FormatDue(f.FetchedAt)
+		}
+		view := ""
+		if f.ViewId != 0 {
+			view = strconv.FormatUint(uint64(f.ViewId), 10)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", f.ID, f.Name, view, util.FormatDue(&f.CreatedAt), fetched)
+	}
+	return tw.Flush()
+}
+
+func newDeleteCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:    cobra.MinimumNArgs(1),
+		Use:     "delete <feed id>...",
+		Aliases: []string{"rm"},
+		Short:   "Delete calendar feeds so their URLs stop working.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return deleteFeeds(cmd, args, log, options)
+		},
+	}
+
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func deleteFeeds(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	ids := make([]uint, 0, len(args))
+	for _, a := range args {
+		id, err := strconv.ParseUint(a, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid feed id: %s", a)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	var deleted []apis.Feed
+	for _, id := range ids {
+		feed, err := tui.DeleteFeed(c, me.ID, id)
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, *feed)
+	}
+	return printFeeds(cmd.OutOrStdout(), deleted)
+}
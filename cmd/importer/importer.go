@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"io"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.ExactArgs(1),
+		Use:   "import <file>",
+		Short: "Import tasks into my list.",
+		Long: `Import tasks into my list from a file, or from standard in if the file is -.
+The format is json unless --format is set or the file ends in .csv, .txt, or
+.ics, which are csv, todo.txt, and ical. The taskwarrior format reads the output
+of task export, and the ical format reads the to-dos of an iCalendar file.
+Tasks with the UUID of one already in the list update it, so the same file can
+be imported again. Otherwise tasks with the same description and due
+date as one already in the list are skipped and reported as duplicates.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importTasks(cmd, args, log, options)
+		},
+	}
+
+	cmd.Flags().String("format", "", "json, csv, todotxt, taskwarrior, or ical")
+	cmd.Flags().Bool("dry-run", false, "report what would be imported without importing anything")
+	util.AddOutputFlag(cmd.Flags())
+
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func importTasks(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+
+	output, err := util.GetOutput(flags)
+	if err != nil {
+		return err
+	}
+
+	format, err := util.GetFormat(flags, args[0])
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := flags.GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if args[0] == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	result, err := tui.ImportTasks(c, me.ID, format, data, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return util.PrintImportResult(cmd.OutOrStdout(), output, result)
+}
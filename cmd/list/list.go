@@ -0,0 +1,135 @@
+package list
+
+import (
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List tasks in my list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listTasks(cmd, log, options)
+		},
+	}
+
+	cmd.Flags().Bool("assigned", false, "list tasks assigned to me instead of the tasks I own")
+	cmd.Flags().StringSlice("status", nil, "Comma separated list of statuses")
+	cmd.Flags().StringSlice("state", nil, "Comma separated list of states")
+	cmd.Flags().StringSlice("tags", nil, "Comma separated list of tags")
+	cmd.Flags().Bool("all-tags", false, "match tasks with all of the tags instead of any of them")
+	cmd.Flags().String("priority-min", "", "lowest priority to list")
+	cmd.Flags().String("priority-max", "", "highest priority to list")
+	cmd.Flags().String("due-before", "", "list tasks due before this date")
+	cmd.Flags().String("due-after", "", "list tasks due after this date")
+	cmd.Flags().StringP("search", "q", "", "text the description must contain")
+	cmd.Flags().String("blocked", "", "list only tasks that unfinished tasks block (true) or that nothing blocks (false)")
+	cmd.Flags().String("parent", "", "list only the subtasks of this task. use 0 for top level tasks.")
+	cmd.Flags().StringP("filter", "f", "", "filter expression like 'status:doing and due<+2d'")
+	cmd.Flags().String("sort", "", "Comma separated list of sort fields. Prefix a field with - to reverse it.")
+	util.AddOutputFlag(cmd.Flags())
+
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func listTasks(cmd *cobra.Command, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+
+	output, err := util.GetOutput(flags)
+	if err != nil {
+		return err
+	}
+
+	query, err := getQuery(flags)
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := tui.ListTasks(c, me.ID, *query)
+	if err != nil {
+		return err
+	}
+
+	return util.PrintTasks(cmd.OutOrStdout(), output, tasks)
+}
+
+// getQuery converts the flags to query parameters and lets apis.TaskQuery
+// validate them.
+func getQuery(flags *pflag.FlagSet) (*apis.TaskQuery, error) {
+	q := &apis.TaskQuery{}
+
+	var err error
+	if q.Assignee, err = flags.GetBool("assigned"); err != nil {
+		return nil, err
+	}
+
+	tags, err := util.GetTags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	allTags, err := flags.GetBool("all-tags")
+	if err != nil {
+		return nil, err
+	}
+
+	if allTags {
+		q.TagsAll = tags
+	} else {
+		q.TagsAny = tags
+	}
+
+	v := q.Values()
+	lists := map[string]string{
+		"status": "status",
+		"state":  "state",
+	}
+	for flag, param := range lists {
+		values, err := flags.GetStringSlice(flag)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			v.Set(param, strings.Join(values, ","))
+		}
+	}
+
+	params := map[string]string{
+		"priority-min": "priority_min",
+		"priority-max": "priority_max",
+		"due-before":   "due_before",
+		"due-after":    "due_after",
+		"search":       "q",
+		"blocked":      "blocked",
+		"parent":       "parent",
+		"filter":       "filter",
+		"sort":         "sort",
+	}
+	for flag, param := range params {
+		value, err := flags.GetString(flag)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			v.Set(param, value)
+		}
+	}
+
+	return apis.ParseTaskQuery(v)
+}
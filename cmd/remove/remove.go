@@ -0,0 +1,57 @@
+package remove
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+	"github.com/csams/doit/pkg/tui/client"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:    cobra.MinimumNArgs(1),
+		Use:     "delete <task id>...",
+		Aliases: []string{"rm"},
+		Short:   "Delete tasks.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return deleteTasks(cmd, args, log, options)
+		},
+	}
+
+	util.AddOutputFlag(cmd.Flags())
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func deleteTasks(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	output, err := util.GetOutput(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	ids, err := util.GetTaskIds(args)
+	if err != nil {
+		return err
+	}
+
+	c, me, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	var deleted []apis.Task
+	for _, id := range ids {
+		// deleting by id is deliberate, so it doesn't matter if the task changed
+		task, err := client.Delete[apis.Task](c, tui.TaskUrl(&apis.Task{ID: id, OwnerId: me.ID}), client.IfMatch("*"))
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, *task)
+	}
+
+	return util.PrintTasks(cmd.OutOrStdout(), output, deleted)
+}
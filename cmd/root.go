@@ -13,10 +13,19 @@ import (
 	"github.com/bombsimon/logrusr/v3"
 	"github.com/sirupsen/logrus"
 
+	"github.com/csams/doit/cmd/add"
 	"github.com/csams/doit/cmd/cli"
+	"github.com/csams/doit/cmd/done"
+	"github.com/csams/doit/cmd/edit"
+	"github.com/csams/doit/cmd/export"
+	"github.com/csams/doit/cmd/feed"
+	"github.com/csams/doit/cmd/importer"
+	"github.com/csams/doit/cmd/list"
 	"github.com/csams/doit/cmd/login"
 	"github.com/csams/doit/cmd/migrate"
+	"github.com/csams/doit/cmd/remove"
 	"github.com/csams/doit/cmd/serve"
+	"github.com/csams/doit/cmd/token"
 
 	"github.com/csams/doit/pkg/auth"
 	"github.com/csams/doit/pkg/server"
@@ -28,6 +37,9 @@ var (
 	rootCmd = &cobra.Command{
 		Use: "doit",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// several commands share flag names, so make sure the ones bound
+			// are from the command that's running
+			viper.BindPFlags(cmd.Flags())
 			initConfig()
 		},
 	}
@@ -69,6 +81,33 @@ func init() {
 	cliCmd := cli.NewCommand(rootLog.WithName("client"), options.Client)
 	rootCmd.AddCommand(cliCmd)
 	viper.BindPFlags(cliCmd.Flags())
+
+	addCmd := add.NewCommand(rootLog.WithName("add"), options.Client)
+	rootCmd.AddCommand(addCmd)
+
+	listCmd := list.NewCommand(rootLog.WithName("list"), options.Client)
+	rootCmd.AddCommand(listCmd)
+
+	doneCmd := done.NewCommand(rootLog.WithName("done"), options.Client)
+	rootCmd.AddCommand(doneCmd)
+
+	editCmd := edit.NewCommand(rootLog.WithName("edit"), options.Client)
+	rootCmd.AddCommand(editCmd)
+
+	deleteCmd := remove.NewCommand(rootLog.WithName("delete"), options.Client)
+	rootCmd.AddCommand(deleteCmd)
+
+	exportCmd := export.NewCommand(rootLog.WithName("export"), options.Client)
+	rootCmd.AddCommand(exportCmd)
+
+	importCmd := importer.NewCommand(rootLog.WithName("import"), options.Client)
+	rootCmd.AddCommand(importCmd)
+
+	feedCmd := feed.NewCommand(rootLog.WithName("feed"), options.Client)
+	rootCmd.AddCommand(feedCmd)
+
+	tokenCmd := token.NewCommand(rootLog.WithName("token"), options.Client)
+	rootCmd.AddCommand(tokenCmd)
 }
 
 func initConfig() {
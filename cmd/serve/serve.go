@@ -40,6 +40,10 @@ func NewCommand(log logr.Logger, storageOptions *storage.Options, serverOptions
 				return err
 			}
 
+			if retention := serverConfig.Options.TrashRetention(); retention > 0 {
+				go server.CollectTrash(db, retention, log.WithName("trash"))
+			}
+
 			authProvider, err := auth.NewTokenProvider(serverConfig.Auth)
 			if err != nil {
 				return err
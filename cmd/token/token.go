@@ -0,0 +1,178 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/csams/doit/cmd/util"
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/tui"
+)
+
+func NewCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage personal access tokens.",
+		Long: `Personal access tokens let scripts and CI use doit without logging in. Set
+DOIT_TOKEN or --client.token to use one. A token acts as me, limited to its
+scopes: read, write (which includes read), or admin (which includes both and
+manages shares and tokens).`,
+	}
+
+	cmd.AddCommand(newCreateCommand(log, options))
+	cmd.AddCommand(newListCommand(log, options))
+	cmd.AddCommand(newRevokeCommand(log, options))
+	return cmd
+}
+
+func newCreateCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.ExactArgs(1),
+		Use:   "create <name>",
+		Short: "Make a personal access token and print it.",
+		Long: `Make a personal access token and print it. The token can't be shown again, so
+keep it somewhere safe.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createToken(cmd, args[0], log, options)
+		},
+	}
+
+	cmd.Flags().StringSlice("scopes", []string{string(apis.ReadScope)}, "what the token may do: read, write, or admin")
+	cmd.Flags().Int("days", 90, "days until the token expires. 0 never expires")
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func createToken(cmd *cobra.Command, name string, log logr.Logger, options *tui.Options) error {
+	flags := cmd.Flags()
+	scopes, err := flags.GetStringSlice("scopes")
+	if err != nil {
+		return err
+	}
+	days, err := flags.GetInt("days")
+	if err != nil {
+		return err
+	}
+	if days < 0 {
+		return errors.New("days can't be negative")
+	}
+
+	token := &apis.AccessToken{Name: name}
+	for _, s := range scopes {
+		token.Scopes = append(token.Scopes, apis.Scope(strings.ToLower(strings.TrimSpace(s))))
+	}
+	if days > 0 {
+		expires := time.Now().AddDate(0, 0, days)
+		token.ExpiresAt = &expires
+	}
+
+	c, _, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	token, err = tui.CreateToken(c, token)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), token.Token)
+	return err
+}
+
+func newListCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:    cobra.NoArgs,
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List my personal access tokens.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listTokens(cmd, log, options)
+		},
+	}
+
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func listTokens(cmd *cobra.Command, log logr.Logger, options *tui.Options) error {
+	c, _, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := tui.ListTokens(c)
+	if err != nil {
+		return err
+	}
+	return printTokens(cmd.OutOrStdout(), tokens)
+}
+
+func printTokens(w io.Writer, tokens []apis.AccessToken) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES\tLAST USED")
+	for _, t := range tokens {
+		scopes := make([]string, len(t.Scopes))
+		for i, s := range t.Scopes {
+			scopes[i] = string(s)
+		}
+		expires := "never"
+		if t.ExpiresAt != nil {
+			expires = util.FormatDue(t.ExpiresAt)
+		}
+		used := "never"
+		if t.LastUsedAt != nil {
+			used = util.FormatDue(t.LastUsedAt)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(scopes, ","), util.FormatDue(&t.CreatedAt), expires, used)
+	}
+	return tw.Flush()
+}
+
+func newRevokeCommand(log logr.Logger, options *tui.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:    cobra.MinimumNArgs(1),
+		Use:     "revoke <token id>...",
+		Aliases: []string{"rm"},
+		Short:   "Revoke personal access tokens so they stop working.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return revokeTokens(cmd, args, log, options)
+		},
+	}
+
+	options.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func revokeTokens(cmd *cobra.Command, args []string, log logr.Logger, options *tui.Options) error {
+	ids := make([]uint, 0, len(args))
+	for _, a := range args {
+		id, err := strconv.ParseUint(a, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid token id: %s", a)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	c, _, err := util.NewClient(log, options)
+	if err != nil {
+		return err
+	}
+
+	var revoked []apis.AccessToken
+	for _, id := range ids {
+		token, err := tui.RevokeToken(c, id)
+		if err != nil {
+			return err
+		}
+		revoked = append(revoked, *token)
+	}
+	return printTokens(cmd.OutOrStdout(), revoked)
+}
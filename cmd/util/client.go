@@ -0,0 +1,100 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/errors"
+	"github.com/csams/doit/pkg/tui"
+	"github.com/csams/doit/pkg/tui/client"
+)
+
+// NewClient completes the client options and returns a client for the server
+// along with the authenticated user.
+func NewClient(log logr.Logger, options *tui.Options) (client.Client, *apis.User, error) {
+	if err := options.Complete(); err != nil {
+		return client.Client{}, nil, err
+	}
+
+	if errs := options.Validate(); errs != nil {
+		return client.Client{}, nil, errors.NewAggregate(errs)
+	}
+
+	config, err := tui.NewConfig(options, log).Complete()
+	if err != nil {
+		return client.Client{}, nil, err
+	}
+
+	me, err := client.Get[apis.User](config.Client, "me")
+	if err != nil {
+		return client.Client{}, nil, err
+	}
+
+	return config.Client, me, nil
+}
+
+// GetTaskIds parses task ids from command arguments
+func GetTaskIds(args []string) ([]uint, error) {
+	ids := make([]uint, 0, len(args))
+	for _, a := range args {
+		id, err := strconv.ParseUint(a, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task id: %s", a)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// GetTask fetches a task from the user's list
+func GetTask(c client.Client, ownerId, taskId uint) (*apis.Task, error) {
+	return client.Get[apis.Task](c, tui.TaskUrl(&apis.Task{ID: taskId, OwnerId: ownerId}))
+}
+
+// GetAssignee looks up the user named by the assignee flag among the users
+// tasks in the owner's list may be assigned to. It returns nil if the flag is
+// empty.
+func GetAssignee(flags *pflag.FlagSet, c client.Client, ownerId uint) (*apis.User, error) {
+	username, err := flags.GetString("assignee")
+	if username == "" || err != nil {
+		return nil, err
+	}
+
+	users, err := tui.ListAssignees(c, ownerId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i].Username == username {
+			return &users[i], nil
+		}
+	}
+	return nil, fmt.Errorf("can't assign tasks to %s without sharing the task list with them", username)
+}
+
+// AddForceFlag adds the flag that changes the status of tasks that unfinished
+// tasks block.
+func AddForceFlag(fs *pflag.FlagSet) {
+	fs.Bool("force", false, "change the status even if unfinished tasks block the task")
+}
+
+// PatchTask saves the changes to a task. Starting or finishing a task that
+// unfinished tasks block fails unless the force flag is set.
+func PatchTask(flags *pflag.FlagSet, c client.Client, orig, task *apis.Task) (*apis.Task, error) {
+	var opts []client.RequestOption
+	if force, _ := flags.GetBool("force"); force {
+		opts = append(opts, client.WithQuery("force", "true"))
+	}
+
+	up, err := tui.PatchTask(c, orig, task, orig.ETag(), opts...)
+	if client.IsStatus(err, http.StatusConflict) {
+		return nil, fmt.Errorf("task %d is blocked by unfinished tasks. use --force to change its status anyway: %w", orig.ID, err)
+	}
+	return up, err
+}
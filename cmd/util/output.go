@@ -0,0 +1,164 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+const (
+	dateSpec = "2006-01-02 15:04"
+
+	TableOutput = "table"
+	JSONOutput  = "json"
+	YAMLOutput  = "yaml"
+)
+
+func AddOutputFlag(fs *pflag.FlagSet) {
+	fs.StringP("output", "o", TableOutput, "output format: table, json, or yaml")
+}
+
+func GetOutput(flags *pflag.FlagSet) (string, error) {
+	output, err := flags.GetString("output")
+	if err != nil {
+		return "", err
+	}
+
+	switch output {
+	case TableOutput, JSONOutput, YAMLOutput:
+		return output, nil
+	default:
+		return "", fmt.Errorf("unrecognized output: %s. use table, json, or yaml", output)
+	}
+}
+
+// PrintTasks writes the tasks to w in the requested format
+func PrintTasks(w io.Writer, output string, tasks []apis.Task) error {
+	if tasks == nil {
+		tasks = []apis.Task{}
+	}
+
+	switch output {
+	case JSONOutput:
+		return printJSON(w, apis.TaskList{Tasks: tasks})
+	case YAMLOutput:
+		return printYAML(w, apis.TaskList{Tasks: tasks})
+	default:
+		return printTable(w, tasks)
+	}
+}
+
+// PrintTask writes a single task to w in the requested format
+func PrintTask(w io.Writer, output string, task *apis.Task) error {
+	switch output {
+	case JSONOutput:
+		return printJSON(w, task)
+	case YAMLOutput:
+		return printYAML(w, task)
+	default:
+		return printTable(w, []apis.Task{*task})
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printYAML converts v through json so the keys match the API
+func printYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+	return enc.Encode(generic)
+}
+
+func printTable(w io.Writer, tasks []apis.Task) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDESCRIPTION\tDUE\tPRIORITY\tSTATE\tSTATUS\tTAGS\tASSIGNEE")
+	for _, t := range tasks {
+		tags := strings.Join(apis.TagNames(t.Tags), ",")
+		desc := t.Description
+		if t.Blocked {
+			desc = "⊘ " + desc
+		}
+		if t.Progress != nil {
+			desc += fmt.Sprintf(" [%d/%d]", t.Progress.Done, t.Progress.Total)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", t.ID, desc, FormatDue(t.Due), t.Priority, t.State, t.Status, tags, t.Assignee.Username)
+	}
+	return tw.Flush()
+}
+
+// FormatDue formats a due date in local time. It's empty if there's no date.
+func FormatDue(due *time.Time) string {
+	if due == nil {
+		return ""
+	}
+	return due.Local().Format(dateSpec)
+}
+
+// PrintImportResult writes what an import did to w in the requested format.
+// The table format lists the tasks created and updated followed by the
+// duplicates.
+func PrintImportResult(w io.Writer, output string, result *apis.ImportResult) error {
+	switch output {
+	case JSONOutput:
+		return printJSON(w, result)
+	case YAMLOutput:
+		return printYAML(w, result)
+	}
+
+	summary := "Imported %d tasks, updated %d, and skipped %d duplicates.\n"
+	if result.DryRun {
+		summary = "Would import %d tasks, update %d, and skip %d duplicates.\n"
+	}
+	fmt.Fprintf(w, summary, len(result.Created), len(result.Updated), len(result.Duplicates))
+
+	if len(result.Created) > 0 {
+		fmt.Fprintln(w)
+		if err := printTable(w, result.Created); err != nil {
+			return err
+		}
+	}
+
+	if len(result.Updated) > 0 {
+		fmt.Fprintln(w)
+		if err := printTable(w, result.Updated); err != nil {
+			return err
+		}
+	}
+
+	if len(result.Duplicates) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "RECORD\tDESCRIPTION\tDUPLICATE OF")
+		for _, d := range result.Duplicates {
+			of := fmt.Sprintf("task %d", d.TaskId)
+			if d.TaskId == 0 {
+				of = fmt.Sprintf("record %d", d.Repeats)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", d.Record, d.Description, of)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
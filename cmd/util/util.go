@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -68,3 +69,77 @@ func GetTags(flags *pflag.FlagSet) ([]string, error) {
 
 	return cleanTags, nil
 }
+
+func GetState(flags *pflag.FlagSet) (*apis.State, error) {
+	stateStr, err := flags.GetString("state")
+	if stateStr == "" || err != nil {
+		return nil, err
+	}
+
+	state := apis.State(strings.ToLower(stateStr))
+	if !apis.IsValidState(state) {
+		return nil, fmt.Errorf("unrecognized state: %s. valid values are open, closed", state)
+	}
+
+	return &state, nil
+}
+
+// GetParent returns the task id given by the parent flag. It's 0 if the flag
+// is none and nil if it isn't set.
+func GetParent(flags *pflag.FlagSet) (*uint, error) {
+	parentStr, err := flags.GetString("parent")
+	if parentStr == "" || err != nil {
+		return nil, err
+	}
+
+	var parent uint
+	if parentStr != "none" {
+		id, err := strconv.ParseUint(parentStr, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent: %s. use a task id or none", parentStr)
+		}
+		parent = uint(id)
+	}
+
+	return &parent, nil
+}
+
+// GetChecklist returns the items given by the checklist flag. Items starting
+// with [x] are done.
+func GetChecklist(flags *pflag.FlagSet) ([]apis.ChecklistItem, error) {
+	texts, err := flags.GetStringSlice("checklist")
+	if texts == nil || err != nil {
+		return nil, err
+	}
+
+	items := make([]apis.ChecklistItem, 0, len(texts))
+	for _, t := range texts {
+		if strings.TrimSpace(t) != "" {
+			items = append(items, apis.ParseChecklistItem(t))
+		}
+	}
+
+	return items, nil
+}
+
+// GetFormat returns the format named by the format flag. If it isn't set, the
+// extension of the file picks it, and anything else is json.
+func GetFormat(flags *pflag.FlagSet, file string) (apis.Format, error) {
+	name, err := flags.GetString("format")
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		return apis.ParseFormat(name)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return apis.CSVFormat, nil
+	case ".txt":
+		return apis.TodoTxtFormat, nil
+	case ".ics":
+		return apis.ICalFormat, nil
+	}
+	return apis.JSONFormat, nil
+}
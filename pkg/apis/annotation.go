@@ -1,6 +1,9 @@
 package apis
 
 import (
+	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,3 +18,14 @@ type Annotation struct {
 	TaskID      uint   `json:"taskid"`
 	Description string `json:"description"`
 }
+
+func (a *Annotation) Bind(r *http.Request) error {
+	if strings.TrimSpace(a.Description) == "" {
+		return errors.New("annotation description is required")
+	}
+	return nil
+}
+
+type AnnotationList struct {
+	Annotations []Annotation `json:"annotations"`
+}
@@ -0,0 +1,171 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBulkTasks is the most tasks a bulk request may change
+const MaxBulkTasks = 1000
+
+// BulkRequest names the tasks a bulk delete or restore applies to.
+type BulkRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+func (b *BulkRequest) Bind(r *http.Request) error {
+	var err error
+	b.IDs, err = bulkIds(b.IDs)
+	return err
+}
+
+// bulkIds drops repeated ids and checks how many are left.
+func bulkIds(ids []uint) ([]uint, error) {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("ids is required")
+	}
+	if len(unique) > MaxBulkTasks {
+		return nil, fmt.Errorf("at most %d tasks may be changed at once", MaxBulkTasks)
+	}
+	return unique, nil
+}
+
+// BulkUpdate applies the same change to many tasks. Fields that are missing
+// are left alone.
+type BulkUpdate struct {
+	IDs []uint `json:"ids"`
+
+	Status   *Status   `json:"status,omitempty"`
+	State    *State    `json:"state,omitempty"`
+	Priority *Priority `json:"priority,omitempty"`
+
+	// DueShift moves due dates by a number of hours, days, or weeks like 2d,
+	// -1w, or 12h. Tasks without a due date keep not having one.
+	DueShift string `json:"due_shift,omitempty"`
+
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+
+	// AssigneeId reassigns the tasks
+	AssigneeId *uint `json:"assignee_id,omitempty"`
+
+	// Force starts or finishes tasks that unfinished tasks block
+	Force bool `json:"force,omitempty"`
+}
+
+func (b *BulkUpdate) Bind(r *http.Request) error {
+	var err error
+	if b.IDs, err = bulkIds(b.IDs); err != nil {
+		return err
+	}
+	if b.Status != nil && !IsValidStatus(*b.Status) {
+		return fmt.Errorf("invalid status %q. use one of %s", *b.Status, strings.Join(StatusStrings(), ", "))
+	}
+	if b.State != nil && !IsValidState(*b.State) {
+		return fmt.Errorf("invalid state %q. use open or closed", *b.State)
+	}
+	if _, err := ParseDueShift(b.DueShift); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Apply makes the change to a task. The assignee is left to the caller since
+// it has to be looked up.
+func (b *BulkUpdate) Apply(t *Task) {
+	if b.Status != nil {
+		t.Status = *b.Status
+	}
+	if b.State != nil {
+		t.State = *b.State
+	}
+	if b.Priority != nil {
+		t.Priority = *b.Priority
+	}
+	if shift, _ := ParseDueShift(b.DueShift); shift != nil && t.Due != nil {
+		due := shift(*t.Due)
+		t.Due = &due
+	}
+	if len(b.AddTags) > 0 || len(b.RemoveTags) > 0 {
+		remove := make(map[string]bool, len(b.RemoveTags))
+		for _, name := range b.RemoveTags {
+			remove[strings.TrimSpace(name)] = true
+		}
+		var names []string
+		for _, name := range append(TagNames(t.Tags), b.AddTags...) {
+			if !remove[strings.TrimSpace(name)] {
+				names = append(names, name)
+			}
+		}
+		t.Tags = NewTags(names...)
+	}
+	if b.AssigneeId != nil {
+		t.AssigneeId = *b.AssigneeId
+	}
+}
+
+// ParseDueShift reads a shift like +2d, -1w, or 12h and returns a function
+// that applies it. Days and weeks are calendar days, so the time of day is
+// kept across daylight saving changes. An empty shift returns nil.
+func ParseDueShift(s string) (func(time.Time) time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	invalid := fmt.Errorf("invalid due_shift %q. use a number followed by h, d, or w, like 2d or -1w", s)
+	if len(s) < 2 {
+		return nil, invalid
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(s[:len(s)-1], "+"))
+	if err != nil {
+		return nil, invalid
+	}
+	switch s[len(s)-1] {
+	case 'h':
+		return func(t time.Time) time.Time { return t.Add(time.Duration(n) * time.Hour) }, nil
+	case 'd':
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, n) }, nil
+	case 'w':
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 7*n) }, nil
+	}
+	return nil, invalid
+}
+
+// BulkResult is what happened to one task of a bulk request. Status is the
+// HTTP status the change would have had on its own, and Task is the task
+// after the change when it succeeded.
+type BulkResult struct {
+	ID     uint   `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Task   *Task  `json:"task,omitempty"`
+}
+
+// BulkResponse holds a result for each task of a bulk request in the order
+// they were requested.
+type BulkResponse struct {
+	Results []BulkResult `json:"results"`
+}
+
+// Failed returns the results that didn't succeed
+func (b *BulkResponse) Failed() []BulkResult {
+	var failed []BulkResult
+	for _, r := range b.Results {
+		if r.Status >= 300 {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
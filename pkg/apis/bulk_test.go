@@ -0,0 +1,89 @@
+package apis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDueShift(t *testing.T) {
+	due := time.Date(2022, 11, 15, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		shift string
+		want  time.Time
+		err   bool
+	}{
+		{shift: "2d", want: due.AddDate(0, 0, 2)},
+		{shift: "+2d", want: due.AddDate(0, 0, 2)},
+		{shift: "-1d", want: due.AddDate(0, 0, -1)},
+		{shift: "1w", want: due.AddDate(0, 0, 7)},
+		{shift: "-2w", want: due.AddDate(0, 0, -14)},
+		{shift: "12h", want: due.Add(12 * time.Hour)},
+		{shift: " -36h ", want: due.Add(-36 * time.Hour)},
+		{shift: "0d", want: due},
+		{shift: "d", err: true},
+		{shift: "2", err: true},
+		{shift: "2m", err: true},
+		{shift: "1.5d", err: true},
+		{shift: "two days", err: true},
+	}
+
+	for _, c := range cases {
+		shift, err := ParseDueShift(c.shift)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: want an error", c.shift)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.shift, err)
+			continue
+		}
+		if got := shift(due); !got.Equal(c.want) {
+			t.Errorf("%q: want %s, got %s", c.shift, c.want, got)
+		}
+	}
+
+	if shift, err := ParseDueShift(""); shift != nil || err != nil {
+		t.Errorf("want no shift for an empty string, got %v", err)
+	}
+}
+
+func TestDueShiftKeepsTimeOfDay(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	// daylight saving time ends on November 6, 2022
+	due := time.Date(2022, 11, 5, 9, 0, 0, 0, loc)
+
+	shift, _ := ParseDueShift("1d")
+	if got := shift(due); got.Hour() != 9 || got.Day() != 6 {
+		t.Errorf("1d: want 9:00 the next day, got %s", got)
+	}
+	shift, _ = ParseDueShift("24h")
+	if got := shift(due); got.Hour() != 8 {
+		t.Errorf("24h: want 8:00 the next day, got %s", got)
+	}
+}
+
+func TestBulkIds(t *testing.T) {
+	ids, err := bulkIds([]uint{3, 1, 3, 2, 1})
+	if err != nil || len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 2 {
+		t.Errorf("want repeated ids dropped in order, got %v and %v", ids, err)
+	}
+	if _, err := bulkIds(nil); err == nil {
+		t.Error("want an error without ids")
+	}
+
+	many := make([]uint, MaxBulkTasks+1)
+	for i := range many {
+		many[i] = uint(i + 1)
+	}
+	if _, err := bulkIds(many[:MaxBulkTasks]); err != nil {
+		t.Errorf("want %d ids allowed, got %v", MaxBulkTasks, err)
+	}
+	if _, err := bulkIds(many); err == nil {
+		t.Errorf("want an error for %d ids", len(many))
+	}
+}
@@ -0,0 +1,39 @@
+package apis
+
+import "time"
+
+// CalendarObject is where a CalDAV client put a task it created. Clients pick
+// the names of the resources they create, and some give tasks UIDs that
+// aren't UUIDs, so both are kept to serve the task back to them the same way.
+// Tasks without one are served as their UUID with an .ics extension.
+type CalendarObject struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	// OwnerId is the user whose task list has the task
+	OwnerId uint `gorm:"uniqueIndex:idx_calendar_objects_name;not null" json:"owner_id"`
+
+	// Name is the last segment of the resource's path
+	Name string `gorm:"uniqueIndex:idx_calendar_objects_name;size:255;not null" json:"name"`
+
+	TaskId uint `gorm:"uniqueIndex;not null" json:"task_id"`
+
+	// UID is the UID the client gave the task. It's empty if that's the
+	// task's UUID.
+	UID string `json:"uid"`
+}
+
+// Tombstone records where a CalDAV client could find a task that was purged,
+// so clients that synced it are told it's gone. Tombstones are never deleted,
+// which makes the highest ID a counter of purges that only goes up.
+type Tombstone struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	// OwnerId is the user whose task list had the task
+	OwnerId uint `gorm:"index;not null" json:"owner_id"`
+
+	// Name is the last segment of the resource's path
+	Name string `gorm:"size:255;not null" json:"name"`
+
+	TaskId   uint      `gorm:"not null" json:"task_id"`
+	PurgedAt time.Time `json:"purged_at"`
+}
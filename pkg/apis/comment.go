@@ -1,6 +1,9 @@
 package apis
 
 import (
+	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,8 +13,24 @@ type Comment struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TaskID uint `json:"taskid"`
+
+	// AuthorId is the user who wrote the comment
+	AuthorId uint  `json:"author_id"`
+	Author   *User `json:"author,omitempty" gorm:"foreignKey:AuthorId"`
 
-	TaskID      uint   `json:"taskid"`
 	Description string `json:"description"`
 }
+
+func (c *Comment) Bind(r *http.Request) error {
+	if strings.TrimSpace(c.Description) == "" {
+		return errors.New("comment description is required")
+	}
+	return nil
+}
+
+type CommentList struct {
+	Comments []Comment `json:"comments"`
+}
@@ -0,0 +1,60 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Dependency records that a task is blocked until another task, its blocker,
+// is finished. Both tasks are in the same list.
+type Dependency struct {
+	TaskID    uint      `gorm:"primaryKey;autoIncrement:false" json:"task_id"`
+	BlockerID uint      `gorm:"primaryKey;autoIncrement:false;index" json:"blocker_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DependencyRequest makes one task block another
+type DependencyRequest struct {
+	BlockerId uint `json:"blocker_id"`
+}
+
+func (d *DependencyRequest) Bind(r *http.Request) error {
+	if d.BlockerId == 0 {
+		return errors.New("blocker_id is required")
+	}
+	return nil
+}
+
+// DependencyList holds the tasks directly related to a task
+type DependencyList struct {
+	// BlockedBy are the tasks that block the task
+	BlockedBy []Task `json:"blocked_by"`
+
+	// Blocks are the tasks the task blocks
+	Blocks []Task `json:"blocks"`
+}
+
+// DependencyNode is a task in a dependency tree with the tasks related to it
+// in the same direction as the node is from the root.
+type DependencyNode struct {
+	Task     Task             `json:"task"`
+	Children []DependencyNode `json:"children"`
+
+	// Repeated is true if the task is already in the tree above or before
+	// this node. Its children are only listed the first time it appears.
+	Repeated bool `json:"repeated,omitempty"`
+}
+
+// DependencyTree is the chain of tasks a task waits on and the chain of tasks
+// waiting on it.
+type DependencyTree struct {
+	Task      Task             `json:"task"`
+	BlockedBy []DependencyNode `json:"blocked_by"`
+	Blocks    []DependencyNode `json:"blocks"`
+}
+
+// Unfinished is true if the task still blocks the tasks that depend on it
+func (t *Task) Unfinished() bool {
+	return t.State == Open && t.Status != Done && t.Status != Abandoned
+}
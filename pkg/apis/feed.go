@@ -0,0 +1,67 @@
+package apis
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Feed is a calendar subscription to a task list or to one of its saved
+// views. Calendar apps can't log in, so they fetch a feed by the secret token
+// in its URL. A feed shows what the user who made it may see of the list.
+type Feed struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// UserId is the user who made the feed
+	UserId uint `gorm:"index;not null" json:"user_id"`
+
+	// OwnerId is the user whose task list the feed shows
+	OwnerId uint `gorm:"not null" json:"owner_id"`
+
+	// ViewId is the saved view the feed lists. The feed of a list without a
+	// view has the list's tasks with due dates.
+	ViewId uint `gorm:"not null;default:0" json:"view_id"`
+
+	Name string `json:"name"`
+
+	// TokenHash is the SHA-256 of the feed's token. The token itself isn't
+	// kept.
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+
+	// URL is the path of the feed with its token. It's only returned when the
+	// feed is created.
+	URL string `gorm:"-" json:"url,omitempty"`
+
+	// FetchedAt is the last time the feed was fetched
+	FetchedAt *time.Time `json:"fetched_at"`
+}
+
+type FeedList struct {
+	Feeds []Feed `json:"feeds"`
+}
+
+func (f *Feed) Bind(r *http.Request) error {
+	f.Name = strings.TrimSpace(f.Name)
+	return nil
+}
+
+// NewToken returns a random secret for a URL or a header
+func NewToken() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("unable to read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// HashToken returns the hash of a token that's stored in its place
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package apis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action is the kind of change a history entry records
+type Action string
+
+const (
+	TaskCreated       Action = "created"
+	TaskUpdated       Action = "updated"
+	TaskDeleted       Action = "deleted"
+	TaskRestored      Action = "restored"
+	CommentAdded      Action = "comment_added"
+	CommentUpdated    Action = "comment_updated"
+	CommentDeleted    Action = "comment_deleted"
+	AnnotationAdded   Action = "annotation_added"
+	AnnotationUpdated Action = "annotation_updated"
+	AnnotationDeleted Action = "annotation_deleted"
+)
+
+type ChangeList struct {
+	Changes []Change `json:"changes"`
+}
+
+// Change is an entry in the history of a task. Entries are only ever added.
+type Change struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TaskID uint `gorm:"index;not null" json:"task_id"`
+
+	// ActorId is the user who made the change
+	ActorId uint  `json:"actor_id"`
+	Actor   *User `json:"actor,omitempty" gorm:"foreignKey:ActorId"`
+
+	Action Action        `json:"action"`
+	Fields []FieldChange `json:"fields" gorm:"serializer:json"`
+}
+
+// FieldChange is the value of a field before and after a change. Empty
+// values mean the field wasn't set.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// DiffTasks returns the fields a client may set that differ between two
+// versions of a task. The assignee is compared by username, so both tasks
+// need it loaded.
+func DiffTasks(before, after *Task) []FieldChange {
+	var changes []FieldChange
+	field := func(name, b, a string) {
+		if b != a {
+			changes = append(changes, FieldChange{Field: name, Before: b, After: a})
+		}
+	}
+	due := func(t *Task) string {
+		if t.Due == nil {
+			return ""
+		}
+		return t.Due.UTC().Format(time.RFC3339)
+	}
+	private := func(t *Task) string {
+		if !t.Private {
+			return ""
+		}
+		return "true"
+	}
+	priority := func(t *Task) string {
+		if t.Priority == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(t.Priority))
+	}
+	flag := func(b bool) string {
+		if !b {
+			return ""
+		}
+		return "true"
+	}
+	parent := func(t *Task) string {
+		if t.ParentId == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(t.ParentId), 10)
+	}
+	tags := func(t *Task) string {
+		names := TagNames(t.Tags)
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+
+	field("desc", before.Description, after.Description)
+	field("due", due(before), due(after))
+	field("priority", priority(before), priority(after))
+	field("private", private(before), private(after))
+	field("state", string(before.State), string(after.State))
+	field("status", string(before.Status), string(after.Status))
+	field("recurrence", before.Recurrence, after.Recurrence)
+	field("assignee", before.Assignee.Username, after.Assignee.Username)
+	field("tags", tags(before), tags(after))
+	field("parent", parent(before), parent(after))
+	field("auto_close", flag(before.AutoClose), flag(after.AutoClose))
+	field("checklist", ChecklistString(before.Checklist), ChecklistString(after.Checklist))
+	return changes
+}
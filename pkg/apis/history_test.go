@@ -0,0 +1,109 @@
+package apis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffTasks(t *testing.T) {
+	due := time.Date(2022, 11, 15, 9, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	base := Task{
+		Description: "write the report",
+		Due:         &due,
+		Priority:    2,
+		State:       Open,
+		Status:      Todo,
+		Assignee:    User{Username: "alice"},
+		Tags:        NewTags("work", "infra"),
+		Checklist:   []ChecklistItem{{Text: "outline"}},
+	}
+
+	cases := []struct {
+		name   string
+		change func(t *Task)
+		want   []FieldChange
+	}{
+		{
+			name:   "nothing",
+			change: func(t *Task) {},
+		},
+		{
+			name: "fields the server sets",
+			change: func(t *Task) {
+				t.ID, t.Version, t.UUID, t.OwnerId, t.SeriesId = 7, 3, "uuid", 2, 7
+				t.Blocked = true
+				t.Progress = &Progress{}
+			},
+		},
+		{
+			name: "the same due date in another zone",
+			change: func(t *Task) {
+				utc := due.UTC()
+				t.Due = &utc
+			},
+		},
+		{
+			name:   "the same tags in another order",
+			change: func(t *Task) { t.Tags = NewTags("infra", "work") },
+		},
+		{
+			name: "status and priority",
+			change: func(t *Task) {
+				t.Status = Done
+				t.Priority = 0
+			},
+			want: []FieldChange{
+				{Field: "priority", Before: "2", After: ""},
+				{Field: "status", Before: "todo", After: "done"},
+			},
+		},
+		{
+			name: "every field",
+			change: func(t *Task) {
+				later := due.AddDate(0, 0, 1)
+				t.Description = "write the summary"
+				t.Due = &later
+				t.Priority = 5
+				t.Private = true
+				t.State = Closed
+				t.Status = Abandoned
+				t.Recurrence = "weekly"
+				t.Assignee = User{Username: "bob"}
+				t.Tags = NewTags("work")
+				t.ParentId = 4
+				t.AutoClose = true
+				t.Checklist = []ChecklistItem{{Text: "outline", Done: true}}
+			},
+			want: []FieldChange{
+				{Field: "desc", Before: "write the report", After: "write the summary"},
+				{Field: "due", Before: "2022-11-15T14:00:00Z", After: "2022-11-16T14:00:00Z"},
+				{Field: "priority", Before: "2", After: "5"},
+				{Field: "private", Before: "", After: "true"},
+				{Field: "state", Before: "open", After: "closed"},
+				{Field: "status", Before: "todo", After: "abandoned"},
+				{Field: "recurrence", Before: "", After: "weekly"},
+				{Field: "assignee", Before: "alice", After: "bob"},
+				{Field: "tags", Before: "infra,work", After: "work"},
+				{Field: "parent", Before: "", After: "4"},
+				{Field: "auto_close", Before: "", After: "true"},
+				{Field: "checklist", Before: ChecklistString(base.Checklist), After: ChecklistString([]ChecklistItem{{Text: "outline", Done: true}})},
+			},
+		},
+		{
+			name:   "clearing the due date",
+			change: func(t *Task) { t.Due = nil },
+			want:   []FieldChange{{Field: "due", Before: "2022-11-15T14:00:00Z", After: ""}},
+		},
+	}
+
+	for _, c := range cases {
+		after := base
+		after.Tags = append([]Tag(nil), base.Tags...)
+		c.change(&after)
+		got := DiffTasks(&base, &after)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: want %+v, got %+v", c.name, c.want, got)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package apis
 
 import (
+	"errors"
+	"net/http"
 	"time"
 
 	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/set"
 )
 
 type Policy struct {
@@ -12,14 +16,46 @@ type Policy struct {
 
 	Mode PolicyMode `json:"mode"`
 
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type PolicyMode string
 
 const (
-	View          = "view"
-	ViewAndUpdate = "view_and_update"
+	View          PolicyMode = "view"
+	ViewAndUpdate PolicyMode = "view_and_update"
+)
+
+var (
+	validPolicyModes = set.New(View, ViewAndUpdate)
 )
+
+func IsValidPolicyMode(m PolicyMode) bool {
+	return validPolicyModes.Has(m)
+}
+
+// Share is a Policy along with the usernames of the owner and delegate
+type Share struct {
+	Policy
+	OwnerUsername    string `json:"owner_username"`
+	DelegateUsername string `json:"delegate_username"`
+}
+
+type ShareList struct {
+	Shares []Share `json:"shares"`
+}
+
+// ShareRequest grants or changes the access a delegate has to a task list
+type ShareRequest struct {
+	Username string     `json:"username"`
+	Mode     PolicyMode `json:"mode"`
+}
+
+func (s *ShareRequest) Bind(r *http.Request) error {
+	if !IsValidPolicyMode(s.Mode) {
+		return errors.New("mode must be one of view or view_and_update")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package apis
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+var (
+	// recurrencePresets are the names a recurrence may use instead of an RRULE
+	recurrencePresets = map[string]string{
+		"daily":    "FREQ=DAILY",
+		"weekdays": "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+		"weekly":   "FREQ=WEEKLY",
+		"monthly":  "FREQ=MONTHLY",
+		"yearly":   "FREQ=YEARLY",
+	}
+
+	everyPattern = regexp.MustCompile(`^every\s+(\d+)\s+(day|week|month|year)s?$`)
+
+	everyFreqs = map[string]string{
+		"day":   "DAILY",
+		"week":  "WEEKLY",
+		"month": "MONTHLY",
+		"year":  "YEARLY",
+	}
+)
+
+// RecurrenceRule returns the RFC 5545 RRULE for the recurrence of a task. A
+// recurrence is daily, weekdays, weekly, monthly, yearly, "every N days" (or
+// weeks, months, or years), or an RRULE like "FREQ=WEEKLY;BYDAY=MO,TH".
+func RecurrenceRule(recurrence string) (string, error) {
+	r := strings.ToLower(strings.TrimSpace(recurrence))
+	if rule, ok := recurrencePresets[r]; ok {
+		return rule, nil
+	}
+
+	if m := everyPattern.FindStringSubmatch(r); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("invalid recurrence %q. the interval must be at least 1", recurrence)
+		}
+		return fmt.Sprintf("FREQ=%s;INTERVAL=%d", everyFreqs[m[2]], n), nil
+	}
+
+	rule := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(recurrence)), "RRULE:")
+	if _, err := rrule.StrToROption(rule); err != nil {
+		return "", fmt.Errorf("invalid recurrence %q. use daily, weekdays, weekly, monthly, yearly, every N days, or an RRULE: %w", recurrence, err)
+	}
+	return rule, nil
+}
+
+// NextDue returns the first occurrence of a recurrence after due. Occurrences
+// are counted from start, the due date of the first task in the series. It
+// returns nil once the recurrence has ended.
+func NextDue(recurrence string, start, due time.Time) (*time.Time, error) {
+	rule, err := RecurrenceRule(recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	opt, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, err
+	}
+	opt.Dtstart = start
+
+	r, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, err
+	}
+
+	next := r.After(due, false)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
@@ -0,0 +1,79 @@
+package apis
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+}
+
+func TestNextDue(t *testing.T) {
+	cases := []struct {
+		recurrence string
+		start, due time.Time
+
+		// want is nil when the recurrence has ended
+		want *time.Time
+		err  bool
+	}{
+		{recurrence: "daily", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 11, 16))},
+		{recurrence: " Daily ", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 11, 16))},
+		{recurrence: "weekdays", start: date(2022, 11, 14), due: date(2022, 11, 18), want: ptr(date(2022, 11, 21))},
+		{recurrence: "weekly", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 11, 22))},
+		{recurrence: "monthly", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 12, 15))},
+		{recurrence: "yearly", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2023, 11, 15))},
+
+		// every N is counted from the start of the series
+		{recurrence: "every 2 weeks", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 11, 29))},
+		{recurrence: "every 2 weeks", start: date(2022, 11, 15), due: date(2022, 11, 20), want: ptr(date(2022, 11, 29))},
+		{recurrence: "Every 3 Days", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 11, 18))},
+		{recurrence: "every 1 month", start: date(2022, 11, 15), due: date(2022, 11, 15), want: ptr(date(2022, 12, 15))},
+		{recurrence: "every 0 days", err: true},
+		{recurrence: "fortnightly", err: true},
+
+		// months without the day are skipped unless the rule asks for the
+		// last day
+		{recurrence: "monthly", start: date(2023, 1, 31), due: date(2023, 1, 31), want: ptr(date(2023, 3, 31))},
+		{recurrence: "FREQ=MONTHLY;BYMONTHDAY=-1", start: date(2023, 1, 31), due: date(2023, 1, 31), want: ptr(date(2023, 2, 28))},
+		{recurrence: "FREQ=MONTHLY;BYMONTHDAY=-1", start: date(2023, 1, 31), due: date(2023, 2, 28), want: ptr(date(2023, 3, 31))},
+		{recurrence: "yearly", start: date(2024, 2, 29), due: date(2024, 2, 29), want: ptr(date(2028, 2, 29))},
+
+		// weekday rules
+		{recurrence: "FREQ=WEEKLY;BYDAY=MO,TH", start: date(2022, 11, 14), due: date(2022, 11, 14), want: ptr(date(2022, 11, 17))},
+		{recurrence: "RRULE:FREQ=WEEKLY;BYDAY=MO,TH", start: date(2022, 11, 14), due: date(2022, 11, 17), want: ptr(date(2022, 11, 21))},
+		{recurrence: "FREQ=MONTHLY;BYDAY=+2TU", start: date(2022, 11, 8), due: date(2022, 11, 8), want: ptr(date(2022, 12, 13))},
+		{recurrence: "FREQ=MONTHLY;BYDAY=-1FR", start: date(2022, 11, 25), due: date(2022, 11, 25), want: ptr(date(2022, 12, 30))},
+
+		// COUNT and UNTIL end the series
+		{recurrence: "FREQ=DAILY;COUNT=3", start: date(2022, 11, 15), due: date(2022, 11, 16), want: ptr(date(2022, 11, 17))},
+		{recurrence: "FREQ=DAILY;COUNT=3", start: date(2022, 11, 15), due: date(2022, 11, 17)},
+		{recurrence: "FREQ=WEEKLY;UNTIL=20221201T000000Z", start: date(2022, 11, 15), due: date(2022, 11, 22), want: ptr(date(2022, 11, 29))},
+		{recurrence: "FREQ=WEEKLY;UNTIL=20221201T000000Z", start: date(2022, 11, 15), due: date(2022, 11, 29)},
+	}
+
+	for _, c := range cases {
+		got, err := NextDue(c.recurrence, c.start, c.due)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: want an error, got %v", c.recurrence, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.recurrence, err)
+			continue
+		}
+		switch {
+		case c.want == nil && got != nil:
+			t.Errorf("%q after %s: want the series ended, got %s", c.recurrence, c.due.Format("2006-01-02"), got)
+		case c.want != nil && (got == nil || !got.Equal(*c.want)):
+			t.Errorf("%q after %s: want %s, got %v", c.recurrence, c.due.Format("2006-01-02"), c.want, got)
+		}
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
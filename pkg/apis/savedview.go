@@ -0,0 +1,88 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/set"
+)
+
+// SavedView is a task listing saved by name: a filter, a sort order, and the
+// columns to show. Views belong to the user who saved them and list tasks
+// from their task list.
+type SavedView struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	OwnerId uint   `gorm:"uniqueIndex:idx_saved_views_owner_name;not null" json:"owner_id"`
+	Name    string `gorm:"uniqueIndex:idx_saved_views_owner_name;not null" json:"name"`
+
+	// Assigned lists the tasks assigned to whoever opens the view instead of
+	// the tasks in the owner's list
+	Assigned bool `json:"assigned"`
+
+	// Filter is an expression in the language of the filter package
+	Filter string `json:"filter"`
+
+	// Sort is a comma separated list of sort fields like the sort parameter
+	// of a task listing
+	Sort string `json:"sort"`
+
+	// Columns are the columns to show in the order to show them. Empty means
+	// all of them.
+	Columns []string `json:"columns" gorm:"serializer:json"`
+
+	// Shared makes the view visible to the users the owner's task list is
+	// shared with
+	Shared bool `json:"shared"`
+
+	// Default is the view the TUI opens with. A user has at most one.
+	Default bool `json:"default"`
+}
+
+type SavedViewList struct {
+	Views []SavedView `json:"views"`
+}
+
+var (
+	// ViewColumns are the columns of a task table
+	ViewColumns = []string{"created", "desc", "due", "priority", "state", "status", "tags", "private", "assignee"}
+
+	validViewColumns = set.New(ViewColumns...)
+)
+
+// Bind checks everything but the filter, which the server parses.
+func (v *SavedView) Bind(r *http.Request) error {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" {
+		return errors.New("name is required")
+	}
+	if _, err := ParseSort(v.Sort); err != nil {
+		return err
+	}
+
+	seen := set.New[string]()
+	for _, c := range v.Columns {
+		if !validViewColumns.Has(c) {
+			return fmt.Errorf("unrecognized column: %s. valid values are %s", c, strings.Join(ViewColumns, ", "))
+		}
+		if seen.Has(c) {
+			return fmt.Errorf("column %s is listed more than once", c)
+		}
+		seen.Add(c)
+	}
+	return nil
+}
+
+// Query returns the task query that lists the view.
+func (v *SavedView) Query() (TaskQuery, error) {
+	keys, err := ParseSort(v.Sort)
+	if err != nil {
+		return TaskQuery{}, err
+	}
+	return TaskQuery{Assignee: v.Assigned, Filter: v.Filter, Sort: keys}, nil
+}
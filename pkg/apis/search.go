@@ -0,0 +1,95 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of text a search matches
+const (
+	SearchTask       = "task"
+	SearchComment    = "comment"
+	SearchAnnotation = "annotation"
+)
+
+// HighlightStart and HighlightEnd surround the matched terms in the snippet
+// of a SearchResult.
+const (
+	HighlightStart = "<b>"
+	HighlightEnd   = "</b>"
+)
+
+// SearchQuery is a full text search of the tasks, comments, and annotations
+// the requester can see. It's sent as query parameters.
+type SearchQuery struct {
+	// Text holds the words to look for. Results must match all of them, and
+	// the last word also matches words it's a prefix of so results can
+	// follow along as it's typed.
+	Text string
+
+	// Limit is the maximum number of results to return. Zero means the
+	// server default.
+	Limit int
+}
+
+// ParseSearchQuery reads a SearchQuery from request query parameters.
+func ParseSearchQuery(v url.Values) (*SearchQuery, error) {
+	q := &SearchQuery{Text: v.Get("q")}
+	if len(q.Terms()) == 0 {
+		return nil, errors.New("q must have at least one word to search for")
+	}
+
+	if l := v.Get("limit"); l != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", l)
+		}
+	}
+	return q, nil
+}
+
+// Values converts the query to request query parameters.
+func (q *SearchQuery) Values() url.Values {
+	v := url.Values{}
+	v.Set("q", q.Text)
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// Terms splits the text into the words to search for. Punctuation separates
+// words and is otherwise ignored.
+func (q *SearchQuery) Terms() []string {
+	return strings.FieldsFunc(strings.ToLower(q.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchResult is a task, comment, or annotation that matched a search.
+type SearchResult struct {
+	// Kind is SearchTask, SearchComment, or SearchAnnotation
+	Kind string `json:"kind"`
+
+	// ID is the id of the comment or annotation that matched. It's the task
+	// id for tasks.
+	ID uint `json:"id"`
+
+	// Score ranks the result. Higher scores are better matches.
+	Score float64 `json:"score"`
+
+	// Snippet is the part of the text around the match with the matched terms
+	// between HighlightStart and HighlightEnd.
+	Snippet string `json:"snippet"`
+
+	// Task is the task that matched or that the comment or annotation is on
+	Task Task `json:"task"`
+}
+
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+}
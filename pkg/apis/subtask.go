@@ -0,0 +1,77 @@
+package apis
+
+import (
+	"errors"
+	"strings"
+)
+
+// Ways a task listing can return subtasks
+const (
+	// SubtasksFlat lists subtasks alongside their parents
+	SubtasksFlat = "flat"
+
+	// SubtasksNested lists top level tasks with their subtasks under
+	// Children
+	SubtasksNested = "nested"
+)
+
+// Progress rolls up the status of a task's subtasks
+type Progress struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Percent int `json:"percent"`
+}
+
+// NewProgress returns the progress of a task with total subtasks, done of
+// which are done. It's nil if there are no subtasks.
+func NewProgress(total, done int) *Progress {
+	if total == 0 {
+		return nil
+	}
+	return &Progress{Total: total, Done: done, Percent: done * 100 / total}
+}
+
+// ChecklistItem is a step of a task too small to be a subtask
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+func (i ChecklistItem) String() string {
+	if i.Done {
+		return "[x] " + i.Text
+	}
+	return "[ ] " + i.Text
+}
+
+// ParseChecklistItem reads an item in the form String returns. Lines without
+// a box are items that aren't done.
+func ParseChecklistItem(s string) ChecklistItem {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "[x]"):
+		return ChecklistItem{Text: strings.TrimSpace(s[3:]), Done: true}
+	case strings.HasPrefix(lower, "[ ]"):
+		return ChecklistItem{Text: strings.TrimSpace(s[3:])}
+	}
+	return ChecklistItem{Text: s}
+}
+
+// ChecklistString is the checklist on a single line
+func ChecklistString(items []ChecklistItem) string {
+	strs := make([]string, len(items))
+	for i, item := range items {
+		strs[i] = item.String()
+	}
+	return strings.Join(strs, "; ")
+}
+
+func validateChecklist(items []ChecklistItem) error {
+	for _, item := range items {
+		if strings.TrimSpace(item.Text) == "" {
+			return errors.New("checklist items need text")
+		}
+	}
+	return nil
+}
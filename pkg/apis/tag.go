@@ -0,0 +1,69 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Tag is a label on a task. Tags are stored in a table of (task, name) pairs
+// and serialized as plain strings.
+type Tag struct {
+	TaskID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name   string `gorm:"primaryKey;index"`
+}
+
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+func (t *Tag) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &t.Name)
+}
+
+// NewTags converts names to tags, dropping blanks and duplicates
+func NewTags(names ...string) []Tag {
+	seen := map[string]bool{}
+	tags := make([]Tag, 0, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		tags = append(tags, Tag{Name: n})
+	}
+	return tags
+}
+
+// TagNames returns the names of the tags
+func TagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// TagRequest names tags to add to a task
+type TagRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func (t *TagRequest) Bind(r *http.Request) error {
+	if len(NewTags(t.Tags...)) == 0 {
+		return errors.New("at least one tag is required")
+	}
+	return nil
+}
+
+// TagCount is the number of tasks in a list that have a tag
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type TagCountList struct {
+	Tags []TagCount `json:"tags"`
+}
@@ -1,8 +1,11 @@
 package apis
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,8 +13,18 @@ import (
 	"github.com/csams/doit/pkg/set"
 )
 
+// Media types of the patches TaskController.Patch accepts
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
 type TaskList struct {
 	Tasks []Task `json:"tasks"`
+
+	// NextPageToken fetches the next page of results when passed as the
+	// page_token query parameter. It's empty on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
 }
 
 // Task is some unit of work to do
@@ -21,6 +34,14 @@ type Task struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// Version is incremented each time the task changes. It's the task's
+	// entity tag.
+	Version uint `json:"version" gorm:"not null;default:1"`
+
+	// UUID identifies the task across task lists and tools like Taskwarrior.
+	// The server sets it when the task is created, and it never changes.
+	UUID string `json:"uuid" gorm:"size:36;index"`
+
 	OwnerId uint `json:"owner_id"`
 	Owner   User `gorm:"foreignKey:ID;references:OwnerId"`
 
@@ -35,13 +56,88 @@ type Task struct {
 	Status      Status       `json:"status"`
 	Comments    []Comment    `json:"comments" gorm:"constraint:OnDelete:CASCADE"`
 	Annotations []Annotation `json:"annotations" gorm:"constraint:OnDelete:CASCADE"`
-	// Tags        *set.Set[string] `json:"tags,omitempty"`
+	Tags        []Tag        `json:"tags" gorm:"constraint:OnDelete:CASCADE"`
+
+	// Recurrence makes the task repeat. See RecurrenceRule for its syntax.
+	// Completing a recurring task creates the next one in its series.
+	Recurrence string `json:"recurrence"`
+
+	// SeriesId is the ID of the first task in the series of a recurring
+	// task. It's 0 for tasks that have never recurred.
+	SeriesId uint `json:"series_id" gorm:"index"`
+
+	// Blocked is true if an unfinished task blocks this one. The server sets
+	// it when it returns tasks.
+	Blocked bool `json:"blocked" gorm:"-"`
+
+	// ParentId is the task this one is a subtask of. It's 0 for top level
+	// tasks.
+	ParentId uint `json:"parent_id" gorm:"index;not null;default:0"`
+
+	// AutoClose closes the task once all of its subtasks are closed
+	AutoClose bool `json:"auto_close"`
+
+	Checklist []ChecklistItem `json:"checklist" gorm:"serializer:json"`
+
+	// Progress rolls up the subtasks of the task. The server sets it when it
+	// returns tasks, and it's nil for tasks without subtasks.
+	Progress *Progress `json:"progress,omitempty" gorm:"-"`
+
+	// Children are the subtasks of the task when they're requested nested
+	Children []Task `json:"children,omitempty" gorm:"-"`
 }
 
 func (t *Task) Bind(r *http.Request) error {
 	return nil
 }
 
+// BeforeCreate gives a new task a UUID unless it already has one
+func (t *Task) BeforeCreate(tx *gorm.DB) error {
+	if t.UUID == "" {
+		t.UUID = NewUUID()
+	}
+	return nil
+}
+
+// BeforeSave stores the task's times in UTC. sqlite keeps times as text with
+// their offset, so times in different zones wouldn't compare in order.
+func (t *Task) BeforeSave(tx *gorm.DB) error {
+	if t.Due != nil {
+		due := t.Due.UTC()
+		t.Due = &due
+	}
+	t.CreatedAt = t.CreatedAt.UTC()
+	t.UpdatedAt = t.UpdatedAt.UTC()
+	return nil
+}
+
+// Validate checks the fields a client may set that have a fixed set of values.
+func (t *Task) Validate() error {
+	if !IsValidStatus(t.Status) {
+		return fmt.Errorf("invalid status %q. use one of %s", t.Status, strings.Join(StatusStrings(), ", "))
+	}
+	if !IsValidState(t.State) {
+		return fmt.Errorf("invalid state %q. use open or closed", t.State)
+	}
+	if t.Recurrence != "" {
+		if _, err := RecurrenceRule(t.Recurrence); err != nil {
+			return err
+		}
+		if t.Due == nil {
+			return errors.New("recurring tasks need a due date")
+		}
+	}
+	if t.ParentId != 0 && t.ParentId == t.ID {
+		return errors.New("a task can't be a subtask of itself")
+	}
+	return validateChecklist(t.Checklist)
+}
+
+// ETag is the value of the ETag header for this version of the task
+func (t *Task) ETag() string {
+	return fmt.Sprintf(`"%d"`, t.Version)
+}
+
 // Priority is how urgent the task is. 0 is lowest priority.
 type Priority uint8
 
@@ -64,12 +160,17 @@ const (
 
 var (
 	validStatuses = set.New(Backlog, Todo, Doing, Done, Abandoned)
+	validStates   = set.New(Open, Closed)
 )
 
 func IsValidStatus(s Status) bool {
 	return validStatuses.Has(s)
 }
 
+func IsValidState(s State) bool {
+	return validStates.Has(s)
+}
+
 func Statuses() []Status {
 	l := validStatuses.ToList()
 	sort.SliceStable(l, func(i, j int) bool {
@@ -0,0 +1,314 @@
+package apis
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+
+	"github.com/csams/doit/pkg/set"
+)
+
+// TaskQuery holds the filters, sort order, and page of a task listing. It's
+// sent as query parameters.
+type TaskQuery struct {
+	// Assignee limits the results to tasks assigned to the requester
+	Assignee bool
+
+	Statuses    []Status
+	States      []State
+	MinPriority *Priority
+	MaxPriority *Priority
+
+	DueBefore     *time.Time
+	DueAfter      *time.Time
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	UpdatedAfter  *time.Time
+
+	// Text matches a substring of the description, ignoring case
+	Text string
+
+	// TagsAny matches tasks with at least one of the tags
+	TagsAny []string
+
+	// TagsAll matches tasks with every one of the tags
+	TagsAll []string
+
+	// Series matches the tasks in the series of a recurring task
+	Series uint
+
+	// Blocked matches tasks that are or aren't blocked by unfinished tasks
+	Blocked *bool
+
+	// Parent matches the subtasks of a task. 0 matches top level tasks.
+	Parent *uint
+
+	// Filter is an expression in the language of the filter package. It's
+	// applied along with the other filters.
+	Filter string
+
+	// Subtasks is SubtasksFlat or SubtasksNested. Nested listings filter,
+	// sort, and page top level tasks and return each with all of its
+	// subtasks.
+	Subtasks string
+
+	Sort []SortKey
+
+	// Limit is the maximum number of tasks to return. Zero means the server
+	// default.
+	Limit     int
+	PageToken string
+}
+
+// SortKey orders a task listing by a field. Valid fields are in SortFields.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Field
+	}
+	return k.Field
+}
+
+var (
+	SortFields = []string{"id", "created", "updated", "due", "priority", "status", "state", "description"}
+
+	validSortFields = set.New(SortFields...)
+)
+
+// ParseSort parses a comma separated list of sort fields. A field prefixed
+// with "-" sorts in descending order.
+func ParseSort(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, f := range splitList(s) {
+		key := SortKey{Field: strings.TrimPrefix(f, "-"), Desc: strings.HasPrefix(f, "-")}
+		if !validSortFields.Has(key.Field) {
+			return nil, fmt.Errorf("unrecognized sort field: %s. valid values are %s", key.Field, strings.Join(SortFields, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseTaskQuery reads a TaskQuery from request query parameters.
+func ParseTaskQuery(v url.Values) (*TaskQuery, error) {
+	q := &TaskQuery{
+		Assignee:  v.Get("assignee") != "",
+		Text:      v.Get("q"),
+		TagsAny:   splitList(v.Get("tags_any")),
+		TagsAll:   splitList(v.Get("tags_all")),
+		Filter:    v.Get("filter"),
+		PageToken: v.Get("page_token"),
+	}
+
+	for _, s := range splitList(v.Get("status")) {
+		status := Status(strings.ToLower(s))
+		if !IsValidStatus(status) {
+			return nil, fmt.Errorf("unrecognized status: %s. valid values are %s", s, strings.Join(StatusStrings(), ", "))
+		}
+		q.Statuses = append(q.Statuses, status)
+	}
+
+	for _, s := range splitList(v.Get("state")) {
+		state := State(strings.ToLower(s))
+		if !IsValidState(state) {
+			return nil, fmt.Errorf("unrecognized state: %s. valid values are open, closed", s)
+		}
+		q.States = append(q.States, state)
+	}
+
+	if s := v.Get("series"); s != "" {
+		series, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid series: %s", s)
+		}
+		q.Series = uint(series)
+	}
+
+	if s := v.Get("blocked"); s != "" {
+		blocked, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked: %s. use true or false", s)
+		}
+		q.Blocked = &blocked
+	}
+
+	if s := v.Get("parent"); s != "" {
+		parent, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent: %s", s)
+		}
+		id := uint(parent)
+		q.Parent = &id
+	}
+
+	switch s := strings.ToLower(v.Get("subtasks")); s {
+	case "", SubtasksFlat, SubtasksNested:
+		q.Subtasks = s
+	default:
+		return nil, fmt.Errorf("invalid subtasks: %s. use %s or %s", s, SubtasksFlat, SubtasksNested)
+	}
+
+	var err error
+	if q.MinPriority, err = parsePriority(v, "priority_min"); err != nil {
+		return nil, err
+	}
+	if q.MaxPriority, err = parsePriority(v, "priority_max"); err != nil {
+		return nil, err
+	}
+
+	times := map[string]**time.Time{
+		"due_before":     &q.DueBefore,
+		"due_after":      &q.DueAfter,
+		"created_before": &q.CreatedBefore,
+		"created_after":  &q.CreatedAfter,
+		"updated_before": &q.UpdatedBefore,
+		"updated_after":  &q.UpdatedAfter,
+	}
+	for name, dest := range times {
+		if *dest, err = parseTime(v, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Sort, err = ParseSort(v.Get("sort")); err != nil {
+		return nil, err
+	}
+
+	if l := v.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 0 {
+			return nil, fmt.Errorf("invalid limit: %s", l)
+		}
+	}
+
+	return q, nil
+}
+
+// Values encodes the query as request query parameters.
+func (q *TaskQuery) Values() url.Values {
+	v := url.Values{}
+	if q.Assignee {
+		v.Set("assignee", "1")
+	}
+
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, 0, len(q.Statuses))
+		for _, s := range q.Statuses {
+			statuses = append(statuses, string(s))
+		}
+		v.Set("status", strings.Join(statuses, ","))
+	}
+
+	if len(q.States) > 0 {
+		states := make([]string, 0, len(q.States))
+		for _, s := range q.States {
+			states = append(states, string(s))
+		}
+		v.Set("state", strings.Join(states, ","))
+	}
+
+	if q.MinPriority != nil {
+		v.Set("priority_min", strconv.Itoa(int(*q.MinPriority)))
+	}
+	if q.MaxPriority != nil {
+		v.Set("priority_max", strconv.Itoa(int(*q.MaxPriority)))
+	}
+
+	times := map[string]*time.Time{
+		"due_before":     q.DueBefore,
+		"due_after":      q.DueAfter,
+		"created_before": q.CreatedBefore,
+		"created_after":  q.CreatedAfter,
+		"updated_before": q.UpdatedBefore,
+		"updated_after":  q.UpdatedAfter,
+	}
+	for name, t := range times {
+		if t != nil {
+			v.Set(name, t.Format(time.RFC3339))
+		}
+	}
+
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	if len(q.TagsAny) > 0 {
+		v.Set("tags_any", strings.Join(q.TagsAny, ","))
+	}
+	if len(q.TagsAll) > 0 {
+		v.Set("tags_all", strings.Join(q.TagsAll, ","))
+	}
+	if q.Series != 0 {
+		v.Set("series", strconv.FormatUint(uint64(q.Series), 10))
+	}
+	if q.Blocked != nil {
+		v.Set("blocked", strconv.FormatBool(*q.Blocked))
+	}
+	if q.Parent != nil {
+		v.Set("parent", strconv.FormatUint(uint64(*q.Parent), 10))
+	}
+	if q.Filter != "" {
+		v.Set("filter", q.Filter)
+	}
+	if q.Subtasks != "" {
+		v.Set("subtasks", q.Subtasks)
+	}
+
+	if len(q.Sort) > 0 {
+		keys := make([]string, 0, len(q.Sort))
+		for _, k := range q.Sort {
+			keys = append(keys, k.String())
+		}
+		v.Set("sort", strings.Join(keys, ","))
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.PageToken != "" {
+		v.Set("page_token", q.PageToken)
+	}
+	return v
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func parsePriority(v url.Values, name string) (*Priority, error) {
+	s := v.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	p, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, s)
+	}
+	prio := Priority(p)
+	return &prio, nil
+}
+
+func parseTime(v url.Values, name string) (*time.Time, error) {
+	s := v.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := dateparse.ParseLocal(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,106 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/set"
+)
+
+// AccessTokenPrefix starts every personal access token so the server can tell
+// them from ID tokens.
+const AccessTokenPrefix = "doit_"
+
+// AccessToken is a personal access token. Scripts and CI send one in place
+// of an ID token, since they can't log in with a browser. It acts as the user
+// who made it, limited to its scopes.
+type AccessToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// UserId is the user who made the token and who it acts as
+	UserId uint `gorm:"index;not null" json:"user_id"`
+
+	Name string `gorm:"not null" json:"name"`
+
+	Scopes []Scope `gorm:"serializer:json" json:"scopes"`
+
+	// TokenHash is the SHA-256 of the token. The token itself isn't kept.
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+
+	// Token is only returned when the token is created
+	Token string `gorm:"-" json:"token,omitempty"`
+
+	// ExpiresAt is when the token stops working. Tokens without one work
+	// until they're revoked.
+	ExpiresAt *time.Time `json:"expires_at"`
+
+	// LastUsedAt is the last time the token was used
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type AccessTokenList struct {
+	Tokens []AccessToken `json:"tokens"`
+}
+
+// Scope is what a personal access token may do. Each scope includes the ones
+// before it: read, then write, then admin.
+type Scope string
+
+const (
+	// ReadScope reads tasks, lists, and views
+	ReadScope Scope = "read"
+
+	// WriteScope changes tasks, lists, and views
+	WriteScope Scope = "write"
+
+	// AdminScope manages users, shares, and access tokens
+	AdminScope Scope = "admin"
+)
+
+var (
+	Scopes = []Scope{ReadScope, WriteScope, AdminScope}
+
+	validScopes = set.New(Scopes...)
+)
+
+func IsValidScope(s Scope) bool {
+	return validScopes.Has(s)
+}
+
+// Allows is true if the token has the scope or one that includes it.
+func (t *AccessToken) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == AdminScope || (s == WriteScope && scope == ReadScope) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired is true if the token has stopped working
+func (t *AccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+func (t *AccessToken) Bind(r *http.Request) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(t.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, s := range t.Scopes {
+		if !IsValidScope(s) {
+			return fmt.Errorf("unrecognized scope: %s. valid values are read, write, and admin", s)
+		}
+	}
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package apis
+
+import (
+	"fmt"
+	"time"
+)
+
+// Format is a file format task lists can be exported to and imported from
+type Format string
+
+const (
+	// JSONFormat is an Archive. It keeps everything about the tasks.
+	JSONFormat Format = "json"
+
+	// CSVFormat has a header row naming the columns and a row for each task
+	CSVFormat Format = "csv"
+
+	// TodoTxtFormat has a line for each task in the todo.txt format
+	TodoTxtFormat Format = "todotxt"
+
+	// TaskwarriorFormat is the JSON array of tasks written by Taskwarrior's
+	// task export and read by its task import
+	TaskwarriorFormat Format = "taskwarrior"
+
+	// ICalFormat is an iCalendar (RFC 5545) calendar with a VTODO for each
+	// task
+	ICalFormat Format = "ical"
+)
+
+// ICalExtension is the file extension of ICalFormat. Tasks a CalDAV client
+// didn't name are served at their UUID with it.
+const ICalExtension = ".ics"
+
+// ParseFormat checks the name of a format. An empty name is JSONFormat.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return JSONFormat, nil
+	case JSONFormat, CSVFormat, TodoTxtFormat, TaskwarriorFormat, ICalFormat:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid format %q. use json, csv, todotxt, taskwarrior, or ical", s)
+}
+
+// ArchiveVersion is the version of the Archive format the server writes
+const ArchiveVersion = 1
+
+// Archive is the JSON export of a task list. Tasks keep the ids they had in
+// the list they came from so their parents and dependencies can be matched up
+// on import.
+type Archive struct {
+	Version    int       `json:"version"`
+	Owner      string    `json:"owner"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	Tasks        []Task       `json:"tasks"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// ImportResult is what an import did, or would have done for a dry run.
+type ImportResult struct {
+	DryRun bool `json:"dry_run"`
+
+	// Created are the tasks the import added. Their ids are 0 for a dry
+	// run.
+	Created []Task `json:"created"`
+
+	// Updated are the tasks already in the list with the UUID of a task in
+	// the import that the import changed
+	Updated []Task `json:"updated"`
+
+	// Duplicates are the tasks that weren't added because the list or the
+	// import already had them
+	Duplicates []ImportDuplicate `json:"duplicates"`
+}
+
+// ImportDuplicate is a task that wasn't imported because one with the same
+// description and due date was already in the list or earlier in the import.
+type ImportDuplicate struct {
+	// Record is the position of the task in the import, counting from 1
+	Record      int    `json:"record"`
+	Description string `json:"desc"`
+
+	// TaskId is the task in the list it matches. It's 0 if it matches an
+	// earlier task in the import.
+	TaskId uint `json:"task_id,omitempty"`
+
+	// Repeats is the record of the earlier task in the import it matches
+	Repeats int `json:"repeats,omitempty"`
+}
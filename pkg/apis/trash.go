@@ -0,0 +1,18 @@
+package apis
+
+import "time"
+
+type TrashList struct {
+	Tasks []TrashedTask `json:"tasks"`
+}
+
+// TrashedTask is a deleted task that can still be restored
+type TrashedTask struct {
+	Task
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// NewTrashedTask returns the trash entry of a deleted task
+func NewTrashedTask(t *Task) TrashedTask {
+	return TrashedTask{Task: *t, DeletedAt: t.DeletedAt.Time}
+}
@@ -21,3 +21,7 @@ type User struct {
 	SharedWith []Policy `gorm:"foreignKey:OwnerUserId;constraint:OnDelete:CASCADE"`
 	SharedFrom []Policy `gorm:"foreignKey:DelegateUserId;constraint:OnDelete:CASCADE"`
 }
+
+type UserList struct {
+	Users []User `json:"users"`
+}
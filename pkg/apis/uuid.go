@@ -0,0 +1,64 @@
+package apis
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// uuidNamespace is the namespace of the UUIDs NameUUID makes
+var uuidNamespace = [16]byte{0x11, 0x8b, 0xed, 0xb2, 0x2d, 0x0a, 0x44, 0xf9, 0x89, 0x7e, 0x2a, 0x42, 0x70, 0x1e, 0xed, 0xc0}
+
+// NewUUID returns a random (version 4) UUID in its canonical lower case form.
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("unable to read random bytes: %v", err))
+	}
+	return formatUUID(b, 4)
+}
+
+// NameUUID returns the name based (version 5) UUID of a name, so the same
+// name always gets the same UUID. It gives identifiers from other tools that
+// aren't UUIDs, like iCalendar UIDs, a UUID a task can keep.
+func NameUUID(name string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write([]byte(name))
+
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	return formatUUID(b, 5)
+}
+
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// ParseUUID checks that s is a UUID like 2b9f5c1e-8d1a-4c3e-9f0a-6b2d7e4c1a95
+// and returns it in lower case.
+func ParseUUID(s string) (string, error) {
+	u := strings.ToLower(s)
+	if len(u) != 36 {
+		return "", fmt.Errorf("invalid uuid %q", s)
+	}
+	for i, c := range u {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", fmt.Errorf("invalid uuid %q", s)
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+				return "", fmt.Errorf("invalid uuid %q", s)
+			}
+		}
+	}
+	return u, nil
+}
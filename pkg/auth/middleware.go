@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/csams/doit/pkg/apis"
 	"gorm.io/gorm"
@@ -29,10 +30,27 @@ func Authenticator(db *gorm.DB, provider *TokenProvider, clientId string) func(h
 
 			// ensure we got one
 			if rawToken == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="doit"`)
 				http.Error(w, "No credentials supplied", http.StatusUnauthorized)
 				return
 			}
 
+			// personal access tokens stand in for ID tokens
+			if strings.HasPrefix(rawToken, apis.AccessTokenPrefix) {
+				usr, token, err := accessTokenUser(db, rawToken)
+				if err != nil {
+					http.Error(w, "Failed to check access token: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if usr == nil {
+					http.Error(w, "Invalid or expired access token", http.StatusUnauthorized)
+					return
+				}
+				ctx := NewAccessTokenContext(NewContext(r.Context(), usr), token)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// verify and parse it
 			tok, err := provider.Verify(rawToken)
 			if err != nil {
@@ -69,6 +87,37 @@ func Authenticator(db *gorm.DB, provider *TokenProvider, clientId string) func(h
 	}
 }
 
+// accessTokenUser looks up the user a personal access token acts as and
+// records that the token was used. It returns nil if the token doesn't exist,
+// has expired, or its user is gone.
+func accessTokenUser(db *gorm.DB, rawToken string) (*apis.User, *apis.AccessToken, error) {
+	token := &apis.AccessToken{}
+	if err := db.First(token, "token_hash = ?", apis.HashToken(rawToken)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if token.Expired(now) {
+		return nil, nil, nil
+	}
+
+	usr := &apis.User{}
+	if err := db.First(usr, token.UserId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	if err := db.Model(token).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, nil, err
+	}
+	return usr, token, nil
+}
+
 func NewContext(ctx context.Context, user *apis.User) context.Context {
 	ctx = context.WithValue(ctx, UserCtxKey, user)
 	return ctx
@@ -82,6 +131,19 @@ func UserFromContext(ctx context.Context) (*apis.User, error) {
 	return user, nil
 }
 
+// NewAccessTokenContext records the personal access token a request was
+// authenticated with
+func NewAccessTokenContext(ctx context.Context, token *apis.AccessToken) context.Context {
+	return context.WithValue(ctx, AccessTokenCtxKey, token)
+}
+
+// AccessTokenFromContext returns the personal access token a request was
+// authenticated with. It's nil if the user logged in instead.
+func AccessTokenFromContext(ctx context.Context) *apis.AccessToken {
+	token, _ := ctx.Value(AccessTokenCtxKey).(*apis.AccessToken)
+	return token
+}
+
 func TokenFromHeader(r *http.Request) string {
 	bearer := r.Header.Get("Authorization")
 	if len(bearer) > 7 && strings.ToLower(bearer[0:6]) == "bearer" {
@@ -101,6 +163,16 @@ func TokenFromQuery(r *http.Request) string {
 	return r.URL.Query().Get("jwt")
 }
 
+// TokenFromBasicAuth returns the password of HTTP basic auth, where apps like
+// CalDAV clients that can't send a bearer token put a personal access token.
+func TokenFromBasicAuth(r *http.Request) string {
+	_, password, ok := r.BasicAuth()
+	if !ok {
+		return ""
+	}
+	return password
+}
+
 type contextKey struct {
 	name string
 }
@@ -108,7 +180,8 @@ type contextKey struct {
 type TokenGetter func(*http.Request) string
 
 var (
-	UserCtxKey   = &contextKey{"token"}
-	ErrorCtxKey  = &contextKey{"error"}
-	TokenGetters = []TokenGetter{TokenFromHeader, TokenFromCookie, TokenFromQuery}
+	UserCtxKey        = &contextKey{"token"}
+	AccessTokenCtxKey = &contextKey{"access-token"}
+	ErrorCtxKey       = &contextKey{"error"}
+	TokenGetters      = []TokenGetter{TokenFromHeader, TokenFromCookie, TokenFromQuery, TokenFromBasicAuth}
 )
@@ -0,0 +1,32 @@
+/*
+Package filter parses task filter expressions like
+
+	status:doing and priority>=3 and due<+2d and tag:infra or assignee:alice
+
+An expression compiles to a gorm Where clause so the server can filter a
+listing, and it can match tasks in memory so clients can filter what they've
+already loaded. Both give the same answer for the same tasks.
+
+A comparison is a field, an operator, and a value. Comparisons combine with
+and, or, and not, which bind in the usual order, and parentheses group them.
+Comparisons next to each other without an operator are anded. A word on its
+own matches descriptions that contain it. Values with spaces or operator
+characters go in double quotes.
+
+	Field                Operators         Values
+	status, state        : = !=            names; a comma separated list matches any
+	priority, id, parent : = != < <= > >=  numbers
+	due, created, updated: = != < <= > >=  dates
+	tag                  : = !=            tag names; a comma separated list matches any
+	assignee             : = !=            usernames or me
+	desc                 : = !=            text the description contains, ignoring case
+	private              : = !=            true or false
+
+Dates are now, today, tomorrow, yesterday, an offset like +2d or -1w (h, d, w,
+m, and y are hours, days, weeks, months, and years), or anything the task
+form's date field accepts. Offsets in days or more count from the start of
+today. A date without a time of day is the whole day, so due:today matches
+anything due today and due<=today matches anything due by the end of it.
+Tasks without a due date don't match any comparison on due.
+*/
+package filter
@@ -0,0 +1,249 @@
+package filter
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// Expr is a parsed filter.
+type Expr interface {
+	// Match reports whether the task passes the filter.
+	Match(t *apis.Task) bool
+
+	// SQL returns the filter as a condition on the tasks table along with its
+	// arguments. The condition is never NULL, so negating it matches exactly
+	// the tasks Match rejects.
+	SQL() (string, []interface{})
+}
+
+// Where adds the filter to a task query.
+func Where(db *gorm.DB, e Expr) *gorm.DB {
+	sql, args := e.SQL()
+	return db.Where(sql, args...)
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e *andExpr) Match(t *apis.Task) bool {
+	return e.left.Match(t) && e.right.Match(t)
+}
+
+func (e *andExpr) SQL() (string, []interface{}) {
+	return binarySQL("AND", e.left, e.right)
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e *orExpr) Match(t *apis.Task) bool {
+	return e.left.Match(t) || e.right.Match(t)
+}
+
+func (e *orExpr) SQL() (string, []interface{}) {
+	return binarySQL("OR", e.left, e.right)
+}
+
+func binarySQL(op string, left, right Expr) (string, []interface{}) {
+	l, largs := left.SQL()
+	r, rargs := right.SQL()
+	return "(" + l + " " + op + " " + r + ")", append(largs, rargs...)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e *notExpr) Match(t *apis.Task) bool {
+	return !e.expr.Match(t)
+}
+
+func (e *notExpr) SQL() (string, []interface{}) {
+	sql, args := e.expr.SQL()
+	return "NOT (" + sql + ")", args
+}
+
+// enumExpr matches a string column against a list of values.
+type enumExpr struct {
+	column string
+	values []string
+	get    func(t *apis.Task) string
+}
+
+func (e *enumExpr) Match(t *apis.Task) bool {
+	v := e.get(t)
+	for _, value := range e.values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *enumExpr) SQL() (string, []interface{}) {
+	return e.column + " IN ?", []interface{}{e.values}
+}
+
+// numberExpr compares a numeric column with a value.
+type numberExpr struct {
+	column string
+	op     string
+	value  int64
+	get    func(t *apis.Task) int64
+}
+
+func (e *numberExpr) Match(t *apis.Task) bool {
+	return compare(e.op, e.get(t), e.value)
+}
+
+func (e *numberExpr) SQL() (string, []interface{}) {
+	return e.column + " " + sqlOp(e.op) + " ?", []interface{}{e.value}
+}
+
+func compare(op string, a, b int64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+func sqlOp(op string) string {
+	if op == ":" {
+		return "="
+	}
+	return op
+}
+
+// bound is one side of a date range
+type bound struct {
+	op string
+	t  time.Time
+}
+
+// dateExpr matches a date column that falls within all of its bounds. Tasks
+// without the date don't match.
+type dateExpr struct {
+	column string
+	bounds []bound
+	get    func(t *apis.Task) *time.Time
+}
+
+func (e *dateExpr) Match(t *apis.Task) bool {
+	v := e.get(t)
+	if v == nil {
+		return false
+	}
+	for _, b := range e.bounds {
+		var ok bool
+		switch b.op {
+		case "<":
+			ok = v.Before(b.t)
+		case "<=":
+			ok = !v.After(b.t)
+		case ">":
+			ok = v.After(b.t)
+		case ">=":
+			ok = !v.Before(b.t)
+		default:
+			ok = v.Equal(b.t)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *dateExpr) SQL() (string, []interface{}) {
+	conds := []string{e.column + " IS NOT NULL"}
+	args := make([]interface{}, 0, len(e.bounds))
+	for _, b := range e.bounds {
+		// stored times are in UTC, and sqlite compares them as text
+		conds = append(conds, e.column+" "+b.op+" ?")
+		args = append(args, b.t.UTC())
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", args
+}
+
+// tagExpr matches tasks with any of the tags.
+type tagExpr struct {
+	names []string
+}
+
+func (e *tagExpr) Match(t *apis.Task) bool {
+	for _, tag := range t.Tags {
+		for _, name := range e.names {
+			if tag.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *tagExpr) SQL() (string, []interface{}) {
+	return "tasks.id IN (SELECT task_id FROM tags WHERE name IN ?)", []interface{}{e.names}
+}
+
+// assigneeExpr matches tasks assigned to any of the users.
+type assigneeExpr struct {
+	usernames []string
+}
+
+func (e *assigneeExpr) Match(t *apis.Task) bool {
+	for _, name := range e.usernames {
+		if t.Assignee.Username == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *assigneeExpr) SQL() (string, []interface{}) {
+	return "tasks.assignee_id IN (SELECT id FROM users WHERE username IN ?)", []interface{}{e.usernames}
+}
+
+// textExpr matches descriptions that contain the text, ignoring case.
+type textExpr struct {
+	text string
+}
+
+func (e *textExpr) Match(t *apis.Task) bool {
+	return strings.Contains(strings.ToLower(t.Description), e.text)
+}
+
+func (e *textExpr) SQL() (string, []interface{}) {
+	return `LOWER(tasks.description) LIKE ? ESCAPE '\'`, []interface{}{"%" + escapeLike(e.text) + "%"}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// boolExpr matches a boolean column.
+type boolExpr struct {
+	column string
+	value  bool
+	get    func(t *apis.Task) bool
+}
+
+func (e *boolExpr) Match(t *apis.Task) bool {
+	return e.get(t) == e.value
+}
+
+func (e *boolExpr) SQL() (string, []interface{}) {
+	return e.column + " = ?", []interface{}{e.value}
+}
@@ -0,0 +1,170 @@
+package filter
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+var now = time.Date(2022, 11, 15, 10, 30, 0, 0, time.UTC)
+
+func day(d int) *time.Time {
+	t := time.Date(2022, 11, d, 12, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func testTasks() []apis.Task {
+	alice := apis.User{ID: 1, Username: "alice"}
+	bob := apis.User{ID: 2, Username: "bob"}
+	return []apis.Task{
+		{ID: 1, Description: "Fix the build", Status: apis.Doing, State: apis.Open, Priority: 3, Due: day(16), AssigneeId: 1, Assignee: alice, Tags: apis.NewTags("infra")},
+		{ID: 2, Description: "Write docs", Status: apis.Todo, State: apis.Open, Priority: 1, Due: day(20), AssigneeId: 2, Assignee: bob},
+		{ID: 3, Description: "Rotate certs", Status: apis.Doing, State: apis.Open, Priority: 5, AssigneeId: 2, Assignee: bob, Tags: apis.NewTags("infra", "security")},
+		{ID: 4, Description: "100% done", Status: apis.Done, State: apis.Closed, Priority: 2, Due: day(15), AssigneeId: 1, Assignee: alice, Private: true, ParentId: 1},
+	}
+}
+
+func matching(t *testing.T, e Expr, tasks []apis.Task) []uint {
+	t.Helper()
+	var ids []uint
+	for i := range tasks {
+		if e.Match(&tasks[i]) {
+			ids = append(ids, tasks[i].ID)
+		}
+	}
+	return ids
+}
+
+func TestMatch(t *testing.T) {
+	env := Env{Now: now, Username: "bob"}
+	cases := map[string][]uint{
+		"status:doing and priority>=3 and due<+2d and tag:infra or assignee:alice": {1, 4},
+		"status:doing,todo":            {1, 2, 3},
+		"status!=doing":                {2, 4},
+		"not (state:open)":             {4},
+		"due:today":                    {4},
+		"due<=tomorrow":                {1, 4},
+		"due>tomorrow":                 {2},
+		"due!=today":                   {1, 2, 3},
+		"due<2022-11-17":               {1, 4},
+		"assignee:me priority>1":       {3},
+		"tag:security or parent=1":     {3, 4},
+		"docs":                         {2},
+		`"100%"`:                       {4},
+		"desc:BUILD and private:false": {1},
+		"(status:doing or status:done) and not tag:infra": {4},
+	}
+	for input, want := range cases {
+		e, err := Parse(input, env)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		got := matching(t, e, testTasks())
+		if !equal(got, want) {
+			t.Errorf("%s: got %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	cases := map[string]int{
+		"":                    1,
+		"status:":             8,
+		"status:nope":         8,
+		"colour:red":          1,
+		"status<doing":        7,
+		"due<+2x":             5,
+		"(status:doing":       14,
+		"status:doing)":       13,
+		"status:doing and or": 18,
+		`desc:"unterminated`:  6,
+		"priority>=high":      11,
+		"tag:infra !":         11,
+	}
+	for input, column := range cases {
+		_, err := Parse(input, Env{Now: now})
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) {
+			t.Errorf("%q: expected a syntax error, got %v", input, err)
+			continue
+		}
+		if syntax.Column != column {
+			t.Errorf("%q: got column %d, want %d: %v", input, syntax.Column, column, err)
+		}
+	}
+}
+
+// TestSQL checks that the SQL a filter compiles to picks the same tasks as
+// Match.
+func TestSQL(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "filter.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&apis.User{}, &apis.Task{}, &apis.Tag{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]apis.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}})
+
+	// due late on the 16th in UTC but on the 17th east of it
+	east := time.FixedZone("+05", 5*60*60)
+	due := time.Date(2022, 11, 17, 1, 0, 0, 0, east)
+	tasks := append(testTasks(), apis.Task{ID: 5, Description: "Call the office", Status: apis.Todo, State: apis.Open, Due: &due, AssigneeId: 2, Assignee: apis.User{ID: 2, Username: "bob"}})
+	for i := range tasks {
+		task := tasks[i]
+		task.Assignee = apis.User{}
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs := []string{
+		"status:doing and priority>=3 and due<+2d and tag:infra or assignee:alice",
+		"due!=today",
+		"not due>=+1d",
+		"due<2022-11-17",
+		"due:tomorrow",
+		"tag!=infra",
+		`"100%"`,
+		"assignee:me or private:true",
+		"id>1 and id<=3",
+	}
+	// dates in the filter are in the zone of Now
+	for _, env := range []Env{{Now: now, Username: "bob"}, {Now: now.In(east), Username: "bob"}} {
+		for _, input := range inputs {
+			e, err := Parse(input, env)
+			if err != nil {
+				t.Fatalf("%s: %v", input, err)
+			}
+			var ids []uint
+			if err := Where(db.Model(&apis.Task{}), e).Order("id").Pluck("id", &ids).Error; err != nil {
+				t.Fatalf("%s: %v", input, err)
+			}
+			if want := matching(t, e, tasks); !equal(ids, want) {
+				t.Errorf("%s in %s: SQL got %v, Match got %v", input, env.Now.Location(), ids, want)
+			}
+		}
+	}
+}
+
+func equal(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
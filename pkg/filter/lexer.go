@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	opToken
+	lparenToken
+	rparenToken
+	endToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+
+	// column is where the token starts, counting runes from 1
+	column int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case stringToken:
+		return fmt.Sprintf("%q", t.text)
+	case endToken:
+		return "end of filter"
+	}
+	return t.text
+}
+
+// SyntaxError describes where and why a filter couldn't be parsed.
+type SyntaxError struct {
+	// Column is where the problem is, counting characters from 1
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+func errorAt(column int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// operators are longest first so <= isn't read as <
+var operators = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+// isWordRune is true for runes that can be part of a word
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`():=!<>"`, r)
+}
+
+// lex splits a filter into tokens. The last one is always an endToken.
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		column := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{lparenToken, "(", column})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{rparenToken, ")", column})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, errorAt(column, "missing closing quote")
+			}
+			i++
+			tokens = append(tokens, token{stringToken, b.String(), column})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{wordToken, string(runes[start:i]), column})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorAt(column, "unexpected %q", r)
+			}
+			tokens = append(tokens, token{opToken, op, column})
+			i += len([]rune(op))
+		}
+	}
+
+	return append(tokens, token{endToken, "", len(runes) + 1}), nil
+}
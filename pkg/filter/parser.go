@@ -0,0 +1,373 @@
+package filter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// Env holds what a filter needs to resolve its values.
+type Env struct {
+	// Now is the time relative dates are resolved against. Its location is
+	// the time zone of dates without one.
+	Now time.Time
+
+	// Username is the user that me refers to
+	Username string
+}
+
+// field describes how a field name compiles.
+type field struct {
+	// ops are the operators the field takes. All fields take :, =, and !=.
+	ops   []string
+	build func(value string, op string, env Env) (Expr, error)
+}
+
+var (
+	equalityOps   = []string{":", "=", "!="}
+	comparisonOps = []string{":", "=", "!=", "<", "<=", ">", ">="}
+)
+
+var fields = map[string]field{
+	"status": {equalityOps, enumField("tasks.status", "status", func(t *apis.Task) string { return string(t.Status) }, func(v string) bool {
+		return apis.IsValidStatus(apis.Status(v))
+	})},
+	"state": {equalityOps, enumField("tasks.state", "state", func(t *apis.Task) string { return string(t.State) }, func(v string) bool {
+		return apis.IsValidState(apis.State(v))
+	})},
+	"priority": {comparisonOps, numberField("tasks.priority", func(t *apis.Task) int64 { return int64(t.Priority) })},
+	"id":       {comparisonOps, numberField("tasks.id", func(t *apis.Task) int64 { return int64(t.ID) })},
+	"parent":   {comparisonOps, numberField("tasks.parent_id", func(t *apis.Task) int64 { return int64(t.ParentId) })},
+	"due":      {comparisonOps, dateField("tasks.due", func(t *apis.Task) *time.Time { return t.Due })},
+	"created":  {comparisonOps, dateField("tasks.created_at", func(t *apis.Task) *time.Time { return &t.CreatedAt })},
+	"updated":  {comparisonOps, dateField("tasks.updated_at", func(t *apis.Task) *time.Time { return &t.UpdatedAt })},
+	"tag": {equalityOps, func(value, op string, env Env) (Expr, error) {
+		names := apis.TagNames(apis.NewTags(strings.Split(value, ",")...))
+		if len(names) == 0 {
+			return nil, valueError("expected a tag")
+		}
+		return &tagExpr{names: names}, nil
+	}},
+	"assignee": {equalityOps, func(value, op string, env Env) (Expr, error) {
+		var names []string
+		for _, n := range splitList(value) {
+			if n == "me" {
+				n = env.Username
+			}
+			names = append(names, n)
+		}
+		if len(names) == 0 {
+			return nil, valueError("expected a username")
+		}
+		return &assigneeExpr{usernames: names}, nil
+	}},
+	"desc": {equalityOps, func(value, op string, env Env) (Expr, error) {
+		return &textExpr{text: strings.ToLower(value)}, nil
+	}},
+	"private": {equalityOps, func(value, op string, env Env) (Expr, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, valueError("private must be true or false")
+		}
+		return &boolExpr{column: "tasks.private", value: b, get: func(t *apis.Task) bool { return t.Private }}, nil
+	}},
+}
+
+// aliases are other names for fields
+var aliases = map[string]string{
+	"tags":        "tag",
+	"description": "desc",
+}
+
+// valueError is a problem with a value. The parser adds the value's column.
+type valueError string
+
+func (e valueError) Error() string {
+	return string(e)
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func enumField(column, name string, get func(t *apis.Task) string, valid func(string) bool) func(string, string, Env) (Expr, error) {
+	return func(value, op string, env Env) (Expr, error) {
+		values := splitList(strings.ToLower(value))
+		if len(values) == 0 {
+			return nil, valueError("expected a " + name)
+		}
+		for _, v := range values {
+			if !valid(v) {
+				return nil, valueError("unrecognized " + name + ": " + v)
+			}
+		}
+		return &enumExpr{column: column, values: values, get: get}, nil
+	}
+}
+
+func numberField(column string, get func(t *apis.Task) int64) func(string, string, Env) (Expr, error) {
+	return func(value, op string, env Env) (Expr, error) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, valueError("expected a number, found " + value)
+		}
+		return &numberExpr{column: column, op: op, value: n, get: get}, nil
+	}
+}
+
+func dateField(column string, get func(t *apis.Task) *time.Time) func(string, string, Env) (Expr, error) {
+	return func(value, op string, env Env) (Expr, error) {
+		start, day, err := resolveDate(value, env)
+		if err != nil {
+			return nil, err
+		}
+
+		// a day is the range [start, end)
+		end := start.AddDate(0, 0, 1)
+		var bounds []bound
+		switch {
+		case op == ":" || op == "=":
+			if day {
+				bounds = []bound{{">=", start}, {"<", end}}
+			} else {
+				bounds = []bound{{"=", start}}
+			}
+		case op == "<=" && day:
+			bounds = []bound{{"<", end}}
+		case op == ">" && day:
+			bounds = []bound{{">=", end}}
+		default:
+			bounds = []bound{{op, start}}
+		}
+		return &dateExpr{column: column, bounds: bounds, get: get}, nil
+	}
+}
+
+// resolveDate turns a date value into a time. day is true if the value names
+// a whole day rather than a moment, in which case the time is its start.
+func resolveDate(value string, env Env) (t time.Time, day bool, err error) {
+	now := env.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch strings.ToLower(value) {
+	case "now":
+		return now, false, nil
+	case "today":
+		return today, true, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true, nil
+	}
+
+	if len(value) > 2 && (value[0] == '+' || value[0] == '-') {
+		n, err := strconv.Atoi(value[1 : len(value)-1])
+		if err == nil {
+			if value[0] == '-' {
+				n = -n
+			}
+			switch value[len(value)-1] {
+			case 'h':
+				return now.Add(time.Duration(n) * time.Hour), false, nil
+			case 'd':
+				return today.AddDate(0, 0, n), true, nil
+			case 'w':
+				return today.AddDate(0, 0, 7*n), true, nil
+			case 'm':
+				return today.AddDate(0, n, 0), true, nil
+			case 'y':
+				return today.AddDate(n, 0, 0), true, nil
+			}
+		}
+		return time.Time{}, false, valueError("invalid date offset: " + value + ". use a number followed by h, d, w, m, or y")
+	}
+
+	t, err = dateparse.ParseIn(value, now.Location())
+	if err != nil {
+		return time.Time{}, false, valueError("invalid date: " + value)
+	}
+	midnight := t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+	return t, midnight, nil
+}
+
+// Parse compiles a filter expression. Errors are *SyntaxError.
+func Parse(input string, env Env) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, env: env}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != endToken {
+		return nil, errorAt(t.column, "unexpected %s", t)
+	}
+	return e, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	env    Env
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != endToken {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the keyword, ignoring case.
+func (p *parser) keyword(k string) bool {
+	t := p.peek()
+	return t.kind == wordToken && strings.EqualFold(t.text, k)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd reads comparisons joined by and or by nothing at all.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch t := p.peek(); {
+		case p.keyword("and"):
+			p.next()
+		case p.keyword("or"), t.kind == endToken, t.kind == rparenToken:
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left, right}
+	}
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.keyword("not") {
+		p.next()
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case lparenToken:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != rparenToken {
+			return nil, errorAt(closing.column, "expected ) to close the ( at column %d, found %s", t.column, closing)
+		}
+		return e, nil
+	case stringToken:
+		return &textExpr{text: strings.ToLower(t.text)}, nil
+	case wordToken:
+		if p.peek().kind == opToken {
+			return p.parseComparison(t)
+		}
+		if strings.EqualFold(t.text, "and") || strings.EqualFold(t.text, "or") {
+			return nil, errorAt(t.column, "expected a comparison before %s", t.text)
+		}
+		return &textExpr{text: strings.ToLower(t.text)}, nil
+	}
+	return nil, errorAt(t.column, "expected a comparison, found %s", t)
+}
+
+func (p *parser) parseComparison(name token) (Expr, error) {
+	fieldName := strings.ToLower(name.text)
+	if alias, ok := aliases[fieldName]; ok {
+		fieldName = alias
+	}
+	f, ok := fields[fieldName]
+	if !ok {
+		return nil, errorAt(name.column, "unknown field %s. valid fields are %s", name.text, strings.Join(fieldNames(), ", "))
+	}
+
+	op := p.next()
+	if !hasOp(f.ops, op.text) {
+		return nil, errorAt(op.column, "%s doesn't take %s. use one of %s", fieldName, op.text, strings.Join(f.ops, " "))
+	}
+
+	value := p.next()
+	if value.kind != wordToken && value.kind != stringToken {
+		return nil, errorAt(value.column, "expected a value after %s%s, found %s", name.text, op.text, value)
+	}
+
+	cmpOp := op.text
+	if cmpOp == "!=" {
+		cmpOp = "="
+	}
+	e, err := f.build(value.text, cmpOp, p.env)
+	if err != nil {
+		return nil, errorAt(value.column, "%s", err.Error())
+	}
+	if op.text == "!=" {
+		return &notExpr{e}, nil
+	}
+	return e, nil
+}
+
+func hasOp(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldNames() []string {
+	names := make([]string, 0, len(fields))
+	for n := range fields {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
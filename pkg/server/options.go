@@ -1,6 +1,8 @@
 package server
 
 import (
+	"time"
+
 	"github.com/csams/doit/pkg/auth"
 	"github.com/spf13/pflag"
 )
@@ -12,6 +14,10 @@ type Options struct {
 	CertFile string `mapstructure:"cert-file"`
 	KeyFile  string `mapstructure:"key-file"`
 
+	// TrashRetentionDays is how long deleted tasks stay in the trash before
+	// they're purged. 0 keeps them until someone purges them.
+	TrashRetentionDays uint `mapstructure:"trash-retention-days"`
+
 	SecureServing bool
 }
 
@@ -27,6 +33,7 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.String("server.addr", "0.0.0.0:9090", "the host and port on which to listen")
 	fs.String("server.cert-file", "", "the file containing the server's serving certificate")
 	fs.String("server.key-file", "", "the file containing the server's private key for the serving cert")
+	fs.Uint("server.trash-retention-days", 0, "the number of days to keep deleted tasks before purging them. 0 keeps them forever")
 
 	o.Auth.AddFlags(fs, "server.auth")
 }
@@ -41,3 +48,9 @@ func (o *Options) Complete() error {
 	o.SecureServing = o.CertFile != "" && o.KeyFile != ""
 	return o.Auth.Complete()
 }
+
+// TrashRetention is how long deleted tasks are kept, or 0 if they're kept
+// until someone purges them.
+func (o *Options) TrashRetention() time.Duration {
+	return time.Duration(o.TrashRetentionDays) * 24 * time.Hour
+}
@@ -0,0 +1,208 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"gorm.io/gorm"
+)
+
+type AccessContextKey string
+
+const (
+	AccessKey AccessContextKey = "accessCtxKey"
+)
+
+// Access describes what the authenticated user may do with the task list of
+// the user named in the request path.
+type Access struct {
+	// User is the authenticated user making the request
+	User *apis.User
+
+	// Owner is the user that owns the task list
+	Owner *apis.User
+
+	// Mode is the policy the owner granted to User. It's empty when User is
+	// the owner.
+	Mode apis.PolicyMode
+}
+
+// IsOwner is true if the authenticated user owns the task list.
+func (a *Access) IsOwner() bool {
+	return a.User.ID == a.Owner.ID
+}
+
+// CanUpdateList is true if the authenticated user may add tasks to the list.
+func (a *Access) CanUpdateList() bool {
+	return a.IsOwner() || a.Mode == apis.ViewAndUpdate
+}
+
+// CanView is true if the authenticated user may see the task. Private tasks
+// are hidden from delegates unless they're assigned to them.
+func (a *Access) CanView(t *apis.Task) bool {
+	if t.OwnerId != a.Owner.ID {
+		return false
+	}
+	if a.IsOwner() || t.AssigneeId == a.User.ID {
+		return true
+	}
+	return a.Mode != "" && !t.Private
+}
+
+// CanUpdate is true if the authenticated user may change or delete the task.
+func (a *Access) CanUpdate(t *apis.Task) bool {
+	if !a.CanView(t) {
+		return false
+	}
+	if a.IsOwner() {
+		return true
+	}
+	return a.Mode == apis.ViewAndUpdate && !t.Private
+}
+
+// CanUpdateProgress is true if the authenticated user may change the status
+// and state of the task. Assignees may do that without update access.
+func (a *Access) CanUpdateProgress(t *apis.Task) bool {
+	if a.CanUpdate(t) {
+		return true
+	}
+	return a.CanView(t) && t.AssigneeId == a.User.ID
+}
+
+// CanModifyComment is true if the authenticated user may change or delete
+// the comment. Only its author and the owner of the task list may.
+func (a *Access) CanModifyComment(c *apis.Comment) bool {
+	return a.IsOwner() || c.AuthorId == a.User.ID
+}
+
+// Visible limits a task query to the rows of the list the authenticated user
+// may see.
+func (a *Access) Visible(db *gorm.DB) *gorm.DB {
+	db = db.Where("tasks.owner_id = ?", a.Owner.ID)
+	if a.IsOwner() {
+		return db
+	}
+	return db.Where("(tasks.private = ? OR tasks.assignee_id = ?)", false, a.User.ID)
+}
+
+func WithAccess(ctx context.Context, access *Access) context.Context {
+	return context.WithValue(ctx, AccessKey, access)
+}
+
+func AccessFromContext(ctx context.Context) (*Access, error) {
+	access, ok := ctx.Value(AccessKey).(*Access)
+	if !ok {
+		return nil, errors.New("Expected task list access in request context")
+	}
+	return access, nil
+}
+
+// NewAccess looks up the policy the owner has granted the user. It returns
+// nil if the user isn't the owner and hasn't been granted access.
+func NewAccess(db *gorm.DB, user *apis.User, owner *apis.User) (*Access, error) {
+	access := &Access{User: user, Owner: owner}
+	if access.IsOwner() {
+		return access, nil
+	}
+
+	var policy apis.Policy
+	err := db.Where("owner_user_id = ? AND delegate_user_id = ?", owner.ID, user.ID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access.Mode = policy.Mode
+	return access, nil
+}
+
+// AccessCtx resolves the authenticated user's access to the task list of the
+// user loaded by UserCtx. Requests from users the list hasn't been shared
+// with are rejected.
+func AccessCtx(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, err := auth.UserFromContext(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			owner, err := UserFromContext(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			access, err := NewAccess(db, u, owner.User)
+			if err != nil {
+				http.Error(w, "Unable to retrieve policy: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if access == nil {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx := WithAccess(r.Context(), access)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireUpdate rejects requests from users that may not change the task or
+// the deleted task in the request context or, if there isn't one, add tasks
+// to the list.
+func RequireUpdate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		allowed := access.CanUpdateList()
+		if task, err := TaskFromContext(r.Context()); err == nil {
+			allowed = access.CanUpdate(task)
+		} else if task, err := TrashedTaskFromContext(r.Context()); err == nil {
+			allowed = access.CanUpdate(task)
+		}
+
+		if !allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireProgressUpdate is like RequireUpdate but also lets the assignee of
+// the task in the request context through. Handlers must check CanUpdate
+// before changing anything other than status and state.
+func RequireProgressUpdate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		task, err := TaskFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !access.CanUpdateProgress(task) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
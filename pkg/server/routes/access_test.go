@@ -0,0 +1,327 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// accessFixture is alice's task list as each request finds it
+type accessFixture struct {
+	// public is a task every delegate may see
+	public *apis.Task
+
+	// private is a private task assigned to dave
+	private *apis.Task
+
+	// trashed and trashedPrivate are deleted copies of the two
+	trashed        *apis.Task
+	trashedPrivate *apis.Task
+
+	// comment is alice's comment on public
+	comment *apis.Comment
+}
+
+// The roles a request is made as, in the order of accessCase.want
+var accessRoles = []string{"alice", "bob", "carol", "dave", "eve"}
+
+type accessCase struct {
+	name string
+
+	// request builds the request as the user
+	request func(s *testServer, f *accessFixture, username string) *http.Request
+
+	// bulk reads the status of the first result of a bulk response
+	bulk bool
+
+	// want is the status for the owner, a view delegate, a view and update
+	// delegate, a view and update delegate the private task is assigned to,
+	// and a stranger
+	want [5]int
+}
+
+func newAccessFixture(s *testServer) *accessFixture {
+	s.t.Helper()
+	owner := s.user("alice")
+	tasks := fmt.Sprintf("/users/%d/tasks", owner.ID)
+	create := func(private bool) *apis.Task {
+		task := &apis.Task{}
+		body := map[string]interface{}{"desc": "task", "status": apis.Todo, "private": private}
+		if private {
+			body["assignee_id"] = s.user("dave").ID
+		}
+		s.expect(http.StatusCreated, s.request(http.MethodPost, tasks, "alice", body), task)
+		return task
+	}
+	remove := func(task *apis.Task) *apis.Task {
+		s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, fmt.Sprintf("%s/%d", tasks, task.ID), "alice", nil), "*"), nil)
+		return task
+	}
+
+	f := &accessFixture{
+		public:         create(false),
+		private:        create(true),
+		trashed:        remove(create(false)),
+		trashedPrivate: remove(create(true)),
+		comment:        &apis.Comment{},
+	}
+	path := fmt.Sprintf("%s/%d/comments", tasks, f.public.ID)
+	s.expect(http.StatusCreated, s.request(http.MethodPost, path, "alice", map[string]string{"description": "hi"}), f.comment)
+	return f
+}
+
+func taskPath(s *testServer, id uint) string {
+	return fmt.Sprintf("/users/%d/tasks/%d", s.user("alice").ID, id)
+}
+
+func trashPath(s *testServer, id uint) string {
+	return fmt.Sprintf("/users/%d/trash/%d", s.user("alice").ID, id)
+}
+
+func listPath(s *testServer, rest string) string {
+	return fmt.Sprintf("/users/%d/%s", s.user("alice").ID, rest)
+}
+
+var accessCases = []accessCase{
+	{
+		name: "create task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks"), u, map[string]interface{}{"desc": "task", "status": apis.Todo})
+		},
+		want: [5]int{201, 403, 201, 201, 403},
+	},
+	{
+		name: "get task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodGet, taskPath(s, f.public.ID), u, nil)
+		},
+		want: [5]int{200, 200, 200, 200, 403},
+	},
+	{
+		name: "get private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodGet, taskPath(s, f.private.ID), u, nil)
+		},
+		want: [5]int{200, 404, 404, 200, 403},
+	},
+	{
+		name: "put task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return withIfMatch(s.request(http.MethodPut, taskPath(s, f.public.ID), u, map[string]string{"desc": "changed"}), "*")
+		},
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "put private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return withIfMatch(s.request(http.MethodPut, taskPath(s, f.private.ID), u, map[string]string{"desc": "changed"}), "*")
+		},
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "patch task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			r := s.request(http.MethodPatch, taskPath(s, f.public.ID), u, `{"priority": 5}`)
+			r.Header.Set("Content-Type", apis.MergePatchType)
+			return withIfMatch(r, "*")
+		},
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "patch status of private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			r := s.request(http.MethodPatch, taskPath(s, f.private.ID), u, `{"status": "doing"}`)
+			r.Header.Set("Content-Type", apis.MergePatchType)
+			return withIfMatch(r, "*")
+		},
+		want: [5]int{200, 404, 404, 200, 403},
+	},
+	{
+		name: "patch private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			r := s.request(http.MethodPatch, taskPath(s, f.private.ID), u, `[{"op": "replace", "path": "/priority", "value": 5}]`)
+			r.Header.Set("Content-Type", apis.JSONPatchType)
+			return withIfMatch(r, "*")
+		},
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "delete task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return withIfMatch(s.request(http.MethodDelete, taskPath(s, f.public.ID), u, nil), "*")
+		},
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "delete private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return withIfMatch(s.request(http.MethodDelete, taskPath(s, f.private.ID), u, nil), "*")
+		},
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "get deleted task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodGet, trashPath(s, f.trashed.ID), u, nil)
+		},
+		want: [5]int{200, 200, 200, 200, 403},
+	},
+	{
+		name: "get deleted private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodGet, trashPath(s, f.trashedPrivate.ID), u, nil)
+		},
+		want: [5]int{200, 404, 404, 200, 403},
+	},
+	{
+		name: "restore task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, trashPath(s, f.trashed.ID)+"/restore", u, nil)
+		},
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "restore private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, trashPath(s, f.trashedPrivate.ID)+"/restore", u, nil)
+		},
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "purge task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodDelete, trashPath(s, f.trashed.ID), u, nil)
+		},
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "purge private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodDelete, trashPath(s, f.trashedPrivate.ID), u, nil)
+		},
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "bulk update",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks/bulk"), u, map[string]interface{}{"ids": []uint{f.public.ID}, "priority": 5})
+		},
+		bulk: true,
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "bulk update status of private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks/bulk"), u, map[string]interface{}{"ids": []uint{f.private.ID}, "status": apis.Doing})
+		},
+		bulk: true,
+		want: [5]int{200, 404, 404, 200, 403},
+	},
+	{
+		name: "bulk update private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks/bulk"), u, map[string]interface{}{"ids": []uint{f.private.ID}, "priority": 5})
+		},
+		bulk: true,
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "bulk delete",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks/bulk/delete"), u, map[string]interface{}{"ids": []uint{f.public.ID}})
+		},
+		bulk: true,
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "bulk delete private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "tasks/bulk/delete"), u, map[string]interface{}{"ids": []uint{f.private.ID}})
+		},
+		bulk: true,
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "bulk restore",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "trash/bulk/restore"), u, map[string]interface{}{"ids": []uint{f.trashed.ID}})
+		},
+		bulk: true,
+		want: [5]int{200, 403, 200, 200, 403},
+	},
+	{
+		name: "bulk restore private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, listPath(s, "trash/bulk/restore"), u, map[string]interface{}{"ids": []uint{f.trashedPrivate.ID}})
+		},
+		bulk: true,
+		want: [5]int{200, 404, 404, 403, 403},
+	},
+	{
+		name: "list comments on private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodGet, taskPath(s, f.private.ID)+"/comments", u, nil)
+		},
+		want: [5]int{200, 404, 404, 200, 403},
+	},
+	{
+		name: "comment",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, taskPath(s, f.public.ID)+"/comments", u, map[string]string{"description": "me too"})
+		},
+		want: [5]int{201, 201, 201, 201, 403},
+	},
+	{
+		name: "comment on private task",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			return s.request(http.MethodPost, taskPath(s, f.private.ID)+"/comments", u, map[string]string{"description": "me too"})
+		},
+		want: [5]int{201, 404, 404, 201, 403},
+	},
+	{
+		name: "put comment",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			path := fmt.Sprintf("%s/comments/%d", taskPath(s, f.public.ID), f.comment.ID)
+			return s.request(http.MethodPut, path, u, map[string]string{"description": "changed"})
+		},
+		want: [5]int{200, 403, 403, 403, 403},
+	},
+	{
+		name: "delete comment",
+		request: func(s *testServer, f *accessFixture, u string) *http.Request {
+			path := fmt.Sprintf("%s/comments/%d", taskPath(s, f.public.ID), f.comment.ID)
+			return s.request(http.MethodDelete, path, u, nil)
+		},
+		want: [5]int{200, 403, 403, 403, 403},
+	},
+}
+
+func TestAccess(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	s.share("alice", "dave", apis.ViewAndUpdate)
+	s.user("eve")
+
+	for _, c := range accessCases {
+		for i, username := range accessRoles {
+			w := s.do(c.request(s, newAccessFixture(s), username))
+
+			got := w.Code
+			if c.bulk && got == http.StatusOK {
+				resp := &apis.BulkResponse{}
+				if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil || len(resp.Results) != 1 {
+					t.Fatalf("%s as %s: want one result, got %s", c.name, username, w.Body.String())
+				}
+				got = resp.Results[0].Status
+			}
+
+			if got != c.want[i] {
+				t.Errorf("%s as %s: want %d, got %d: %s", c.name, username, c.want[i], got, w.Body.String())
+			}
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/go-logr/logr"
 	"gorm.io/gorm"
 )
@@ -19,17 +23,157 @@ func NewAnnotationController(db *gorm.DB, log logr.Logger) *AnnotationController
 	}
 }
 
+// annotation loads the annotation named in the request path from the task in
+// the request context. It writes the error response and returns nil if it
+// can't.
+func (c *AnnotationController) annotation(w http.ResponseWriter, r *http.Request) *apis.Annotation {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	annotation := &apis.Annotation{}
+	err = c.DB.Where("task_id = ?", task.ID).First(annotation, "id = ?", chi.URLParam(r, "annotationid")).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrNotFound)
+			return nil
+		}
+		http.Error(w, "Unable to retrieve annotation: "+err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	return annotation
+}
+
+// List returns the annotations on a task, oldest first.
 func (c *AnnotationController) List(w http.ResponseWriter, r *http.Request) {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	annotations := []apis.Annotation{}
+	if err := c.DB.Where("task_id = ?", task.ID).Order("created_at, id").Find(&annotations).Error; err != nil {
+		http.Error(w, "error retrieving annotations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, &apis.AnnotationList{Annotations: annotations})
 }
 
 func (c *AnnotationController) Create(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	annotation := &apis.Annotation{}
+	if err := render.Bind(r, annotation); err != nil {
+		http.Error(w, "Unable to decode annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	annotation.ID = 0
+	annotation.TaskID = task.ID
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(annotation).Error; err != nil {
+			return err
+		}
+		if err := touch(tx, task); err != nil {
+			return err
+		}
+		return record(tx, task.ID, access.User.ID, apis.AnnotationAdded, apis.FieldChange{Field: "annotation", After: annotation.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to create annotation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, annotation)
 }
 
 func (c *AnnotationController) Get(w http.ResponseWriter, r *http.Request) {
+	annotation := c.annotation(w, r)
+	if annotation == nil {
+		return
+	}
+
+	render.JSON(w, r, annotation)
 }
 
+// Update changes the text of an annotation.
 func (c *AnnotationController) Update(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	annotation := c.annotation(w, r)
+	if annotation == nil {
+		return
+	}
+
+	req := &apis.Annotation{}
+	if err := render.Bind(r, req); err != nil {
+		http.Error(w, "Unable to decode annotation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before := annotation.Description
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(annotation).Update("description", req.Description).Error; err != nil {
+			return err
+		}
+		if err := touch(tx, &apis.Task{ID: annotation.TaskID}); err != nil {
+			return err
+		}
+		return record(tx, annotation.TaskID, access.User.ID, apis.AnnotationUpdated, apis.FieldChange{Field: "annotation", Before: before, After: annotation.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to update annotation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, annotation)
 }
 
 func (c *AnnotationController) Delete(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	annotation := c.annotation(w, r)
+	if annotation == nil {
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(annotation).Error; err != nil {
+			return err
+		}
+		if err := touch(tx, &apis.Task{ID: annotation.TaskID}); err != nil {
+			return err
+		}
+		return record(tx, annotation.TaskID, access.User.ID, apis.AnnotationDeleted, apis.FieldChange{Field: "annotation", Before: annotation.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to delete annotation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, annotation)
 }
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var errNotAssignable = errors.New("tasks may only be assigned to the owner of the list or users it's shared with")
+
+// assignable limits a user query to the owner of a task list and the users
+// the owner has shared the list with.
+func assignable(db *gorm.DB, ownerId uint) *gorm.DB {
+	delegates := db.Model(&apis.Policy{}).Select("delegate_user_id").Where("owner_user_id = ?", ownerId)
+	return db.Where("users.id = ? OR users.id IN (?)", ownerId, delegates)
+}
+
+// findAssignee loads a user that tasks in the owner's list may be assigned
+// to. It returns errNotAssignable if the user isn't eligible.
+func findAssignee(db *gorm.DB, ownerId, userId uint) (*apis.User, error) {
+	user := &apis.User{}
+	err := assignable(db, ownerId).First(user, "users.id = ?", userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errNotAssignable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// progressOnly is true if the proposed task differs from the original in at
+// most its status, its state, and which checklist items are done.
+func progressOnly(orig, proposed *apis.Task) bool {
+	if orig.Description != proposed.Description ||
+		orig.Priority != proposed.Priority ||
+		orig.Private != proposed.Private ||
+		orig.Recurrence != proposed.Recurrence ||
+		orig.AssigneeId != proposed.AssigneeId ||
+		orig.ParentId != proposed.ParentId ||
+		orig.AutoClose != proposed.AutoClose {
+		return false
+	}
+
+	if len(orig.Checklist) != len(proposed.Checklist) {
+		return false
+	}
+	for i := range orig.Checklist {
+		if orig.Checklist[i].Text != proposed.Checklist[i].Text {
+			return false
+		}
+	}
+
+	if (orig.Due == nil) != (proposed.Due == nil) {
+		return false
+	}
+	if orig.Due != nil && !orig.Due.Equal(*proposed.Due) {
+		return false
+	}
+
+	origTags, proposedTags := apis.TagNames(orig.Tags), apis.TagNames(proposed.Tags)
+	if len(origTags) != len(proposedTags) {
+		return false
+	}
+	sort.Strings(origTags)
+	sort.Strings(proposedTags)
+	for i := range origTags {
+		if origTags[i] != proposedTags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Assignees lists the users that tasks in the requested list may be assigned
+// to.
+func (c *TaskController) Assignees(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	users := []apis.User{}
+	if err := assignable(c.DB, access.Owner.ID).Order("username").Find(&users).Error; err != nil {
+		http.Error(w, "error retrieving assignees: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, &apis.UserList{Users: users})
+}
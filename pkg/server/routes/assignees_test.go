@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func TestAssignees(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	s.share("dave", "eve", apis.View)
+
+	for _, username := range []string{"alice", "bob"} {
+		users := &apis.UserList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "assignees"), username, nil), users)
+		names := make([]string, len(users.Users))
+		for i, u := range users.Users {
+			names[i] = u.Username
+		}
+		if got := strings.Join(names, ","); got != "alice,bob,carol" {
+			t.Errorf("as %s: want alice,bob,carol, got %s", username, got)
+		}
+	}
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, listPath(s, "assignees"), "eve", nil), nil)
+}
+
+func TestNotAssignable(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.share("dave", "eve", apis.View)
+	task := s.createTask("alice", map[string]interface{}{"desc": "task"})
+
+	// eve is someone else's delegate, and 999 isn't anyone
+	for _, id := range []uint{s.user("eve").ID, 999} {
+		resp := &ErrResponse{}
+		body := map[string]interface{}{"desc": "task", "status": apis.Todo, "assignee_id": id}
+		s.expect(http.StatusBadRequest, s.request(http.MethodPost, listPath(s, "tasks"), "alice", body), resp)
+		if resp.ErrorText != errNotAssignable.Error() {
+			t.Errorf("create assigned to %d: want %q, got %q", id, errNotAssignable, resp.ErrorText)
+		}
+
+		resp = &ErrResponse{}
+		s.expect(http.StatusBadRequest, s.patchTask("alice", task.ID, fmt.Sprintf(`{"assignee_id": %d}`, id)), resp)
+		if resp.ErrorText != errNotAssignable.Error() {
+			t.Errorf("assign to %d: want %q, got %q", id, errNotAssignable, resp.ErrorText)
+		}
+	}
+	if got := s.getTask(task.ID); got.AssigneeId != s.user("alice").ID || got.Version != task.Version {
+		t.Errorf("want the task unchanged, got assignee %d at version %d", got.AssigneeId, got.Version)
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, fmt.Sprintf(`{"assignee_id": %d}`, s.user("bob").ID)), nil)
+}
+
+func TestAssigneeProgress(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	bob := s.user("bob")
+	assigned := s.createTask("alice", map[string]interface{}{
+		"desc":        "assigned",
+		"assignee_id": bob.ID,
+		"checklist":   []apis.ChecklistItem{{Text: "one"}, {Text: "two"}},
+	})
+	private := s.createTask("alice", map[string]interface{}{"desc": "private", "assignee_id": bob.ID, "private": true})
+	other := s.createTask("alice", map[string]interface{}{"desc": "other"})
+
+	// bob may move his tasks along but may not change them otherwise
+	s.expect(http.StatusOK, s.patchTask("bob", assigned.ID, `{"status": "doing"}`), nil)
+	s.expect(http.StatusOK, s.patchTask("bob", assigned.ID, `{"checklist": [{"text": "one", "done": true}, {"text": "two"}]}`), nil)
+	s.expect(http.StatusOK, s.patchTask("bob", private.ID, `{"status": "done", "state": "closed"}`), nil)
+
+	forbidden := []string{
+		`{"desc": "changed"}`,
+		`{"status": "done", "desc": "changed"}`,
+		`{"priority": 5}`,
+		`{"checklist": [{"text": "one", "done": true}, {"text": "three"}]}`,
+		fmt.Sprintf(`{"assignee_id": %d}`, s.user("alice").ID),
+	}
+	for _, patch := range forbidden {
+		s.expect(http.StatusForbidden, s.patchTask("bob", assigned.ID, patch), nil)
+	}
+	s.expect(http.StatusForbidden, s.patchTask("bob", other.ID, `{"status": "doing"}`), nil)
+
+	got := s.getTask(assigned.ID)
+	if got.Status != apis.Doing || got.Description != "assigned" || !got.Checklist[0].Done || got.AssigneeId != bob.ID {
+		t.Errorf("want only bob's progress on the task, got %+v", got)
+	}
+	if got := s.getTask(private.ID); got.State != apis.Closed || got.Status != apis.Done {
+		t.Errorf("want the private task closed, got %s and %s", got.State, got.Status)
+	}
+	if got := s.getTask(other.ID); got.Status != apis.Todo {
+		t.Errorf("want the unassigned task unchanged, got %s", got.Status)
+	}
+}
@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/render"
+	"gorm.io/gorm"
+)
+
+var (
+	errTaskNotFound = errors.New("task not found")
+	errForbidden    = errors.New("Forbidden")
+)
+
+// bulk makes a change to each of the tasks in one transaction. Each change
+// gets a savepoint, so one that fails is undone without undoing the others,
+// and the results say which failed and why. Database errors undo everything.
+func bulk(db *gorm.DB, ids []uint, change func(tx *gorm.DB, id uint) (*apis.Task, error)) (*apis.BulkResponse, error) {
+	resp := &apis.BulkResponse{Results: make([]apis.BulkResult, 0, len(ids))}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			var task *apis.Task
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				task, err = change(tx, id)
+				return err
+			})
+
+			result := apis.BulkResult{ID: id, Status: http.StatusOK, Task: task}
+			if err != nil {
+				status := updateStatus(err)
+				if status == http.StatusInternalServerError {
+					return err
+				}
+				result = apis.BulkResult{ID: id, Status: status, Error: err.Error()}
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// loadTask loads a task the authenticated user may see the way TaskCtx does.
+func loadTask(tx *gorm.DB, access *Access, id uint) (*apis.Task, error) {
+	tasks := make([]apis.Task, 1)
+	err := access.Visible(tx).Preload("Tags").Preload("Assignee").First(&tasks[0], "tasks.id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := markComputed(tx, access, tasks); err != nil {
+		return nil, err
+	}
+	return &tasks[0], nil
+}
+
+// BulkUpdate applies one change to many tasks in the list. Each task is
+// changed as if it were updated on its own, so assignees without update
+// access may only change the status and state of their tasks, and blocked
+// tasks can't start or finish unless force is set. The tasks are changed in
+// the order given, and each sees the changes made before it.
+func (c *TaskController) BulkUpdate(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.BulkUpdate{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	resp, err := bulk(c.DB, req.IDs, func(tx *gorm.DB, id uint) (*apis.Task, error) {
+		orig, err := loadTask(tx, access, id)
+		if err != nil {
+			return nil, err
+		}
+		if !access.CanUpdateProgress(orig) {
+			return nil, errForbidden
+		}
+
+		proposed := *orig
+		proposed.Tags = append([]apis.Tag(nil), orig.Tags...)
+		proposed.Checklist = append([]apis.ChecklistItem(nil), orig.Checklist...)
+		req.Apply(&proposed)
+
+		if err := updateTask(tx, access, orig, &proposed, req.Force); err != nil {
+			return nil, err
+		}
+		return &proposed, nil
+	})
+	if err != nil {
+		http.Error(w, "Unable to update tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// BulkDelete moves many tasks in the list to the trash.
+func (c *TaskController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.BulkRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	resp, err := bulk(c.DB, req.IDs, func(tx *gorm.DB, id uint) (*apis.Task, error) {
+		task, err := loadTask(tx, access, id)
+		if err != nil {
+			return nil, err
+		}
+		if !access.CanUpdate(task) {
+			return nil, errForbidden
+		}
+		if err := deleteTask(tx, access, task); err != nil {
+			return nil, err
+		}
+		return task, nil
+	})
+	if err != nil {
+		http.Error(w, "Unable to delete tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// BulkRestore takes many tasks in the list out of the trash. Tasks the
+// authenticated user may not change are left there, and like the other bulk
+// changes each gets its own status.
+func (c *TrashController) BulkRestore(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.BulkRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	resp, err := bulk(c.DB, req.IDs, func(tx *gorm.DB, id uint) (*apis.Task, error) {
+		task := &apis.Task{}
+		if err := trash(tx, access).First(task, "tasks.id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w in the trash", errTaskNotFound)
+			}
+			return nil, err
+		}
+		if !access.CanUpdate(task) {
+			return nil, errForbidden
+		}
+		if err := restoreTask(tx, access, task); err != nil {
+			return nil, err
+		}
+		return task, nil
+	})
+	if err != nil {
+		http.Error(w, "Unable to restore tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, resp)
+}
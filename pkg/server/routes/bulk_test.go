@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// bulkStatuses returns the status of each result of a bulk response
+func bulkStatuses(resp *apis.BulkResponse) []int {
+	statuses := make([]int, len(resp.Results))
+	for i, r := range resp.Results {
+		statuses[i] = r.Status
+	}
+	return statuses
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBulkUpdateSavepoints(t *testing.T) {
+	s := newTestServer(t)
+	first := s.createTask("alice", map[string]interface{}{"desc": "first"})
+	blocked := s.createTask("alice", map[string]interface{}{"desc": "blocked", "priority": 1})
+	last := s.createTask("alice", map[string]interface{}{"desc": "last"})
+	blocker := s.createTask("alice", map[string]interface{}{"desc": "blocker"})
+	s.expect(http.StatusOK, s.block(blocked, blocker), nil)
+	blocked = s.getTask(blocked.ID)
+
+	resp := &apis.BulkResponse{}
+	body := map[string]interface{}{"ids": []uint{first.ID, blocked.ID, last.ID, 999}, "status": apis.Done, "priority": 4}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "tasks/bulk"), "alice", body), resp)
+
+	if got, want := bulkStatuses(resp), []int{200, 409, 200, 404}; !equalInts(got, want) {
+		t.Fatalf("want statuses %v, got %v", want, got)
+	}
+	for _, task := range []*apis.Task{first, last} {
+		if got := s.getTask(task.ID); got.Status != apis.Done || got.Priority != 4 {
+			t.Errorf("task %d: want done with priority 4, got %s and %d", task.ID, got.Status, got.Priority)
+		}
+	}
+
+	// the blocked task is as it was, history and all
+	got := s.getTask(blocked.ID)
+	if got.Status != apis.Todo || got.Priority != 1 || got.Version != blocked.Version {
+		t.Errorf("want the blocked task unchanged, got %s, priority %d, and version %d", got.Status, got.Priority, got.Version)
+	}
+	history := &apis.ChangeList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, blocked.ID)+"/history", "alice", nil), history)
+	for _, c := range history.Changes {
+		if c.Action == apis.TaskCreated {
+			continue
+		}
+		for _, f := range c.Fields {
+			if f.Field == "status" || f.Field == "priority" {
+				t.Errorf("want no history of the failed change, got %+v", c)
+			}
+		}
+	}
+}
+
+func TestBulkDueShift(t *testing.T) {
+	s := newTestServer(t)
+	due := time.Date(2022, 11, 15, 9, 0, 0, 0, time.UTC)
+	dated := s.createTask("alice", map[string]interface{}{"desc": "dated", "due": due})
+	undated := s.createTask("alice", map[string]interface{}{"desc": "undated"})
+
+	resp := &apis.BulkResponse{}
+	body := map[string]interface{}{"ids": []uint{dated.ID, undated.ID}, "due_shift": "-1w"}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "tasks/bulk"), "alice", body), resp)
+
+	if got := s.getTask(dated.ID); got.Due == nil || !got.Due.Equal(due.AddDate(0, 0, -7)) {
+		t.Errorf("want the due date a week earlier, got %v", got.Due)
+	}
+	if got := s.getTask(undated.ID); got.Due != nil {
+		t.Errorf("want no due date, got %s", got.Due)
+	}
+
+	body["due_shift"] = "soon"
+	s.expect(http.StatusBadRequest, s.request(http.MethodPost, listPath(s, "tasks/bulk"), "alice", body), nil)
+}
+
+func TestBulkLimit(t *testing.T) {
+	s := newTestServer(t)
+	task := s.createTask("alice", map[string]interface{}{"desc": "task"})
+
+	ids := make([]uint, apis.MaxBulkTasks+1)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	for _, path := range []string{"tasks/bulk", "tasks/bulk/delete", "trash/bulk/restore"} {
+		body := map[string]interface{}{"ids": ids, "priority": 1}
+		s.expect(http.StatusBadRequest, s.request(http.MethodPost, listPath(s, path), "alice", body), nil)
+		s.expect(http.StatusBadRequest, s.request(http.MethodPost, listPath(s, path), "alice", map[string]interface{}{"ids": []uint{}}), nil)
+	}
+
+	// repeated ids count once
+	same := make([]uint, apis.MaxBulkTasks+1)
+	for i := range same {
+		same[i] = task.ID
+	}
+	resp := &apis.BulkResponse{}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "tasks/bulk"), "alice", map[string]interface{}{"ids": same, "priority": 1}), resp)
+	if len(resp.Results) != 1 {
+		t.Errorf("want one result, got %d", len(resp.Results))
+	}
+}
+
+func TestBulkRestore(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	trashed := s.createTask("alice", map[string]interface{}{"desc": "trashed"})
+	live := s.createTask("alice", map[string]interface{}{"desc": "live"})
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, trashed.ID), "alice", nil), "*"), nil)
+
+	body := map[string]interface{}{"ids": []uint{trashed.ID, live.ID}}
+
+	// a view delegate gets a status for each task rather than one for all
+	resp := &apis.BulkResponse{}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "trash/bulk/restore"), "bob", body), resp)
+	if got, want := bulkStatuses(resp), []int{403, 404}; !equalInts(got, want) {
+		t.Errorf("as bob: want statuses %v, got %v", want, got)
+	}
+
+	resp = &apis.BulkResponse{}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "trash/bulk/restore"), "alice", body), resp)
+	if got, want := bulkStatuses(resp), []int{200, 404}; !equalInts(got, want) {
+		t.Errorf("as alice: want statuses %v, got %v", want, got)
+	}
+	s.getTask(trashed.ID)
+}
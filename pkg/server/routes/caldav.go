@@ -0,0 +1,1143 @@
+package routes
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"github.com/csams/doit/pkg/transfer"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DavPath is where the CalDAV server is mounted. The task lists the
+// authenticated user may see are calendar collections of VTODO resources
+// under DavPath/calendars/{userid}/.
+const DavPath = "/dav"
+
+// davAllow is the methods the CalDAV server supports
+const davAllow = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+
+// davSyncPrefix starts the sync tokens of calendar collections. Sync tokens
+// have to be URIs.
+const davSyncPrefix = "http://doit/ns/sync/"
+
+var (
+	errDavNotFound = errors.New("Not found")
+	errUIDConflict = errors.New("another task in the list has the UID")
+)
+
+type DavController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewDavController(db *gorm.DB, log logr.Logger) *DavController {
+	return &DavController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// davKind is the kind of resource a CalDAV path names
+type davKind int
+
+const (
+	davRootKind davKind = iota
+	davPrincipalKind
+	davHomeKind
+	davCalendarKind
+	davObjectKind
+)
+
+// davResource is the resource a CalDAV request is for
+type davResource struct {
+	kind davKind
+	href string
+
+	// calendar is set for calendars and their objects
+	calendar *davCalendar
+
+	// name is the last segment of an object's path, and task is the task
+	// there. task is nil if there isn't one.
+	name string
+	task *apis.Task
+}
+
+// ServeHTTP handles the CalDAV requests under DavPath. It must be behind the
+// authenticator.
+func (c *DavController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", davAllow)
+		return
+	}
+
+	res, err := c.resolve(user, r.URL.Path)
+	switch {
+	case errors.Is(err, errDavNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Unable to retrieve resource: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		c.propfind(w, r, user, res)
+	case "REPORT":
+		c.report(w, r, res)
+	case http.MethodGet, http.MethodHead:
+		c.get(w, r, res)
+	case http.MethodPut:
+		c.put(w, r, res)
+	case http.MethodDelete:
+		c.delete(w, r, res)
+	default:
+		w.Header().Set("Allow", davAllow)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func principalHref(userId uint) string {
+	return fmt.Sprintf("%s/principals/%d/", DavPath, userId)
+}
+
+func calendarHref(ownerId uint) string {
+	return fmt.Sprintf("%s/calendars/%d/", DavPath, ownerId)
+}
+
+// resolve finds the resource at a path. Users have a principal, and the
+// calendars collection holds a calendar for each task list they may see.
+func (c *DavController) resolve(user *apis.User, path string) (*davResource, error) {
+	var segments []string
+	if rest := strings.Trim(strings.TrimPrefix(path, DavPath), "/"); rest != "" {
+		segments = strings.Split(rest, "/")
+	}
+
+	switch {
+	case len(segments) == 0:
+		return &davResource{kind: davRootKind, href: DavPath + "/"}, nil
+	case segments[0] == "principals" && len(segments) == 2:
+		if segments[1] != strconv.FormatUint(uint64(user.ID), 10) {
+			return nil, errDavNotFound
+		}
+		return &davResource{kind: davPrincipalKind, href: principalHref(user.ID)}, nil
+	case segments[0] == "calendars" && len(segments) == 1:
+		return &davResource{kind: davHomeKind, href: DavPath + "/calendars/"}, nil
+	case segments[0] != "calendars" || len(segments) > 3:
+		return nil, errDavNotFound
+	}
+
+	ownerId, err := strconv.ParseUint(segments[1], 10, 0)
+	if err != nil {
+		return nil, errDavNotFound
+	}
+	owner := &apis.User{}
+	if err := c.DB.First(owner, ownerId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errDavNotFound
+		}
+		return nil, err
+	}
+	access, err := NewAccess(c.DB, user, owner)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return nil, errForbidden
+	}
+	cal, err := loadCalendar(c.DB, access)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &davResource{kind: davCalendarKind, href: cal.href, calendar: cal}
+	if len(segments) == 2 {
+		return res, nil
+	}
+	res.kind = davObjectKind
+	res.name = segments[2]
+	res.href = cal.href + url.PathEscape(res.name)
+	res.task, err = cal.find(c.DB, res.name)
+	return res, err
+}
+
+// davCalendar is the calendar collection of a task list
+type davCalendar struct {
+	access *Access
+	href   string
+
+	// objects are the resource names clients gave tasks by task id, and
+	// byName are the same by name
+	objects map[uint]*apis.CalendarObject
+	byName  map[string]*apis.CalendarObject
+}
+
+func loadCalendar(db *gorm.DB, access *Access) (*davCalendar, error) {
+	var objects []apis.CalendarObject
+	if err := db.Where("owner_id = ?", access.Owner.ID).Find(&objects).Error; err != nil {
+		return nil, err
+	}
+	cal := &davCalendar{
+		access:  access,
+		href:    calendarHref(access.Owner.ID),
+		objects: make(map[uint]*apis.CalendarObject, len(objects)),
+		byName:  make(map[string]*apis.CalendarObject, len(objects)),
+	}
+	for i := range objects {
+		cal.objects[objects[i].TaskId] = &objects[i]
+		cal.byName[objects[i].Name] = &objects[i]
+	}
+	return cal, nil
+}
+
+// name is the name of a task's resource. Tasks a client didn't name are
+// their UUID with an .ics extension.
+func (cal *davCalendar) name(t *apis.Task) string {
+	if o, ok := cal.objects[t.ID]; ok {
+		return o.Name
+	}
+	return t.UUID + apis.ICalExtension
+}
+
+func (cal *davCalendar) taskHref(t *apis.Task) string {
+	return cal.href + url.PathEscape(cal.name(t))
+}
+
+// uid is the UID a task is served with
+func (cal *davCalendar) uid(t *apis.Task) string {
+	if o, ok := cal.objects[t.ID]; ok && o.UID != "" {
+		return o.UID
+	}
+	return t.UUID
+}
+
+// find loads the task at a resource name with its tags and annotations. It
+// returns nil if there isn't one or the authenticated user may not see it, so
+// private tasks look like they aren't there.
+func (cal *davCalendar) find(db *gorm.DB, name string) (*apis.Task, error) {
+	id, err := cal.lookup(db, name)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+
+	tasks, err := cal.tasks(db.Where("tasks.id = ?", id), true)
+	if err != nil || len(tasks) == 0 {
+		return nil, err
+	}
+	return &tasks[0], nil
+}
+
+// lookup returns the id of the task at a resource name whether or not the
+// authenticated user may see it. It returns 0 if the name isn't a task's.
+func (cal *davCalendar) lookup(db *gorm.DB, name string) (uint, error) {
+	if o, ok := cal.byName[name]; ok {
+		return o.TaskId, nil
+	}
+	stem := strings.TrimSuffix(name, apis.ICalExtension)
+	if stem == name {
+		return 0, nil
+	}
+	u, err := apis.ParseUUID(stem)
+	if err != nil {
+		return 0, nil
+	}
+	var ids []uint
+	if err := db.Model(&apis.Task{}).Where("owner_id = ? AND uuid = ?", cal.access.Owner.ID, u).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	// tasks a client named are only at that name
+	if len(ids) == 0 || cal.objects[ids[0]] != nil {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// load lists the tasks of the list that match the query. With data set
+// their tags and annotations are loaded too.
+func (cal *davCalendar) load(db *gorm.DB, data bool) ([]apis.Task, error) {
+	tx := db.Where("tasks.owner_id = ?", cal.access.Owner.ID)
+	if data {
+		tx = tx.Preload("Tags").Preload("Annotations", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		})
+	}
+	var tasks []apis.Task
+	err := tx.Order("tasks.id").Find(&tasks).Error
+	return tasks, err
+}
+
+// tasks lists the tasks of the list the authenticated user may see
+func (cal *davCalendar) tasks(db *gorm.DB, data bool) ([]apis.Task, error) {
+	return cal.load(cal.access.Visible(db), data)
+}
+
+// parents returns the UIDs of the parents of the tasks by parent id. Parents
+// the authenticated user may not see are left out.
+func (cal *davCalendar) parents(db *gorm.DB, tasks []apis.Task) (map[uint]string, error) {
+	var ids []uint
+	for i := range tasks {
+		if tasks[i].ParentId != 0 {
+			ids = append(ids, tasks[i].ParentId)
+		}
+	}
+	uids := make(map[uint]string)
+	if len(ids) == 0 {
+		return uids, nil
+	}
+
+	var parents []apis.Task
+	if err := cal.access.Visible(db).Select("tasks.id", "tasks.uuid").Where("tasks.id IN ?", ids).Find(&parents).Error; err != nil {
+		return nil, err
+	}
+	for i := range parents {
+		uids[parents[i].ID] = cal.uid(&parents[i])
+	}
+	return uids, nil
+}
+
+// parentId is the id of the task in the list a VTODO is RELATED-TO. parent is
+// the UID as a UUID like transfer.VTodo has it. It's 0 if the authenticated
+// user can't see a task with that UID.
+func (cal *davCalendar) parentId(db *gorm.DB, parent string) (uint, error) {
+	if parent == "" {
+		return 0, nil
+	}
+	tx := cal.access.Visible(db).Model(&apis.Task{}).Where("tasks.uuid = ?", parent)
+	for _, o := range cal.objects {
+		if o.UID != "" && uidUUID(o.UID) == parent {
+			tx = cal.access.Visible(db).Model(&apis.Task{}).Where("tasks.id = ?", o.TaskId)
+			break
+		}
+	}
+	var ids []uint
+	if err := tx.Pluck("tasks.id", &ids).Error; err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// uidUUID makes a UID into a UUID the way the iCalendar decoder does
+func uidUUID(uid string) string {
+	if u, err := apis.ParseUUID(uid); err == nil {
+		return u
+	}
+	return apis.NameUUID(uid)
+}
+
+// data is the calendar object resource of a task
+func (cal *davCalendar) data(t *apis.Task, parents map[uint]string) (string, error) {
+	served := *t
+	served.UUID = cal.uid(t)
+	var b strings.Builder
+	err := transfer.EncodeVTodo(&b, &served, parents[t.ParentId])
+	return b.String(), err
+}
+
+// syncToken is the sync token of the calendar. It's the time of the latest
+// change to a task in the list, the highest task id, so tasks created with an
+// earlier UpdatedAt, like imported ones, are still found as changes, and the
+// highest tombstone id. Tombstones keep the times and ids of purged tasks, so
+// none of the three goes down when a task is purged.
+func (cal *davCalendar) syncToken(db *gorm.DB) (string, error) {
+	list := func() *gorm.DB {
+		return db.Unscoped().Model(&apis.Task{}).Where("owner_id = ?", cal.access.Owner.ID)
+	}
+	graves := func() *gorm.DB {
+		return db.Model(&apis.Tombstone{}).Where("owner_id = ?", cal.access.Owner.ID)
+	}
+	var updated, deleted, purged []time.Time
+	var ids, buried, graveIds []uint
+	if err := list().Order("updated_at DESC").Limit(1).Pluck("updated_at", &updated).Error; err != nil {
+		return "", err
+	}
+	if err := list().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Limit(1).Pluck("deleted_at", &deleted).Error; err != nil {
+		return "", err
+	}
+	if err := list().Order("id DESC").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return "", err
+	}
+	if err := graves().Order("purged_at DESC").Limit(1).Pluck("purged_at", &purged).Error; err != nil {
+		return "", err
+	}
+	if err := graves().Order("task_id DESC").Limit(1).Pluck("task_id", &buried).Error; err != nil {
+		return "", err
+	}
+	if err := graves().Order("id DESC").Limit(1).Pluck("id", &graveIds).Error; err != nil {
+		return "", err
+	}
+
+	var latest int64
+	for _, t := range append(append(updated, deleted...), purged...) {
+		if !t.IsZero() && t.UnixNano() > latest {
+			latest = t.UnixNano()
+		}
+	}
+	var last, grave uint
+	for _, id := range append(ids, buried...) {
+		if id > last {
+			last = id
+		}
+	}
+	if len(graveIds) > 0 {
+		grave = graveIds[0]
+	}
+	return fmt.Sprintf("%s%d-%d-%d", davSyncPrefix, latest, last, grave), nil
+}
+
+var errInvalidSyncToken = errors.New("invalid sync token")
+
+// syncPoint is the state of a calendar a sync token names
+type syncPoint struct {
+	// since is the time of the latest change
+	since time.Time
+
+	// last is the highest task id
+	last uint
+
+	// grave is the highest tombstone id. Tokens from before tombstones
+	// don't have one, so every tombstone is new to them.
+	grave uint
+}
+
+func parseSyncToken(token string) (*syncPoint, error) {
+	rest := strings.TrimPrefix(token, davSyncPrefix)
+	parts := strings.Split(rest, "-")
+	if rest == token || len(parts) < 2 || len(parts) > 3 {
+		return nil, errInvalidSyncToken
+	}
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidSyncToken
+	}
+	last, err := strconv.ParseUint(parts[1], 10, 0)
+	if err != nil {
+		return nil, errInvalidSyncToken
+	}
+	// stored times are in UTC, and sqlite compares them as text
+	p := &syncPoint{since: time.Unix(0, n).UTC(), last: uint(last)}
+	if len(parts) == 3 {
+		grave, err := strconv.ParseUint(parts[2], 10, 0)
+		if err != nil {
+			return nil, errInvalidSyncToken
+		}
+		p.grave = uint(grave)
+	}
+	return p, nil
+}
+
+// props are the properties of a collection
+func (c *DavController) props(user *apis.User, res *davResource) ([]davElem, error) {
+	props := []davElem{
+		davNode(davName("current-user-principal"), davHref(principalHref(user.ID))),
+	}
+	home := davNode(calName("calendar-home-set"), davHref(DavPath+"/calendars/"))
+
+	switch res.kind {
+	case davRootKind:
+		props = append(props,
+			davNode(davName("resourcetype"), davNode(davName("collection"))),
+			davText(davName("displayname"), "doit"),
+			home)
+	case davPrincipalKind:
+		props = append(props,
+			davNode(davName("resourcetype"), davNode(davName("principal"))),
+			davText(davName("displayname"), user.Username),
+			davNode(davName("principal-URL"), davHref(principalHref(user.ID))),
+			home)
+	case davHomeKind:
+		props = append(props,
+			davNode(davName("resourcetype"), davNode(davName("collection"))),
+			davText(davName("displayname"), "Task lists"))
+	case davCalendarKind:
+		cal := res.calendar
+		token, err := cal.syncToken(c.DB)
+		if err != nil {
+			return nil, err
+		}
+		reports := make([]davElem, 0, 3)
+		for _, name := range []xml.Name{calName("calendar-query"), calName("calendar-multiget"), davName("sync-collection")} {
+			reports = append(reports, davNode(davName("supported-report"), davNode(davName("report"), davNode(name))))
+		}
+		props = append(props,
+			davNode(davName("resourcetype"), davNode(davName("collection")), davNode(calName("calendar"))),
+			davText(davName("displayname"), "doit: "+cal.access.Owner.Username),
+			davNode(davName("owner"), davHref(principalHref(cal.access.Owner.ID))),
+			davNode(calName("supported-calendar-component-set"), davElem{
+				XMLName: calName("comp"),
+				Attrs:   []xml.Attr{{Name: xml.Name{Local: "name"}, Value: "VTODO"}},
+			}),
+			davNode(davName("supported-report-set"), reports...),
+			privileges(cal.access.CanUpdateList()),
+			davText(davName("sync-token"), token),
+			davText(xml.Name{Space: calServeNS, Local: "getctag"}, token))
+	}
+	return props, nil
+}
+
+// objectProps are the properties of a task's resource. Its calendar data is
+// only encoded if the request asks for it.
+func (c *DavController) objectProps(req *davRequest, cal *davCalendar, t *apis.Task, parents map[uint]string) ([]davElem, error) {
+	props := []davElem{
+		davNode(davName("resourcetype")),
+		davText(davName("getetag"), t.ETag()),
+		davText(davName("getcontenttype"), transfer.ContentType(apis.ICalFormat)+"; component=VTODO"),
+		davText(davName("getlastmodified"), t.UpdatedAt.UTC().Format(http.TimeFormat)),
+		privileges(cal.access.CanUpdate(t)),
+	}
+	if req.wants(calName("calendar-data")) {
+		data, err := cal.data(t, parents)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, davText(calName("calendar-data"), data))
+	}
+	return props, nil
+}
+
+// privileges is the current-user-privilege-set of a calendar or task
+func privileges(write bool) davElem {
+	names := []string{"read"}
+	if write {
+		names = append(names, "write", "write-content", "bind", "unbind")
+	}
+	set := make([]davElem, len(names))
+	for i, n := range names {
+		set[i] = davNode(davName("privilege"), davNode(davName(n)))
+	}
+	return davNode(davName("current-user-privilege-set"), set...)
+}
+
+// objectResponses makes the responses for the tasks of a calendar
+func (c *DavController) objectResponses(req *davRequest, cal *davCalendar, tasks []apis.Task) ([]davResponse, error) {
+	var parents map[uint]string
+	if req.wants(calName("calendar-data")) {
+		var err error
+		if parents, err = cal.parents(c.DB, tasks); err != nil {
+			return nil, err
+		}
+	}
+
+	responses := make([]davResponse, 0, len(tasks))
+	for i := range tasks {
+		props, err := c.objectProps(req, cal, &tasks[i], parents)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, req.response(cal.taskHref(&tasks[i]), props))
+	}
+	return responses, nil
+}
+
+// calendars lists the calendars of the task lists the user may see: theirs
+// and the ones shared with them.
+func (c *DavController) calendars(user *apis.User) ([]*davCalendar, error) {
+	var ownerIds []uint
+	if err := c.DB.Model(&apis.Policy{}).Where("delegate_user_id = ?", user.ID).Order("owner_user_id").Pluck("owner_user_id", &ownerIds).Error; err != nil {
+		return nil, err
+	}
+	owners := []apis.User{*user}
+	if len(ownerIds) > 0 {
+		var shared []apis.User
+		if err := c.DB.Where("id IN ?", ownerIds).Order("id").Find(&shared).Error; err != nil {
+			return nil, err
+		}
+		owners = append(owners, shared...)
+	}
+
+	cals := make([]*davCalendar, 0, len(owners))
+	for i := range owners {
+		access, err := NewAccess(c.DB, user, &owners[i])
+		if err != nil {
+			return nil, err
+		}
+		if access == nil {
+			continue
+		}
+		cal, err := loadCalendar(c.DB, access)
+		if err != nil {
+			return nil, err
+		}
+		cals = append(cals, cal)
+	}
+	return cals, nil
+}
+
+// propfind returns the properties of a resource and, unless the Depth header
+// is 0, of its members.
+func (c *DavController) propfind(w http.ResponseWriter, r *http.Request, user *apis.User, res *davResource) {
+	req, err := readDavRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ms := &davMultistatus{}
+	if res.kind == davObjectKind {
+		if res.task == nil {
+			http.Error(w, errDavNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		if ms.Responses, err = c.objectResponses(req, res.calendar, []apis.Task{*res.task}); err != nil {
+			http.Error(w, "Unable to retrieve properties: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeMultistatus(w, ms)
+		return
+	}
+
+	props, err := c.props(user, res)
+	if err != nil {
+		http.Error(w, "Unable to retrieve properties: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ms.Responses = append(ms.Responses, req.response(res.href, props))
+
+	if r.Header.Get("Depth") != "0" {
+		var members []davResponse
+		switch res.kind {
+		case davRootKind:
+			home := &davResource{kind: davHomeKind, href: DavPath + "/calendars/"}
+			if props, err = c.props(user, home); err == nil {
+				members = append(members, req.response(home.href, props))
+			}
+		case davHomeKind:
+			var cals []*davCalendar
+			cals, err = c.calendars(user)
+			for _, cal := range cals {
+				member := &davResource{kind: davCalendarKind, href: cal.href, calendar: cal}
+				if props, err = c.props(user, member); err != nil {
+					break
+				}
+				members = append(members, req.response(cal.href, props))
+			}
+		case davCalendarKind:
+			var tasks []apis.Task
+			if tasks, err = res.calendar.tasks(c.DB, req.wants(calName("calendar-data"))); err == nil {
+				members, err = c.objectResponses(req, res.calendar, tasks)
+			}
+		}
+		if err != nil {
+			http.Error(w, "Unable to retrieve properties: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ms.Responses = append(ms.Responses, members...)
+	}
+	writeMultistatus(w, ms)
+}
+
+// report handles the calendar-query, calendar-multiget, and sync-collection
+// reports of a calendar.
+func (c *DavController) report(w http.ResponseWriter, r *http.Request, res *davResource) {
+	req, err := readDavRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if res.kind != davCalendarKind {
+		davError(w, http.StatusForbidden, davNode(davName("supported-report")))
+		return
+	}
+
+	var ms *davMultistatus
+	switch req.XMLName {
+	case calName("calendar-query"):
+		ms, err = c.query(req, res.calendar)
+	case calName("calendar-multiget"):
+		ms, err = c.multiget(req, res.calendar)
+	case davName("sync-collection"):
+		ms, err = c.syncCollection(req, res.calendar)
+	default:
+		davError(w, http.StatusForbidden, davNode(davName("supported-report")))
+		return
+	}
+	if errors.Is(err, errInvalidSyncToken) {
+		davError(w, http.StatusForbidden, davNode(davName("valid-sync-token")))
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to run report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMultistatus(w, ms)
+}
+
+// query returns the tasks whose VTODOs pass the filter.
+func (c *DavController) query(req *davRequest, cal *davCalendar) (*davMultistatus, error) {
+	tasks, err := cal.tasks(c.DB, true)
+	if err != nil {
+		return nil, err
+	}
+	matched := tasks[:0]
+	for i := range tasks {
+		if req.Filter.matches(&tasks[i], todoProps(&tasks[i], cal.uid(&tasks[i]))) {
+			matched = append(matched, tasks[i])
+		}
+	}
+	responses, err := c.objectResponses(req, cal, matched)
+	if err != nil {
+		return nil, err
+	}
+	return &davMultistatus{Responses: responses}, nil
+}
+
+// multiget returns the tasks at the hrefs. Hrefs without a task the
+// authenticated user may see are reported as not found.
+func (c *DavController) multiget(req *davRequest, cal *davCalendar) (*davMultistatus, error) {
+	ms := &davMultistatus{}
+	var tasks []apis.Task
+	for _, href := range req.Hrefs {
+		var task *apis.Task
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			name := strings.TrimPrefix(u.Path, cal.href)
+			if name != u.Path && name != "" && !strings.Contains(name, "/") {
+				if task, err = cal.find(c.DB, name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if task == nil {
+			ms.Responses = append(ms.Responses, davResponse{Href: href, Status: davStatus(http.StatusNotFound)})
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+
+	responses, err := c.objectResponses(req, cal, tasks)
+	if err != nil {
+		return nil, err
+	}
+	ms.Responses = append(responses, ms.Responses...)
+	return ms, nil
+}
+
+// syncCollection returns the tasks that changed since the sync token in the
+// request, or all of them without one. Tasks that were deleted or purged or
+// that the authenticated user can no longer see are reported as not found.
+func (c *DavController) syncCollection(req *davRequest, cal *davCalendar) (*davMultistatus, error) {
+	// the token is taken first so changes made while the report runs are
+	// found again next time
+	token, err := cal.syncToken(c.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &davMultistatus{SyncToken: token}
+	data := req.wants(calName("calendar-data"))
+	if req.SyncToken == nil || *req.SyncToken == "" {
+		tasks, err := cal.tasks(c.DB, data)
+		if err != nil {
+			return nil, err
+		}
+		ms.Responses, err = c.objectResponses(req, cal, tasks)
+		return ms, err
+	}
+
+	point, err := parseSyncToken(strings.TrimSpace(*req.SyncToken))
+	if err != nil {
+		return nil, err
+	}
+	var changed []apis.Task
+	err = c.DB.Unscoped().
+		Select("id", "uuid", "owner_id", "assignee_id", "private", "deleted_at").
+		Where("owner_id = ?", cal.access.Owner.ID).
+		Where("updated_at > ? OR deleted_at > ? OR id > ?", point.since, point.since, point.last).
+		Order("id").
+		Find(&changed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var live []uint
+	for i := range changed {
+		t := &changed[i]
+		if t.DeletedAt.Valid || !cal.access.CanView(t) {
+			ms.Responses = append(ms.Responses, davResponse{Href: cal.taskHref(t), Status: davStatus(http.StatusNotFound)})
+			continue
+		}
+		live = append(live, t.ID)
+	}
+
+	// a tombstone's name may have been taken by a task created since
+	var tombstones []apis.Tombstone
+	err = c.DB.Where("owner_id = ? AND id > ?", cal.access.Owner.ID, point.grave).Order("id").Find(&tombstones).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tombstones {
+		if _, ok := cal.byName[t.Name]; !ok {
+			ms.Responses = append(ms.Responses, davResponse{Href: cal.href + url.PathEscape(t.Name), Status: davStatus(http.StatusNotFound)})
+		}
+	}
+
+	if len(live) > 0 {
+		tasks, err := cal.tasks(c.DB.Where("tasks.id IN ?", live), data)
+		if err != nil {
+			return nil, err
+		}
+		responses, err := c.objectResponses(req, cal, tasks)
+		if err != nil {
+			return nil, err
+		}
+		ms.Responses = append(responses, ms.Responses...)
+	}
+	return ms, nil
+}
+
+// get returns the VTODO of a task, or the whole list as one calendar.
+func (c *DavController) get(w http.ResponseWriter, r *http.Request, res *davResource) {
+	var tasks []apis.Task
+	switch {
+	case res.kind == davObjectKind && res.task == nil:
+		http.Error(w, errDavNotFound.Error(), http.StatusNotFound)
+		return
+	case res.kind == davObjectKind:
+		tasks = []apis.Task{*res.task}
+	case res.kind == davCalendarKind:
+		var err error
+		if tasks, err = res.calendar.tasks(c.DB, true); err != nil {
+			http.Error(w, "Unable to retrieve tasks: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cal := res.calendar
+	parents, err := cal.parents(c.DB, tasks)
+	if err != nil {
+		http.Error(w, "Unable to retrieve tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(apis.ICalFormat))
+	if res.kind == davObjectKind {
+		data, err := cal.data(res.task, parents)
+		if err != nil {
+			http.Error(w, "Unable to encode task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", res.task.ETag())
+		w.Header().Set("Last-Modified", res.task.UpdatedAt.UTC().Format(http.TimeFormat))
+		w.Write([]byte(data))
+		return
+	}
+
+	for i := range tasks {
+		tasks[i].UUID = cal.uid(&tasks[i])
+	}
+	archive := &apis.Archive{
+		Version:    apis.ArchiveVersion,
+		Owner:      cal.access.Owner.Username,
+		ExportedAt: time.Now().UTC(),
+		Tasks:      tasks,
+	}
+	if err := transfer.Encode(w, apis.ICalFormat, archive, nil); err != nil {
+		c.Log.Error(err, "calendar failed", "owner", cal.access.Owner.ID)
+	}
+}
+
+// put creates or replaces the task at a resource from the VTODO in the
+// request body. If-Match and If-None-Match keep clients from overwriting
+// changes they haven't seen.
+func (c *DavController) put(w http.ResponseWriter, r *http.Request, res *davResource) {
+	if res.kind != davObjectKind {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	match := r.Header.Get("If-Match")
+	if res.task == nil && match != "" ||
+		res.task != nil && r.Header.Get("If-None-Match") == "*" ||
+		res.task != nil && match != "" && !matchesETag(match, res.task.ETag()) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	todo, err := transfer.DecodeVTodo(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		c.Log.V(1).Info("invalid calendar object", "href", res.href, "error", err.Error())
+		davError(w, http.StatusForbidden, davNode(calName("valid-calendar-data")))
+		return
+	}
+
+	var conflict string
+	status := http.StatusNoContent
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if res.task != nil {
+			return updateDavTask(tx, res.calendar, res.task.ID, todo)
+		}
+		status = http.StatusCreated
+		var err error
+		conflict, err = createDavTask(tx, res.calendar, res.name, todo)
+		return err
+	})
+	switch {
+	case err == nil:
+		w.WriteHeader(status)
+	case errors.Is(err, errUIDConflict):
+		davError(w, http.StatusConflict, davNode(calName("no-uid-conflict"), davHref(conflict)))
+	case updateStatus(err) == http.StatusInternalServerError:
+		http.Error(w, "Unable to store task: "+err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), updateStatus(err))
+	}
+}
+
+// createDavTask adds the task of a VTODO to the list at a resource name. If
+// the name or the UID isn't the task's UUID, they're kept to serve the task
+// back the way the client wrote it. It returns the href of the task that
+// already has the UID if there's a conflict.
+func createDavTask(tx *gorm.DB, cal *davCalendar, name string, todo *transfer.VTodo) (string, error) {
+	access := cal.access
+	if !access.CanUpdateList() {
+		return "", errForbidden
+	}
+
+	// the name of a task the client can't see isn't free, but the task has
+	// to look like it isn't there
+	id, err := cal.lookup(tx, name)
+	if err != nil {
+		return "", err
+	}
+	if id != 0 {
+		var held int64
+		if err := tx.Model(&apis.Task{}).Where("id = ?", id).Count(&held).Error; err != nil {
+			return "", err
+		}
+		if held > 0 {
+			return "", errTaskNotFound
+		}
+	}
+
+	src := &todo.Task
+	var existing []apis.Task
+	err = tx.Unscoped().
+		Select("id", "uuid", "owner_id", "assignee_id", "private", "deleted_at").
+		Where("owner_id = ? AND uuid = ?", access.Owner.ID, src.UUID).
+		Find(&existing).Error
+	if err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		if !existing[0].DeletedAt.Valid && access.CanView(&existing[0]) {
+			return cal.taskHref(&existing[0]), errUIDConflict
+		}
+		// tasks the client can't see keep their UUIDs
+		src.UUID = ""
+	}
+
+	task, err := newImportedTask(access, src, nil)
+	if err != nil {
+		return "", errInvalidTask{err}
+	}
+	// sync tokens find new tasks by when they were stored
+	task.UpdatedAt = time.Time{}
+	if err := davParent(tx, cal, task, todo.Parent); err != nil {
+		return "", err
+	}
+
+	if err := tx.Omit(clause.Associations).Create(task).Error; err != nil {
+		return "", err
+	}
+	if err := replaceTags(tx, task); err != nil {
+		return "", err
+	}
+	if err := startSeries(tx, task); err != nil {
+		return "", err
+	}
+	if err := record(tx, task.ID, access.User.ID, apis.TaskCreated, apis.DiffTasks(&apis.Task{}, task)...); err != nil {
+		return "", err
+	}
+	if _, err := importAnnotations(tx, access, task.ID, src.Annotations); err != nil {
+		return "", err
+	}
+
+	// a name left by a task that was deleted goes to the new one
+	if err := tx.Where("owner_id = ? AND name = ?", access.Owner.ID, name).Delete(&apis.CalendarObject{}).Error; err != nil {
+		return "", err
+	}
+	if name == cal.name(task) && todo.UID == task.UUID {
+		return "", nil
+	}
+	object := &apis.CalendarObject{OwnerId: access.Owner.ID, Name: name, TaskId: task.ID}
+	if todo.UID != task.UUID {
+		object.UID = todo.UID
+	}
+	return "", tx.Create(object).Error
+}
+
+// updateDavTask changes a task to match a VTODO. VTODOs can't hold
+// everything a task can, so fields the VTODO has the same way they'd be
+// written from the task keep their values: a backlog task stays in the
+// backlog when its VTODO still NEEDS-ACTION, and a priority of 10 stays 10
+// while the VTODO's PRIORITY is 1. Annotations are replaced by the
+// paragraphs of the DESCRIPTION, and the task moves under the parent it's
+// RELATED-TO if the list has it.
+func updateDavTask(tx *gorm.DB, cal *davCalendar, id uint, todo *transfer.VTodo) error {
+	access := cal.access
+	orig, err := loadTask(tx, access, id)
+	if err != nil {
+		return err
+	}
+	if !access.CanUpdateProgress(orig) {
+		return errForbidden
+	}
+
+	src := &todo.Task
+	proposed := *orig
+	proposed.Description = src.Description
+	proposed.Due = src.Due
+	proposed.Tags = src.Tags
+	if transfer.ICalPriority(orig.Priority) != transfer.ICalPriority(src.Priority) {
+		proposed.Priority = src.Priority
+	}
+	if transfer.ICalStatus(orig) != transfer.ICalStatus(src) {
+		proposed.State, proposed.Status = src.State, src.Status
+	}
+	if rule, _ := apis.RecurrenceRule(orig.Recurrence); rule != src.Recurrence {
+		proposed.Recurrence = src.Recurrence
+	}
+	if err := davParent(tx, cal, &proposed, todo.Parent); err != nil {
+		return err
+	}
+
+	changed := len(apis.DiffTasks(orig, &proposed)) > 0
+	if changed {
+		// the client has the task the way the user wants it, so it isn't
+		// held up by blockers
+		if err := updateTask(tx, access, orig, &proposed, true); err != nil {
+			return err
+		}
+	}
+
+	noted, err := replaceAnnotations(tx, access, orig, src.Annotations)
+	if err != nil {
+		return err
+	}
+	if noted && !changed {
+		return touch(tx, orig)
+	}
+	return nil
+}
+
+// davParent moves a task under the task with the parent UID. A task stays
+// where it is if the list has no such task or it can't be the parent, since
+// clients can't be told why.
+func davParent(tx *gorm.DB, cal *davCalendar, task *apis.Task, parent string) error {
+	id, err := cal.parentId(tx, parent)
+	if err != nil || id == 0 {
+		return err
+	}
+	orig := task.ParentId
+	task.ParentId = id
+	if err := checkParent(tx, cal.access, task); err != nil {
+		task.ParentId = orig
+		if !errors.Is(err, errInvalidParent) {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceAnnotations makes the annotations of a task the ones given, matched
+// up by their descriptions. It reports whether any changed.
+func replaceAnnotations(tx *gorm.DB, access *Access, task *apis.Task, annotations []apis.Annotation) (bool, error) {
+	var have []apis.Annotation
+	if err := tx.Where("task_id = ?", task.ID).Find(&have).Error; err != nil {
+		return false, err
+	}
+	keep := make(map[string]bool, len(annotations))
+	for _, a := range annotations {
+		keep[a.Description] = true
+	}
+
+	var removed []apis.Annotation
+	for _, a := range have {
+		if !keep[a.Description] {
+			removed = append(removed, a)
+		}
+	}
+	if len(removed) > 0 && !access.CanUpdate(task) {
+		return false, errProgressOnly
+	}
+	for _, a := range removed {
+		if err := tx.Delete(&apis.Annotation{}, a.ID).Error; err != nil {
+			return false, err
+		}
+		if err := record(tx, task.ID, access.User.ID, apis.AnnotationDeleted, apis.FieldChange{Field: "annotation", Before: a.Description}); err != nil {
+			return false, err
+		}
+	}
+
+	if !access.CanUpdate(task) {
+		exists := make(map[string]bool, len(have))
+		for _, a := range have {
+			exists[a.Description] = true
+		}
+		for _, a := range annotations {
+			if !exists[a.Description] {
+				return false, errProgressOnly
+			}
+		}
+		return false, nil
+	}
+	added, err := importAnnotations(tx, access, task.ID, annotations)
+	return added || len(removed) > 0, err
+}
+
+// delete moves the task at a resource to the trash.
+func (c *DavController) delete(w http.ResponseWriter, r *http.Request, res *davResource) {
+	if res.kind != davObjectKind {
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if res.task == nil {
+		http.Error(w, errDavNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && !matchesETag(match, res.task.ETag()) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if !res.calendar.access.CanUpdate(res.task) {
+		http.Error(w, errForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteTask(tx, res.calendar.access, res.task)
+	})
+	if errors.Is(err, errVersionConflict) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to delete task: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+const testVTodo = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:%s\r\nSUMMARY:%s\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+func TestDavPrivateTasks(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.ViewAndUpdate)
+	alice := s.user("alice")
+
+	private := &apis.Task{}
+	body := map[string]interface{}{"desc": "secret", "status": apis.Todo, "private": true}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, listPath(s, "tasks"), "alice", body), private)
+
+	cal := fmt.Sprintf("%s/calendars/%d/", DavPath, alice.ID)
+	href := cal + private.UUID + ".ics"
+
+	s.expect(http.StatusNotFound, s.request(http.MethodGet, href, "bob", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodDelete, href, "bob", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodPut, href, "bob", fmt.Sprintf(testVTodo, "mine", "mine")), nil)
+
+	multiget := fmt.Sprintf(`<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <D:href>%s</D:href>
+</C:calendar-multiget>`, href)
+	w := s.expect(http.StatusMultiStatus, s.request("REPORT", cal, "bob", multiget), nil)
+	if got := w.Body.String(); strings.Contains(got, "secret") || !strings.Contains(got, "404") {
+		t.Errorf("multiget of a private task: want not found, got %s", got)
+	}
+
+	// the owner still has the task where it was
+	w = s.expect(http.StatusOK, s.request(http.MethodGet, href, "alice", nil), nil)
+	if !strings.Contains(w.Body.String(), "SUMMARY:secret") {
+		t.Errorf("want the private task, got %s", w.Body.String())
+	}
+}
+
+func TestDavBasicAuth(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	token := s.accessToken("alice", apis.WriteScope)
+	cal := fmt.Sprintf("%s/calendars/%d/", DavPath, alice.ID)
+	propfind := `<propfind xmlns="DAV:"><prop><getetag/><resourcetype/></prop></propfind>`
+
+	w := s.expect(http.StatusUnauthorized, s.request("PROPFIND", cal, "", propfind), nil)
+	if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Basic ") {
+		t.Errorf("want a basic auth challenge, got %q", got)
+	}
+	s.expect(http.StatusUnauthorized, withBasicAuth(s.request("PROPFIND", cal, "", propfind), "alice", apis.AccessTokenPrefix+"wrong"), nil)
+
+	basic := func(method, path, body string) *http.Request {
+		return withBasicAuth(s.request(method, path, "", body), "alice", token)
+	}
+
+	r := basic("PROPFIND", cal, propfind)
+	r.Header.Set("Depth", "1")
+	w = s.expect(http.StatusMultiStatus, r, nil)
+	if !strings.Contains(w.Body.String(), "calendar") {
+		t.Errorf("want the calendar, got %s", w.Body.String())
+	}
+
+	sync := `<D:sync-collection xmlns:D="DAV:"><D:sync-token>%s</D:sync-token><D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop></D:sync-collection>`
+	w = s.expect(http.StatusMultiStatus, basic("REPORT", cal, fmt.Sprintf(sync, "")), nil)
+	m := regexp.MustCompile(`<sync-token[^>]*>([^<]+)</sync-token>`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("want a sync token, got %s", w.Body.String())
+	}
+
+	r = basic(http.MethodPut, cal+"phone-1.ics", fmt.Sprintf(testVTodo, "phone-1", "From my phone"))
+	r.Header.Set("If-None-Match", "*")
+	s.expect(http.StatusCreated, r, nil)
+
+	w = s.expect(http.StatusMultiStatus, basic("REPORT", cal, fmt.Sprintf(sync, m[1])), nil)
+	if !strings.Contains(w.Body.String(), cal+"phone-1.ics") {
+		t.Errorf("want the new task in the sync, got %s", w.Body.String())
+	}
+
+	// an ID token works as the password too
+	r = withBasicAuth(s.request("PROPFIND", cal, "", propfind), "alice", s.idToken("alice"))
+	r.Header.Set("Depth", "0")
+	s.expect(http.StatusMultiStatus, r, nil)
+}
+
+// syncTokenPattern finds the sync token in a multistatus response
+var syncTokenPattern = regexp.MustCompile(`<sync-token[^>]*>([^<]+)</sync-token>`)
+
+// davSync reports the changes to the calendar since the token as alice. It
+// returns the response and its sync token.
+func (s *testServer) davSync(cal, token string) (string, string) {
+	s.t.Helper()
+	body := fmt.Sprintf(`<D:sync-collection xmlns:D="DAV:"><D:sync-token>%s</D:sync-token><D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop></D:sync-collection>`, token)
+	w := s.expect(http.StatusMultiStatus, s.request("REPORT", cal, "alice", body), nil)
+	m := syncTokenPattern.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		s.t.Fatalf("want a sync token, got %s", w.Body.String())
+	}
+	return w.Body.String(), m[1]
+}
+
+func TestDavSyncPurged(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	cal := fmt.Sprintf("%s/calendars/%d/", DavPath, alice.ID)
+	purge := func(task *apis.Task) {
+		s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, task.ID), "alice", nil), "*"), nil)
+		s.expect(http.StatusOK, s.request(http.MethodDelete, trashPath(s, task.ID), "alice", nil), nil)
+	}
+
+	kept := s.createTask("alice", map[string]interface{}{"desc": "kept"})
+	r := s.request(http.MethodPut, cal+"phone-1.ics", "alice", fmt.Sprintf(testVTodo, "phone-1", "From my phone"))
+	r.Header.Set("If-None-Match", "*")
+	s.expect(http.StatusCreated, r, nil)
+	named := &apis.TaskList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks?sort=-id&limit=1"), "alice", nil), named)
+
+	// the purged task is the latest change and has the highest id
+	_, before := s.davSync(cal, "")
+	purge(&named.Tasks[0])
+
+	body, after := s.davSync(cal, before)
+	if !strings.Contains(body, cal+"phone-1.ics") || !strings.Contains(body, "404") {
+		t.Errorf("want the purged task reported as not found, got %s", body)
+	}
+	if strings.Contains(body, kept.UUID) {
+		t.Errorf("want only the purged task, got %s", body)
+	}
+	b, err := parseSyncToken(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := parseSyncToken(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.since.Before(b.since) || a.last < b.last || a.grave <= b.grave {
+		t.Errorf("want the sync token to go up, got %s after %s", after, before)
+	}
+
+	// a task the client never named is purged from its UUID resource
+	purge(kept)
+	body, _ = s.davSync(cal, after)
+	if !strings.Contains(body, cal+kept.UUID+".ics") || strings.Contains(body, "phone-1") {
+		t.Errorf("want only the second purged task, got %s", body)
+	}
+}
+
+func TestDavSyncZones(t *testing.T) {
+	// the server's zone is west of UTC
+	local := time.Local
+	time.Local = time.FixedZone("-05", -5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	s := newTestServer(t)
+	alice := s.user("alice")
+	cal := fmt.Sprintf("%s/calendars/%d/", DavPath, alice.ID)
+
+	// an import keeps the time the archive says the task was last updated,
+	// here an hour ago east of UTC
+	archive := apis.Archive{
+		Version: apis.ArchiveVersion,
+		Tasks: []apis.Task{{
+			ID:          1,
+			Description: "imported",
+			Status:      apis.Todo,
+			UpdatedAt:   time.Now().Add(-time.Hour).In(time.FixedZone("+05", 5*60*60)),
+		}},
+	}
+	result := &apis.ImportResult{}
+	s.expect(http.StatusOK, s.request(http.MethodPost, listPath(s, "import?format=json"), "alice", archive), result)
+	if len(result.Created) != 1 {
+		t.Fatalf("want one task imported, got %d", len(result.Created))
+	}
+	imported := result.Created[0]
+	created := s.createTask("alice", map[string]interface{}{"desc": "created"})
+
+	_, token := s.davSync(cal, "")
+	if body, _ := s.davSync(cal, token); strings.Contains(body, imported.UUID) || strings.Contains(body, created.UUID) {
+		t.Errorf("want no changes since the last sync, got %s", body)
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", created.ID, `{"priority": 3}`), nil)
+	body, _ := s.davSync(cal, token)
+	if !strings.Contains(body, created.UUID) || strings.Contains(body, imported.UUID) {
+		t.Errorf("want only the updated task, got %s", body)
+	}
+}
@@ -1,10 +1,16 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/go-logr/logr"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CommentController struct {
@@ -19,17 +25,174 @@ func NewCommentController(db *gorm.DB, log logr.Logger) *CommentController {
 	}
 }
 
+// comment loads the comment named in the request path from the task in the
+// request context. It writes the error response and returns nil if it can't.
+func (c *CommentController) comment(w http.ResponseWriter, r *http.Request) *apis.Comment {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	comment := &apis.Comment{}
+	err = c.DB.Preload("Author").
+		Where("task_id = ?", task.ID).
+		First(comment, "id = ?", chi.URLParam(r, "commentid")).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrNotFound)
+			return nil
+		}
+		http.Error(w, "Unable to retrieve comment: "+err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	return comment
+}
+
+// modifiable loads the comment named in the request path and checks that the
+// authenticated user may change it.
+func (c *CommentController) modifiable(w http.ResponseWriter, r *http.Request) *apis.Comment {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+
+	comment := c.comment(w, r)
+	if comment == nil {
+		return nil
+	}
+
+	if !access.CanModifyComment(comment) {
+		http.Error(w, "Only the author or the task owner may change a comment", http.StatusForbidden)
+		return nil
+	}
+	return comment
+}
+
+// List returns the comments on a task, oldest first.
 func (c *CommentController) List(w http.ResponseWriter, r *http.Request) {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comments := []apis.Comment{}
+	if err := c.DB.Preload("Author").Where("task_id = ?", task.ID).Order("created_at, id").Find(&comments).Error; err != nil {
+		http.Error(w, "error retrieving comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, &apis.CommentList{Comments: comments})
 }
 
+// Create adds a comment to a task. Anyone who can see the task may comment on
+// it.
 func (c *CommentController) Create(w http.ResponseWriter, r *http.Request) {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := &apis.Comment{}
+	if err := render.Bind(r, comment); err != nil {
+		http.Error(w, "Unable to decode comment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comment.ID = 0
+	comment.TaskID = task.ID
+	comment.AuthorId = user.ID
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(comment).Error; err != nil {
+			return err
+		}
+		return record(tx, task.ID, user.ID, apis.CommentAdded, apis.FieldChange{Field: "comment", After: comment.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comment.Author = user
+
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, comment)
 }
 
 func (c *CommentController) Get(w http.ResponseWriter, r *http.Request) {
+	comment := c.comment(w, r)
+	if comment == nil {
+		return
+	}
+
+	render.JSON(w, r, comment)
 }
 
+// Update changes the text of a comment.
 func (c *CommentController) Update(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := c.modifiable(w, r)
+	if comment == nil {
+		return
+	}
+
+	req := &apis.Comment{}
+	if err := render.Bind(r, req); err != nil {
+		http.Error(w, "Unable to decode comment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before := comment.Description
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(comment).Omit(clause.Associations).Update("description", req.Description).Error; err != nil {
+			return err
+		}
+		return record(tx, comment.TaskID, access.User.ID, apis.CommentUpdated, apis.FieldChange{Field: "comment", Before: before, After: comment.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, comment)
 }
 
 func (c *CommentController) Delete(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := c.modifiable(w, r)
+	if comment == nil {
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(comment).Error; err != nil {
+			return err
+		}
+		return record(tx, comment.TaskID, access.User.ID, apis.CommentDeleted, apis.FieldChange{Field: "comment", Before: comment.Description})
+	})
+	if err != nil {
+		http.Error(w, "Unable to delete comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, comment)
 }
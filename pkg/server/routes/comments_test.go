@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// checkAuthor fails the test unless the comment has the user as its author
+func (s *testServer) checkAuthor(step string, comment *apis.Comment, username string) {
+	s.t.Helper()
+	id := s.user(username).ID
+	if comment.AuthorId != id || comment.Author == nil || comment.Author.Username != username {
+		s.t.Errorf("%s: want the comment by %s (%d), got author %d and %+v", step, username, id, comment.AuthorId, comment.Author)
+	}
+}
+
+func TestCommentAuthors(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	task := s.createTask("alice", map[string]interface{}{"desc": "task"})
+	comments := taskPath(s, task.ID) + "/comments"
+
+	first := &apis.Comment{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, comments, "alice", map[string]string{"description": "first"}), first)
+	s.checkAuthor("create", first, "alice")
+
+	// the author is whoever is logged in, whatever the request says
+	second := &apis.Comment{}
+	body := map[string]interface{}{"description": "second", "author_id": s.user("alice").ID, "author": map[string]string{"username": "alice"}}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, comments, "bob", body), second)
+	s.checkAuthor("create as bob", second, "bob")
+
+	list := &apis.CommentList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, comments, "bob", nil), list)
+	if len(list.Comments) != 2 {
+		t.Fatalf("want 2 comments, got %d", len(list.Comments))
+	}
+	s.checkAuthor("list", &list.Comments[0], "alice")
+	s.checkAuthor("list", &list.Comments[1], "bob")
+
+	got := &apis.Comment{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, fmt.Sprintf("%s/%d", comments, second.ID), "alice", nil), got)
+	s.checkAuthor("get", got, "bob")
+}
+
+func TestCommentHistory(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	task := s.createTask("alice", map[string]interface{}{"desc": "task"})
+	comments := taskPath(s, task.ID) + "/comments"
+
+	comment := &apis.Comment{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, comments, "bob", map[string]string{"description": "draft"}), comment)
+	path := fmt.Sprintf("%s/%d", comments, comment.ID)
+
+	updated := &apis.Comment{}
+	s.expect(http.StatusOK, s.request(http.MethodPut, path, "bob", map[string]string{"description": "final"}), updated)
+	if updated.Description != "final" {
+		t.Errorf("want the comment to say final, got %q", updated.Description)
+	}
+	s.checkAuthor("update", updated, "bob")
+
+	// only the author and the owner may change a comment
+	s.expect(http.StatusForbidden, s.request(http.MethodPut, path, "carol", map[string]string{"description": "carol's"}), nil)
+	s.expect(http.StatusForbidden, s.request(http.MethodDelete, path, "carol", nil), nil)
+	s.expect(http.StatusOK, s.request(http.MethodPut, path, "alice", map[string]string{"description": "edited"}), nil)
+
+	// editing doesn't change who wrote it
+	got := &apis.Comment{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, path, "carol", nil), got)
+	s.checkAuthor("after alice's edit", got, "bob")
+
+	s.expect(http.StatusOK, s.request(http.MethodDelete, path, "bob", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodGet, path, "bob", nil), nil)
+
+	type entry struct {
+		action apis.Action
+		actor  string
+		field  apis.FieldChange
+	}
+	var entries []entry
+	for _, c := range s.history(task.ID)[1:] {
+		if len(c.Fields) != 1 || c.Actor == nil {
+			t.Fatalf("want one field and an actor in each comment change, got %+v", c)
+		}
+		entries = append(entries, entry{c.Action, c.Actor.Username, c.Fields[0]})
+	}
+	want := []entry{
+		{apis.CommentAdded, "bob", apis.FieldChange{Field: "comment", After: "draft"}},
+		{apis.CommentUpdated, "bob", apis.FieldChange{Field: "comment", Before: "draft", After: "final"}},
+		{apis.CommentUpdated, "alice", apis.FieldChange{Field: "comment", Before: "final", After: "edited"}},
+		{apis.CommentDeleted, "bob", apis.FieldChange{Field: "comment", Before: "edited"}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("want history %+v, got %+v", want, entries)
+	}
+}
@@ -0,0 +1,377 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/transfer"
+)
+
+// Namespaces of the WebDAV and CalDAV elements
+const (
+	davNS      = "DAV:"
+	calDavNS   = "urn:ietf:params:xml:ns:caldav"
+	calServeNS = "http://calendarserver.org/ns/"
+)
+
+// maxDavRequest is the largest PROPFIND or REPORT body the server reads
+const maxDavRequest = 1 << 20
+
+// davTime is the layout of the times in time-range filters
+const davTime = "20060102T150405Z"
+
+func davName(local string) xml.Name {
+	return xml.Name{Space: davNS, Local: local}
+}
+
+func calName(local string) xml.Name {
+	return xml.Name{Space: calDavNS, Local: local}
+}
+
+// davElem is an XML element of a WebDAV request or response, like a property
+type davElem struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []davElem  `xml:",any"`
+}
+
+func davNode(name xml.Name, children ...davElem) davElem {
+	return davElem{XMLName: name, Children: children}
+}
+
+func davText(name xml.Name, text string) davElem {
+	return davElem{XMLName: name, Text: text}
+}
+
+func davHref(href string) davElem {
+	return davText(davName("href"), href)
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"DAV: response"`
+	SyncToken string        `xml:"DAV: sync-token,omitempty"`
+}
+
+// davResponse is the response for one resource. It has either propstats or,
+// for a resource that isn't there, a status.
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat,omitempty"`
+	Status    string        `xml:"DAV: status,omitempty"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type davProp struct {
+	Elems []davElem `xml:",any"`
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// davRequest is the body of a PROPFIND or REPORT request. The name of the
+// root element says which REPORT it is.
+type davRequest struct {
+	XMLName   xml.Name
+	AllProp   *struct{}  `xml:"DAV: allprop"`
+	PropName  *struct{}  `xml:"DAV: propname"`
+	Prop      *davProp   `xml:"DAV: prop"`
+	Filter    *calFilter `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Hrefs     []string   `xml:"DAV: href"`
+	SyncToken *string    `xml:"DAV: sync-token"`
+}
+
+// readDavRequest reads the body of a request. An empty body asks for all
+// properties.
+func readDavRequest(r *http.Request) (*davRequest, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDavRequest))
+	if err != nil {
+		return nil, err
+	}
+	req := &davRequest{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return req, nil
+	}
+	if err := xml.Unmarshal(body, req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return req, nil
+}
+
+// wants is true if the request asks for the property. Asking for all
+// properties doesn't include calendar-data.
+func (req *davRequest) wants(name xml.Name) bool {
+	if req.PropName != nil {
+		return false
+	}
+	if req.Prop == nil {
+		return name != calName("calendar-data")
+	}
+	for _, p := range req.Prop.Elems {
+		if p.XMLName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// response makes the response for a resource with the properties it has,
+// keeping the ones the request asks for. Properties it asks for that the
+// resource doesn't have are reported as not found.
+func (req *davRequest) response(href string, props []davElem) davResponse {
+	resp := davResponse{Href: href}
+	if req.PropName != nil {
+		names := make([]davElem, len(props))
+		for i, p := range props {
+			names[i] = davElem{XMLName: p.XMLName}
+		}
+		resp.Propstats = []davPropstat{{Prop: davProp{names}, Status: davStatus(http.StatusOK)}}
+		return resp
+	}
+
+	var found, missing []davElem
+	if req.Prop == nil {
+		for _, p := range props {
+			if req.wants(p.XMLName) {
+				found = append(found, p)
+			}
+		}
+	} else {
+		have := make(map[xml.Name]davElem, len(props))
+		for _, p := range props {
+			have[p.XMLName] = p
+		}
+		for _, p := range req.Prop.Elems {
+			if v, ok := have[p.XMLName]; ok {
+				found = append(found, v)
+			} else {
+				missing = append(missing, davElem{XMLName: p.XMLName})
+			}
+		}
+	}
+
+	if len(found) > 0 || len(missing) == 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{Prop: davProp{found}, Status: davStatus(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		resp.Propstats = append(resp.Propstats, davPropstat{Prop: davProp{missing}, Status: davStatus(http.StatusNotFound)})
+	}
+	return resp
+}
+
+func writeMultistatus(w http.ResponseWriter, ms *davMultistatus) {
+	body, err := xml.Marshal(ms)
+	if err != nil {
+		http.Error(w, "Unable to encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	w.Write(body)
+}
+
+type davErrorBody struct {
+	XMLName   xml.Name `xml:"DAV: error"`
+	Condition davElem
+}
+
+// davError writes the error response for a request that failed a WebDAV or
+// CalDAV precondition, like CALDAV:valid-calendar-data.
+func davError(w http.ResponseWriter, code int, condition davElem) {
+	body, err := xml.Marshal(davErrorBody{Condition: condition})
+	if err != nil {
+		http.Error(w, "Unable to encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	io.WriteString(w, xml.Header)
+	w.Write(body)
+}
+
+// calFilter is the filter of a calendar-query. Its component filter is for
+// the VCALENDAR, which has a VTODO for each task.
+type calFilter struct {
+	Comp calCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type calCompFilter struct {
+	Name         string          `xml:"name,attr"`
+	IsNotDefined *struct{}       `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *calTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	Props        []calPropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	Comps        []calCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type calPropFilter struct {
+	Name         string        `xml:"name,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TextMatch    *calTextMatch `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+type calTextMatch struct {
+	Collation string `xml:"collation,attr"`
+	Negate    string `xml:"negate-condition,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type calTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// matches is true if the VTODO of a task passes the filter. props are the
+// VTODO's properties from todoProps.
+func (f *calFilter) matches(t *apis.Task, props map[string][]string) bool {
+	if f == nil {
+		return true
+	}
+	if !strings.EqualFold(f.Comp.Name, "VCALENDAR") {
+		return f.Comp.IsNotDefined != nil
+	}
+	if f.Comp.IsNotDefined != nil {
+		return false
+	}
+	for i := range f.Comp.Comps {
+		if !f.Comp.Comps[i].matchesTodo(t, props) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTodo tests a filter of the components in a VCALENDAR. The VTODO is
+// the only one, and it has no components of its own, like alarms.
+func (f *calCompFilter) matchesTodo(t *apis.Task, props map[string][]string) bool {
+	if !strings.EqualFold(f.Name, "VTODO") {
+		return f.IsNotDefined != nil
+	}
+	if f.IsNotDefined != nil {
+		return false
+	}
+	if f.TimeRange != nil && !f.TimeRange.overlaps(t) {
+		return false
+	}
+	for i := range f.Props {
+		if !f.Props[i].matches(props) {
+			return false
+		}
+	}
+	for _, c := range f.Comps {
+		if c.IsNotDefined == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *calPropFilter) matches(props map[string][]string) bool {
+	values, defined := props[strings.ToUpper(f.Name)]
+	if f.IsNotDefined != nil {
+		return !defined
+	}
+	if !defined {
+		return false
+	}
+	if f.TextMatch == nil {
+		return true
+	}
+	for _, v := range values {
+		if f.TextMatch.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches is true if the value has the text as a substring. Matches ignore
+// ASCII case unless the collation is i;octet.
+func (m *calTextMatch) matches(value string) bool {
+	text := m.Value
+	if m.Collation != "i;octet" {
+		value, text = strings.ToLower(value), strings.ToLower(text)
+	}
+	return strings.Contains(value, text) != (m.Negate == "yes")
+}
+
+// overlaps is true if the VTODO of a task overlaps the time range. Tasks have
+// no start date, so the rules of RFC 4791 for VTODOs with just DUE,
+// COMPLETED, and CREATED apply.
+func (tr *calTimeRange) overlaps(t *apis.Task) bool {
+	start, _ := time.Parse(davTime, tr.Start)
+	end, _ := time.Parse(davTime, tr.End)
+	before := func(a, b time.Time, orEqual bool) bool {
+		if a.IsZero() || b.IsZero() {
+			return true
+		}
+		return a.Before(b) || (orEqual && a.Equal(b))
+	}
+
+	if t.Due != nil {
+		return before(start, *t.Due, false) && before(*t.Due, end, true)
+	}
+	completed := transfer.ICalStatus(t) == "COMPLETED" && !t.UpdatedAt.IsZero()
+	switch {
+	case completed && !t.CreatedAt.IsZero():
+		return (before(start, t.CreatedAt, true) || before(start, t.UpdatedAt, true)) &&
+			(before(t.CreatedAt, end, true) || before(t.UpdatedAt, end, true))
+	case completed:
+		return before(start, t.UpdatedAt, true) && before(t.UpdatedAt, end, true)
+	case !t.CreatedAt.IsZero():
+		return before(t.CreatedAt, end, false)
+	}
+	return true
+}
+
+// todoProps are the values of the properties of the VTODO of a task that
+// filters can test, by property name
+func todoProps(t *apis.Task, uid string) map[string][]string {
+	props := map[string][]string{
+		"UID":     {uid},
+		"SUMMARY": {t.Description},
+		"STATUS":  {transfer.ICalStatus(t)},
+	}
+	stamp := func(name string, at time.Time) {
+		if !at.IsZero() {
+			props[name] = []string{at.UTC().Format(davTime)}
+		}
+	}
+	stamp("CREATED", t.CreatedAt)
+	stamp("LAST-MODIFIED", t.UpdatedAt)
+	if t.Due != nil {
+		stamp("DUE", *t.Due)
+	}
+	if props["STATUS"][0] == "COMPLETED" {
+		stamp("COMPLETED", t.UpdatedAt)
+	}
+	if p := transfer.ICalPriority(t.Priority); p != 0 {
+		props["PRIORITY"] = []string{fmt.Sprint(p)}
+	}
+	if names := apis.TagNames(t.Tags); len(names) > 0 {
+		props["CATEGORIES"] = names
+	}
+	if len(t.Annotations) > 0 {
+		notes := make([]string, len(t.Annotations))
+		for i, a := range t.Annotations {
+			notes[i] = a.Description
+		}
+		props["DESCRIPTION"] = []string{strings.Join(notes, "\n\n")}
+	}
+	if t.Recurrence != "" {
+		props["RRULE"] = []string{t.Recurrence}
+	}
+	return props
+}
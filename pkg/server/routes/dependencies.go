@@ -0,0 +1,437 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DependencyController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewDependencyController(db *gorm.DB, log logr.Logger) *DependencyController {
+	return &DependencyController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// blockedTasks selects the ids of the tasks that an unfinished task blocks.
+// It takes the blockedArgs.
+const blockedTasks = `SELECT dependencies.task_id FROM dependencies
+	JOIN tasks AS blockers ON blockers.id = dependencies.blocker_id
+	WHERE blockers.deleted_at IS NULL AND blockers.state = ? AND blockers.status NOT IN ?`
+
+func blockedArgs() []interface{} {
+	return []interface{}{apis.Open, []apis.Status{apis.Done, apis.Abandoned}}
+}
+
+// markBlocked sets Blocked on each of the tasks that an unfinished task
+// blocks.
+func markBlocked(db *gorm.DB, tasks []apis.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+
+	var blocked []uint
+	args := append(blockedArgs(), ids)
+	if err := db.Raw(blockedTasks+" AND dependencies.task_id IN ?", args...).Scan(&blocked).Error; err != nil {
+		return err
+	}
+
+	found := make(map[uint]bool, len(blocked))
+	for _, id := range blocked {
+		found[id] = true
+	}
+	for i := range tasks {
+		tasks[i].Blocked = found[tasks[i].ID]
+	}
+	return nil
+}
+
+// openBlockers returns the ids of the unfinished tasks that block a task.
+func openBlockers(db *gorm.DB, taskId uint) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&apis.Task{}).
+		Joins("JOIN dependencies ON dependencies.blocker_id = tasks.id").
+		Where("dependencies.task_id = ?", taskId).
+		Where("tasks.state = ? AND tasks.status NOT IN ?", blockedArgs()...).
+		Order("tasks.id").
+		Pluck("tasks.id", &ids).Error
+	return ids, err
+}
+
+// errBlocked is returned when a task can't start or finish because other
+// tasks block it. Only the blockers the user may see are named.
+type errBlocked struct {
+	blockers []uint
+	hidden   bool
+}
+
+func (e *errBlocked) Error() string {
+	switch {
+	case len(e.blockers) == 0:
+		return "task is blocked by tasks you can't see"
+	case e.hidden:
+		return fmt.Sprintf("task is blocked by unfinished tasks %s and by tasks you can't see", joinIds(e.blockers))
+	}
+	return fmt.Sprintf("task is blocked by unfinished tasks %s", joinIds(e.blockers))
+}
+
+// checkBlockers returns an errBlocked if the update starts or finishes a task
+// that unfinished tasks block. Every blocker counts, but the error only names
+// the ones the authenticated user may see.
+func checkBlockers(db *gorm.DB, access *Access, orig, proposed *apis.Task) error {
+	if proposed.Status == orig.Status || (proposed.Status != apis.Doing && proposed.Status != apis.Done) {
+		return nil
+	}
+	blockers, err := openBlockers(db, orig.ID)
+	if err != nil {
+		return err
+	}
+	if len(blockers) == 0 {
+		return nil
+	}
+
+	var visible []uint
+	err = access.Visible(db).Model(&apis.Task{}).
+		Where("tasks.id IN ?", blockers).
+		Order("tasks.id").
+		Pluck("tasks.id", &visible).Error
+	if err != nil {
+		return err
+	}
+	return &errBlocked{blockers: visible, hidden: len(visible) < len(blockers)}
+}
+
+func joinIds(ids []uint) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+// listEdges returns every dependency between tasks in the owner's list,
+// including deleted tasks so restoring one can't complete a cycle.
+func listEdges(db *gorm.DB, ownerId uint) ([]apis.Dependency, error) {
+	var deps []apis.Dependency
+	err := db.Model(&apis.Dependency{}).
+		Joins("JOIN tasks ON tasks.id = dependencies.task_id").
+		Where("tasks.owner_id = ?", ownerId).
+		Order("dependencies.task_id, dependencies.blocker_id").
+		Find(&deps).Error
+	return deps, err
+}
+
+// blocks reports whether from is blocked by to, directly or through other
+// tasks.
+func blocks(deps []apis.Dependency, from, to uint) bool {
+	blockers := make(map[uint][]uint)
+	for _, d := range deps {
+		blockers[d.TaskID] = append(blockers[d.TaskID], d.BlockerID)
+	}
+
+	seen := map[uint]bool{from: true}
+	queue := []uint{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			return true
+		}
+		for _, b := range blockers[id] {
+			if !seen[b] {
+				seen[b] = true
+				queue = append(queue, b)
+			}
+		}
+	}
+	return false
+}
+
+// blockerIds returns the sorted ids of the tasks that directly block a task.
+func blockerIds(db *gorm.DB, taskId uint) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&apis.Dependency{}).Where("task_id = ?", taskId).Order("blocker_id").Pluck("blocker_id", &ids).Error
+	return ids, err
+}
+
+// recordBlockers bumps the version of a task after its blockers change and
+// records the change in its history.
+func recordBlockers(tx *gorm.DB, access *Access, task *apis.Task, before []uint) error {
+	after, err := blockerIds(tx, task.ID)
+	if err != nil {
+		return err
+	}
+	if err := touch(tx, task); err != nil {
+		return err
+	}
+	blockers, err := openBlockers(tx, task.ID)
+	if err != nil {
+		return err
+	}
+	task.Blocked = len(blockers) > 0
+
+	b, a := joinIds(before), joinIds(after)
+	if b == a {
+		return nil
+	}
+	return record(tx, task.ID, access.User.ID, apis.TaskUpdated, apis.FieldChange{Field: "blocked_by", Before: b, After: a})
+}
+
+// List returns the tasks that directly block the task in the request context
+// and the tasks it directly blocks.
+func (c *DependencyController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := &apis.DependencyList{BlockedBy: []apis.Task{}, Blocks: []apis.Task{}}
+	err = access.Visible(c.DB).Preload("Tags").Preload("Assignee").
+		Where("tasks.id IN (SELECT blocker_id FROM dependencies WHERE task_id = ?)", task.ID).
+		Order("tasks.id").Find(&list.BlockedBy).Error
+	if err == nil {
+		err = access.Visible(c.DB).Preload("Tags").Preload("Assignee").
+			Where("tasks.id IN (SELECT task_id FROM dependencies WHERE blocker_id = ?)", task.ID).
+			Order("tasks.id").Find(&list.Blocks).Error
+	}
+	if err == nil {
+		err = markBlocked(c.DB, list.BlockedBy)
+	}
+	if err == nil {
+		err = markBlocked(c.DB, list.Blocks)
+	}
+	if err != nil {
+		http.Error(w, "error retrieving dependencies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, list)
+}
+
+// Tree returns the chains of tasks that block the task in the request
+// context and that it blocks. Tasks the authenticated user can't see are
+// left out along with the tasks beyond them.
+func (c *DependencyController) Tree(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deps, err := listEdges(c.DB, access.Owner.ID)
+	if err != nil {
+		http.Error(w, "error retrieving dependencies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]uint, 0, 2*len(deps))
+	for _, d := range deps {
+		ids = append(ids, d.TaskID, d.BlockerID)
+	}
+
+	var tasks []apis.Task
+	if len(ids) > 0 {
+		if err := access.Visible(c.DB).Preload("Tags").Preload("Assignee").Find(&tasks, "tasks.id IN ?", ids).Error; err != nil {
+			http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := markBlocked(c.DB, tasks); err != nil {
+		http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	visible := make(map[uint]*apis.Task, len(tasks))
+	for i := range tasks {
+		visible[tasks[i].ID] = &tasks[i]
+	}
+
+	blockedBy := make(map[uint][]uint)
+	blocking := make(map[uint][]uint)
+	for _, d := range deps {
+		blockedBy[d.TaskID] = append(blockedBy[d.TaskID], d.BlockerID)
+		blocking[d.BlockerID] = append(blocking[d.BlockerID], d.TaskID)
+	}
+
+	tree := &apis.DependencyTree{
+		Task:      *task,
+		BlockedBy: dependencyNodes(visible, blockedBy, task.ID, map[uint]bool{task.ID: true}),
+		Blocks:    dependencyNodes(visible, blocking, task.ID, map[uint]bool{task.ID: true}),
+	}
+	render.JSON(w, r, tree)
+}
+
+// dependencyNodes builds the subtrees of the tasks related to a task by
+// edges. seen holds the tasks already in the tree. A task reached again by
+// another path is a leaf marked Repeated, which keeps the tree the size of
+// the graph and guards against cycles.
+func dependencyNodes(tasks map[uint]*apis.Task, edges map[uint][]uint, id uint, seen map[uint]bool) []apis.DependencyNode {
+	nodes := []apis.DependencyNode{}
+	related := append([]uint(nil), edges[id]...)
+	sort.Slice(related, func(i, j int) bool { return related[i] < related[j] })
+	for _, next := range related {
+		task, ok := tasks[next]
+		if !ok {
+			continue
+		}
+		if seen[next] {
+			nodes = append(nodes, apis.DependencyNode{Task: *task, Children: []apis.DependencyNode{}, Repeated: true})
+			continue
+		}
+		seen[next] = true
+		nodes = append(nodes, apis.DependencyNode{
+			Task:     *task,
+			Children: dependencyNodes(tasks, edges, next, seen),
+		})
+	}
+	return nodes
+}
+
+// Add makes another task in the same list block the task in the request
+// context. Adding a blocker that's already there does nothing, and blockers
+// that would make the tasks wait on each other are rejected.
+func (c *DependencyController) Add(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.DependencyRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if req.BlockerId == task.ID {
+		render.Render(w, r, ErrInvalidRequest(errors.New("a task can't block itself")))
+		return
+	}
+
+	blocker := &apis.Task{}
+	if err := access.Visible(c.DB).Select("tasks.id").First(blocker, "tasks.id = ?", req.BlockerId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("task %d isn't in this list", req.BlockerId)))
+			return
+		}
+		http.Error(w, "Unable to retrieve task: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	errCycle := fmt.Errorf("task %d already waits on task %d", req.BlockerId, task.ID)
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		deps, err := listEdges(tx, access.Owner.ID)
+		if err != nil {
+			return err
+		}
+		if blocks(deps, req.BlockerId, task.ID) {
+			return errCycle
+		}
+
+		before, err := blockerIds(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		dep := &apis.Dependency{TaskID: task.ID, BlockerID: req.BlockerId}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(dep).Error; err != nil {
+			return err
+		}
+		return recordBlockers(tx, access, task, before)
+	})
+	if errors.Is(err, errCycle) {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to add dependency: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", task.ETag())
+	render.JSON(w, r, task)
+}
+
+// Remove stops a task from blocking the task in the request context.
+func (c *DependencyController) Remove(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	blockerId, err := strconv.ParseUint(chi.URLParam(r, "blockerid"), 10, 0)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		before, err := blockerIds(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		res := tx.Where("task_id = ? AND blocker_id = ?", task.ID, blockerId).Delete(&apis.Dependency{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordBlockers(tx, access, task, before)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to remove dependency: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", task.ETag())
+	render.JSON(w, r, task)
+}
@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// block makes the blocker block the task in alice's list
+func (s *testServer) block(task, blocker *apis.Task) *http.Request {
+	return s.request(http.MethodPost, taskPath(s, task.ID)+"/dependencies", "alice", map[string]uint{"blocker_id": blocker.ID})
+}
+
+func TestDependencyCycle(t *testing.T) {
+	s := newTestServer(t)
+	a := s.createTask("alice", map[string]interface{}{"desc": "a"})
+	b := s.createTask("alice", map[string]interface{}{"desc": "b"})
+	c := s.createTask("alice", map[string]interface{}{"desc": "c"})
+
+	s.expect(http.StatusOK, s.block(a, b), nil)
+	s.expect(http.StatusOK, s.block(b, c), nil)
+
+	// adding the same blocker again does nothing
+	s.expect(http.StatusOK, s.block(a, b), nil)
+
+	s.expect(http.StatusBadRequest, s.block(a, a), nil)
+	s.expect(http.StatusBadRequest, s.block(b, a), nil)
+	s.expect(http.StatusBadRequest, s.block(c, a), nil)
+
+	list := &apis.DependencyList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, c.ID)+"/dependencies", "alice", nil), list)
+	if len(list.BlockedBy) != 0 || len(list.Blocks) != 1 || list.Blocks[0].ID != b.ID {
+		t.Errorf("want c to block only b, got %+v", list)
+	}
+}
+
+func TestBlockedStatus(t *testing.T) {
+	s := newTestServer(t)
+	task := s.createTask("alice", map[string]interface{}{"desc": "Paint"})
+	blocker := s.createTask("alice", map[string]interface{}{"desc": "Buy paint"})
+	s.expect(http.StatusOK, s.block(task, blocker), nil)
+
+	w := s.expect(http.StatusConflict, s.patchTask("alice", task.ID, `{"status": "doing"}`), nil)
+	if !strings.Contains(w.Body.String(), fmt.Sprintf("unfinished tasks %d", blocker.ID)) {
+		t.Errorf("want the blocker named, got %s", w.Body.String())
+	}
+	s.expect(http.StatusConflict, s.patchTask("alice", task.ID, `{"status": "done"}`), nil)
+
+	// other changes to a blocked task are fine
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"priority": 2}`), nil)
+
+	r := s.patchTask("alice", task.ID, `{"status": "doing"}`)
+	r.URL.RawQuery = "force=true"
+	s.expect(http.StatusOK, r, nil)
+
+	s.expect(http.StatusOK, s.patchTask("alice", blocker.ID, `{"status": "done"}`), nil)
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "done"}`), nil)
+}
+
+func TestBlockedByHiddenTask(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	task := s.createTask("alice", map[string]interface{}{"desc": "Paint"})
+	blocker := s.createTask("alice", map[string]interface{}{"desc": "Buy paint"})
+	private := s.createTask("alice", map[string]interface{}{"desc": "Hire painters", "private": true})
+	s.expect(http.StatusOK, s.block(task, blocker), nil)
+	s.expect(http.StatusOK, s.block(task, private), nil)
+
+	w := s.expect(http.StatusConflict, s.patchTask("carol", task.ID, `{"status": "doing"}`), nil)
+	want := fmt.Sprintf("unfinished tasks %d and by tasks you can't see", blocker.ID)
+	if got := w.Body.String(); !strings.Contains(got, want) {
+		t.Errorf("want only the visible blocker named, got %s", got)
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", blocker.ID, `{"status": "done"}`), nil)
+	w = s.expect(http.StatusConflict, s.patchTask("carol", task.ID, `{"status": "doing"}`), nil)
+	if got := w.Body.String(); strings.Contains(got, fmt.Sprint(private.ID)) || !strings.Contains(got, "blocked by tasks you can't see") {
+		t.Errorf("want the private blocker left out, got %s", got)
+	}
+}
+
+func TestBlockedFilter(t *testing.T) {
+	s := newTestServer(t)
+	task := s.createTask("alice", map[string]interface{}{"desc": "Paint"})
+	blocker := s.createTask("alice", map[string]interface{}{"desc": "Buy paint"})
+	free := s.createTask("alice", map[string]interface{}{"desc": "Sweep"})
+	s.expect(http.StatusOK, s.block(task, blocker), nil)
+
+	ids := func(query string) []uint {
+		list := &apis.TaskList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks?sort=id&"+query), "alice", nil), list)
+		var ids []uint
+		for _, t := range list.Tasks {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+	if got := ids("blocked=true"); !reflect.DeepEqual(got, []uint{task.ID}) {
+		t.Errorf("blocked=true: want %d, got %v", task.ID, got)
+	}
+	if got := ids("blocked=false"); !reflect.DeepEqual(got, []uint{blocker.ID, free.ID}) {
+		t.Errorf("blocked=false: want %d and %d, got %v", blocker.ID, free.ID, got)
+	}
+
+	// finished blockers don't block
+	s.expect(http.StatusOK, s.patchTask("alice", blocker.ID, `{"status": "abandoned"}`), nil)
+	if got := ids("blocked=true"); len(got) != 0 {
+		t.Errorf("blocked=true after the blocker is abandoned: want none, got %v", got)
+	}
+}
+
+// countNodes counts how many times each task appears in the nodes and
+// returns how many of those are marked repeated.
+func countNodes(t *testing.T, nodes []apis.DependencyNode, counts map[uint]int) (repeated int) {
+	for _, n := range nodes {
+		counts[n.Task.ID]++
+		if n.Repeated {
+			repeated++
+			if len(n.Children) != 0 {
+				t.Errorf("task %d: want a repeated node to be a leaf, got %d children", n.Task.ID, len(n.Children))
+			}
+		}
+		repeated += countNodes(t, n.Children, counts)
+	}
+	return repeated
+}
+
+func TestDependencyTreeDiamonds(t *testing.T) {
+	s := newTestServer(t)
+
+	// a chain of diamonds: each top is blocked by a left and a right task,
+	// which are both blocked by the top of the next diamond
+	const diamonds = 12
+	top := s.createTask("alice", map[string]interface{}{"desc": "top"})
+	root := top
+	for i := 0; i < diamonds; i++ {
+		left := s.createTask("alice", map[string]interface{}{"desc": "left"})
+		right := s.createTask("alice", map[string]interface{}{"desc": "right"})
+		next := s.createTask("alice", map[string]interface{}{"desc": "top"})
+		for _, d := range [][2]*apis.Task{{top, left}, {top, right}, {left, next}, {right, next}} {
+			s.expect(http.StatusOK, s.block(d[0], d[1]), nil)
+		}
+		top = next
+	}
+
+	tree := &apis.DependencyTree{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, root.ID)+"/dependencies/tree", "alice", nil), tree)
+
+	counts := map[uint]int{}
+	repeated := countNodes(t, tree.BlockedBy, counts)
+	if len(counts) != 3*diamonds {
+		t.Errorf("want %d tasks in the tree, got %d", 3*diamonds, len(counts))
+	}
+	if repeated != diamonds {
+		t.Errorf("want %d repeated nodes, got %d", diamonds, repeated)
+	}
+	for id, n := range counts {
+		if n > 2 {
+			t.Errorf("task %d: want at most two nodes, got %d", id, n)
+		}
+	}
+
+	// from the bottom, every task is reached by one path or repeated
+	tree = &apis.DependencyTree{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, top.ID)+"/dependencies/tree", "alice", nil), tree)
+	counts = map[uint]int{}
+	if repeated := countNodes(t, tree.Blocks, counts); len(counts) != 3*diamonds || repeated != diamonds {
+		t.Errorf("want %d tasks and %d repeated nodes, got %d and %d", 3*diamonds, diamonds, len(counts), repeated)
+	}
+}
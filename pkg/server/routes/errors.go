@@ -38,4 +38,26 @@ func ErrRender(err error) render.Renderer {
 	}
 }
 
+func ErrConflict(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Resource already exists.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrBlocked(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Task is blocked.",
+		ErrorText:      err.Error(),
+	}
+}
+
 var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
+
+var ErrPreconditionFailed = &ErrResponse{HTTPStatusCode: 412, StatusText: "Resource has changed."}
+
+var ErrPreconditionRequired = &ErrResponse{HTTPStatusCode: 428, StatusText: "If-Match header is required."}
@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/filter"
+	"github.com/csams/doit/pkg/transfer"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+)
+
+// FeedPath is the path calendar apps fetch a feed from. Feeds are served
+// outside of the authenticator, since the token in the path is the
+// credential.
+const FeedPath = "/feeds"
+
+var errFeedNotFound = errors.New("feed not found")
+
+type FeedController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewFeedController(db *gorm.DB, log logr.Logger) *FeedController {
+	return &FeedController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// List returns the feeds the authenticated user made of the list.
+func (c *FeedController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var feeds []apis.Feed
+	err = c.DB.Where("user_id = ? AND owner_id = ?", access.User.ID, access.Owner.ID).Order("id").Find(&feeds).Error
+	if err != nil {
+		http.Error(w, "error retrieving feeds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, apis.FeedList{Feeds: feeds})
+}
+
+// Create makes a feed of the list, or of one of its saved views the
+// authenticated user may see, and returns it with its URL. The token in the
+// URL isn't kept, so this is the only time it's returned.
+func (c *FeedController) Create(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	feed := &apis.Feed{}
+	if err := render.Bind(r, feed); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	name := access.Owner.Username
+	if feed.ViewId != 0 {
+		view, err := feedView(c.DB, access, feed.ViewId)
+		if errors.Is(err, errFeedNotFound) {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("view %d not found", feed.ViewId)))
+			return
+		}
+		if err != nil {
+			http.Error(w, "Unable to retrieve view: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		name = view.Name
+	}
+	if feed.Name == "" {
+		feed.Name = name
+	}
+
+	token := apis.NewToken()
+	feed.ID = 0
+	feed.UserId = access.User.ID
+	feed.OwnerId = access.Owner.ID
+	feed.TokenHash = apis.HashToken(token)
+	feed.FetchedAt = nil
+	if err := c.DB.Create(feed).Error; err != nil {
+		http.Error(w, "Unable to create feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	feed.URL = FeedPath + "/" + token + transfer.Extension(apis.ICalFormat)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, feed)
+}
+
+// Delete revokes a feed the authenticated user made of the list.
+func (c *FeedController) Delete(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	feed := &apis.Feed{}
+	err = c.DB.First(feed, "id = ? AND user_id = ? AND owner_id = ?", chi.URLParam(r, "feedid"), access.User.ID, access.Owner.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to retrieve feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.DB.Delete(feed).Error; err != nil {
+		http.Error(w, "Unable to delete feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, feed)
+}
+
+// Serve writes the feed whose token is in the request path as an iCalendar
+// file. The feed shows what its user may see of the list right now, so a feed
+// stops working when the list is no longer shared with them.
+func (c *FeedController) Serve(w http.ResponseWriter, r *http.Request) {
+	feed := &apis.Feed{}
+	err := c.DB.First(feed, "token_hash = ?", apis.HashToken(chi.URLParam(r, "token"))).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to retrieve feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	access, err := feedAccess(c.DB, feed)
+	if err != nil {
+		http.Error(w, "Unable to retrieve policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if access == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	tasks, err := feedTasks(c.DB, access, feed)
+	if errors.Is(err, errFeedNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to retrieve tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := c.DB.Model(feed).UpdateColumn("fetched_at", now).Error; err != nil {
+		c.Log.Error(err, "unable to record feed fetch", "feed", feed.ID)
+	}
+
+	archive := &apis.Archive{
+		Version:    apis.ArchiveVersion,
+		Owner:      access.Owner.Username,
+		ExportedAt: now,
+		Tasks:      tasks,
+	}
+	w.Header().Set("Content-Type", transfer.ContentType(apis.ICalFormat))
+	if err := transfer.Encode(w, apis.ICalFormat, archive, nil); err != nil {
+		c.Log.Error(err, "feed failed", "feed", feed.ID)
+	}
+}
+
+// feedAccess is the access the user who made a feed has to its list. It's nil
+// if they no longer have any.
+func feedAccess(db *gorm.DB, feed *apis.Feed) (*Access, error) {
+	var user, owner apis.User
+	if err := db.First(&user, feed.UserId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := db.First(&owner, feed.OwnerId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return NewAccess(db, &user, &owner)
+}
+
+// feedView loads a saved view of the list the way ViewCtx does.
+func feedView(db *gorm.DB, access *Access, viewId uint) (*apis.SavedView, error) {
+	view := &apis.SavedView{}
+	err := db.First(view, "id = ? AND owner_id = ?", viewId, access.Owner.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !access.IsOwner() && !view.Shared) {
+		return nil, errFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// feedTasks lists the tasks of a feed with their tags and annotations. A
+// feed of a view lists what the view does, sorted the same way, and a feed of
+// a list has the tasks with due dates.
+func feedTasks(db *gorm.DB, access *Access, feed *apis.Feed) ([]apis.Task, error) {
+	query := apis.TaskQuery{}
+	if feed.ViewId != 0 {
+		view, err := feedView(db, access, feed.ViewId)
+		if err != nil {
+			return nil, err
+		}
+		if query, err = view.Query(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := db
+	if query.Assignee {
+		if !access.IsOwner() {
+			tx = access.Visible(tx)
+		}
+		tx = tx.Where("tasks.assignee_id = ?", access.User.ID)
+	} else {
+		tx = access.Visible(tx)
+	}
+	if feed.ViewId == 0 {
+		tx = tx.Where("tasks.due IS NOT NULL")
+	}
+
+	if query.Filter != "" {
+		expr, err := filter.Parse(query.Filter, filter.Env{Now: time.Now(), Username: access.User.Username})
+		if err != nil {
+			return nil, err
+		}
+		tx = filter.Where(tx, expr)
+	}
+	tx = orderTasks(filterTasks(tx, &query), sortKeys(&query))
+
+	var tasks []apis.Task
+	err := tx.Preload("Tags").
+		Preload("Annotations", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Find(&tasks).Error
+	return tasks, err
+}
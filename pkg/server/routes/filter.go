@@ -0,0 +1,312 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type columnType int
+
+const (
+	intColumn columnType = iota
+	stringColumn
+	timeColumn
+)
+
+// sortColumn describes how a sort field of apis.TaskQuery maps onto the
+// tasks table.
+type sortColumn struct {
+	column   string
+	typ      columnType
+	nullable bool
+	value    func(t *apis.Task) interface{}
+}
+
+var sortColumns = map[string]sortColumn{
+	"id":          {"tasks.id", intColumn, false, func(t *apis.Task) interface{} { return t.ID }},
+	"created":     {"tasks.created_at", timeColumn, false, func(t *apis.Task) interface{} { return t.CreatedAt }},
+	"updated":     {"tasks.updated_at", timeColumn, false, func(t *apis.Task) interface{} { return t.UpdatedAt }},
+	"due":         {"tasks.due", timeColumn, true, func(t *apis.Task) interface{} { return t.Due }},
+	"priority":    {"tasks.priority", intColumn, false, func(t *apis.Task) interface{} { return t.Priority }},
+	"status":      {"tasks.status", stringColumn, false, func(t *apis.Task) interface{} { return t.Status }},
+	"state":       {"tasks.state", stringColumn, false, func(t *apis.Task) interface{} { return t.State }},
+	"description": {"tasks.description", stringColumn, false, func(t *apis.Task) interface{} { return t.Description }},
+}
+
+// pageToken is the position of the last task on a page. It's serialized as
+// base64 encoded json.
+type pageToken struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// sortKeys returns the requested sort keys with the task id appended as a
+// tie breaker so every task has a unique position.
+func sortKeys(q *apis.TaskQuery) []apis.SortKey {
+	keys := make([]apis.SortKey, 0, len(q.Sort)+1)
+	for _, k := range q.Sort {
+		if k.Field == "id" {
+			return append(keys, k)
+		}
+		keys = append(keys, k)
+	}
+	return append(keys, apis.SortKey{Field: "id"})
+}
+
+func sortString(keys []apis.SortKey) string {
+	strs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		strs = append(strs, k.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// filterTasks adds the filters of the query to a task query.
+func filterTasks(db *gorm.DB, q *apis.TaskQuery) *gorm.DB {
+	if len(q.Statuses) > 0 {
+		db = db.Where("tasks.status IN ?", q.Statuses)
+	}
+	if len(q.States) > 0 {
+		db = db.Where("tasks.state IN ?", q.States)
+	}
+	if q.MinPriority != nil {
+		db = db.Where("tasks.priority >= ?", *q.MinPriority)
+	}
+	if q.MaxPriority != nil {
+		db = db.Where("tasks.priority <= ?", *q.MaxPriority)
+	}
+
+	ranges := []struct {
+		column string
+		op     string
+		t      *time.Time
+	}{
+		{"tasks.due", "<", q.DueBefore},
+		{"tasks.due", ">", q.DueAfter},
+		{"tasks.created_at", "<", q.CreatedBefore},
+		{"tasks.created_at", ">", q.CreatedAfter},
+		{"tasks.updated_at", "<", q.UpdatedBefore},
+		{"tasks.updated_at", ">", q.UpdatedAfter},
+	}
+	for _, r := range ranges {
+		if r.t != nil {
+			// stored times are in UTC, so the bound has to be too
+			db = db.Where(r.column+" "+r.op+" ?", r.t.UTC())
+		}
+	}
+
+	if q.Text != "" {
+		db = db.Where(`LOWER(tasks.description) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(q.Text))+"%")
+	}
+
+	if len(q.TagsAny) > 0 {
+		db = db.Where("tasks.id IN (SELECT task_id FROM tags WHERE name IN ?)", q.TagsAny)
+	}
+	if len(q.TagsAll) > 0 {
+		names := apis.TagNames(apis.NewTags(q.TagsAll...))
+		db = db.Where("tasks.id IN (SELECT task_id FROM tags WHERE name IN ? GROUP BY task_id HAVING COUNT(*) = ?)", names, len(names))
+	}
+	if q.Series != 0 {
+		db = db.Where("tasks.series_id = ?", q.Series)
+	}
+	if q.Parent != nil {
+		db = db.Where("tasks.parent_id = ?", *q.Parent)
+	}
+	if q.Blocked != nil {
+		op := "IN"
+		if !*q.Blocked {
+			op = "NOT IN"
+		}
+		db = db.Where("tasks.id "+op+" ("+blockedTasks+")", blockedArgs()...)
+	}
+	return db
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// pageTasks sorts a task query and limits it to the page requested. Tasks
+// with no due date sort last in either direction.
+func pageTasks(db *gorm.DB, q *apis.TaskQuery) (*gorm.DB, error) {
+	keys := sortKeys(q)
+	db = orderTasks(db, keys)
+
+	if q.PageToken != "" {
+		values, err := decodePageToken(q.PageToken, keys)
+		if err != nil {
+			return nil, err
+		}
+		clause, args := afterClause(keys, values)
+		db = db.Where(clause, args...)
+	}
+
+	// fetch one extra so we know if there's another page
+	return db.Limit(pageSize(q) + 1), nil
+}
+
+// orderTasks sorts a task query by the keys. Nulls sort last.
+func orderTasks(db *gorm.DB, keys []apis.SortKey) *gorm.DB {
+	for _, k := range keys {
+		col := sortColumns[k.Field]
+		if col.nullable {
+			db = db.Order(col.column + " IS NULL")
+		}
+		if k.Desc {
+			db = db.Order(col.column + " DESC")
+		} else {
+			db = db.Order(col.column)
+		}
+	}
+	return db
+}
+
+func pageSize(q *apis.TaskQuery) int {
+	switch {
+	case q.Limit <= 0:
+		return defaultPageSize
+	case q.Limit > maxPageSize:
+		return maxPageSize
+	default:
+		return q.Limit
+	}
+}
+
+// afterClause builds a condition that matches the tasks sorted after the
+// position given by values.
+func afterClause(keys []apis.SortKey, values []interface{}) (string, []interface{}) {
+	var ors []string
+	var args []interface{}
+
+	for i, k := range keys {
+		var ands []string
+		var andArgs []interface{}
+
+		for j := 0; j < i; j++ {
+			col := sortColumns[keys[j].Field]
+			if values[j] == nil {
+				ands = append(ands, col.column+" IS NULL")
+			} else {
+				ands = append(ands, col.column+" = ?")
+				andArgs = append(andArgs, values[j])
+			}
+		}
+
+		col := sortColumns[k.Field]
+		if values[i] == nil {
+			// nulls sort last, so nothing comes after a null in this column
+			continue
+		}
+
+		op := " > ?"
+		if k.Desc {
+			op = " < ?"
+		}
+		cond := col.column + op
+		if col.nullable {
+			cond = "(" + cond + " OR " + col.column + " IS NULL)"
+		}
+		ands = append(ands, cond)
+		andArgs = append(andArgs, values[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		args = append(args, andArgs...)
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func encodePageToken(keys []apis.SortKey, last *apis.Task) (string, error) {
+	tok := pageToken{Sort: sortString(keys)}
+	for _, k := range keys {
+		v, err := json.Marshal(sortColumns[k.Field].value(last))
+		if err != nil {
+			return "", err
+		}
+		tok.Values = append(tok.Values, v)
+	}
+
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+var errBadPageToken = errors.New("invalid page_token")
+
+func decodePageToken(s string, keys []apis.SortKey) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadPageToken
+	}
+
+	var tok pageToken
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, errBadPageToken
+	}
+
+	if tok.Sort != sortString(keys) || len(tok.Values) != len(keys) {
+		return nil, errors.New("page_token doesn't match the requested sort order")
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		col := sortColumns[k.Field]
+		var err error
+		switch col.typ {
+		case intColumn:
+			var v *int64
+			err = json.Unmarshal(tok.Values[i], &v)
+			if v != nil {
+				values[i] = *v
+			}
+		case stringColumn:
+			var v *string
+			err = json.Unmarshal(tok.Values[i], &v)
+			if v != nil {
+				values[i] = *v
+			}
+		case timeColumn:
+			var v *time.Time
+			err = json.Unmarshal(tok.Values[i], &v)
+			if v != nil {
+				values[i] = v.UTC()
+			}
+		}
+		if err != nil {
+			return nil, errBadPageToken
+		}
+		if values[i] == nil && !col.nullable {
+			return nil, errBadPageToken
+		}
+	}
+	return values, nil
+}
+
+// pageResults trims the extra task fetched by pageTasks and builds the token
+// for the next page.
+func pageResults(q *apis.TaskQuery, results []apis.Task) (apis.TaskList, error) {
+	size := pageSize(q)
+	if len(results) <= size {
+		return apis.TaskList{Tasks: results}, nil
+	}
+
+	results = results[:size]
+	tok, err := encodePageToken(sortKeys(q), &results[size-1])
+	if err != nil {
+		return apis.TaskList{}, err
+	}
+	return apis.TaskList{Tasks: results, NextPageToken: tok}, nil
+}
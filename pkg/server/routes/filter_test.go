@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// pageAll lists alice's tasks with the query a page at a time and returns
+// them in the order they came.
+func (s *testServer) pageAll(query url.Values) []apis.Task {
+	s.t.Helper()
+	var tasks []apis.Task
+	for page := 0; ; page++ {
+		if page > 20 {
+			s.t.Fatalf("%s: too many pages", query.Encode())
+		}
+		list := &apis.TaskList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks?"+query.Encode()), "alice", nil), list)
+		tasks = append(tasks, list.Tasks...)
+		if list.NextPageToken == "" {
+			return tasks
+		}
+		query.Set("page_token", list.NextPageToken)
+	}
+}
+
+func TestPageTasks(t *testing.T) {
+	s := newTestServer(t)
+	day := func(d int) *time.Time {
+		t := time.Date(2022, 11, d, 9, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	// ties on every sort field and tasks without a due date at both ends
+	// and in the middle of the creation order
+	for _, f := range []struct {
+		due      *time.Time
+		priority int
+	}{
+		{nil, 1}, {day(3), 2}, {day(1), 2}, {nil, 3}, {day(3), 1},
+		{day(2), 3}, {day(1), 1}, {nil, 2}, {day(3), 3},
+	} {
+		body := map[string]interface{}{"desc": "task", "priority": f.priority}
+		if f.due != nil {
+			body["due"] = f.due
+		}
+		s.createTask("alice", body)
+	}
+
+	for _, sort := range []string{"due", "-due", "priority,-created"} {
+		all := s.pageAll(url.Values{"sort": {sort}, "limit": {"100"}})
+		if len(all) != 9 {
+			t.Fatalf("sort=%s: want 9 tasks on one page, got %d", sort, len(all))
+		}
+
+		paged := s.pageAll(url.Values{"sort": {sort}, "limit": {"2"}})
+		seen := map[uint]int{}
+		for _, task := range paged {
+			seen[task.ID]++
+		}
+		for _, task := range all {
+			if seen[task.ID] != 1 {
+				t.Errorf("sort=%s: want task %d once, got it %d times", sort, task.ID, seen[task.ID])
+			}
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("sort=%s: want %d tasks, got %d", sort, len(all), len(paged))
+		}
+		for i := range all {
+			if paged[i].ID != all[i].ID {
+				t.Errorf("sort=%s: want task %d at %d, got %d", sort, all[i].ID, i, paged[i].ID)
+			}
+		}
+
+		for i := 1; i < len(all); i++ {
+			a, b := all[i-1], all[i]
+			switch sort {
+			case "due", "-due":
+				if a.Due == nil && b.Due != nil {
+					t.Errorf("sort=%s: want tasks without a due date last, got %d before %d", sort, a.ID, b.ID)
+				}
+				if a.Due != nil && b.Due != nil && (sort == "due" && a.Due.After(*b.Due) || sort == "-due" && a.Due.Before(*b.Due)) {
+					t.Errorf("sort=%s: want %d and %d the other way around", sort, a.ID, b.ID)
+				}
+			case "priority,-created":
+				if a.Priority > b.Priority || (a.Priority == b.Priority && a.CreatedAt.Before(b.CreatedAt)) {
+					t.Errorf("sort=%s: want %d and %d the other way around", sort, a.ID, b.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestPageTokenSort(t *testing.T) {
+	s := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		s.createTask("alice", map[string]interface{}{"desc": "task"})
+	}
+
+	list := &apis.TaskList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks?sort=due&limit=2"), "alice", nil), list)
+	if list.NextPageToken == "" {
+		t.Fatal("want a token for the next page")
+	}
+
+	next := url.Values{"limit": {"2"}, "page_token": {list.NextPageToken}}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks?sort=due&"+next.Encode()), "alice", nil), nil)
+	s.expect(http.StatusBadRequest, s.request(http.MethodGet, listPath(s, "tasks?sort=-due&"+next.Encode()), "alice", nil), nil)
+	s.expect(http.StatusBadRequest, s.request(http.MethodGet, listPath(s, "tasks?"+next.Encode()), "alice", nil), nil)
+	s.expect(http.StatusBadRequest, s.request(http.MethodGet, listPath(s, "tasks?sort=due&page_token=garbage"), "alice", nil), nil)
+}
+
+func TestDueOffsets(t *testing.T) {
+	s := newTestServer(t)
+
+	// east is due first though its time of day is later
+	east := s.createTask("alice", map[string]interface{}{"desc": "east", "due": time.Date(2022, 11, 15, 12, 0, 0, 0, time.FixedZone("", 5*60*60))})
+	utc := s.createTask("alice", map[string]interface{}{"desc": "utc", "due": time.Date(2022, 11, 15, 9, 0, 0, 0, time.UTC)})
+
+	ids := func(tasks []apis.Task) []uint {
+		var ids []uint
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	before := s.pageAll(url.Values{"due_before": {"2022-11-15T03:00:00-05:00"}})
+	if got := ids(before); len(got) != 1 || got[0] != east.ID {
+		t.Errorf("want only task %d, due at 07:00 UTC, before 08:00 UTC, got %v", east.ID, got)
+	}
+
+	paged := s.pageAll(url.Values{"sort": {"due"}, "limit": {"1"}})
+	if got := ids(paged); len(got) != 2 || got[0] != east.ID || got[1] != utc.ID {
+		t.Errorf("want tasks %d and %d in order of their due times, got %v", east.ID, utc.ID, got)
+	}
+}
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+)
+
+type HistoryController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewHistoryController(db *gorm.DB, log logr.Logger) *HistoryController {
+	return &HistoryController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// record appends an entry to the history of a task. Callers that change the
+// task in a transaction should record the change in the same one.
+func record(db *gorm.DB, taskId, actorId uint, action apis.Action, fields ...apis.FieldChange) error {
+	change := &apis.Change{
+		TaskID:  taskId,
+		ActorId: actorId,
+		Action:  action,
+		Fields:  fields,
+	}
+	if change.Fields == nil {
+		change.Fields = []apis.FieldChange{}
+	}
+	return db.Create(change).Error
+}
+
+// List returns the history of a task, oldest first.
+func (c *HistoryController) List(w http.ResponseWriter, r *http.Request) {
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	changes := []apis.Change{}
+	if err := c.DB.Preload("Actor").Where("task_id = ?", task.ID).Order("created_at, id").Find(&changes).Error; err != nil {
+		http.Error(w, "error retrieving history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, &apis.ChangeList{Changes: changes})
+}
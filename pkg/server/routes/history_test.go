@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// history returns the history of a task in alice's list as alice
+func (s *testServer) history(id uint) []apis.Change {
+	s.t.Helper()
+	changes := &apis.ChangeList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, id)+"/history", "alice", nil), changes)
+	return changes.Changes
+}
+
+// describe summarizes a change as its action, its actor, and the names of the
+// fields it changed
+func describe(c apis.Change) string {
+	fields := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		fields[i] = f.Field
+	}
+	actor := ""
+	if c.Actor != nil {
+		actor = c.Actor.Username
+	}
+	return fmt.Sprintf("%s by %s: %s", c.Action, actor, strings.Join(fields, ","))
+}
+
+func TestHistory(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.ViewAndUpdate)
+
+	task := s.createTask("alice", map[string]interface{}{"desc": "write the report", "priority": 2, "tags": []string{"work"}})
+
+	// bob sends the whole task back with only the status changed
+	s.expect(http.StatusOK, s.patchTask("bob", task.ID, `{"desc": "write the report", "priority": 2, "status": "doing", "tags": ["work"]}`), nil)
+
+	// a patch that changes nothing isn't recorded
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "doing"}`), nil)
+
+	s.expect(http.StatusCreated, s.request(http.MethodPost, taskPath(s, task.ID)+"/comments", "alice", map[string]string{"description": "started"}), nil)
+	s.expect(http.StatusCreated, s.request(http.MethodPost, taskPath(s, task.ID)+"/annotations", "bob", map[string]string{"description": "see the wiki"}), nil)
+	s.expect(http.StatusOK, s.request(http.MethodPost, taskPath(s, task.ID)+"/tags", "alice", map[string]interface{}{"tags": []string{"q4"}}), nil)
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, task.ID), "alice", nil), "*"), nil)
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodPost, trashPath(s, task.ID)+"/restore", "bob", nil), "*"), nil)
+
+	changes := s.history(task.ID)
+	got := make([]string, len(changes))
+	for i, c := range changes {
+		got[i] = describe(c)
+	}
+	want := []string{
+		"created by alice: desc,priority,state,status,assignee,tags",
+		"updated by bob: status",
+		"comment_added by alice: comment",
+		"annotation_added by bob: annotation",
+		"updated by alice: tags",
+		"deleted by alice: ",
+		"restored by bob: ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want history\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	fields := [][]apis.FieldChange{
+		1: {{Field: "status", Before: "todo", After: "doing"}},
+		2: {{Field: "comment", After: "started"}},
+		3: {{Field: "annotation", After: "see the wiki"}},
+		4: {{Field: "tags", Before: "work", After: "q4,work"}},
+	}
+	for i, f := range fields {
+		if f != nil && !reflect.DeepEqual(changes[i].Fields, f) {
+			t.Errorf("%s: want %+v, got %+v", changes[i].Action, f, changes[i].Fields)
+		}
+	}
+	for i := 1; i < len(changes); i++ {
+		if changes[i].CreatedAt.Before(changes[i-1].CreatedAt) {
+			t.Errorf("want the history oldest first, got %s before %s", changes[i-1].Action, changes[i].Action)
+		}
+	}
+}
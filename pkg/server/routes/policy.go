@@ -1,11 +1,14 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/csams/doit/pkg/apis"
 	"github.com/csams/doit/pkg/auth"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/go-logr/logr"
 	"gorm.io/gorm"
 )
@@ -22,52 +25,289 @@ func NewPolicyController(db *gorm.DB, log logr.Logger) *PolicyController {
 	}
 }
 
-func (c *PolicyController) ListSharedWith(w http.ResponseWriter, r *http.Request) {
+// shares builds a query that returns policies along with the usernames of
+// their owners and delegates.
+func (c *PolicyController) shares() *gorm.DB {
+	return c.DB.Model(&apis.Policy{}).
+		Select("policies.*, owners.username AS owner_username, delegates.username AS delegate_username").
+		Joins("JOIN users owners ON owners.id = policies.owner_user_id").
+		Joins("JOIN users delegates ON delegates.id = policies.delegate_user_id")
+}
+
+func (c *PolicyController) getShare(ownerId, delegateId uint) (*apis.Share, error) {
+	var results []apis.Share
+	err := c.shares().
+		Where("policies.owner_user_id = ? AND policies.delegate_user_id = ?", ownerId, delegateId).
+		Limit(1).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &results[0], nil
+}
+
+// self returns the authenticated user if they're the user named in the
+// request path. Otherwise it writes an error and returns nil.
+func self(w http.ResponseWriter, r *http.Request) *apis.User {
 	u, err := auth.UserFromContext(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
 	}
 
 	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
 
 	if err != nil {
 		http.Error(w, "invalid userid", http.StatusBadRequest)
-		return
+		return nil
 	}
 
 	if u.ID != uint(userId) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+	return u
+}
+
+func delegateId(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	delegateId, err := strconv.Atoi(chi.URLParam(r, "delegateid"))
+	if err != nil {
+		http.Error(w, "invalid delegateid", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(delegateId), true
+}
+
+// ListSharedWith returns the users with whom the user has shared their task
+// list.
+func (c *PolicyController) ListSharedWith(w http.ResponseWriter, r *http.Request) {
+	u := self(w, r)
+	if u == nil {
+		return
+	}
+
+	var results []apis.Share
+	if err := c.shares().Where("policies.owner_user_id = ?", u.ID).Scan(&results).Error; err != nil {
+		http.Error(w, "error retrieving shares: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	render.JSON(w, r, apis.ShareList{Shares: results})
 }
 
+// ListSharedFrom returns the users that have shared their task lists with
+// the user.
 func (c *PolicyController) ListSharedFrom(w http.ResponseWriter, r *http.Request) {
-}
+	u := self(w, r)
+	if u == nil {
+		return
+	}
 
-func (c *PolicyController) Get(w http.ResponseWriter, r *http.Request) {
+	var results []apis.Share
+	if err := c.shares().Where("policies.delegate_user_id = ?", u.ID).Scan(&results).Error; err != nil {
+		http.Error(w, "error retrieving shares: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, apis.ShareList{Shares: results})
 }
 
-func (c *PolicyController) Create(w http.ResponseWriter, r *http.Request) {
+// Get returns the policy between the owner in the path and the delegate. Both
+// the owner and the delegate may see it.
+func (c *PolicyController) Get(w http.ResponseWriter, r *http.Request) {
 	u, err := auth.UserFromContext(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
-
+	owner, err := UserFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
+	delegateId, ok := delegateId(w, r)
+	if !ok {
+		return
+	}
+
+	if u.ID != owner.ID && u.ID != delegateId {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
+
+	share, err := c.getShare(owner.ID, delegateId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		http.Error(w, "Unable to retrieve share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, share)
 }
 
+// Create grants the user named in the request access to the task list of the
+// authenticated user.
+func (c *PolicyController) Create(w http.ResponseWriter, r *http.Request) {
+	u := self(w, r)
+	if u == nil {
+		return
+	}
+
+	req := &apis.ShareRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	delegate := &apis.User{}
+	if err := c.DB.Where("username = ?", req.Username).First(delegate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		http.Error(w, "Unable to retrieve user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if delegate.ID == u.ID {
+		render.Render(w, r, ErrInvalidRequest(errors.New("can't share a task list with its owner")))
+		return
+	}
+
+	// a revoked policy is soft deleted, so bring it back instead of creating
+	// a new row with the same primary key
+	policy := &apis.Policy{}
+	err := c.DB.Unscoped().Where("owner_user_id = ? AND delegate_user_id = ?", u.ID, delegate.ID).First(policy).Error
+	switch {
+	case err == nil && !policy.DeletedAt.Valid:
+		render.Render(w, r, ErrConflict(errors.New("task list is already shared with "+delegate.Username)))
+		return
+	case err == nil:
+		err = c.DB.Unscoped().Model(policy).Updates(map[string]interface{}{"mode": req.Mode, "deleted_at": nil}).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		policy = &apis.Policy{OwnerUserId: u.ID, DelegateUserId: delegate.ID, Mode: req.Mode}
+		err = c.DB.Create(policy).Error
+	}
+
+	if err != nil {
+		http.Error(w, "Unable to create share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	share, err := c.getShare(u.ID, delegate.ID)
+	if err != nil {
+		http.Error(w, "Unable to retrieve share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, share)
+}
+
+// Update changes the mode of an existing policy. The username in the request
+// is ignored in favor of the delegate in the path.
 func (c *PolicyController) Update(w http.ResponseWriter, r *http.Request) {
+	u := self(w, r)
+	if u == nil {
+		return
+	}
+
+	delegateId, ok := delegateId(w, r)
+	if !ok {
+		return
+	}
+
+	req := &apis.ShareRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	res := c.DB.Model(&apis.Policy{}).
+		Where("owner_user_id = ? AND delegate_user_id = ?", u.ID, delegateId).
+		Update("mode", req.Mode)
+	if res.Error != nil {
+		http.Error(w, "Unable to update share: "+res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if res.RowsAffected == 0 {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	share, err := c.getShare(u.ID, delegateId)
+	if err != nil {
+		http.Error(w, "Unable to retrieve share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, share)
 }
 
+// Delete revokes the delegate's access to the authenticated user's task list.
 func (c *PolicyController) Delete(w http.ResponseWriter, r *http.Request) {
+	u := self(w, r)
+	if u == nil {
+		return
+	}
+
+	delegateId, ok := delegateId(w, r)
+	if !ok {
+		return
+	}
+
+	share, err := c.getShare(u.ID, delegateId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		http.Error(w, "Unable to retrieve share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the delegate can't reach tasks assigned to them anymore, so give them
+	// back to the owner
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&share.Policy).Error; err != nil {
+			return err
+		}
+		// deleted tasks too, so they don't come back out of the trash
+		// assigned to someone who can't see them
+		var taskIds []uint
+		err := tx.Unscoped().Model(&apis.Task{}).
+			Where("owner_id = ? AND assignee_id = ?", u.ID, delegateId).
+			Pluck("id", &taskIds).Error
+		if err != nil || len(taskIds) == 0 {
+			return err
+		}
+		err = tx.Unscoped().Model(&apis.Task{}).
+			Where("id IN ?", taskIds).
+			Updates(map[string]interface{}{"assignee_id": u.ID, "version": gorm.Expr("version + 1")}).Error
+		if err != nil {
+			return err
+		}
+		change := apis.FieldChange{Field: "assignee", Before: share.DelegateUsername, After: u.Username}
+		for _, id := range taskIds {
+			if err := record(tx, id, u.ID, apis.TaskUpdated, change); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Unable to delete share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, share)
 }
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func sharesPath(s *testServer, rest string) string {
+	return fmt.Sprintf("/users/%d/shares%s", s.user("alice").ID, rest)
+}
+
+func TestShare(t *testing.T) {
+	s := newTestServer(t)
+	bob := s.user("bob")
+	s.user("carol")
+
+	share := &apis.Share{}
+	body := map[string]interface{}{"username": "bob", "mode": apis.View}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, sharesPath(s, ""), "alice", body), share)
+	if share.DelegateUsername != "bob" || share.OwnerUsername != "alice" || share.Mode != apis.View {
+		t.Errorf("want alice's list shared with bob, got %+v", share)
+	}
+
+	s.expect(http.StatusConflict, s.request(http.MethodPost, sharesPath(s, ""), "alice", body), nil)
+	s.expect(http.StatusBadRequest, s.request(http.MethodPost, sharesPath(s, ""), "alice", map[string]interface{}{"username": "alice", "mode": apis.View}), nil)
+	s.expect(http.StatusBadRequest, s.request(http.MethodPost, sharesPath(s, ""), "alice", map[string]interface{}{"username": "carol", "mode": "admin"}), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodPost, sharesPath(s, ""), "alice", map[string]interface{}{"username": "dave", "mode": apis.View}), nil)
+	s.expect(http.StatusForbidden, s.request(http.MethodPost, sharesPath(s, ""), "bob", map[string]interface{}{"username": "carol", "mode": apis.View}), nil)
+
+	delegate := fmt.Sprintf("/%d", bob.ID)
+	s.expect(http.StatusOK, s.request(http.MethodGet, sharesPath(s, delegate), "bob", nil), nil)
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, sharesPath(s, delegate), "carol", nil), nil)
+
+	share = &apis.Share{}
+	s.expect(http.StatusOK, s.request(http.MethodPut, sharesPath(s, delegate), "alice", map[string]interface{}{"mode": apis.ViewAndUpdate}), share)
+	if share.Mode != apis.ViewAndUpdate {
+		t.Errorf("want mode %s, got %s", apis.ViewAndUpdate, share.Mode)
+	}
+	s.expect(http.StatusNotFound, s.request(http.MethodPut, sharesPath(s, fmt.Sprintf("/%d", s.user("carol").ID)), "alice", map[string]interface{}{"mode": apis.View}), nil)
+
+	s.expect(http.StatusOK, s.request(http.MethodDelete, sharesPath(s, delegate), "alice", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodGet, sharesPath(s, delegate), "alice", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodDelete, sharesPath(s, delegate), "alice", nil), nil)
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, listPath(s, "tasks"), "bob", nil), nil)
+
+	// sharing again revives the revoked policy with the new mode
+	share = &apis.Share{}
+	body["mode"] = apis.ViewAndUpdate
+	s.expect(http.StatusCreated, s.request(http.MethodPost, sharesPath(s, ""), "alice", body), share)
+	if share.Mode != apis.ViewAndUpdate {
+		t.Errorf("want mode %s, got %s", apis.ViewAndUpdate, share.Mode)
+	}
+	shares := &apis.ShareList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, sharesPath(s, "/with"), "alice", nil), shares)
+	if len(shares.Shares) != 1 || shares.Shares[0].DelegateUsername != "bob" {
+		t.Errorf("want one share with bob, got %+v", shares.Shares)
+	}
+	shares = &apis.ShareList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, fmt.Sprintf("/users/%d/shares/from", bob.ID), "bob", nil), shares)
+	if len(shares.Shares) != 1 || shares.Shares[0].OwnerUsername != "alice" {
+		t.Errorf("want one share from alice, got %+v", shares.Shares)
+	}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tasks"), "bob", nil), nil)
+	s.expect(http.StatusConflict, s.request(http.MethodPost, sharesPath(s, ""), "alice", body), nil)
+}
+
+func TestRevokeShare(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.ViewAndUpdate)
+	bob := s.user("bob")
+
+	assigned := s.createTask("alice", map[string]interface{}{"desc": "assigned", "assignee_id": bob.ID})
+	trashed := s.createTask("alice", map[string]interface{}{"desc": "trashed", "assignee_id": bob.ID})
+	own := s.createTask("alice", map[string]interface{}{"desc": "own"})
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, trashed.ID), "alice", nil), "*"), nil)
+
+	tasks := []*apis.Task{assigned, trashed, own}
+	versions := make([]uint, len(tasks))
+	for i, task := range tasks {
+		if err := s.DB.Unscoped().First(task, task.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		versions[i] = task.Version
+	}
+
+	s.expect(http.StatusOK, s.request(http.MethodDelete, sharesPath(s, fmt.Sprintf("/%d", bob.ID)), "alice", nil), nil)
+
+	for i, task := range tasks {
+		got := &apis.Task{}
+		if err := s.DB.Unscoped().First(got, task.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		want, assignee := versions[i]+1, s.user("alice").ID
+		if task == own {
+			want = versions[i]
+		}
+		if got.AssigneeId != assignee || got.Version != want {
+			t.Errorf("%s: want assignee %d at version %d, got %d at %d", task.Description, assignee, want, got.AssigneeId, got.Version)
+		}
+	}
+
+	// a trashed task comes back out of the trash assigned to alice
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodPost, trashPath(s, trashed.ID)+"/restore", "alice", nil), "*"), nil)
+	if got := s.getTask(trashed.ID); got.AssigneeId != s.user("alice").ID {
+		t.Errorf("want the restored task assigned to alice, got %d", got.AssigneeId)
+	}
+
+	for _, task := range []*apis.Task{assigned, trashed} {
+		history := &apis.ChangeList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, task.ID)+"/history", "alice", nil), history)
+		found := false
+		for _, c := range history.Changes {
+			for _, f := range c.Fields {
+				if c.Action == apis.TaskUpdated && f.Field == "assignee" && f.Before == "bob" && f.After == "alice" && c.ActorId == s.user("alice").ID {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: want a change of assignee from bob to alice by alice, got %+v", task.Description, history.Changes)
+		}
+	}
+}
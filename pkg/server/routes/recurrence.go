@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/csams/doit/pkg/apis"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// startSeries makes a task that was just made recurring the first task of its
+// series.
+func startSeries(tx *gorm.DB, task *apis.Task) error {
+	if task.Recurrence == "" || task.SeriesId != 0 {
+		return nil
+	}
+	if err := tx.Model(&apis.Task{ID: task.ID}).Update("series_id", task.ID).Error; err != nil {
+		return err
+	}
+	task.SeriesId = task.ID
+	return nil
+}
+
+// completed reports whether an update finished a recurring task, so the next
+// task in its series is due.
+func completed(orig, proposed *apis.Task) bool {
+	return proposed.Recurrence != "" && orig.Status != apis.Done && proposed.Status == apis.Done
+}
+
+// nextInstance creates the task that follows a recurring task in its series.
+// The new task keeps the description, tags, priority, privacy, assignee,
+// recurrence, parent, and checklist, with the checklist items unchecked, and
+// it's due at the next occurrence after the completed one. It returns nil if
+// the recurrence has ended or the next task already exists.
+func nextInstance(tx *gorm.DB, actorId uint, done *apis.Task) (*apis.Task, error) {
+	start := *done.Due
+	if done.SeriesId != done.ID {
+		first := &apis.Task{}
+		err := tx.Unscoped().Select("id", "due").First(first, done.SeriesId).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && first.Due != nil {
+			start = *first.Due
+		}
+	}
+
+	due, err := apis.NextDue(done.Recurrence, start, *done.Due)
+	if err != nil || due == nil {
+		return nil, err
+	}
+
+	// completing a task again after reopening it shouldn't start another one
+	var existing int64
+	if err := tx.Model(&apis.Task{}).Where("series_id = ? AND due >= ?", done.SeriesId, *due).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	next := &apis.Task{
+		Version:     1,
+		OwnerId:     done.OwnerId,
+		AssigneeId:  done.AssigneeId,
+		Assignee:    done.Assignee,
+		Description: done.Description,
+		Due:         due,
+		Priority:    done.Priority,
+		Private:     done.Private,
+		State:       apis.Open,
+		Status:      apis.Todo,
+		Recurrence:  done.Recurrence,
+		SeriesId:    done.SeriesId,
+		Tags:        apis.NewTags(apis.TagNames(done.Tags)...),
+		ParentId:    done.ParentId,
+		AutoClose:   done.AutoClose,
+	}
+	for _, item := range done.Checklist {
+		next.Checklist = append(next.Checklist, apis.ChecklistItem{Text: item.Text})
+	}
+	if err := tx.Omit(clause.Associations).Create(next).Error; err != nil {
+		return nil, err
+	}
+	if err := replaceTags(tx, next); err != nil {
+		return nil, err
+	}
+	if err := record(tx, next.ID, actorId, apis.TaskCreated, apis.DiffTasks(&apis.Task{}, next)...); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// series lists the tasks in a series in alice's list, oldest first
+func (s *testServer) series(id uint) []apis.Task {
+	s.t.Helper()
+	list := &apis.TaskList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, fmt.Sprintf("tasks?series=%d&sort=id", id)), "alice", nil), list)
+	return list.Tasks
+}
+
+func TestRecurringTask(t *testing.T) {
+	s := newTestServer(t)
+	due := time.Date(2022, 11, 15, 9, 0, 0, 0, time.UTC)
+	task := s.createTask("alice", map[string]interface{}{
+		"desc":       "Water the plants",
+		"due":        due,
+		"recurrence": "every 3 days",
+		"priority":   2,
+		"tags":       []string{"home"},
+		"checklist":  []map[string]interface{}{{"text": "ferns", "done": true}},
+	})
+	if task.SeriesId != task.ID {
+		t.Fatalf("want the task to start its series, got series %d", task.SeriesId)
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "done", "state": "closed"}`), nil)
+	tasks := s.series(task.ID)
+	if len(tasks) != 2 {
+		t.Fatalf("want the next task created, got %d tasks", len(tasks))
+	}
+	next := tasks[1]
+	if !next.Due.Equal(due.AddDate(0, 0, 3)) || next.Status != apis.Todo || next.State != apis.Open {
+		t.Errorf("want an open task due %s, got %s, %s, and %s", due.AddDate(0, 0, 3), next.Due, next.Status, next.State)
+	}
+	if next.Priority != 2 || len(next.Tags) != 1 || next.Tags[0].Name != "home" {
+		t.Errorf("want the priority and tags kept, got %d and %v", next.Priority, next.Tags)
+	}
+	if len(next.Checklist) != 1 || next.Checklist[0].Done {
+		t.Errorf("want the checklist unchecked, got %v", next.Checklist)
+	}
+
+	// reopening and completing the task again doesn't start another one
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "todo", "state": "open"}`), nil)
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "done", "state": "closed"}`), nil)
+	if tasks := s.series(task.ID); len(tasks) != 2 {
+		t.Errorf("want two tasks in the series, got %d", len(tasks))
+	}
+
+	// the next one continues the series
+	s.expect(http.StatusOK, s.patchTask("alice", next.ID, `{"status": "done", "state": "closed"}`), nil)
+	tasks = s.series(task.ID)
+	if len(tasks) != 3 || !tasks[2].Due.Equal(due.AddDate(0, 0, 6)) {
+		t.Errorf("want a third task due %s, got %d tasks", due.AddDate(0, 0, 6), len(tasks))
+	}
+}
+
+func TestRecurrenceEnds(t *testing.T) {
+	s := newTestServer(t)
+	due := time.Date(2022, 11, 15, 9, 0, 0, 0, time.UTC)
+	task := s.createTask("alice", map[string]interface{}{"desc": "Take pills", "due": due, "recurrence": "FREQ=DAILY;COUNT=2"})
+
+	s.expect(http.StatusOK, s.patchTask("alice", task.ID, `{"status": "done", "state": "closed"}`), nil)
+	tasks := s.series(task.ID)
+	if len(tasks) != 2 {
+		t.Fatalf("want the second task created, got %d tasks", len(tasks))
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", tasks[1].ID, `{"status": "done", "state": "closed"}`), nil)
+	if tasks := s.series(task.ID); len(tasks) != 2 {
+		t.Errorf("want the series to end after two tasks, got %d", len(tasks))
+	}
+
+	s.expect(http.StatusBadRequest, s.patchTask("alice", task.ID, `{"recurrence": "fortnightly"}`), nil)
+}
@@ -8,6 +8,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"github.com/csams/doit/pkg/apis"
 	"github.com/csams/doit/pkg/auth"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -17,13 +18,16 @@ import (
 
 // NewHandler sets up all of the routes for the site
 func NewHandler(db *gorm.DB, authProvider *auth.TokenProvider, clientId string, log logr.Logger) http.Handler {
+	// CalDAV clients use WebDAV methods
+	chi.RegisterMethod("PROPFIND")
+	chi.RegisterMethod("REPORT")
+
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Heartbeat("/ping"))
 	r.Use(middleware.URLFormat)
 	r.Use(middleware.Recoverer)
-	r.Use(auth.Authenticator(db, authProvider, clientId))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
 	meController := NewMeController(db, log.WithName("meController"))
@@ -32,55 +36,140 @@ func NewHandler(db *gorm.DB, authProvider *auth.TokenProvider, clientId string,
 	commentController := NewCommentController(db, log.WithName("commentController"))
 	annotationController := NewAnnotationController(db, log.WithName("annotationController"))
 	policyController := NewPolicyController(db, log.WithName("policyController"))
+	tagController := NewTagController(db, log.WithName("tagController"))
+	historyController := NewHistoryController(db, log.WithName("historyController"))
+	trashController := NewTrashController(db, log.WithName("trashController"))
+	dependencyController := NewDependencyController(db, log.WithName("dependencyController"))
+	searchController := NewSearchController(db, log.WithName("searchController"))
+	viewController := NewViewController(db, log.WithName("viewController"))
+	transferController := NewTransferController(db, log.WithName("transferController"))
+	feedController := NewFeedController(db, log.WithName("feedController"))
+	davController := NewDavController(db, log.WithName("davController"))
+	tokenController := NewTokenController(db, log.WithName("tokenController"))
 
-	r.Route("/me", func(r chi.Router) {
-		r.Get("/", meController.Get)
-	})
+	// calendar apps can't log in, so feeds are fetched by the token in their
+	// path
+	r.Get(FeedPath+"/{token}", feedController.Serve)
+	r.Handle("/.well-known/caldav", http.RedirectHandler(DavPath+"/", http.StatusMovedPermanently))
 
-	r.Route("/users", func(r chi.Router) {
-		r.Post("/", userController.Create)
-		r.Route("/{userid}", func(r chi.Router) {
-			r.Use(userController.UserCtx)
-			r.Get("/", userController.Get)
-			r.Put("/", userController.Update)
-			r.Delete("/", userController.Delete)
-
-			r.Route("/shares", func(r chi.Router) {
-				r.Get("/with", policyController.ListSharedWith)
-				r.Get("/from", policyController.ListSharedFrom)
-				r.Post("/", policyController.Create)
-				r.Route("/{delegateid}", func(r chi.Router) {
-					r.Get("/", policyController.Get)
-					r.Put("/", taskController.Update)
-					r.Delete("/", taskController.Delete)
-				})
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Authenticator(db, authProvider, clientId))
+		r.Use(RequireMethodScope)
+
+		r.Route("/me", func(r chi.Router) {
+			r.Get("/", meController.Get)
+
+			r.Route("/tokens", func(r chi.Router) {
+				r.Get("/", tokenController.List)
+				r.With(RequireScope(apis.AdminScope)).Post("/", tokenController.Create)
+				r.With(RequireScope(apis.AdminScope)).Delete("/{tokenid}", tokenController.Delete)
 			})
+		})
 
-			r.Route("/tasks", func(r chi.Router) {
-				r.Get("/", taskController.List)
-				r.Post("/", taskController.Create)
-				r.Route("/{taskid}", func(r chi.Router) {
-					r.Get("/", taskController.Get)
-					r.Put("/", taskController.Update)
-					r.Delete("/", taskController.Delete)
-
-					r.Route("/comments", func(r chi.Router) {
-						r.Get("/", commentController.List)
-						r.Post("/", commentController.Create)
-						r.Route("/{commentid}", func(r chi.Router) {
-							r.Get("/", commentController.Get)
-							r.Put("/", commentController.Update)
-							r.Delete("/", commentController.Delete)
-						})
+		r.Get("/search", searchController.Search)
+
+		r.Handle(DavPath, davController)
+		r.Handle(DavPath+"/*", davController)
+
+		r.Route("/users", func(r chi.Router) {
+			r.With(RequireScope(apis.AdminScope)).Post("/", userController.Create)
+			r.Route("/{userid}", func(r chi.Router) {
+				r.Use(userController.UserCtx)
+				r.Get("/", userController.Get)
+				r.With(RequireScope(apis.AdminScope)).Put("/", userController.Update)
+				r.With(RequireScope(apis.AdminScope)).Delete("/", userController.Delete)
+
+				r.Route("/shares", func(r chi.Router) {
+					r.Get("/with", policyController.ListSharedWith)
+					r.Get("/from", policyController.ListSharedFrom)
+					r.With(RequireScope(apis.AdminScope)).Post("/", policyController.Create)
+					r.Route("/{delegateid}", func(r chi.Router) {
+						r.Get("/", policyController.Get)
+						r.With(RequireScope(apis.AdminScope)).Put("/", policyController.Update)
+						r.With(RequireScope(apis.AdminScope)).Delete("/", policyController.Delete)
 					})
+				})
+
+				r.With(AccessCtx(db)).Get("/tags", tagController.List)
+				r.With(AccessCtx(db)).Get("/assignees", taskController.Assignees)
+				r.With(AccessCtx(db)).Get("/export", transferController.Export)
+				r.With(AccessCtx(db), RequireUpdate).Post("/import", transferController.Import)
+
+				r.Route("/feeds", func(r chi.Router) {
+					r.Use(AccessCtx(db))
+					r.Get("/", feedController.List)
+					r.Post("/", feedController.Create)
+					r.Delete("/{feedid}", feedController.Delete)
+				})
+
+				r.Route("/views", func(r chi.Router) {
+					r.Use(AccessCtx(db))
+					r.Get("/", viewController.List)
+					r.With(RequireOwner).Post("/", viewController.Create)
+					r.Route("/{viewid}", func(r chi.Router) {
+						r.Use(viewController.ViewCtx)
+						r.Get("/", viewController.Get)
+						r.With(RequireOwner).Put("/", viewController.Update)
+						r.With(RequireOwner).Delete("/", viewController.Delete)
+					})
+				})
+
+				r.Route("/trash", func(r chi.Router) {
+					r.Use(AccessCtx(db))
+					r.Get("/", trashController.List)
+					r.Post("/bulk/restore", trashController.BulkRestore)
+					r.Route("/{taskid}", func(r chi.Router) {
+						r.Use(trashController.TrashCtx)
+						r.Get("/", trashController.Get)
+						r.With(RequireUpdate).Post("/restore", trashController.Restore)
+						r.With(RequireUpdate).Delete("/", trashController.Purge)
+					})
+				})
+
+				r.Route("/tasks", func(r chi.Router) {
+					r.Use(AccessCtx(db))
+					r.Get("/", taskController.List)
+					r.With(RequireUpdate).Post("/", taskController.Create)
+					r.Post("/bulk", taskController.BulkUpdate)
+					r.Post("/bulk/delete", taskController.BulkDelete)
+					r.Route("/{taskid}", func(r chi.Router) {
+						r.Use(taskController.TaskCtx)
+						r.Get("/", taskController.Get)
+						r.With(RequireProgressUpdate).Put("/", taskController.Update)
+						r.With(RequireProgressUpdate).Patch("/", taskController.Patch)
+						r.With(RequireUpdate).Delete("/", taskController.Delete)
+						r.Get("/history", historyController.List)
+
+						r.Route("/tags", func(r chi.Router) {
+							r.With(RequireUpdate).Post("/", tagController.Add)
+							r.With(RequireUpdate).Delete("/{tag}", tagController.Remove)
+						})
+
+						r.Route("/dependencies", func(r chi.Router) {
+							r.Get("/", dependencyController.List)
+							r.Get("/tree", dependencyController.Tree)
+							r.With(RequireUpdate).Post("/", dependencyController.Add)
+							r.With(RequireUpdate).Delete("/{blockerid}", dependencyController.Remove)
+						})
+
+						r.Route("/comments", func(r chi.Router) {
+							r.Get("/", commentController.List)
+							r.Post("/", commentController.Create)
+							r.Route("/{commentid}", func(r chi.Router) {
+								r.Get("/", commentController.Get)
+								r.Put("/", commentController.Update)
+								r.Delete("/", commentController.Delete)
+							})
+						})
 
-					r.Route("/annotations", func(r chi.Router) {
-						r.Get("/", annotationController.List)
-						r.Post("/", annotationController.Create)
-						r.Route("/{annotationid}", func(r chi.Router) {
-							r.Get("/", annotationController.Get)
-							r.Put("/", annotationController.Update)
-							r.Delete("/", annotationController.Delete)
+						r.Route("/annotations", func(r chi.Router) {
+							r.Get("/", annotationController.List)
+							r.With(RequireUpdate).Post("/", annotationController.Create)
+							r.Route("/{annotationid}", func(r chi.Router) {
+								r.Get("/", annotationController.Get)
+								r.With(RequireUpdate).Put("/", annotationController.Update)
+								r.With(RequireUpdate).Delete("/", annotationController.Delete)
+							})
 						})
 					})
 				})
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"github.com/csams/doit/pkg/storage"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+
+	// snippetWords is about how many words a snippet has
+	snippetWords = 16
+)
+
+type SearchController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewSearchController(db *gorm.DB, log logr.Logger) *SearchController {
+	return &SearchController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// searchRow is a match before its task is loaded
+type searchRow struct {
+	Kind    string
+	ID      uint
+	TaskID  uint
+	Score   float64
+	Snippet string
+}
+
+// searchVisible limits a query joined with tasks to the tasks the user may
+// see in their own list and in the lists shared with them. It follows
+// Access.Visible.
+func searchVisible(db *gorm.DB, user *apis.User) *gorm.DB {
+	shared := db.Session(&gorm.Session{NewDB: true}).Model(&apis.Policy{}).
+		Select("owner_user_id").
+		Where("delegate_user_id = ?", user.ID)
+	return db.Where("(tasks.owner_id = ? OR (tasks.owner_id IN (?) AND (tasks.private = ? OR tasks.assignee_id = ?)))",
+		user.ID, shared, false, user.ID)
+}
+
+// Search finds the tasks, comments, and annotations that match the words in
+// the query, best matches first.
+func (c *SearchController) Search(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query, err := apis.ParseSearchQuery(r.URL.Query())
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultSearchResults
+	}
+	if limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+
+	var rows []searchRow
+	switch {
+	case c.DB.Dialector.Name() == "postgres":
+		rows, err = searchPostgres(c.DB, u, query.Terms(), limit)
+	case c.DB.Dialector.Name() == "sqlite" && storage.HasSearchIndex(c.DB):
+		rows, err = searchSqlite(c.DB, u, query.Terms(), limit)
+	default:
+		rows, err = searchSubstrings(c.DB, u, query.Terms(), limit)
+	}
+	if err != nil {
+		http.Error(w, "error searching: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results, err := searchResults(c.DB, u, rows)
+	if err != nil {
+		http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, &apis.SearchResults{Results: results})
+}
+
+// searchSqlite matches the FTS5 index. Each term is quoted so punctuation
+// and FTS5 keywords in it are taken literally, and the last term matches as
+// a prefix.
+func searchSqlite(db *gorm.DB, user *apis.User, terms []string, limit int) ([]searchRow, error) {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	match := strings.Join(quoted, " ") + "*"
+
+	index := storage.SearchIndex
+	var rows []searchRow
+	err := searchVisible(db.Table(index), user).
+		Select(fmt.Sprintf("%[1]s.kind AS kind, %[1]s.row_id AS id, %[1]s.task_id AS task_id, -bm25(%[1]s) AS score, snippet(%[1]s, 3, ?, ?, '…', ?) AS snippet", index),
+			apis.HighlightStart, apis.HighlightEnd, snippetWords).
+		Joins(fmt.Sprintf("JOIN tasks ON tasks.id = %s.task_id AND tasks.deleted_at IS NULL", index)).
+		Where(index+" MATCH ?", match).
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// searchPostgres matches the tsvector columns of each searchable table and
+// ranks the matches with ts_rank.
+func searchPostgres(db *gorm.DB, user *apis.User, terms []string, limit int) ([]searchRow, error) {
+	tsquery := strings.Join(terms, " & ") + ":*"
+	headline := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, FragmentDelimiter=…",
+		apis.HighlightStart, apis.HighlightEnd, snippetWords, snippetWords/2)
+
+	parts := make([]interface{}, 0, len(storage.SearchSources))
+	for _, s := range storage.SearchSources {
+		part := db.Session(&gorm.Session{NewDB: true}).Table(s.Table).
+			Select(fmt.Sprintf("'%[2]s' AS kind, %[1]s.id AS id, %[1]s.%[3]s AS task_id, ts_rank(%[1]s.search_vector, query) AS score, ts_headline('english', %[1]s.description, query, ?) AS snippet",
+				s.Table, s.Kind, s.TaskColumn), headline)
+		if s.Table != "tasks" {
+			part = part.Joins(fmt.Sprintf("JOIN tasks ON tasks.id = %s.%s", s.Table, s.TaskColumn)).
+				Where(s.Table + ".deleted_at IS NULL")
+		}
+		part = part.Joins("CROSS JOIN to_tsquery('english', ?) query", tsquery).
+			Where(s.Table + ".search_vector @@ query").
+			Where("tasks.deleted_at IS NULL")
+		parts = append(parts, searchVisible(part, user))
+	}
+
+	union := strings.TrimSuffix(strings.Repeat("? UNION ALL ", len(parts)), " UNION ALL ")
+	var rows []searchRow
+	err := db.Raw(union+" ORDER BY score DESC LIMIT ?", append(parts, limit)...).Scan(&rows).Error
+	return rows, err
+}
+
+// searchSubstrings is the fallback for sqlite built without FTS5. It matches
+// descriptions that contain every term, newest tasks first, and highlights
+// the terms itself.
+func searchSubstrings(db *gorm.DB, user *apis.User, terms []string, limit int) ([]searchRow, error) {
+	parts := make([]interface{}, 0, len(storage.SearchSources))
+	for _, s := range storage.SearchSources {
+		part := db.Session(&gorm.Session{NewDB: true}).Table(s.Table).
+			Select(fmt.Sprintf("'%[2]s' AS kind, %[1]s.id AS id, %[1]s.%[3]s AS task_id, 0 AS score, %[1]s.description AS snippet",
+				s.Table, s.Kind, s.TaskColumn))
+		if s.Table != "tasks" {
+			part = part.Joins(fmt.Sprintf("JOIN tasks ON tasks.id = %s.%s", s.Table, s.TaskColumn)).
+				Where(s.Table + ".deleted_at IS NULL")
+		}
+		part = part.Where("tasks.deleted_at IS NULL")
+		for _, t := range terms {
+			part = part.Where("LOWER("+s.Table+".description) LIKE ?", "%"+t+"%")
+		}
+		parts = append(parts, searchVisible(part, user))
+	}
+
+	union := strings.TrimSuffix(strings.Repeat("? UNION ALL ", len(parts)), " UNION ALL ")
+	var rows []searchRow
+	err := db.Raw(union+" ORDER BY task_id DESC, id DESC LIMIT ?", append(parts, limit)...).Scan(&rows).Error
+	for i := range rows {
+		rows[i].Snippet = highlight(rows[i].Snippet, terms)
+	}
+	return rows, err
+}
+
+// highlight marks the terms in the words of text around the first match.
+func highlight(text string, terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	words := strings.Fields(text)
+	first := 0
+	for i, w := range words {
+		if re.MatchString(w) {
+			first = i
+			break
+		}
+	}
+	start := first - snippetWords/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+
+	snippet := strings.Join(words[start:end], " ")
+	snippet = re.ReplaceAllString(snippet, apis.HighlightStart+"$0"+apis.HighlightEnd)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// searchResults loads the tasks of the matches along with the fields the
+// server works out for them in each task's list.
+func searchResults(db *gorm.DB, user *apis.User, rows []searchRow) ([]apis.SearchResult, error) {
+	results := make([]apis.SearchResult, 0, len(rows))
+	if len(rows) == 0 {
+		return results, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, r := range rows {
+		ids[i] = r.TaskID
+	}
+	var tasks []apis.Task
+	if err := db.Preload("Tags").Preload("Assignee").Preload("Owner").Find(&tasks, ids).Error; err != nil {
+		return nil, err
+	}
+
+	// progress depends on which subtasks the user may see in each list
+	byOwner := make(map[uint][]apis.Task)
+	for _, t := range tasks {
+		byOwner[t.OwnerId] = append(byOwner[t.OwnerId], t)
+	}
+	byId := make(map[uint]apis.Task, len(tasks))
+	for _, owned := range byOwner {
+		owner := owned[0].Owner
+		access, err := NewAccess(db, user, &owner)
+		if err != nil {
+			return nil, err
+		}
+		if access == nil {
+			continue
+		}
+		if err := markComputed(db, access, owned); err != nil {
+			return nil, err
+		}
+		for _, t := range owned {
+			byId[t.ID] = t
+		}
+	}
+
+	for _, r := range rows {
+		task, ok := byId[r.TaskID]
+		if !ok {
+			continue
+		}
+		results = append(results, apis.SearchResult{
+			Kind:    r.Kind,
+			ID:      r.ID,
+			Score:   r.Score,
+			Snippet: r.Snippet,
+			Task:    task,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// search returns the kind and id of each result of a search as the user,
+// sorted so they compare regardless of score
+func (s *testServer) search(username, q string) []string {
+	s.t.Helper()
+	results := &apis.SearchResults{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, "/search?"+url.Values{"q": {q}}.Encode(), username, nil), results)
+	return searchKeys(results.Results)
+}
+
+func searchKeys(results []apis.SearchResult) []string {
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = fmt.Sprintf("%s %d", r.Kind, r.ID)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func rowKeys(rows []searchRow) []string {
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = fmt.Sprintf("%s %d", r.Kind, r.ID)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func keys(keys ...string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.user("carol")
+
+	roof := s.createTask("alice", map[string]interface{}{"desc": "fix the gazebo roof"})
+	paint := s.createTask("alice", map[string]interface{}{"desc": "paint the gazebo", "private": true})
+	screws := s.createTask("alice", map[string]interface{}{"desc": "hardware store"})
+	permit := s.createTask("alice", map[string]interface{}{"desc": "call the city"})
+	s.createTask("alice", map[string]interface{}{"desc": "mow the lawn"})
+
+	comment := &apis.Comment{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, taskPath(s, screws.ID)+"/comments", "alice", map[string]string{"description": "buy screws for the gazebo"}), comment)
+	annotation := &apis.Annotation{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, taskPath(s, permit.ID)+"/annotations", "alice", map[string]string{"description": "ask about a gazebo permit"}), annotation)
+
+	roofKey := fmt.Sprintf("%s %d", apis.SearchTask, roof.ID)
+	paintKey := fmt.Sprintf("%s %d", apis.SearchTask, paint.ID)
+	commentKey := fmt.Sprintf("%s %d", apis.SearchComment, comment.ID)
+	annotationKey := fmt.Sprintf("%s %d", apis.SearchAnnotation, annotation.ID)
+
+	cases := []struct {
+		username string
+		want     []string
+	}{
+		{"alice", keys(roofKey, paintKey, commentKey, annotationKey)},
+		{"bob", keys(roofKey, commentKey, annotationKey)},
+		{"carol", []string{}},
+	}
+	for _, c := range cases {
+		got := s.search(c.username, "gazebo")
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("as %s: want %v, got %v", c.username, c.want, got)
+		}
+
+		// the fallback for sqlite without FTS5 sees the same matches
+		rows, err := searchSubstrings(s.DB, s.user(c.username), []string{"gazebo"}, maxSearchResults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rowKeys(rows); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("as %s without FTS5: want %v, got %v", c.username, c.want, got)
+		}
+	}
+
+	// every word must match
+	if got, want := s.search("alice", "gazebo roof"), keys(roofKey); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// trashing a task hides it and its comments
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, roof.ID), "alice", nil), "*"), nil)
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, screws.ID), "alice", nil), "*"), nil)
+	want := keys(paintKey, annotationKey)
+	if got := s.search("alice", "gazebo"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("after trashing: want %v, got %v", want, got)
+	}
+	rows, err := searchSubstrings(s.DB, s.user("alice"), []string{"gazebo"}, maxSearchResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rowKeys(rows); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("after trashing without FTS5: want %v, got %v", want, got)
+	}
+
+	s.expect(http.StatusBadRequest, s.request(http.MethodGet, "/search?q=", "alice", nil), nil)
+}
@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"github.com/csams/doit/pkg/storage"
+)
+
+const testClientId = "todo-app"
+
+// testServer is the whole API on a sqlite database. Users log in with ID
+// tokens signed by a fake identity provider.
+type testServer struct {
+	t       *testing.T
+	DB      *gorm.DB
+	handler http.Handler
+	issuer  string
+	key     *rsa.PrivateKey
+	users   map[string]*apis.User
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{t: t, key: key, users: map[string]*apis.User{}}
+
+	mux := http.NewServeMux()
+	idp := httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	s.issuer = idp.URL
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                s.issuer,
+			"authorization_endpoint":                s.issuer + "/auth",
+			"token_endpoint":                        s.issuer + "/token",
+			"jwks_uri":                              s.issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "doit.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: storage.Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	s.DB = db
+
+	o := auth.NewOptions()
+	o.ClientId = testClientId
+	o.AuthorizationServerURL = s.issuer
+	o.LocalAddr = "localhost:0"
+	provider, err := auth.NewTokenProvider(auth.NewConfig(o).Complete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.handler = NewHandler(db, provider, testClientId, logr.Discard())
+	return s
+}
+
+// idToken signs an ID token for the user
+func (s *testServer) idToken(username string) string {
+	s.t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: s.key, KeyID: "test"},
+	}, nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                s.issuer,
+		"aud":                testClientId,
+		"sub":                username,
+		"preferred_username": username,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return token
+}
+
+// user logs the user in, which creates them the first time.
+func (s *testServer) user(username string) *apis.User {
+	s.t.Helper()
+	if u, ok := s.users[username]; ok {
+		return u
+	}
+	u := &apis.User{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, "/me", username, nil), u)
+	s.users[username] = u
+	return u
+}
+
+// share grants the delegate access to the owner's task list
+func (s *testServer) share(owner, delegate string, mode apis.PolicyMode) {
+	s.t.Helper()
+	policy := &apis.Policy{OwnerUserId: s.user(owner).ID, DelegateUserId: s.user(delegate).ID, Mode: mode}
+	if err := s.DB.Create(policy).Error; err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// request builds a request from the user. The body is sent as is if it's a
+// string and as JSON otherwise. Requests from an empty username aren't
+// authenticated.
+func (s *testServer) request(method, path, username string, body interface{}) *http.Request {
+	s.t.Helper()
+	var rd io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		rd = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		rd = bytes.NewBuffer(data)
+	}
+
+	r := httptest.NewRequest(method, path, rd)
+	if _, ok := body.(string); !ok && body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if username != "" {
+		r.Header.Set("Authorization", "Bearer "+s.idToken(username))
+	}
+	return r
+}
+
+func (s *testServer) do(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// expect sends the request, fails the test unless the response has the
+// status, and decodes the body into out if it isn't nil.
+func (s *testServer) expect(status int, r *http.Request, out interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	w := s.do(r)
+	if w.Code != status {
+		s.t.Fatalf("%s %s: want %d, got %d: %s", r.Method, r.URL, status, w.Code, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: %v", r.Method, r.URL, err)
+		}
+	}
+	return w
+}
+
+// withIfMatch sets the If-Match header of a request
+func withIfMatch(r *http.Request, etag string) *http.Request {
+	r.Header.Set("If-Match", etag)
+	return r
+}
+
+// createTask adds a task to alice's list as the user
+func (s *testServer) createTask(username string, body map[string]interface{}) *apis.Task {
+	s.t.Helper()
+	if _, ok := body["status"]; !ok {
+		body["status"] = apis.Todo
+	}
+	task := &apis.Task{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, listPath(s, "tasks"), username, body), task)
+	return task
+}
+
+// getTask reads a task in alice's list as alice
+func (s *testServer) getTask(id uint) *apis.Task {
+	s.t.Helper()
+	task := &apis.Task{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, id), "alice", nil), task)
+	return task
+}
+
+// patchTask merges the patch into a task in alice's list as the user
+func (s *testServer) patchTask(username string, id uint, patch string) *http.Request {
+	s.t.Helper()
+	r := s.request(http.MethodPatch, taskPath(s, id), username, patch)
+	r.Header.Set("Content-Type", apis.MergePatchType)
+	return withIfMatch(r, "*")
+}
+
+// accessToken creates a personal access token for the user
+func (s *testServer) accessToken(username string, scopes ...apis.Scope) string {
+	s.t.Helper()
+	token := &apis.AccessToken{}
+	body := map[string]interface{}{"name": "test", "scopes": scopes}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, "/me/tokens", username, body), token)
+	return token.Token
+}
+
+// withBasicAuth replaces the credentials of a request with HTTP basic auth
+func withBasicAuth(r *http.Request, username, password string) *http.Request {
+	r.Header.Del("Authorization")
+	r.SetBasicAuth(username, password)
+	return r
+}
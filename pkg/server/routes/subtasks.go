@@ -0,0 +1,243 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/csams/doit/pkg/apis"
+	"gorm.io/gorm"
+)
+
+var errInvalidParent = errors.New("invalid parent")
+
+// checkParent returns an errInvalidParent if the parent of the task isn't a
+// task in the same list the authenticated user may see or is one of the
+// task's own subtasks.
+func checkParent(db *gorm.DB, access *Access, task *apis.Task) error {
+	if task.ParentId == 0 {
+		return nil
+	}
+
+	parent := &apis.Task{}
+	if err := access.Visible(db).Select("tasks.id").First(parent, "tasks.id = ?", task.ParentId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: task %d isn't in this list", errInvalidParent, task.ParentId)
+		}
+		return err
+	}
+
+	// deleted tasks count so restoring one can't complete a cycle
+	seen := make(map[uint]bool)
+	for id := task.ParentId; id != 0 && !seen[id]; {
+		if id == task.ID {
+			return fmt.Errorf("%w: task %d is a subtask of task %d", errInvalidParent, task.ParentId, task.ID)
+		}
+		seen[id] = true
+
+		next := &apis.Task{}
+		if err := db.Unscoped().Select("id", "parent_id").First(next, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		id = next.ParentId
+	}
+	return nil
+}
+
+// topLevel limits a task query to tasks that aren't subtasks of a task the
+// authenticated user can see.
+func topLevel(db *gorm.DB, access *Access) *gorm.DB {
+	parents := access.Visible(db.Session(&gorm.Session{NewDB: true}).Model(&apis.Task{})).Select("tasks.id")
+	return db.Where("tasks.parent_id = ? OR tasks.parent_id NOT IN (?)", 0, parents)
+}
+
+// markProgress sets Progress on each of the tasks that has subtasks the
+// authenticated user can see.
+func markProgress(db *gorm.DB, access *Access, tasks []apis.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+
+	var rows []struct {
+		ParentId uint
+		Total    int
+		Done     int
+	}
+	err := access.Visible(db.Model(&apis.Task{})).
+		Select("tasks.parent_id AS parent_id, COUNT(*) AS total, SUM(CASE WHEN tasks.status = ? THEN 1 ELSE 0 END) AS done", apis.Done).
+		Where("tasks.parent_id IN ?", ids).
+		Group("tasks.parent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	progress := make(map[uint]*apis.Progress, len(rows))
+	for _, r := range rows {
+		progress[r.ParentId] = apis.NewProgress(r.Total, r.Done)
+	}
+	for i := range tasks {
+		tasks[i].Progress = progress[tasks[i].ID]
+	}
+	return nil
+}
+
+// markComputed sets the fields of the tasks that the server works out when
+// it returns them.
+func markComputed(db *gorm.DB, access *Access, tasks []apis.Task) error {
+	if err := markBlocked(db, tasks); err != nil {
+		return err
+	}
+	return markProgress(db, access, tasks)
+}
+
+// loadSubtasks returns all of the subtasks below the tasks that the
+// authenticated user can see.
+func loadSubtasks(db *gorm.DB, access *Access, tasks []apis.Task) ([]apis.Task, error) {
+	seen := make(map[uint]bool, len(tasks))
+	ids := make([]uint, 0, len(tasks))
+	for i := range tasks {
+		seen[tasks[i].ID] = true
+		ids = append(ids, tasks[i].ID)
+	}
+
+	var subtasks []apis.Task
+	for len(ids) > 0 {
+		var level []apis.Task
+		err := access.Visible(db).Preload("Tags").Preload("Assignee").
+			Where("tasks.parent_id IN ?", ids).
+			Order("tasks.id").
+			Find(&level).Error
+		if err != nil {
+			return nil, err
+		}
+
+		ids = nil
+		for i := range level {
+			if !seen[level[i].ID] {
+				seen[level[i].ID] = true
+				subtasks = append(subtasks, level[i])
+				ids = append(ids, level[i].ID)
+			}
+		}
+	}
+	return subtasks, nil
+}
+
+// nestTasks puts the subtasks under the Children of their parents.
+func nestTasks(tasks []apis.Task, subtasks []apis.Task) []apis.Task {
+	children := make(map[uint][]apis.Task)
+	for _, t := range subtasks {
+		children[t.ParentId] = append(children[t.ParentId], t)
+	}
+
+	var nest func(t apis.Task) apis.Task
+	nest = func(t apis.Task) apis.Task {
+		for _, child := range children[t.ID] {
+			t.Children = append(t.Children, nest(child))
+		}
+		return t
+	}
+
+	nested := make([]apis.Task, len(tasks))
+	for i := range tasks {
+		nested[i] = nest(tasks[i])
+	}
+	return nested
+}
+
+// withSubtasks marks the computed fields of the tasks and, when subtasks are
+// requested nested, returns them with all of their subtasks.
+func withSubtasks(db *gorm.DB, access *Access, subtasks string, tasks []apis.Task) ([]apis.Task, error) {
+	if subtasks != apis.SubtasksNested {
+		return tasks, markComputed(db, access, tasks)
+	}
+
+	below, err := loadSubtasks(db, access, tasks)
+	if err != nil {
+		return nil, err
+	}
+	if err := markComputed(db, access, tasks); err != nil {
+		return nil, err
+	}
+	if err := markComputed(db, access, below); err != nil {
+		return nil, err
+	}
+	return nestTasks(tasks, below), nil
+}
+
+// closing reports whether an update closed a task.
+func closing(orig, proposed *apis.Task) bool {
+	return orig.State != apis.Closed && proposed.State == apis.Closed
+}
+
+// closeParents closes the parent of a task that was just closed if the parent
+// is set to close automatically and none of its other subtasks are open. The
+// parent is marked done unless it was abandoned, and closing it may close its
+// own parent in turn. Parents the authenticated user may not change and
+// parents that unfinished tasks block are left open.
+func closeParents(tx *gorm.DB, access *Access, task *apis.Task) error {
+	seen := make(map[uint]bool)
+	for id := task.ParentId; id != 0 && !seen[id]; {
+		seen[id] = true
+
+		parent := &apis.Task{}
+		if err := tx.Preload("Tags").Preload("Assignee").First(parent, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !parent.AutoClose || parent.State == apis.Closed || !access.CanUpdate(parent) {
+			return nil
+		}
+
+		var open int64
+		if err := tx.Model(&apis.Task{}).Where("parent_id = ? AND state = ?", parent.ID, apis.Open).Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return nil
+		}
+
+		before := *parent
+		parent.State = apis.Closed
+		if parent.Status != apis.Abandoned {
+			parent.Status = apis.Done
+		}
+		parent.Version++
+
+		if err := checkBlockers(tx, access, &before, parent); err != nil {
+			var blocked *errBlocked
+			if errors.As(err, &blocked) {
+				return nil
+			}
+			return err
+		}
+
+		err := tx.Model(&apis.Task{ID: parent.ID}).Updates(map[string]interface{}{
+			"state":   parent.State,
+			"status":  parent.Status,
+			"version": parent.Version,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := record(tx, parent.ID, access.User.ID, apis.TaskUpdated, apis.DiffTasks(&before, parent)...); err != nil {
+			return err
+		}
+		if completed(&before, parent) {
+			if _, err := nextInstance(tx, access.User.ID, parent); err != nil {
+				return err
+			}
+		}
+		id = parent.ParentId
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+const closeTask = `{"state": "closed", "status": "done"}`
+
+func TestAutoCloseParent(t *testing.T) {
+	s := newTestServer(t)
+	parent := s.createTask("alice", map[string]interface{}{"desc": "Move", "auto_close": true})
+	first := s.createTask("alice", map[string]interface{}{"desc": "Pack", "parent_id": parent.ID})
+	second := s.createTask("alice", map[string]interface{}{"desc": "Clean", "parent_id": parent.ID})
+
+	s.expect(http.StatusOK, s.patchTask("alice", first.ID, closeTask), nil)
+	if got := s.getTask(parent.ID); got.State != apis.Open {
+		t.Errorf("want the parent open while a subtask is open, got %s", got.State)
+	}
+
+	s.expect(http.StatusOK, s.patchTask("alice", second.ID, closeTask), nil)
+	if got := s.getTask(parent.ID); got.State != apis.Closed || got.Status != apis.Done {
+		t.Errorf("want the parent closed and done, got %s and %s", got.State, got.Status)
+	}
+}
+
+func TestAutoCloseBlockedParent(t *testing.T) {
+	s := newTestServer(t)
+	parent := s.createTask("alice", map[string]interface{}{"desc": "Move", "auto_close": true})
+	child := s.createTask("alice", map[string]interface{}{"desc": "Pack", "parent_id": parent.ID})
+	blocker := s.createTask("alice", map[string]interface{}{"desc": "Sign the lease"})
+
+	path := taskPath(s, parent.ID) + "/dependencies"
+	s.expect(http.StatusOK, s.request(http.MethodPost, path, "alice", map[string]uint{"blocker_id": blocker.ID}), nil)
+
+	s.expect(http.StatusOK, s.patchTask("alice", child.ID, closeTask), nil)
+	if got := s.getTask(parent.ID); got.State != apis.Open || got.Status != apis.Todo {
+		t.Errorf("want the blocked parent left open, got %s and %s", got.State, got.Status)
+	}
+}
+
+func TestAutoCloseHiddenParent(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	parent := s.createTask("alice", map[string]interface{}{"desc": "Surprise party", "auto_close": true, "private": true})
+	child := s.createTask("alice", map[string]interface{}{"desc": "Buy cake", "parent_id": parent.ID})
+
+	s.expect(http.StatusOK, s.patchTask("carol", child.ID, closeTask), nil)
+	got := s.getTask(parent.ID)
+	if got.State != apis.Open || got.Version != parent.Version {
+		t.Errorf("want the private parent untouched, got %s at version %d", got.State, got.Version)
+	}
+
+}
@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TagController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewTagController(db *gorm.DB, log logr.Logger) *TagController {
+	return &TagController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// replaceTags makes the stored tags of the task match task.Tags
+func replaceTags(db *gorm.DB, task *apis.Task) error {
+	task.Tags = apis.NewTags(apis.TagNames(task.Tags)...)
+	if err := db.Where("task_id = ?", task.ID).Delete(&apis.Tag{}).Error; err != nil {
+		return err
+	}
+	if len(task.Tags) == 0 {
+		return nil
+	}
+	for i := range task.Tags {
+		task.Tags[i].TaskID = task.ID
+	}
+	return db.Create(&task.Tags).Error
+}
+
+// pathParam returns an unescaped URL parameter. The URLFormat middleware
+// strips anything after a dot in the last path segment, so it's added back.
+func pathParam(r *http.Request, name string) (string, error) {
+	value := chi.URLParam(r, name)
+	if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format != "" {
+		value = value + "." + format
+	}
+	if r.URL.RawPath != "" {
+		return url.PathUnescape(value)
+	}
+	return value, nil
+}
+
+// List returns each tag used in the task list with the number of tasks that
+// have it.
+func (c *TagController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var results []apis.TagCount
+	err = access.Visible(c.DB.Model(&apis.Task{})).
+		Select("tags.name AS name, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.task_id = tasks.id").
+		Group("tags.name").
+		Order("count DESC").
+		Order("name").
+		Scan(&results).Error
+	if err != nil {
+		http.Error(w, "error retrieving tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, apis.TagCountList{Tags: results})
+}
+
+// beforeTags copies the task so its tags can be compared once they change.
+func beforeTags(task *apis.Task) *apis.Task {
+	before := *task
+	before.Tags = append([]apis.Tag(nil), task.Tags...)
+	return &before
+}
+
+// recordTags reloads the tags of the task. If they changed, it bumps the
+// task's version and records the change in its history.
+func recordTags(tx *gorm.DB, access *Access, before, task *apis.Task) error {
+	if err := tx.Where("task_id = ?", task.ID).Order("name").Find(&task.Tags).Error; err != nil {
+		return err
+	}
+	changes := apis.DiffTasks(before, task)
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := touch(tx, task); err != nil {
+		return err
+	}
+	return record(tx, task.ID, access.User.ID, apis.TaskUpdated, changes...)
+}
+
+// Add puts tags on the task in the request context. Tags it already has are
+// ignored, so adding only those leaves the task as it was.
+func (c *TagController) Add(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.TagRequest{}
+	if err := render.Bind(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	tags := apis.NewTags(req.Tags...)
+	for i := range tags {
+		tags[i].TaskID = task.ID
+	}
+
+	before := beforeTags(task)
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+			return err
+		}
+		return recordTags(tx, access, before, task)
+	})
+	if err != nil {
+		http.Error(w, "Unable to add tags: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", task.ETag())
+	render.JSON(w, r, task)
+}
+
+// Remove takes a tag off of the task in the request context.
+func (c *TagController) Remove(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name, err := pathParam(r, "tag")
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	before := beforeTags(task)
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("task_id = ? AND name = ?", task.ID, name).Delete(&apis.Tag{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordTags(tx, access, before, task)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to remove tag: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", task.ETag())
+	render.JSON(w, r, task)
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func tagCounts(list *apis.TagCountList) string {
+	counts := make([]string, len(list.Tags))
+	for i, t := range list.Tags {
+		counts[i] = fmt.Sprintf("%s=%d", t.Name, t.Count)
+	}
+	return strings.Join(counts, " ")
+}
+
+func TestTagCounts(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.user("carol")
+
+	s.createTask("alice", map[string]interface{}{"desc": "a", "tags": []string{"infra", "v1.2"}})
+	s.createTask("alice", map[string]interface{}{"desc": "b", "tags": []string{"infra"}})
+	s.createTask("alice", map[string]interface{}{"desc": "c", "tags": []string{"secret", "infra"}, "private": true})
+	trashed := s.createTask("alice", map[string]interface{}{"desc": "d", "tags": []string{"infra", "old"}})
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, taskPath(s, trashed.ID), "alice", nil), "*"), nil)
+
+	cases := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "infra=3 secret=1 v1.2=1"},
+		{"bob", "infra=2 v1.2=1"},
+	}
+	for _, c := range cases {
+		list := &apis.TagCountList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "tags"), c.username, nil), list)
+		if got := tagCounts(list); got != c.want {
+			t.Errorf("as %s: want %q, got %q", c.username, c.want, got)
+		}
+	}
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, listPath(s, "tags"), "carol", nil), nil)
+}
+
+func TestTags(t *testing.T) {
+	s := newTestServer(t)
+	task := s.createTask("alice", map[string]interface{}{"desc": "task", "tags": []string{"infra"}})
+	tags := taskPath(s, task.ID) + "/tags"
+
+	// history returns the number of entries in the task's history
+	history := func() int {
+		t.Helper()
+		changes := &apis.ChangeList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, task.ID)+"/history", "alice", nil), changes)
+		return len(changes.Changes)
+	}
+	check := func(step string, got *apis.Task, tags string, version uint, entries int) {
+		t.Helper()
+		if names := strings.Join(apis.TagNames(got.Tags), ","); names != tags {
+			t.Errorf("%s: want tags %q, got %q", step, tags, names)
+		}
+		if got.Version != version {
+			t.Errorf("%s: want version %d, got %d", step, version, got.Version)
+		}
+		if n := history(); n != entries {
+			t.Errorf("%s: want %d history entries, got %d", step, entries, n)
+		}
+	}
+
+	// tags with dots are kept whole, even ones that look like a format
+	got := &apis.Task{}
+	body := map[string]interface{}{"tags": []string{"infra", "v1.2", "notes.json", " "}}
+	s.expect(http.StatusOK, s.request(http.MethodPost, tags, "alice", body), got)
+	check("add", got, "infra,notes.json,v1.2", task.Version+1, 2)
+
+	got = &apis.Task{}
+	s.expect(http.StatusOK, s.request(http.MethodPost, tags, "alice", body), got)
+	check("add again", got, "infra,notes.json,v1.2", task.Version+1, 2)
+
+	for i, name := range []string{"v1.2", "notes.json"} {
+		got = &apis.Task{}
+		s.expect(http.StatusOK, s.request(http.MethodDelete, tags+"/"+url.PathEscape(name), "alice", nil), got)
+		want := strings.Join([]string{"infra", "notes.json"}[:2-i], ",")
+		check("remove "+name, got, want, task.Version+uint(i)+2, 3+i)
+
+		s.expect(http.StatusNotFound, s.request(http.MethodDelete, tags+"/"+url.PathEscape(name), "alice", nil), nil)
+		check("remove "+name+" again", s.getTask(task.ID), want, task.Version+uint(i)+2, 3+i)
+	}
+
+	changes := &apis.ChangeList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, task.ID)+"/history", "alice", nil), changes)
+	last := changes.Changes[len(changes.Changes)-1]
+	if len(last.Fields) != 1 || last.Fields[0] != (apis.FieldChange{Field: "tags", Before: "infra,notes.json", After: "infra"}) {
+		t.Errorf("want the last change to remove notes.json, got %+v", last.Fields)
+	}
+
+	s.expect(http.StatusBadRequest, s.request(http.MethodPost, tags, "alice", map[string]interface{}{"tags": []string{" "}}), nil)
+}
@@ -1,15 +1,31 @@
 package routes
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/csams/doit/pkg/apis"
-	"github.com/csams/doit/pkg/auth"
+	"github.com/csams/doit/pkg/filter"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/go-logr/logr"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TaskContextKey string
+
+const (
+	TaskKey TaskContextKey = "taskCtxKey"
 )
 
 type TaskController struct {
@@ -24,63 +40,131 @@ func NewTaskController(db *gorm.DB, log logr.Logger) *TaskController {
 	}
 }
 
-// List returns the list of tasks for the user that authenticated for the
-// current request
-func (c *TaskController) List(w http.ResponseWriter, r *http.Request) {
-	u, err := auth.UserFromContext(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func WithTask(ctx context.Context, task *apis.Task) context.Context {
+	return context.WithValue(ctx, TaskKey, task)
+}
+
+func TaskFromContext(ctx context.Context) (*apis.Task, error) {
+	task, ok := ctx.Value(TaskKey).(*apis.Task)
+	if !ok {
+		return nil, errors.New("Expected task in request context")
 	}
+	return task, nil
+}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
+// TaskCtx loads the task named in the request path if the authenticated user
+// may see it. Tasks the user can't see are reported as not found so private
+// tasks don't leak.
+func (c *TaskController) TaskCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		taskId := chi.URLParam(r, "taskid")
+		if taskId == "" {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		tasks := make([]apis.Task, 1)
+		if err := access.Visible(c.DB).Preload("Tags").Preload("Assignee").First(&tasks[0], "tasks.id = ?", taskId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Render(w, r, ErrNotFound)
+				return
+			}
+			http.Error(w, "Unable to retrieve task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := markComputed(c.DB, access, tasks); err != nil {
+			http.Error(w, "Unable to retrieve task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := WithTask(r.Context(), &tasks[0])
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
+// List returns a page of the tasks in the requested list that the
+// authenticated user may see. With the assignee query parameter, it returns
+// the tasks assigned to the authenticated user instead. Query parameters
+// described by apis.TaskQuery filter and sort the results, and the filter
+// parameter takes an expression in the language of the filter package.
+//
+// Subtasks are listed like any other task unless they're requested nested,
+// in which case the page holds top level tasks with their subtasks under
+// children.
+func (c *TaskController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	query, err := apis.ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
 
-	// TODO: add pagination. this probably can be done generically in some
-	// middleware in which we call db.Limit and store the resulting db object
-	// on in the request context
 	db := c.DB
 
-	var results []apis.Task
-
-	if chi.URLParam(r, "assignee") != "" {
-		if err := db.Where("assignee_id = ?", u.ID).Find(&results).Error; err != nil {
-			http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
-			return
+	if query.Assignee {
+		if !access.IsOwner() {
+			db = access.Visible(db)
 		}
+		db = db.Where("tasks.assignee_id = ?", access.User.ID)
 	} else {
-		if err := db.Where("owner_id = ?", u.ID).Find(&results).Error; err != nil {
-			http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
+		db = access.Visible(db)
+	}
+
+	if query.Subtasks == apis.SubtasksNested {
+		db = topLevel(db, access)
+	}
+
+	if query.Filter != "" {
+		expr, err := filter.Parse(query.Filter, filter.Env{Now: time.Now(), Username: access.User.Username})
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid filter: %w", err)))
 			return
 		}
+		db = filter.Where(db, expr)
 	}
 
-	render.JSON(w, r, apis.TaskList{Tasks: results})
-}
-
-func (c *TaskController) Create(w http.ResponseWriter, r *http.Request) {
-	u, err := auth.UserFromContext(r.Context())
+	db, err = pageTasks(filterTasks(db, query), query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
 	}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
+	var results []apis.Task
+	if err := db.Preload("Tags").Preload("Assignee").Find(&results).Error; err != nil {
+		http.Error(w, "error retrieving tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	taskList, err := pageResults(query, results)
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, "error paging tasks: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	taskList.Tasks, err = withSubtasks(c.DB, access, query.Subtasks, taskList.Tasks)
+	if err != nil {
+		http.Error(w, "error retrieving subtasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, taskList)
+}
+
+func (c *TaskController) Create(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -97,135 +181,421 @@ func (c *TaskController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task.OwnerId = u.ID
-	task.AssigneeId = u.ID
+	task.ID = 0
+	task.Version = 1
+	task.UUID = ""
+	task.OwnerId = access.Owner.ID
 	task.State = apis.Open
+	task.SeriesId = 0
+	task.Progress = nil
+	task.Children = nil
+
+	if err := task.Validate(); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := checkParent(c.DB, access, task); err != nil {
+		if errors.Is(err, errInvalidParent) {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		http.Error(w, "Unable to retrieve parent: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if task.AssigneeId == 0 {
+		task.AssigneeId = access.Owner.ID
+	}
+	assignee, err := findAssignee(c.DB, access.Owner.ID, task.AssigneeId)
+	if err != nil {
+		if errors.Is(err, errNotAssignable) {
+			render.Render(w, r, ErrInvalidRequest(err))
+			return
+		}
+		http.Error(w, "Unable to retrieve assignee: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	task.Assignee = *assignee
 
-	if err = c.DB.Create(task).Error; err != nil {
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(task).Error; err != nil {
+			return err
+		}
+		if err := replaceTags(tx, task); err != nil {
+			return err
+		}
+		if err := startSeries(tx, task); err != nil {
+			return err
+		}
+		return record(tx, task.ID, access.User.ID, apis.TaskCreated, apis.DiffTasks(&apis.Task{}, task)...)
+	})
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", task.ETag())
 	w.WriteHeader(http.StatusCreated)
 	render.JSON(w, r, task)
 }
 
+// Get returns a task. With the subtasks query parameter set to nested, it
+// includes all of the task's subtasks under children.
 func (c *TaskController) Get(w http.ResponseWriter, r *http.Request) {
-	u, err := auth.UserFromContext(r.Context())
+	access, err := AccessFromContext(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
-
+	task, err := TaskFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	w.Header().Set("ETag", task.ETag())
+	if r.URL.Query().Get("subtasks") != apis.SubtasksNested {
+		render.JSON(w, r, task)
+		return
+	}
+
+	// the task is already marked, so only its subtasks need to be
+	subtasks, err := loadSubtasks(c.DB, access, []apis.Task{*task})
+	if err == nil {
+		err = markComputed(c.DB, access, subtasks)
+	}
+	if err != nil {
+		http.Error(w, "error retrieving subtasks: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	render.JSON(w, r, nestTasks([]apis.Task{*task}, subtasks)[0])
+}
 
-	taskId, err := strconv.Atoi(chi.URLParam(r, "taskid"))
+// Update replaces the fields of a task. The If-Match header must hold the
+// task's current ETag.
+func (c *TaskController) Update(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	orig, err := TaskFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid taskid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	task := &apis.Task{ID: uint(taskId), OwnerId: uint(userId)}
-	if err := c.DB.First(task).Error; err != nil {
-		http.Error(w, "Unable to retrieve task: "+err.Error(), http.StatusInternalServerError)
+	if !ifMatch(w, r, orig) {
 		return
 	}
 
-	render.JSON(w, r, task)
+	// fields missing from the body keep their values, but decoding reuses the
+	// slices and due pointer, so the copy needs its own
+	proposed := *orig
+	proposed.Tags = append([]apis.Tag(nil), orig.Tags...)
+	proposed.Checklist = append([]apis.ChecklistItem(nil), orig.Checklist...)
+	if orig.Due != nil {
+		due := *orig.Due
+		proposed.Due = &due
+	}
+
+	if err := render.Bind(r, &proposed); err != nil {
+		http.Error(w, "Unable to decode task: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.save(w, r, access, orig, &proposed)
 }
 
-func (c *TaskController) Update(w http.ResponseWriter, r *http.Request) {
-	u, err := auth.UserFromContext(r.Context())
+// Patch changes some of the fields of a task. The body is either a JSON Merge
+// Patch (RFC 7386) or a JSON Patch (RFC 6902) of the task's JSON, chosen by
+// the Content-Type header. The If-Match header must hold the task's current
+// ETag.
+func (c *TaskController) Patch(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
-
+	orig, err := TaskFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !ifMatch(w, r, orig) {
 		return
 	}
 
-	taskId, err := strconv.Atoi(chi.URLParam(r, "taskid"))
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Unable to read patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	doc, err := json.Marshal(orig)
 	if err != nil {
-		http.Error(w, "invalid taskid", http.StatusBadRequest)
+		http.Error(w, "Unable to encode task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	task := &apis.Task{ID: uint(taskId), OwnerId: uint(userId)}
-	if err := c.DB.Find(task).Error; err != nil {
-		http.Error(w, "Unable to delete task: "+err.Error(), http.StatusInternalServerError)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case apis.MergePatchType:
+		doc, err = jsonpatch.MergePatch(doc, body)
+	case apis.JSONPatchType:
+		var patch jsonpatch.Patch
+		if patch, err = jsonpatch.DecodePatch(body); err == nil {
+			doc, err = patch.Apply(doc)
+		}
+	default:
+		http.Error(w, "Patches must be "+apis.MergePatchType+" or "+apis.JSONPatchType, http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
 		return
 	}
 
-	render.Bind(r, task)
-	task.ID = uint(taskId)
-	task.OwnerId = uint(userId)
+	proposed := &apis.Task{}
+	if err := json.Unmarshal(doc, proposed); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
 
-	if err := c.DB.Save(task).Error; err != nil {
-		http.Error(w, "Unable to delete task: "+err.Error(), http.StatusInternalServerError)
+	c.save(w, r, access, orig, proposed)
+}
+
+// save stores the proposed version of a task in place of the original and
+// writes the response. The force query parameter starts or finishes tasks
+// that unfinished tasks block.
+func (c *TaskController) save(w http.ResponseWriter, r *http.Request, access *Access, orig, proposed *apis.Task) {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		return updateTask(tx, access, orig, proposed, force)
+	})
+	if err != nil {
+		renderUpdateError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", proposed.ETag())
 	w.WriteHeader(http.StatusOK)
-	render.JSON(w, r, task)
+	render.JSON(w, r, proposed)
+}
+
+// errInvalidTask is a proposed task with fields that aren't valid
+type errInvalidTask struct {
+	error
+}
+
+var errProgressOnly = errors.New("Assignees may only change the status and state of the task")
+
+// updateTask stores the proposed version of a task in place of the original.
+// Users that may update the task may also reassign it to the owner or anyone
+// the list is shared with. Assignees without update access may only change
+// its status and state. Fields the server manages keep their original values.
+// Starting or finishing a task that unfinished tasks block is rejected unless
+// force is true. Completing a recurring task creates the next task in its
+// series, and closing the last open subtask of a parent set to close
+// automatically closes the parent.
+func updateTask(tx *gorm.DB, access *Access, orig, proposed *apis.Task, force bool) error {
+	proposed.ID = orig.ID
+	proposed.Version = orig.Version + 1
+	proposed.UUID = orig.UUID
+	proposed.OwnerId = orig.OwnerId
+	proposed.Owner = orig.Owner
+	proposed.Assignee = orig.Assignee
+	proposed.CreatedAt = orig.CreatedAt
+	proposed.SeriesId = orig.SeriesId
+	proposed.Blocked = orig.Blocked
+	proposed.Progress = orig.Progress
+	proposed.Children = nil
+	proposed.Comments = nil
+	proposed.Annotations = nil
+	if proposed.AssigneeId == 0 {
+		proposed.AssigneeId = orig.OwnerId
+	}
+
+	if err := proposed.Validate(); err != nil {
+		return errInvalidTask{err}
+	}
+
+	if !access.CanUpdate(orig) && !progressOnly(orig, proposed) {
+		return errProgressOnly
+	}
+
+	if proposed.ParentId != orig.ParentId {
+		if err := checkParent(tx, access, proposed); err != nil {
+			return err
+		}
+	}
+
+	if !force {
+		if err := checkBlockers(tx, access, orig, proposed); err != nil {
+			return err
+		}
+	}
+
+	if proposed.AssigneeId != orig.AssigneeId {
+		assignee, err := findAssignee(tx, orig.OwnerId, proposed.AssigneeId)
+		if err != nil {
+			return err
+		}
+		proposed.Assignee = *assignee
+	}
+
+	// the version check catches updates made since the task was loaded
+	res := tx.Model(proposed).Where("version = ?", orig.Version).Select("*").Omit(clause.Associations).Updates(proposed)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	if err := replaceTags(tx, proposed); err != nil {
+		return err
+	}
+	if err := startSeries(tx, proposed); err != nil {
+		return err
+	}
+	if changes := apis.DiffTasks(orig, proposed); len(changes) > 0 {
+		if err := record(tx, proposed.ID, access.User.ID, apis.TaskUpdated, changes...); err != nil {
+			return err
+		}
+	}
+	if completed(orig, proposed) {
+		if _, err := nextInstance(tx, access.User.ID, proposed); err != nil {
+			return err
+		}
+	}
+	if closing(orig, proposed) {
+		return closeParents(tx, access, proposed)
+	}
+	return nil
+}
+
+// updateStatus is the HTTP status of an error from changing a task.
+func updateStatus(err error) int {
+	var invalid errInvalidTask
+	var blocked *errBlocked
+	switch {
+	case errors.As(err, &invalid), errors.Is(err, errInvalidParent), errors.Is(err, errNotAssignable):
+		return http.StatusBadRequest
+	case errors.Is(err, errProgressOnly), errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, errTaskNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &blocked):
+		return http.StatusConflict
+	case errors.Is(err, errVersionConflict):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// renderUpdateError writes the response for an error from updateTask.
+func renderUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch updateStatus(err) {
+	case http.StatusBadRequest:
+		render.Render(w, r, ErrInvalidRequest(err))
+	case http.StatusForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case http.StatusNotFound:
+		render.Render(w, r, ErrNotFound)
+	case http.StatusConflict:
+		render.Render(w, r, ErrBlocked(err))
+	case http.StatusPreconditionFailed:
+		render.Render(w, r, ErrPreconditionFailed)
+	default:
+		http.Error(w, "Unable to update task: "+err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func (c *TaskController) Delete(w http.ResponseWriter, r *http.Request) {
-	u, err := auth.UserFromContext(r.Context())
+	access, err := AccessFromContext(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userId, err := strconv.Atoi(chi.URLParam(r, "userid"))
-
+	task, err := TaskFromContext(r.Context())
 	if err != nil {
-		http.Error(w, "invalid userid", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if u.ID != uint(userId) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !ifMatch(w, r, task) {
 		return
 	}
 
-	taskId, err := strconv.Atoi(chi.URLParam(r, "taskid"))
-
-	if err != nil {
-		http.Error(w, "invalid taskid", http.StatusBadRequest)
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteTask(tx, access, task)
+	})
+	if errors.Is(err, errVersionConflict) {
+		render.Render(w, r, ErrPreconditionFailed)
 		return
 	}
-
-	task := &apis.Task{ID: uint(taskId), OwnerId: uint(userId)}
-	if err := c.DB.Find(task).Error; err != nil {
+	if err != nil {
 		http.Error(w, "Unable to delete task: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := c.DB.Delete(task).Error; err != nil {
-		http.Error(w, "Unable to delete task: "+err.Error(), http.StatusInternalServerError)
-		return
+	render.JSON(w, r, task)
+}
+
+// deleteTask moves a task to the trash unless it changed since it was loaded.
+func deleteTask(tx *gorm.DB, access *Access, task *apis.Task) error {
+	res := tx.Where("version = ?", task.Version).Delete(task)
+	if res.Error != nil {
+		return res.Error
 	}
+	if res.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	return record(tx, task.ID, access.User.ID, apis.TaskDeleted)
+}
 
-	render.JSON(w, r, task)
+var errVersionConflict = errors.New("task has changed")
+
+// ifMatch checks the If-Match header of a request that changes the task. It
+// writes the error response and returns false if the header is missing or
+// doesn't match the task's ETag.
+func ifMatch(w http.ResponseWriter, r *http.Request, task *apis.Task) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		render.Render(w, r, ErrPreconditionRequired)
+		return false
+	}
+
+	if matchesETag(header, task.ETag()) {
+		return true
+	}
+
+	render.Render(w, r, ErrPreconditionFailed)
+	return false
+}
+
+// matchesETag is true if an If-Match header lists the ETag or is *.
+func matchesETag(header, etag string) bool {
+	for _, e := range strings.Split(header, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// touch records a change to a task's associations by bumping its version.
+func touch(db *gorm.DB, task *apis.Task) error {
+	if err := db.Model(&apis.Task{ID: task.ID}).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+		return err
+	}
+	task.Version++
+	return nil
 }
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// newTask creates a task in alice's list and returns it with its ETag
+func newTask(s *testServer) (*apis.Task, string) {
+	s.t.Helper()
+	task := &apis.Task{}
+	body := map[string]interface{}{"desc": "Pay rent", "status": apis.Todo, "priority": 3}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, listPath(s, "tasks"), "alice", body), task)
+	w := s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, task.ID), "alice", nil), nil)
+	etag := w.Header().Get("ETag")
+	if etag != task.ETag() {
+		s.t.Fatalf("want ETag %s, got %s", task.ETag(), etag)
+	}
+	return task, etag
+}
+
+func TestUpdateIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	task, etag := newTask(s)
+	path := taskPath(s, task.ID)
+	body := map[string]interface{}{"desc": "Pay rent early"}
+
+	s.expect(http.StatusPreconditionRequired, s.request(http.MethodPut, path, "alice", body), nil)
+	s.expect(http.StatusPreconditionFailed, withIfMatch(s.request(http.MethodPut, path, "alice", body), `"0"`), nil)
+
+	updated := &apis.Task{}
+	w := s.expect(http.StatusOK, withIfMatch(s.request(http.MethodPut, path, "alice", body), etag), updated)
+	if got := w.Header().Get("ETag"); got == etag || got != updated.ETag() {
+		t.Errorf("want a new ETag matching version %d, got %s", updated.Version, got)
+	}
+	if updated.Description != "Pay rent early" || updated.Priority != 3 {
+		t.Errorf("want the description changed and the priority kept, got %q and %d", updated.Description, updated.Priority)
+	}
+
+	// the ETag the change was made with is stale now
+	s.expect(http.StatusPreconditionFailed, withIfMatch(s.request(http.MethodPut, path, "alice", body), etag), nil)
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	task, etag := newTask(s)
+	path := taskPath(s, task.ID)
+
+	s.expect(http.StatusPreconditionRequired, s.request(http.MethodDelete, path, "alice", nil), nil)
+	s.expect(http.StatusPreconditionFailed, withIfMatch(s.request(http.MethodDelete, path, "alice", nil), `"0"`), nil)
+	s.expect(http.StatusOK, withIfMatch(s.request(http.MethodDelete, path, "alice", nil), etag), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodGet, path, "alice", nil), nil)
+}
+
+func TestPatchIfMatch(t *testing.T) {
+	patches := []struct {
+		contentType string
+		body        string
+	}{
+		{apis.MergePatchType, `{"desc": "Pay rent early", "due": null}`},
+		{apis.JSONPatchType, `[{"op": "replace", "path": "/desc", "value": "Pay rent early"}]`},
+	}
+
+	for _, p := range patches {
+		s := newTestServer(t)
+		task, etag := newTask(s)
+		path := taskPath(s, task.ID)
+		patch := func(etag string) *http.Request {
+			r := s.request(http.MethodPatch, path, "alice", p.body)
+			r.Header.Set("Content-Type", p.contentType)
+			if etag != "" {
+				withIfMatch(r, etag)
+			}
+			return r
+		}
+
+		s.expect(http.StatusPreconditionRequired, patch(""), nil)
+		s.expect(http.StatusPreconditionFailed, patch(`"0"`), nil)
+
+		patched := &apis.Task{}
+		w := s.expect(http.StatusOK, patch(etag), patched)
+		if got := w.Header().Get("ETag"); got == etag || got != patched.ETag() {
+			t.Errorf("%s: want a new ETag matching version %d, got %s", p.contentType, patched.Version, got)
+		}
+		if patched.Description != "Pay rent early" || patched.Priority != 3 || patched.Status != apis.Todo {
+			t.Errorf("%s: want only the description changed, got %+v", p.contentType, patched)
+		}
+
+		s.expect(http.StatusPreconditionFailed, patch(etag), nil)
+	}
+}
+
+func TestPatchContentType(t *testing.T) {
+	s := newTestServer(t)
+	task, etag := newTask(s)
+
+	r := s.request(http.MethodPatch, taskPath(s, task.ID), "alice", map[string]string{"desc": "Pay rent early"})
+	s.expect(http.StatusUnsupportedMediaType, withIfMatch(r, etag), nil)
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+)
+
+type TokenController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewTokenController(db *gorm.DB, log logr.Logger) *TokenController {
+	return &TokenController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// List returns the authenticated user's personal access tokens.
+func (c *TokenController) List(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var tokens []apis.AccessToken
+	if err := c.DB.Where("user_id = ?", user.ID).Order("id").Find(&tokens).Error; err != nil {
+		http.Error(w, "error retrieving tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, apis.AccessTokenList{Tokens: tokens})
+}
+
+// Create makes a personal access token for the authenticated user. The token
+// isn't kept, so this is the only time it's returned.
+func (c *TokenController) Create(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token := &apis.AccessToken{}
+	if err := render.Bind(r, token); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	raw := apis.AccessTokenPrefix + apis.NewToken()
+	token.ID = 0
+	token.UserId = user.ID
+	token.TokenHash = apis.HashToken(raw)
+	token.LastUsedAt = nil
+	if err := c.DB.Create(token).Error; err != nil {
+		http.Error(w, "Unable to create token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token.Token = raw
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, token)
+}
+
+// Delete revokes one of the authenticated user's personal access tokens.
+func (c *TokenController) Delete(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token := &apis.AccessToken{}
+	err = c.DB.First(token, "id = ? AND user_id = ?", chi.URLParam(r, "tokenid"), user.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to retrieve token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.DB.Delete(token).Error; err != nil {
+		http.Error(w, "Unable to delete token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, token)
+}
+
+// readMethods are the methods that don't change anything
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+}
+
+// RequireScope rejects requests made with a personal access token that
+// doesn't have the scope. Requests from users who logged in have every
+// scope.
+func RequireScope(scope apis.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := auth.AccessTokenFromContext(r.Context()); token != nil && !token.Allows(scope) {
+				http.Error(w, fmt.Sprintf("Forbidden. The access token needs the %s scope", scope), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireMethodScope requires the read scope for requests that only read and
+// the write scope for the rest.
+func RequireMethodScope(next http.Handler) http.Handler {
+	read, write := RequireScope(apis.ReadScope)(next), RequireScope(apis.WriteScope)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if readMethods[r.Method] {
+			read.ServeHTTP(w, r)
+			return
+		}
+		write.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// withBearer sends a request with the token in the Authorization header
+func withBearer(r *http.Request, token string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	s := newTestServer(t)
+	s.user("bob")
+	task, _ := newTask(s)
+	tasks := listPath(s, "tasks")
+	shares := listPath(s, "shares")
+
+	read := s.accessToken("alice", apis.ReadScope)
+	write := s.accessToken("alice", apis.WriteScope)
+	admin := s.accessToken("alice", apis.AdminScope)
+
+	create := map[string]interface{}{"desc": "Call the bank", "status": apis.Todo}
+	share := map[string]interface{}{"username": "bob", "mode": apis.View}
+	token := map[string]interface{}{"name": "ci", "scopes": []apis.Scope{apis.ReadScope}}
+
+	cases := []struct {
+		token  string
+		r      *http.Request
+		status int
+	}{
+		{read, s.request(http.MethodGet, tasks, "", nil), http.StatusOK},
+		{read, s.request(http.MethodGet, "/me/tokens", "", nil), http.StatusOK},
+		{read, s.request(http.MethodPost, tasks, "", create), http.StatusForbidden},
+		{read, withIfMatch(s.request(http.MethodPut, taskPath(s, task.ID), "", map[string]string{"desc": "x"}), "*"), http.StatusForbidden},
+		{read, withIfMatch(s.request(http.MethodDelete, taskPath(s, task.ID), "", nil), "*"), http.StatusForbidden},
+
+		{write, s.request(http.MethodPost, tasks, "", create), http.StatusCreated},
+		{write, s.request(http.MethodPost, shares, "", share), http.StatusForbidden},
+		{write, s.request(http.MethodPost, "/me/tokens", "", token), http.StatusForbidden},
+		{write, s.request(http.MethodDelete, "/me/tokens/1", "", nil), http.StatusForbidden},
+
+		{admin, s.request(http.MethodPost, shares, "", share), http.StatusCreated},
+		{admin, s.request(http.MethodPost, "/me/tokens", "", token), http.StatusCreated},
+	}
+	for _, c := range cases {
+		w := s.do(withBearer(c.r, c.token))
+		if w.Code != c.status {
+			t.Errorf("%s %s: want %d, got %d: %s", c.r.Method, c.r.URL, c.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAccessTokenAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.user("alice")
+	raw := s.accessToken("alice", apis.ReadScope)
+
+	token := &apis.AccessToken{}
+	if err := s.DB.First(token, "token_hash = ?", apis.HashToken(raw)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if token.LastUsedAt != nil {
+		t.Errorf("want a new token to be unused, got last used at %s", token.LastUsedAt)
+	}
+
+	me := &apis.User{}
+	s.expect(http.StatusOK, withBearer(s.request(http.MethodGet, "/me", "", nil), raw), me)
+	if me.ID != alice.ID {
+		t.Errorf("want the token to act as alice, got user %d", me.ID)
+	}
+	if err := s.DB.First(token, token.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if token.LastUsedAt == nil {
+		t.Error("want last_used_at set after the token was used")
+	}
+
+	// tokens without the prefix are ID tokens
+	s.expect(http.StatusOK, withBearer(s.request(http.MethodGet, "/me", "", nil), s.idToken("alice")), nil)
+	s.expect(http.StatusUnauthorized, withBearer(s.request(http.MethodGet, "/me", "", nil), "not-a-token"), nil)
+	s.expect(http.StatusUnauthorized, withBearer(s.request(http.MethodGet, "/me", "", nil), apis.AccessTokenPrefix+"not-a-token"), nil)
+
+	expired := time.Now().Add(-time.Minute)
+	if err := s.DB.Model(token).Update("expires_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.expect(http.StatusUnauthorized, withBearer(s.request(http.MethodGet, "/me", "", nil), raw), nil)
+}
+
+func TestAccessTokenRevoke(t *testing.T) {
+	s := newTestServer(t)
+	raw := s.accessToken("alice", apis.ReadScope)
+
+	list := &apis.AccessTokenList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, "/me/tokens", "alice", nil), list)
+	if len(list.Tokens) != 1 || list.Tokens[0].Token != "" {
+		t.Fatalf("want one token without its secret, got %+v", list.Tokens)
+	}
+
+	path := fmt.Sprintf("/me/tokens/%d", list.Tokens[0].ID)
+	s.expect(http.StatusNotFound, s.request(http.MethodDelete, path, "bob", nil), nil)
+	s.expect(http.StatusOK, s.request(http.MethodDelete, path, "alice", nil), nil)
+	s.expect(http.StatusUnauthorized, withBearer(s.request(http.MethodGet, "/me", "", nil), raw), nil)
+}
@@ -0,0 +1,560 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/transfer"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxImportBytes is the largest file the server imports
+const maxImportBytes = 10 << 20
+
+type TransferController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewTransferController(db *gorm.DB, log logr.Logger) *TransferController {
+	return &TransferController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+// Export writes the tasks in the list the authenticated user may see, with
+// their comments and annotations, in the format named by the format query
+// parameter. CSV exports take their columns from the columns parameter.
+func (c *TransferController) Export(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format, err := apis.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	columns, err := transfer.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	archive := &apis.Archive{
+		Version:    apis.ArchiveVersion,
+		Owner:      access.Owner.Username,
+		ExportedAt: time.Now().UTC(),
+	}
+	err = access.Visible(c.DB).
+		Preload("Tags").
+		Preload("Assignee").
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Preload("Comments.Author").
+		Preload("Annotations", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Order("tasks.id").
+		Find(&archive.Tasks).Error
+	if err != nil {
+		http.Error(w, "Unable to retrieve tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]uint, len(archive.Tasks))
+	for i := range archive.Tasks {
+		ids[i] = archive.Tasks[i].ID
+	}
+	archive.Dependencies = []apis.Dependency{}
+	if len(ids) > 0 {
+		err := c.DB.Where("task_id IN ? AND blocker_id IN ?", ids, ids).
+			Order("task_id, blocker_id").
+			Find(&archive.Dependencies).Error
+		if err != nil {
+			http.Error(w, "Unable to retrieve dependencies: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filename := "doit-" + access.Owner.Username + transfer.Extension(format)
+	w.Header().Set("Content-Type", transfer.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := transfer.Encode(w, format, archive, columns); err != nil {
+		c.Log.Error(err, "export failed", "owner", access.Owner.Username)
+	}
+}
+
+var errDryRun = errors.New("dry run")
+
+// errInvalidImport is a task in an import that can't be added to the list
+type errInvalidImport struct {
+	error
+}
+
+// Import adds the tasks in the request body to the list. The format query
+// parameter names the body's format, and dry_run=true reports what would be
+// imported without changing anything. Tasks with the UUID of a task already in
+// the list update it instead. Otherwise tasks with the same description and
+// due date as a task already in the list, or as an earlier task in the import,
+// are reported as duplicates and skipped.
+func (c *TransferController) Import(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format, err := apis.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid dry_run %q", v)))
+			return
+		}
+	}
+
+	archive, err := transfer.Decode(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	result := &apis.ImportResult{DryRun: dryRun, Created: []apis.Task{}, Updated: []apis.Task{}, Duplicates: []apis.ImportDuplicate{}}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := importTasks(tx, access, archive, result); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	var invalid errInvalidImport
+	if errors.As(err, &invalid) {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	if err != nil && !errors.Is(err, errDryRun) {
+		http.Error(w, "Unable to import tasks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if dryRun {
+		for i := range result.Created {
+			result.Created[i].ID = 0
+		}
+	}
+	render.JSON(w, r, result)
+}
+
+// duplicateKey is what makes two tasks the same for an import
+func duplicateKey(t *apis.Task) string {
+	if t.Due == nil {
+		return t.Description + "\x00"
+	}
+	return t.Description + "\x00" + t.Due.UTC().Format(time.RFC3339)
+}
+
+// importTasks creates the tasks of the archive in the list, or updates the
+// tasks already in it with the same UUIDs. Parents, series, and dependencies
+// between imported tasks are matched up by the ids the tasks had in the
+// archive, and a task that's updated or skipped as a duplicate stands in for
+// the task in the list.
+func importTasks(tx *gorm.DB, access *Access, archive *apis.Archive, result *apis.ImportResult) error {
+	var existing []apis.Task
+	if err := access.Visible(tx).Select("tasks.id", "tasks.uuid", "tasks.description", "tasks.due").Find(&existing).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]uint, len(existing))
+	uuids := make(map[string]uint, len(existing))
+	for i := range existing {
+		seen[duplicateKey(&existing[i])] = existing[i].ID
+		uuids[existing[i].UUID] = existing[i].ID
+	}
+
+	// tasks the importer can't see, like those in the trash, keep their
+	// UUIDs, and imported tasks that would reuse them get new ones
+	var taken []string
+	if err := tx.Unscoped().Model(&apis.Task{}).Where("owner_id = ?", access.Owner.ID).Pluck("uuid", &taken).Error; err != nil {
+		return err
+	}
+	hidden := make(map[string]bool, len(taken))
+	for _, u := range taken {
+		if _, ok := uuids[u]; !ok {
+			hidden[u] = true
+		}
+	}
+
+	var users []apis.User
+	if err := assignable(tx, access.Owner.ID).Find(&users).Error; err != nil {
+		return err
+	}
+	assignees := make(map[string]uint, len(users))
+	for _, u := range users {
+		assignees[u.Username] = u.ID
+	}
+
+	// ids maps the ids in the archive to ids in the list
+	ids := make(map[uint]uint)
+	records := make(map[string]int)
+	var created, matched []*apis.Task
+	var sources []*apis.Task
+	changed := make(map[uint]bool)
+	before := make(map[uint][]uint)
+	uuidRecords := make(map[string]int)
+
+	for i := range archive.Tasks {
+		src := &archive.Tasks[i]
+		rec := i + 1
+		key := duplicateKey(src)
+
+		if src.UUID != "" {
+			u, err := apis.ParseUUID(src.UUID)
+			if err != nil {
+				return errInvalidImport{fmt.Errorf("task %d: %w", rec, err)}
+			}
+			src.UUID = u
+			if n, ok := uuidRecords[u]; ok {
+				return errInvalidImport{fmt.Errorf("task %d: uuid %s repeats task %d", rec, u, n)}
+			}
+			uuidRecords[u] = rec
+		}
+
+		if id, ok := uuids[src.UUID]; ok && src.UUID != "" {
+			task, isChanged, err := updateImportedTask(tx, access, id, src)
+			if err != nil {
+				return importError(rec, err)
+			}
+			if before[id], err = blockerIds(tx, id); err != nil {
+				return err
+			}
+			seen[duplicateKey(task)] = id
+			records[duplicateKey(task)] = rec
+			if src.ID != 0 {
+				ids[src.ID] = id
+			}
+			matched = append(matched, task)
+			changed[id] = isChanged
+			continue
+		}
+
+		if id, ok := seen[key]; ok {
+			dup := apis.ImportDuplicate{Record: rec, Description: src.Description}
+			if n, ok := records[key]; ok {
+				dup.Repeats = n
+			} else {
+				dup.TaskId = id
+			}
+			result.Duplicates = append(result.Duplicates, dup)
+			if src.ID != 0 {
+				ids[src.ID] = id
+			}
+			continue
+		}
+
+		task, err := newImportedTask(access, src, assignees)
+		if err != nil {
+			return errInvalidImport{fmt.Errorf("task %d: %w", rec, err)}
+		}
+		if hidden[task.UUID] {
+			task.UUID = ""
+		}
+		if err := tx.Omit(clause.Associations).Create(task).Error; err != nil {
+			return err
+		}
+		uuids[task.UUID] = task.ID
+		if err := replaceTags(tx, task); err != nil {
+			return err
+		}
+
+		seen[key] = task.ID
+		records[key] = rec
+		if src.ID != 0 {
+			ids[src.ID] = task.ID
+		}
+		created = append(created, task)
+		sources = append(sources, src)
+	}
+
+	for i, task := range created {
+		src := sources[i]
+		if parent, ok := ids[src.ParentId]; ok && src.ParentId != 0 {
+			task.ParentId = parent
+			if err := checkParent(tx, access, task); err != nil {
+				if errors.Is(err, errInvalidParent) {
+					return errInvalidImport{err}
+				}
+				return err
+			}
+			if err := tx.Model(&apis.Task{ID: task.ID}).Update("parent_id", parent).Error; err != nil {
+				return err
+			}
+		}
+
+		if series, ok := ids[src.SeriesId]; ok && src.SeriesId != 0 {
+			if err := tx.Model(&apis.Task{ID: task.ID}).Update("series_id", series).Error; err != nil {
+				return err
+			}
+			task.SeriesId = series
+		} else if err := startSeries(tx, task); err != nil {
+			return err
+		}
+	}
+
+	blockers, err := importDependencies(tx, access, archive.Dependencies, ids, append(created, matched...))
+	if err != nil {
+		return err
+	}
+	var updated []*apis.Task
+	for _, task := range matched {
+		if len(blockers[task.ID]) > 0 {
+			if err := recordBlockers(tx, access, task, before[task.ID]); err != nil {
+				return err
+			}
+			changed[task.ID] = true
+		}
+		if changed[task.ID] {
+			updated = append(updated, task)
+		}
+	}
+
+	for i, task := range created {
+		changes := apis.DiffTasks(&apis.Task{}, task)
+		if b := blockers[task.ID]; len(b) > 0 {
+			changes = append(changes, apis.FieldChange{Field: "blocked_by", After: joinIds(b)})
+		}
+		if err := record(tx, task.ID, access.User.ID, apis.TaskCreated, changes...); err != nil {
+			return err
+		}
+		if err := importNotes(tx, access, task, sources[i]); err != nil {
+			return err
+		}
+	}
+
+	tasks := make([]apis.Task, len(created), len(created)+len(updated))
+	for i, task := range created {
+		tasks[i] = *task
+	}
+	for _, task := range updated {
+		tasks = append(tasks, *task)
+	}
+	if err := markComputed(tx, access, tasks); err != nil {
+		return err
+	}
+	result.Created = tasks[:len(created)]
+	result.Updated = tasks[len(created):]
+	return nil
+}
+
+// importError is the error for a task in an import that can't be changed the
+// way the import asks
+func importError(rec int, err error) error {
+	var invalid errInvalidTask
+	if errors.As(err, &invalid) || errors.Is(err, errProgressOnly) || errors.Is(err, errInvalidParent) {
+		return errInvalidImport{fmt.Errorf("task %d: %w", rec, err)}
+	}
+	return err
+}
+
+// updateImportedTask changes the task in the list with the UUID of a task in
+// an import to match it. The description, due date, priority, state, status,
+// and tags are changed, and annotations the task doesn't have yet are added.
+// Everything else, like the assignee and the checklist, is left alone. It
+// reports whether anything changed.
+func updateImportedTask(tx *gorm.DB, access *Access, id uint, src *apis.Task) (*apis.Task, bool, error) {
+	orig, err := loadTask(tx, access, id)
+	if err != nil {
+		return nil, false, err
+	}
+	if src.Description == "" {
+		return nil, false, errInvalidTask{errors.New("description is required")}
+	}
+
+	proposed := *orig
+	proposed.Description = src.Description
+	proposed.Due = src.Due
+	proposed.Priority = src.Priority
+	proposed.State = src.State
+	proposed.Status = src.Status
+	proposed.Tags = apis.NewTags(apis.TagNames(src.Tags)...)
+	if proposed.State == "" {
+		proposed.State = apis.Open
+	}
+	if proposed.Status == "" {
+		proposed.Status = apis.Todo
+	}
+
+	changed := len(apis.DiffTasks(orig, &proposed)) > 0
+	if changed {
+		// the import is the record of what the task should be, so it isn't
+		// held up by blockers
+		if err := updateTask(tx, access, orig, &proposed, true); err != nil {
+			return nil, false, err
+		}
+	} else {
+		proposed = *orig
+	}
+
+	added, err := importAnnotations(tx, access, proposed.ID, src.Annotations)
+	if err != nil {
+		return nil, false, err
+	}
+	if added && !changed {
+		if err := touch(tx, &proposed); err != nil {
+			return nil, false, err
+		}
+	}
+	return &proposed, changed || added, nil
+}
+
+// newImportedTask makes a task for the list from one in an archive. Tasks
+// assigned to users the list isn't shared with are assigned to the owner.
+func newImportedTask(access *Access, src *apis.Task, assignees map[string]uint) (*apis.Task, error) {
+	task := &apis.Task{
+		CreatedAt:   src.CreatedAt,
+		UpdatedAt:   src.UpdatedAt,
+		Version:     1,
+		OwnerId:     access.Owner.ID,
+		AssigneeId:  access.Owner.ID,
+		Description: src.Description,
+		Due:         src.Due,
+		Priority:    src.Priority,
+		Private:     src.Private,
+		State:       src.State,
+		Status:      src.Status,
+		Tags:        apis.NewTags(apis.TagNames(src.Tags)...),
+		Recurrence:  src.Recurrence,
+		AutoClose:   src.AutoClose,
+		Checklist:   src.Checklist,
+		UUID:        src.UUID,
+	}
+	if task.State == "" {
+		task.State = apis.Open
+	}
+	if task.Status == "" {
+		task.Status = apis.Todo
+	}
+	if id, ok := assignees[src.Assignee.Username]; ok {
+		task.AssigneeId = id
+	}
+	if task.Description == "" {
+		return nil, errors.New("description is required")
+	}
+	if err := task.Validate(); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// importDependencies adds the dependencies of the archive whose blocked task
+// was imported. Dependencies that would make a cycle are skipped. It returns
+// the blockers added to each imported task.
+func importDependencies(tx *gorm.DB, access *Access, deps []apis.Dependency, ids map[uint]uint, tasks []*apis.Task) (map[uint][]uint, error) {
+	imported := make(map[uint]bool, len(tasks))
+	for _, task := range tasks {
+		imported[task.ID] = true
+	}
+
+	edges, err := listEdges(tx, access.Owner.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	blockers := make(map[uint][]uint)
+	for _, d := range deps {
+		taskId, blockerId := ids[d.TaskID], ids[d.BlockerID]
+		if !imported[taskId] || blockerId == 0 || taskId == blockerId || blocks(edges, blockerId, taskId) {
+			continue
+		}
+		dep := apis.Dependency{TaskID: taskId, BlockerID: blockerId, CreatedAt: d.CreatedAt}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dep)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		edges = append(edges, dep)
+		blockers[taskId] = append(blockers[taskId], blockerId)
+	}
+	return blockers, nil
+}
+
+// importNotes adds the comments and annotations of an imported task. The
+// archive could name anyone as the author of a comment, so comments are by the
+// importer, and the text of comments by someone else starts with their name.
+func importNotes(tx *gorm.DB, access *Access, task, src *apis.Task) error {
+	for _, c := range src.Comments {
+		comment := &apis.Comment{
+			CreatedAt:   c.CreatedAt,
+			UpdatedAt:   c.UpdatedAt,
+			TaskID:      task.ID,
+			AuthorId:    access.User.ID,
+			Description: c.Description,
+		}
+		if c.Author != nil && c.Author.Username != "" && c.Author.Username != access.User.Username {
+			comment.Description = fmt.Sprintf("%s wrote: %s", c.Author.Username, c.Description)
+		}
+		if err := tx.Omit(clause.Associations).Create(comment).Error; err != nil {
+			return err
+		}
+		if err := record(tx, task.ID, access.User.ID, apis.CommentAdded, apis.FieldChange{Field: "comment", After: comment.Description}); err != nil {
+			return err
+		}
+	}
+
+	_, err := importAnnotations(tx, access, task.ID, src.Annotations)
+	return err
+}
+
+// importAnnotations adds the annotations a task doesn't already have one with
+// the same description of. It reports whether it added any.
+func importAnnotations(tx *gorm.DB, access *Access, taskId uint, annotations []apis.Annotation) (bool, error) {
+	var have []string
+	if err := tx.Model(&apis.Annotation{}).Where("task_id = ?", taskId).Pluck("description", &have).Error; err != nil {
+		return false, err
+	}
+	exists := make(map[string]bool, len(have))
+	for _, d := range have {
+		exists[d] = true
+	}
+
+	added := false
+	for _, a := range annotations {
+		if a.Description == "" || exists[a.Description] {
+			continue
+		}
+		annotation := &apis.Annotation{
+			CreatedAt:   a.CreatedAt,
+			UpdatedAt:   a.UpdatedAt,
+			TaskID:      taskId,
+			Description: a.Description,
+		}
+		if err := tx.Omit(clause.Associations).Create(annotation).Error; err != nil {
+			return false, err
+		}
+		if err := record(tx, taskId, access.User.ID, apis.AnnotationAdded, apis.FieldChange{Field: "annotation", After: annotation.Description}); err != nil {
+			return false, err
+		}
+		exists[a.Description] = true
+		added = true
+	}
+	return added, nil
+}
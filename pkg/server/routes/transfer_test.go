@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func TestImportCommentAuthors(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.ViewAndUpdate)
+	alice := s.user("alice")
+
+	archive := apis.Archive{
+		Version: apis.ArchiveVersion,
+		Tasks: []apis.Task{{
+			ID:          1,
+			Description: "Fix the build",
+			Status:      apis.Todo,
+			Comments: []apis.Comment{
+				{Description: "flaky on arm", Author: &apis.User{Username: "alice"}},
+				{Description: "I'll take it", Author: &apis.User{Username: "bob"}},
+				{Description: "no author"},
+			},
+		}},
+	}
+
+	// bob imports into alice's list a comment that claims to be by alice
+	result := &apis.ImportResult{}
+	path := fmt.Sprintf("/users/%d/import?format=json", alice.ID)
+	s.expect(http.StatusOK, s.request(http.MethodPost, path, "bob", archive), result)
+	if len(result.Created) != 1 {
+		t.Fatalf("want one task created, got %d", len(result.Created))
+	}
+
+	comments := &apis.CommentList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, taskPath(s, result.Created[0].ID)+"/comments", "alice", nil), comments)
+
+	want := []string{"alice wrote: flaky on arm", "I'll take it", "no author"}
+	if len(comments.Comments) != len(want) {
+		t.Fatalf("want %d comments, got %d", len(want), len(comments.Comments))
+	}
+	for i, c := range comments.Comments {
+		if c.AuthorId != s.user("bob").ID {
+			t.Errorf("comment %d: want author bob, got %d", i, c.AuthorId)
+		}
+		if c.Description != want[i] {
+			t.Errorf("comment %d: want %q, got %q", i, want[i], c.Description)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+)
+
+type TrashContextKey string
+
+const (
+	TrashKey TrashContextKey = "trashCtxKey"
+)
+
+type TrashController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewTrashController(db *gorm.DB, log logr.Logger) *TrashController {
+	return &TrashController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func WithTrashedTask(ctx context.Context, task *apis.Task) context.Context {
+	return context.WithValue(ctx, TrashKey, task)
+}
+
+func TrashedTaskFromContext(ctx context.Context) (*apis.Task, error) {
+	task, ok := ctx.Value(TrashKey).(*apis.Task)
+	if !ok {
+		return nil, errors.New("Expected deleted task in request context")
+	}
+	return task, nil
+}
+
+// trash limits a task query to the deleted tasks the authenticated user may
+// see, along with what was attached to them.
+func trash(db *gorm.DB, access *Access) *gorm.DB {
+	return access.Visible(db.Unscoped()).
+		Where("tasks.deleted_at IS NOT NULL").
+		Preload("Tags").
+		Preload("Assignee").
+		Preload("Comments", "deleted_at IS NULL", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		}).
+		Preload("Comments.Author").
+		Preload("Annotations", "deleted_at IS NULL", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at, id")
+		})
+}
+
+// TrashCtx loads the deleted task named in the request path if the
+// authenticated user may see it.
+func (c *TrashController) TrashCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		taskId := chi.URLParam(r, "taskid")
+		if taskId == "" {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		task := &apis.Task{}
+		if err := trash(c.DB, access).First(task, "tasks.id = ?", taskId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Render(w, r, ErrNotFound)
+				return
+			}
+			http.Error(w, "Unable to retrieve task: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := WithTrashedTask(r.Context(), task)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// List returns the deleted tasks in the requested list that the
+// authenticated user may see, most recently deleted first.
+func (c *TrashController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var tasks []apis.Task
+	if err := trash(c.DB, access).Order("tasks.deleted_at DESC, tasks.id").Find(&tasks).Error; err != nil {
+		http.Error(w, "error retrieving trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := &apis.TrashList{Tasks: make([]apis.TrashedTask, 0, len(tasks))}
+	for i := range tasks {
+		list.Tasks = append(list.Tasks, apis.NewTrashedTask(&tasks[i]))
+	}
+	render.JSON(w, r, list)
+}
+
+func (c *TrashController) Get(w http.ResponseWriter, r *http.Request) {
+	task, err := TrashedTaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, apis.NewTrashedTask(task))
+}
+
+// Restore takes a task out of the trash. Its comments and annotations come
+// back with it.
+func (c *TrashController) Restore(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	task, err := TrashedTaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		return restoreTask(tx, access, task)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to restore task: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", task.ETag())
+	render.JSON(w, r, task)
+}
+
+// restoreTask takes a task out of the trash.
+func restoreTask(tx *gorm.DB, access *Access, task *apis.Task) error {
+	res := tx.Unscoped().Model(&apis.Task{ID: task.ID}).
+		Where("deleted_at IS NOT NULL").
+		Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := record(tx, task.ID, access.User.ID, apis.TaskRestored); err != nil {
+		return err
+	}
+	task.DeletedAt = gorm.DeletedAt{}
+	task.Version++
+	return nil
+}
+
+// Purge permanently deletes a task in the trash along with everything
+// attached to it, including its history.
+func (c *TrashController) Purge(w http.ResponseWriter, r *http.Request) {
+	task, err := TrashedTaskFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := storage.PurgeTasks(c.DB, task.ID); err != nil {
+		http.Error(w, "Unable to purge task: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, apis.NewTrashedTask(task))
+}
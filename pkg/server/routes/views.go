@@ -0,0 +1,249 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/filter"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+)
+
+type ViewContextKey string
+
+const (
+	ViewKey ViewContextKey = "viewCtxKey"
+)
+
+type ViewController struct {
+	DB  *gorm.DB
+	Log logr.Logger
+}
+
+func NewViewController(db *gorm.DB, log logr.Logger) *ViewController {
+	return &ViewController{
+		DB:  db,
+		Log: log,
+	}
+}
+
+func WithView(ctx context.Context, view *apis.SavedView) context.Context {
+	return context.WithValue(ctx, ViewKey, view)
+}
+
+func ViewFromContext(ctx context.Context) (*apis.SavedView, error) {
+	view, ok := ctx.Value(ViewKey).(*apis.SavedView)
+	if !ok {
+		return nil, errors.New("Expected view in request context")
+	}
+	return view, nil
+}
+
+// ViewCtx loads the view named in the request path. Users the list is shared
+// with only see the owner's shared views.
+func (c *ViewController) ViewCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		viewId := chi.URLParam(r, "viewid")
+		if viewId == "" {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		view := &apis.SavedView{}
+		if err := c.DB.First(view, "id = ? AND owner_id = ?", viewId, access.Owner.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				render.Render(w, r, ErrNotFound)
+				return
+			}
+			http.Error(w, "Unable to retrieve view: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !access.IsOwner() && !view.Shared {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		ctx := WithView(r.Context(), view)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireOwner rejects requests from users other than the owner of the list.
+func RequireOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access, err := AccessFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !access.IsOwner() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// List returns the owner's views. Users the list is shared with get only the
+// shared ones.
+func (c *ViewController) List(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	db := c.DB.Where("owner_id = ?", access.Owner.ID)
+	if !access.IsOwner() {
+		db = db.Where("shared = ?", true)
+	}
+
+	var views []apis.SavedView
+	if err := db.Order("name").Find(&views).Error; err != nil {
+		http.Error(w, "error retrieving views: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, apis.SavedViewList{Views: views})
+}
+
+func (c *ViewController) Get(w http.ResponseWriter, r *http.Request) {
+	view, err := ViewFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, view)
+}
+
+// Create saves a view for the owner of the list.
+func (c *ViewController) Create(w http.ResponseWriter, r *http.Request) {
+	access, err := AccessFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view := &apis.SavedView{}
+	if err := bindView(r, view); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	view.ID = 0
+	view.OwnerId = access.Owner.ID
+
+	if err := c.save(view); err != nil {
+		c.saveError(w, r, view, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	render.JSON(w, r, view)
+}
+
+// Update replaces the name, filter, sort, columns, and flags of a view.
+func (c *ViewController) Update(w http.ResponseWriter, r *http.Request) {
+	view, err := ViewFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := &apis.SavedView{}
+	if err := bindView(r, req); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	req.ID, req.OwnerId, req.CreatedAt = view.ID, view.OwnerId, view.CreatedAt
+
+	if err := c.save(req); err != nil {
+		c.saveError(w, r, req, err)
+		return
+	}
+
+	render.JSON(w, r, req)
+}
+
+func (c *ViewController) Delete(w http.ResponseWriter, r *http.Request) {
+	view, err := ViewFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the calendar feeds of the view go with it
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("view_id = ?", view.ID).Delete(&apis.Feed{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(view).Error
+	})
+	if err != nil {
+		http.Error(w, "Unable to delete view: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, view)
+}
+
+// bindView decodes a view and checks its filter parses.
+func bindView(r *http.Request, view *apis.SavedView) error {
+	if err := render.Bind(r, view); err != nil {
+		return err
+	}
+	if view.Filter != "" {
+		if _, err := filter.Parse(view.Filter, filter.Env{}); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	return nil
+}
+
+var errDuplicateView = errors.New("a view with that name already exists")
+
+// save creates or updates a view. A new default replaces the owner's old
+// one.
+func (c *ViewController) save(view *apis.SavedView) error {
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&apis.SavedView{}).
+			Where("owner_id = ? AND name = ? AND id <> ?", view.OwnerId, view.Name, view.ID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errDuplicateView
+		}
+
+		if view.Default {
+			err := tx.Model(&apis.SavedView{}).
+				Where("owner_id = ? AND id <> ?", view.OwnerId, view.ID).
+				Update("default", false).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Save(view).Error
+	})
+}
+
+func (c *ViewController) saveError(w http.ResponseWriter, r *http.Request, view *apis.SavedView, err error) {
+	if errors.Is(err, errDuplicateView) {
+		render.Render(w, r, ErrConflict(fmt.Errorf("a view named %s already exists", view.Name)))
+		return
+	}
+	http.Error(w, "Unable to save view: "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func viewPath(s *testServer, id uint) string {
+	return listPath(s, fmt.Sprintf("views/%d", id))
+}
+
+// defaults returns the names of alice's default views
+func (s *testServer) defaults() []string {
+	s.t.Helper()
+	views := &apis.SavedViewList{}
+	s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "views"), "alice", nil), views)
+	var names []string
+	for _, v := range views.Views {
+		if v.Default {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+func TestViews(t *testing.T) {
+	s := newTestServer(t)
+	s.share("alice", "bob", apis.View)
+	s.share("alice", "carol", apis.ViewAndUpdate)
+	s.user("dave")
+
+	doing := &apis.SavedView{}
+	body := map[string]interface{}{"name": "doing", "filter": "status:doing and priority>=3", "sort": "-priority", "shared": true, "default": true}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, listPath(s, "views"), "alice", body), doing)
+	mine := &apis.SavedView{}
+	s.expect(http.StatusCreated, s.request(http.MethodPost, listPath(s, "views"), "alice", map[string]interface{}{"name": "mine", "default": true}), mine)
+
+	// a new default replaces the old one
+	if got := s.defaults(); fmt.Sprint(got) != "[mine]" {
+		t.Errorf("want mine to be the only default, got %v", got)
+	}
+	s.expect(http.StatusOK, s.request(http.MethodPut, viewPath(s, doing.ID), "alice", body), nil)
+	if got := s.defaults(); fmt.Sprint(got) != "[doing]" {
+		t.Errorf("want doing to be the only default, got %v", got)
+	}
+
+	// delegates see shared views but can't change any
+	for _, delegate := range []string{"bob", "carol"} {
+		views := &apis.SavedViewList{}
+		s.expect(http.StatusOK, s.request(http.MethodGet, listPath(s, "views"), delegate, nil), views)
+		if len(views.Views) != 1 || views.Views[0].ID != doing.ID {
+			t.Errorf("as %s: want only the shared view, got %+v", delegate, views.Views)
+		}
+		s.expect(http.StatusOK, s.request(http.MethodGet, viewPath(s, doing.ID), delegate, nil), nil)
+		s.expect(http.StatusNotFound, s.request(http.MethodGet, viewPath(s, mine.ID), delegate, nil), nil)
+		s.expect(http.StatusForbidden, s.request(http.MethodPost, listPath(s, "views"), delegate, map[string]interface{}{"name": delegate}), nil)
+		s.expect(http.StatusForbidden, s.request(http.MethodPut, viewPath(s, doing.ID), delegate, body), nil)
+		s.expect(http.StatusForbidden, s.request(http.MethodDelete, viewPath(s, doing.ID), delegate, nil), nil)
+	}
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, listPath(s, "views"), "dave", nil), nil)
+	s.expect(http.StatusForbidden, s.request(http.MethodGet, viewPath(s, doing.ID), "dave", nil), nil)
+
+	invalid := []map[string]interface{}{
+		{"name": "bad filter", "filter": "priority>>3"},
+		{"name": "unclosed", "filter": "(status:todo"},
+		{"name": "bad sort", "sort": "color"},
+		{"name": "bad column", "columns": []string{"color"}},
+		{"name": " "},
+	}
+	for _, b := range invalid {
+		s.expect(http.StatusBadRequest, s.request(http.MethodPost, listPath(s, "views"), "alice", b), nil)
+	}
+	s.expect(http.StatusBadRequest, s.request(http.MethodPut, viewPath(s, mine.ID), "alice", invalid[0]), nil)
+
+	s.expect(http.StatusConflict, s.request(http.MethodPost, listPath(s, "views"), "alice", map[string]interface{}{"name": "doing"}), nil)
+	s.expect(http.StatusConflict, s.request(http.MethodPut, viewPath(s, mine.ID), "alice", map[string]interface{}{"name": "doing"}), nil)
+
+	s.expect(http.StatusOK, s.request(http.MethodDelete, viewPath(s, doing.ID), "alice", nil), nil)
+	s.expect(http.StatusNotFound, s.request(http.MethodGet, viewPath(s, doing.ID), "alice", nil), nil)
+	if got := s.defaults(); len(got) != 0 {
+		t.Errorf("want no default, got %v", got)
+	}
+}
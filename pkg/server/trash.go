@@ -0,0 +1,27 @@
+package server
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/storage"
+)
+
+// trashInterval is how often CollectTrash looks for expired tasks
+const trashInterval = time.Hour
+
+// CollectTrash purges tasks that have been in the trash longer than retention.
+// It checks right away and then every hour, and it never returns.
+func CollectTrash(db *gorm.DB, retention time.Duration, log logr.Logger) {
+	for {
+		n, err := storage.PurgeTrash(db, time.Now().Add(-retention))
+		if err != nil {
+			log.Error(err, "Unable to purge trash")
+		} else if n > 0 {
+			log.V(0).Info("Purged expired tasks", "count", n)
+		}
+		time.Sleep(trashInterval)
+	}
+}
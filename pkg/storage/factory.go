@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -8,7 +10,13 @@ import (
 
 func New(c CompletedConfig) (*gorm.DB, error) {
 	if c.DSN != "" {
-		return gorm.Open(postgres.Open(c.DSN), &gorm.Config{})
+		return gorm.Open(postgres.Open(c.DSN), &gorm.Config{NowFunc: Now})
 	}
-	return gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	return gorm.Open(sqlite.Open("test.db"), &gorm.Config{NowFunc: Now})
+}
+
+// Now is the time gorm stamps rows with. It's in UTC because sqlite keeps
+// times as text with their offset and compares them as strings.
+func Now() time.Time {
+	return time.Now().UTC()
 }
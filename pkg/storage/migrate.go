@@ -14,6 +14,12 @@ func Migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(&apis.Task{}); err != nil {
 		return err
 	}
+	if err := migrateUUIDs(db); err != nil {
+		return err
+	}
+	if err := migrateTaskTimes(db); err != nil {
+		return err
+	}
 	if err := db.AutoMigrate(&apis.Policy{}); err != nil {
 		return err
 	}
@@ -23,5 +29,79 @@ func Migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(&apis.Annotation{}); err != nil {
 		return err
 	}
-	return nil
+	if err := db.AutoMigrate(&apis.Tag{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.Change{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.Dependency{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.SavedView{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.Feed{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.CalendarObject{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.Tombstone{}); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&apis.AccessToken{}); err != nil {
+		return err
+	}
+	return migrateSearch(db)
+}
+
+// migrateUUIDs gives a UUID to the tasks created before tasks had them
+func migrateUUIDs(db *gorm.DB) error {
+	var ids []uint
+	if err := db.Unscoped().Model(&apis.Task{}).Where("uuid IS NULL OR uuid = ''").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if err := tx.Unscoped().Model(&apis.Task{}).Where("id = ?", id).UpdateColumn("uuid", apis.NewUUID()).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateTaskTimes rewrites the times of tasks saved before they were kept in
+// UTC. sqlite stores times as text with their offset, so only times in the
+// same zone compare in order. Other databases store instants.
+func migrateTaskTimes(db *gorm.DB) error {
+	if db.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	var tasks []apis.Task
+	err := db.Unscoped().Select("id", "due", "created_at", "updated_at", "deleted_at").
+		Where("due NOT LIKE '%+00:00' OR created_at NOT LIKE '%+00:00' OR updated_at NOT LIKE '%+00:00' OR deleted_at NOT LIKE '%+00:00'").
+		Find(&tasks).Error
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range tasks {
+			times := map[string]interface{}{
+				"created_at": t.CreatedAt.UTC(),
+				"updated_at": t.UpdatedAt.UTC(),
+			}
+			if t.Due != nil {
+				times["due"] = t.Due.UTC()
+			}
+			if t.DeletedAt.Valid {
+				times["deleted_at"] = t.DeletedAt.Time.UTC()
+			}
+			if err := tx.Unscoped().Model(&apis.Task{}).Where("id = ?", t.ID).UpdateColumns(times).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func TestMigrateTaskTimes(t *testing.T) {
+	db := testDB(t)
+	alice := &apis.User{Username: "alice"}
+	create(t, db, alice)
+	task := newTask(t, db, alice, "saved with an offset")
+
+	// how sqlite kept times saved in a zone east of UTC
+	err := db.Exec("UPDATE tasks SET due = ?, updated_at = ? WHERE id = ?", "2022-11-15 12:00:00+05:00", "2022-11-14 12:00:00+05:00", task.ID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := time.Date(2022, 11, 15, 8, 0, 0, 0, time.UTC)
+	if n := count(t, db, &apis.Task{}, "due < ?", bound); n != 0 {
+		t.Fatalf("want the offset to hide the task from the comparison before migrating, got %d", n)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, &apis.Task{}, "due < ?", bound); n != 1 {
+		t.Errorf("want the task due at 07:00 UTC found before 08:00 UTC, got %d", n)
+	}
+	if n := count(t, db, &apis.Task{}, "updated_at < ?", time.Date(2022, 11, 14, 8, 0, 0, 0, time.UTC)); n != 1 {
+		t.Errorf("want the update time rewritten too, got %d", n)
+	}
+
+	got := &apis.Task{}
+	if err := db.First(got, task.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2022, 11, 15, 7, 0, 0, 0, time.UTC); got.Due == nil || !got.Due.Equal(want) {
+		t.Errorf("want the task due %s, got %v", want, got.Due)
+	}
+}
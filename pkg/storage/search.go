@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// SearchIndex is the sqlite FTS5 table that indexes the descriptions of tasks,
+// comments, and annotations.
+const SearchIndex = "search_index"
+
+var errNoFTS5 = errors.New("sqlite was built without FTS5")
+
+// SearchSource is a table whose descriptions are searchable.
+type SearchSource struct {
+	Table string
+	Kind  string
+
+	// TaskColumn holds the id of the task a row belongs to
+	TaskColumn string
+}
+
+var SearchSources = []SearchSource{
+	{"tasks", apis.SearchTask, "id"},
+	{"comments", apis.SearchComment, "task_id"},
+	{"annotations", apis.SearchAnnotation, "task_id"},
+}
+
+// migrateSearch sets up full text search. Postgres gets a generated tsvector
+// column with a GIN index on each searchable table. Sqlite gets an FTS5 table
+// kept up to date by triggers, but only if the driver was built with FTS5
+// (the sqlite_fts5 build tag). Without it search falls back to matching
+// substrings.
+func migrateSearch(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return migratePostgresSearch(db)
+	case "sqlite":
+		return migrateSqliteSearch(db)
+	}
+	return nil
+}
+
+func migratePostgresSearch(db *gorm.DB) error {
+	for _, s := range SearchSources {
+		stmts := []string{
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector
+				GENERATED ALWAYS AS (to_tsvector('english', coalesce(description, ''))) STORED`, s.Table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_search_vector ON %s USING GIN (search_vector)`, s.Table, s.Table),
+		}
+		for _, stmt := range stmts {
+			if err := db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func migrateSqliteSearch(db *gorm.DB) error {
+	if HasSearchIndex(db) {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(
+			kind UNINDEXED, row_id UNINDEXED, task_id UNINDEXED, body, tokenize = 'porter unicode61')`, SearchIndex)).Error
+		if err != nil {
+			if strings.Contains(err.Error(), "no such module") {
+				return errNoFTS5
+			}
+			return err
+		}
+
+		for _, s := range SearchSources {
+			// soft deleted rows leave the index and come back when they're
+			// restored
+			insert := fmt.Sprintf(`INSERT INTO %s (kind, row_id, task_id, body)
+				SELECT '%s', new.id, new.%s, new.description WHERE new.deleted_at IS NULL;`, SearchIndex, s.Kind, s.TaskColumn)
+			remove := fmt.Sprintf(`DELETE FROM %s WHERE kind = '%s' AND row_id = old.id;`, SearchIndex, s.Kind)
+
+			stmts := []string{
+				fmt.Sprintf(`CREATE TRIGGER %s_search_insert AFTER INSERT ON %s BEGIN %s END`, s.Table, s.Table, insert),
+				fmt.Sprintf(`CREATE TRIGGER %s_search_update AFTER UPDATE OF description, deleted_at ON %s BEGIN %s %s END`, s.Table, s.Table, remove, insert),
+				fmt.Sprintf(`CREATE TRIGGER %s_search_delete AFTER DELETE ON %s BEGIN %s END`, s.Table, s.Table, remove),
+				fmt.Sprintf(`INSERT INTO %s (kind, row_id, task_id, body)
+					SELECT '%s', id, %s, description FROM %s WHERE deleted_at IS NULL`, SearchIndex, s.Kind, s.TaskColumn, s.Table),
+			}
+			for _, stmt := range stmts {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errNoFTS5) {
+		return nil
+	}
+	return err
+}
+
+// HasSearchIndex reports whether a sqlite database has the FTS5 search index.
+func HasSearchIndex(db *gorm.DB) bool {
+	var count int64
+	db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", SearchIndex).Scan(&count)
+	return count > 0
+}
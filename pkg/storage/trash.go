@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// PurgeTasks permanently deletes tasks along with their tags, comments,
+// annotations, history, dependencies, and CalDAV resource names. Their
+// subtasks become top level tasks, and a tombstone is left at each task's
+// CalDAV resource.
+func PurgeTasks(db *gorm.DB, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := buryTasks(tx, ids); err != nil {
+			return err
+		}
+		for _, m := range []interface{}{&apis.Tag{}, &apis.Comment{}, &apis.Annotation{}, &apis.Change{}, &apis.CalendarObject{}} {
+			if err := tx.Unscoped().Where("task_id IN ?", ids).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("task_id IN ? OR blocker_id IN ?", ids, ids).Delete(&apis.Dependency{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&apis.Task{}).Where("parent_id IN ?", ids).Update("parent_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&apis.Task{}).Error
+	})
+}
+
+// buryTasks leaves a tombstone at the CalDAV resource of each task. Tasks a
+// client didn't name are at their UUID with an .ics extension.
+func buryTasks(tx *gorm.DB, ids []uint) error {
+	var tasks []apis.Task
+	if err := tx.Unscoped().Select("id", "uuid", "owner_id").Where("id IN ?", ids).Order("id").Find(&tasks).Error; err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+	var objects []apis.CalendarObject
+	if err := tx.Where("task_id IN ?", ids).Find(&objects).Error; err != nil {
+		return err
+	}
+	names := make(map[uint]string, len(objects))
+	for _, o := range objects {
+		names[o.TaskId] = o.Name
+	}
+
+	now := time.Now().UTC()
+	tombstones := make([]apis.Tombstone, len(tasks))
+	for i, t := range tasks {
+		name, ok := names[t.ID]
+		if !ok {
+			name = t.UUID + apis.ICalExtension
+		}
+		tombstones[i] = apis.Tombstone{OwnerId: t.OwnerId, Name: name, TaskId: t.ID, PurgedAt: now}
+	}
+	return tx.Create(&tombstones).Error
+}
+
+// PurgeTrash permanently deletes the tasks that were deleted before cutoff. It
+// returns how many it purged. The cutoff may be in any zone.
+func PurgeTrash(db *gorm.DB, cutoff time.Time) (int, error) {
+	var ids []uint
+	err := db.Unscoped().Model(&apis.Task{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff.UTC()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), PurgeTasks(db, ids...)
+}
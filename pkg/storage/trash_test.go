@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "doit.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// create stores the rows, failing the test if it can't
+func create(t *testing.T, db *gorm.DB, rows ...interface{}) {
+	t.Helper()
+	for _, r := range rows {
+		if err := db.Omit(clause.Associations).Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// trash soft deletes the task as if it was deleted at the time
+func trash(t *testing.T, db *gorm.DB, task *apis.Task, at time.Time) {
+	t.Helper()
+	if err := db.Unscoped().Model(task).Update("deleted_at", at).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// count returns how many rows of the model match, deleted or not
+func count(t *testing.T, db *gorm.DB, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Unscoped().Model(model).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func newTask(t *testing.T, db *gorm.DB, owner *apis.User, desc string) *apis.Task {
+	t.Helper()
+	task := &apis.Task{
+		OwnerId:     owner.ID,
+		AssigneeId:  owner.ID,
+		Description: desc,
+		State:       apis.Open,
+		Status:      apis.Todo,
+		UUID:        apis.NewUUID(),
+	}
+	create(t, db, task)
+	return task
+}
+
+func TestPurgeTasks(t *testing.T) {
+	db := testDB(t)
+	alice := &apis.User{Username: "alice"}
+	create(t, db, alice)
+
+	doomed := newTask(t, db, alice, "doomed")
+	kept := newTask(t, db, alice, "kept")
+	child := newTask(t, db, alice, "child")
+	if err := db.Model(child).Update("parent_id", doomed.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range []*apis.Task{doomed, kept} {
+		create(t, db,
+			&apis.Tag{TaskID: task.ID, Name: "home"},
+			&apis.Comment{TaskID: task.ID, AuthorId: alice.ID, Description: "comment"},
+			&apis.Annotation{TaskID: task.ID, Description: "annotation"},
+			&apis.Change{TaskID: task.ID, ActorId: alice.ID, Action: apis.TaskCreated, Fields: []apis.FieldChange{}},
+			&apis.CalendarObject{OwnerId: alice.ID, Name: task.Description + ".ics", TaskId: task.ID},
+		)
+	}
+	create(t, db,
+		&apis.Dependency{TaskID: doomed.ID, BlockerID: kept.ID},
+		&apis.Dependency{TaskID: child.ID, BlockerID: doomed.ID},
+		&apis.Dependency{TaskID: child.ID, BlockerID: kept.ID},
+	)
+	trash(t, db, doomed, time.Now())
+
+	if err := PurgeTasks(db, doomed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, db, &apis.Task{}, "id = ?", doomed.ID); n != 0 {
+		t.Errorf("want the task gone, got %d", n)
+	}
+	for _, m := range []interface{}{&apis.Tag{}, &apis.Comment{}, &apis.Annotation{}, &apis.Change{}, &apis.CalendarObject{}} {
+		if n := count(t, db, m, "task_id = ?", doomed.ID); n != 0 {
+			t.Errorf("%T: want the purged task's rows gone, got %d", m, n)
+		}
+		if n := count(t, db, m, "task_id = ?", kept.ID); n != 1 {
+			t.Errorf("%T: want the other task's row kept, got %d", m, n)
+		}
+	}
+	if n := count(t, db, &apis.Dependency{}, "task_id = ? OR blocker_id = ?", doomed.ID, doomed.ID); n != 0 {
+		t.Errorf("want the purged task's dependencies gone, got %d", n)
+	}
+	if n := count(t, db, &apis.Dependency{}, "task_id = ? AND blocker_id = ?", child.ID, kept.ID); n != 1 {
+		t.Errorf("want other dependencies kept, got %d", n)
+	}
+
+	promoted := &apis.Task{}
+	if err := db.First(promoted, child.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if promoted.ParentId != 0 {
+		t.Errorf("want the subtask promoted to the top level, got parent %d", promoted.ParentId)
+	}
+
+	var tombstones []apis.Tombstone
+	if err := db.Find(&tombstones).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tombstones) != 1 || tombstones[0].TaskId != doomed.ID || tombstones[0].Name != "doomed.ics" || tombstones[0].OwnerId != alice.ID {
+		t.Errorf("want a tombstone at the task's CalDAV resource, got %+v", tombstones)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := testDB(t)
+	alice := &apis.User{Username: "alice"}
+	create(t, db, alice)
+
+	now := time.Now()
+	expired := newTask(t, db, alice, "expired")
+	recent := newTask(t, db, alice, "recent")
+	live := newTask(t, db, alice, "live")
+	trash(t, db, expired, now.Add(-31*24*time.Hour))
+	trash(t, db, recent, now.Add(-29*24*time.Hour))
+
+	n, err := PurgeTrash(db, now.Add(-30*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want one task purged, got %d", n)
+	}
+	if n := count(t, db, &apis.Task{}, "id = ?", expired.ID); n != 0 {
+		t.Errorf("want the expired task purged, got %d", n)
+	}
+	if n := count(t, db, &apis.Task{}, "id IN ?", []uint{recent.ID, live.ID}); n != 2 {
+		t.Errorf("want the recently deleted and live tasks kept, got %d", n)
+	}
+
+	// nothing is left to purge
+	if n, err := PurgeTrash(db, now.Add(-30*24*time.Hour)); err != nil || n != 0 {
+		t.Errorf("want nothing purged again, got %d and %v", n, err)
+	}
+}
+
+func TestPurgeTrashZone(t *testing.T) {
+	db := testDB(t)
+	alice := &apis.User{Username: "alice"}
+	create(t, db, alice)
+
+	// deleted an hour after the cutoff, which is later in the day east of UTC
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	recent := newTask(t, db, alice, "recent")
+	trash(t, db, recent, cutoff.Add(time.Hour).UTC())
+
+	n, err := PurgeTrash(db, cutoff.In(time.FixedZone("", 5*60*60)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || count(t, db, &apis.Task{}, "id = ?", recent.ID) != 1 {
+		t.Errorf("want the task deleted after the cutoff kept, got %d purged", n)
+	}
+}
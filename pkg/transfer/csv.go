@@ -0,0 +1,304 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+var (
+	// Columns are the CSV columns a task can be written with. Multiline
+	// columns like comments have a line per item.
+	Columns = []string{
+		"id",
+		"desc",
+		"created",
+		"updated",
+		"due",
+		"priority",
+		"state",
+		"status",
+		"tags",
+		"private",
+		"assignee",
+		"recurrence",
+		"parent",
+		"auto_close",
+		"checklist",
+		"comments",
+		"annotations",
+	}
+
+	// DefaultColumns are the columns exported when none are chosen
+	DefaultColumns = []string{"id", "desc", "due", "priority", "state", "status", "tags", "assignee"}
+)
+
+// ParseColumns reads a comma separated list of CSV columns. An empty list is
+// DefaultColumns.
+func ParseColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultColumns, nil
+	}
+
+	seen := make(map[string]bool)
+	var columns []string
+	for _, col := range strings.Split(s, ",") {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if col == "" || seen[col] {
+			continue
+		}
+		if !isColumn(col) {
+			return nil, fmt.Errorf("invalid column %q. use any of %s", col, strings.Join(Columns, ", "))
+		}
+		seen[col] = true
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+func isColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCSV(w io.Writer, tasks []apis.Task, columns []string) error {
+	if columns == nil {
+		columns = DefaultColumns
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for i := range tasks {
+		for c, col := range columns {
+			row[c] = csvValue(&tasks[i], col)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(t *apis.Task, column string) string {
+	switch column {
+	case "id":
+		return strconv.FormatUint(uint64(t.ID), 10)
+	case "desc":
+		return t.Description
+	case "created":
+		return formatTime(t.CreatedAt)
+	case "updated":
+		return formatTime(t.UpdatedAt)
+	case "due":
+		if t.Due == nil {
+			return ""
+		}
+		return formatTime(*t.Due)
+	case "priority":
+		return strconv.Itoa(int(t.Priority))
+	case "state":
+		return string(t.State)
+	case "status":
+		return string(t.Status)
+	case "tags":
+		return strings.Join(apis.TagNames(t.Tags), ",")
+	case "private":
+		return strconv.FormatBool(t.Private)
+	case "assignee":
+		return t.Assignee.Username
+	case "recurrence":
+		return t.Recurrence
+	case "parent":
+		if t.ParentId == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(t.ParentId), 10)
+	case "auto_close":
+		return strconv.FormatBool(t.AutoClose)
+	case "checklist":
+		lines := make([]string, len(t.Checklist))
+		for i, item := range t.Checklist {
+			lines[i] = item.String()
+		}
+		return strings.Join(lines, "\n")
+	case "comments":
+		lines := make([]string, len(t.Comments))
+		for i, c := range t.Comments {
+			lines[i] = c.Description
+		}
+		return strings.Join(lines, "\n")
+	case "annotations":
+		lines := make([]string, len(t.Annotations))
+		for i, a := range t.Annotations {
+			lines[i] = a.Description
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func decodeCSV(r io.Reader) ([]apis.Task, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	hasDesc := false
+	for i, h := range header {
+		col := strings.ToLower(strings.TrimSpace(h))
+		if !isColumn(col) {
+			return nil, fmt.Errorf("line 1: invalid column %q. use any of %s", h, strings.Join(Columns, ", "))
+		}
+		columns[i] = col
+		hasDesc = hasDesc || col == "desc"
+	}
+	if !hasDesc {
+		return nil, errors.New("line 1: the desc column is required")
+	}
+
+	var tasks []apis.Task
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return tasks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		task := apis.Task{State: apis.Open, Status: apis.Todo}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if err := setCSVValue(&task, columns[i], value); err != nil {
+				line, _ := cr.FieldPos(i)
+				return nil, fmt.Errorf("line %d: invalid %s %q", line, columns[i], value)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+}
+
+func setCSVValue(t *apis.Task, column, value string) error {
+	var err error
+	switch column {
+	case "id":
+		t.ID, err = parseId(value)
+	case "desc":
+		t.Description = value
+	case "created":
+		t.CreatedAt, err = parseTime(value)
+	case "updated":
+		t.UpdatedAt, err = parseTime(value)
+	case "due":
+		if value != "" {
+			var due time.Time
+			due, err = parseTime(value)
+			t.Due = &due
+		}
+	case "priority":
+		if value != "" {
+			var p uint64
+			p, err = strconv.ParseUint(value, 10, 8)
+			t.Priority = apis.Priority(p)
+		}
+	case "state":
+		if value != "" {
+			t.State = apis.State(strings.ToLower(value))
+		}
+	case "status":
+		if value != "" {
+			t.Status = apis.Status(strings.ToLower(value))
+		}
+	case "tags":
+		t.Tags = apis.NewTags(strings.Split(value, ",")...)
+	case "private":
+		t.Private, err = parseBool(value)
+	case "assignee":
+		t.Assignee.Username = value
+	case "recurrence":
+		t.Recurrence = value
+	case "parent":
+		t.ParentId, err = parseId(value)
+	case "auto_close":
+		t.AutoClose, err = parseBool(value)
+	case "checklist":
+		for _, line := range lines(value) {
+			t.Checklist = append(t.Checklist, apis.ParseChecklistItem(line))
+		}
+	case "comments":
+		for _, line := range lines(value) {
+			t.Comments = append(t.Comments, apis.Comment{Description: line})
+		}
+	case "annotations":
+		for _, line := range lines(value) {
+			t.Annotations = append(t.Annotations, apis.Annotation{Description: line})
+		}
+	}
+	return err
+}
+
+// lines splits a multiline value, dropping blank lines
+func lines(value string) []string {
+	var out []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func parseId(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	return uint(id), err
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseTime reads a date in any of the formats dateparse understands. Dates
+// without a zone are UTC.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return dateparse.ParseIn(value, time.UTC)
+}
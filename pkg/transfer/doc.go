@@ -0,0 +1,32 @@
+/*
+Package transfer reads and writes task lists in the formats doit exports and
+imports.
+
+The JSON format is an apis.Archive and keeps everything about the tasks. CSV
+has a header row naming its columns, which may be any of Columns in any order,
+and a row per task. todo.txt has a line per task:
+
+	x 2024-05-02 2024-04-30 Renew passport +errands @town due:2024-05-10 pri:B
+
+Priorities (A) through (Z) are apis.Priority 26 through 1, so (A) is the most
+urgent. Tags are written as +tag unless they already start with @, and due
+dates are whole days in UTC. The status is written as status:abandoned and
+the like when the x doesn't already imply it.
+
+The Taskwarrior format is what task export writes and task import reads.
+Tasks keep their UUIDs, so importing the same export again finds the tasks it
+made before. Pending tasks are todo, or doing once started, waiting tasks are
+backlog, and completed and deleted tasks are done and abandoned. Backlog tasks
+are exported waiting until someday. Priorities H, M, and L are 3, 2, and 1, and
+the project is kept as a tag like project:home.
+
+The iCalendar format is a VCALENDAR with a VTODO for each task, identified by
+the task's UUID. Tags are CATEGORIES, annotations are the paragraphs of the
+DESCRIPTION, and subtasks are RELATED-TO their parents. Priorities 3 and above
+are PRIORITY 1, 2 is 5, and 1 is 9. Times are written in UTC and read in their
+TZID. UIDs that aren't UUIDs are read as apis.NameUUID of the UID.
+
+Every format decodes to an apis.Archive. Formats that can't hold something,
+like todo.txt comments, leave it empty.
+*/
+package transfer
@@ -0,0 +1,611 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// Layouts of iCalendar dates and times
+const (
+	icalDate     = "20060102"
+	icalDateTime = "20060102T150405"
+	icalUTC      = "20060102T150405Z"
+)
+
+// icalLineLength is the most octets a content line may have before it's
+// folded
+const icalLineLength = 75
+
+// maxICalLine is the longest physical line readICal accepts
+const maxICalLine = 1 << 20
+
+// annotationSeparator separates the annotations of a task in its DESCRIPTION
+const annotationSeparator = "\n\n"
+
+// Statuses of VTODO components
+const (
+	icalNeedsAction = "NEEDS-ACTION"
+	icalInProcess   = "IN-PROCESS"
+	icalCompleted   = "COMPLETED"
+	icalCancelled   = "CANCELLED"
+)
+
+// ICalPriority converts a task priority to a VTODO priority, where 1 is the
+// most urgent and 9 the least. Priorities of 3 and above are 1, 2 is 5, 1 is
+// 9, and 0 is 0, which means undefined.
+func ICalPriority(p apis.Priority) int {
+	switch {
+	case p == 0:
+		return 0
+	case p == 1:
+		return 9
+	case p == 2:
+		return 5
+	}
+	return 1
+}
+
+// PriorityFromICal converts a VTODO priority to a task priority. 1 through 4
+// are 3, 5 is 2, 6 through 9 are 1, and 0 is 0.
+func PriorityFromICal(p int) (apis.Priority, bool) {
+	switch {
+	case p < 0 || p > 9:
+		return 0, false
+	case p == 0:
+		return 0, true
+	case p < 5:
+		return 3, true
+	case p == 5:
+		return 2, true
+	}
+	return 1, true
+}
+
+// ICalStatus is the VTODO status of a task
+func ICalStatus(t *apis.Task) string {
+	switch {
+	case t.Status == apis.Abandoned:
+		return icalCancelled
+	case finished(t):
+		return icalCompleted
+	case t.Status == apis.Doing:
+		return icalInProcess
+	}
+	return icalNeedsAction
+}
+
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes a content line, folding it so no line is longer than
+// icalLineLength octets. Folds don't split UTF-8 sequences.
+func (iw *icalWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+	s := name + ":" + value
+	limit := icalLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		iw.w.WriteString(s[:cut])
+		iw.w.WriteString("\r\n ")
+		s = s[cut:]
+		// the space that starts a continuation counts toward its length
+		limit = icalLineLength - 1
+	}
+	iw.w.WriteString(s)
+	_, iw.err = iw.w.WriteString("\r\n")
+}
+
+func (iw *icalWriter) time(name string, t time.Time) {
+	if !t.IsZero() {
+		iw.line(name, t.UTC().Format(icalUTC))
+	}
+}
+
+// icalEscape escapes the characters with special meaning in a TEXT value
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func encodeICal(w io.Writer, archive *apis.Archive) error {
+	stamp := archive.ExportedAt
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	uuids := make(map[uint]string, len(archive.Tasks))
+	for i := range archive.Tasks {
+		uuids[archive.Tasks[i].ID] = archive.Tasks[i].UUID
+	}
+
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//doit//doit//EN")
+	if archive.Owner != "" {
+		iw.line("X-WR-CALNAME", icalEscape("doit: "+archive.Owner))
+	}
+	for i := range archive.Tasks {
+		writeVTodo(iw, &archive.Tasks[i], stamp, uuids)
+	}
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// EncodeVTodo writes a calendar with just the VTODO of a task, like a CalDAV
+// calendar object resource. The UID is the task's UUID, and parent is the UID
+// of the task's parent, if it has one.
+func EncodeVTodo(w io.Writer, t *apis.Task, parent string) error {
+	uuids := make(map[uint]string)
+	if parent != "" {
+		uuids[t.ParentId] = parent
+	}
+
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//doit//doit//EN")
+	writeVTodo(iw, t, time.Now(), uuids)
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+func writeVTodo(iw *icalWriter, t *apis.Task, stamp time.Time, uuids map[uint]string) {
+	iw.line("BEGIN", "VTODO")
+	iw.line("UID", t.UUID)
+	iw.time("DTSTAMP", stamp)
+	iw.time("CREATED", t.CreatedAt)
+	iw.time("LAST-MODIFIED", t.UpdatedAt)
+	iw.line("SUMMARY", icalEscape(t.Description))
+
+	if len(t.Annotations) > 0 {
+		notes := make([]string, len(t.Annotations))
+		for i, a := range t.Annotations {
+			notes[i] = a.Description
+		}
+		iw.line("DESCRIPTION", icalEscape(strings.Join(notes, annotationSeparator)))
+	}
+	if t.Due != nil {
+		iw.time("DUE", *t.Due)
+	}
+	if p := ICalPriority(t.Priority); p != 0 {
+		iw.line("PRIORITY", strconv.Itoa(p))
+	}
+
+	status := ICalStatus(t)
+	iw.line("STATUS", status)
+	if status == icalCompleted {
+		iw.time("COMPLETED", t.UpdatedAt)
+	}
+
+	if names := apis.TagNames(t.Tags); len(names) > 0 {
+		for i, n := range names {
+			names[i] = icalEscape(n)
+		}
+		iw.line("CATEGORIES", strings.Join(names, ","))
+	}
+	if t.Recurrence != "" {
+		if rule, err := apis.RecurrenceRule(t.Recurrence); err == nil {
+			iw.line("RRULE", rule)
+		}
+	}
+	if parent, ok := uuids[t.ParentId]; ok && t.ParentId != 0 {
+		iw.line("RELATED-TO;RELTYPE=PARENT", parent)
+	}
+	iw.line("END", "VTODO")
+}
+
+// icalProperty is an unfolded content line
+type icalProperty struct {
+	line   int
+	name   string
+	params map[string]string
+	value  string
+}
+
+// readICal unfolds the content lines of a calendar and splits them into
+// properties. Each property remembers the line it started on.
+func readICal(r io.Reader) ([]icalProperty, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxICalLine)
+
+	var props []icalProperty
+	var current strings.Builder
+	start := 0
+	flush := func() error {
+		if current.Len() == 0 {
+			return nil
+		}
+		p, err := parseICalLine(current.String())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", start, err)
+		}
+		p.line = start
+		props = append(props, p)
+		current.Reset()
+		return nil
+	}
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			current.WriteString(text[1:])
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(text) != "" {
+			current.WriteString(text)
+			start = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// parseICalLine splits a content line like DUE;TZID=Europe/Berlin:20221201T090000
+// into its name, parameters, and value
+func parseICalLine(line string) (icalProperty, error) {
+	p := icalProperty{params: make(map[string]string)}
+
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("invalid content line %q", line)
+	}
+	p.value = line[colon+1:]
+
+	parts := splitUnquoted(line[:colon], ';')
+	p.name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	if p.name == "" {
+		return p, fmt.Errorf("invalid content line %q", line)
+	}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return p, nil
+}
+
+// splitUnquoted splits s at each sep that isn't in double quotes
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	last := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// icalUnescape reverses icalEscape
+func icalUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitText splits a TEXT list at the commas that aren't escaped and
+// unescapes each item
+func splitText(s string) []string {
+	var items []string
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, icalUnescape(s[last:i]))
+			last = i + 1
+		}
+	}
+	return append(items, icalUnescape(s[last:]))
+}
+
+// icalTime reads a DATE or DATE-TIME value. Times with a TZID are in that
+// zone, and floating times and dates are UTC.
+func icalTime(p icalProperty) (time.Time, error) {
+	v := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(v) == len(icalDate) {
+		return time.Parse(icalDate, v)
+	}
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse(icalUTC, v)
+	}
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(icalDateTime, v, loc)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// decodeICal reads the VTODO components of a calendar.
+func decodeICal(r io.Reader) (*apis.Archive, error) {
+	todos, err := readTodos(r)
+	if err != nil {
+		return nil, err
+	}
+	return todos.archive, nil
+}
+
+// VTodo is a task read from a CalDAV calendar object resource
+type VTodo struct {
+	Task apis.Task
+
+	// UID is the UID of the VTODO as it was written. Task.UUID is the same
+	// UID made into a UUID.
+	UID string
+
+	// Parent is the UUID of the task's parent from RELATED-TO. It's empty if
+	// the task isn't a subtask.
+	Parent string
+}
+
+// DecodeVTodo reads a calendar with a single VTODO, like a CalDAV calendar
+// object resource. Its parent is returned as a UUID since it isn't in the
+// calendar.
+func DecodeVTodo(r io.Reader) (*VTodo, error) {
+	todos, err := readTodos(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(todos.archive.Tasks) != 1 {
+		return nil, fmt.Errorf("calendar must have one VTODO, not %d", len(todos.archive.Tasks))
+	}
+
+	task := todos.archive.Tasks[0]
+	uid := todos.uids[task.ID]
+	if uid == "" {
+		return nil, fmt.Errorf("VTODO has no UID")
+	}
+	todo := &VTodo{Task: task, UID: uid, Parent: todos.parents[task.ID]}
+	todo.Task.ID = 0
+	todo.Task.ParentId = 0
+	return todo, nil
+}
+
+// icalTodos is what readTodos reads from a calendar
+type icalTodos struct {
+	archive *apis.Archive
+
+	// uids are the UIDs of the tasks as they were written by task id
+	uids map[uint]string
+
+	// parents are the UUIDs of the parents of subtasks by task id
+	parents map[uint]string
+}
+
+// readTodos reads the VTODO components of a calendar. Other components, like
+// events and time zones, are skipped. The tasks get ids by their position so
+// subtasks can be matched up with their parents by RELATED-TO. UIDs that
+// aren't UUIDs are made into UUIDs with apis.NameUUID.
+func readTodos(r io.Reader) (*icalTodos, error) {
+	props, err := readICal(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(props) > 0 && (props[0].name != "BEGIN" || strings.ToUpper(props[0].value) != "VCALENDAR") {
+		return nil, fmt.Errorf("line %d: invalid calendar. it must start with BEGIN:VCALENDAR", props[0].line)
+	}
+
+	archive := &apis.Archive{Version: apis.ArchiveVersion}
+	ids := make(map[string]uint)
+	uids := make(map[uint]string)
+	parents := make(map[uint]string)
+
+	var task *apis.Task
+	var depth []string
+	begun := 0
+	for _, p := range props {
+		switch p.name {
+		case "BEGIN":
+			name := strings.ToUpper(p.value)
+			depth = append(depth, name)
+			if name == "VTODO" && len(depth) == 2 {
+				task = &apis.Task{ID: uint(len(archive.Tasks) + 1), State: apis.Open, Status: apis.Todo}
+				begun = p.line
+			}
+			continue
+		case "END":
+			name := strings.ToUpper(p.value)
+			if len(depth) == 0 || depth[len(depth)-1] != name {
+				return nil, fmt.Errorf("line %d: END:%s doesn't match a BEGIN", p.line, p.value)
+			}
+			depth = depth[:len(depth)-1]
+			if name == "VTODO" && task != nil && len(depth) == 1 {
+				if task.Description == "" {
+					return nil, fmt.Errorf("line %d: VTODO has no SUMMARY", begun)
+				}
+				if task.Recurrence != "" && task.Due == nil {
+					task.Recurrence = ""
+				}
+				if task.UUID != "" {
+					if _, ok := ids[task.UUID]; ok {
+						return nil, fmt.Errorf("line %d: UID is repeated", begun)
+					}
+					ids[task.UUID] = task.ID
+				}
+				archive.Tasks = append(archive.Tasks, *task)
+				task = nil
+			}
+			continue
+		}
+
+		// properties of anything but a VTODO, or of the components in it
+		// like VALARM, are skipped
+		if task == nil || len(depth) != 2 {
+			continue
+		}
+		if p.name == "UID" {
+			uids[task.ID] = strings.TrimSpace(p.value)
+		}
+		if err := setICalProperty(task, p, parents); err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+	}
+	if len(depth) > 0 {
+		return nil, fmt.Errorf("BEGIN:%s has no END", depth[len(depth)-1])
+	}
+
+	for i := range archive.Tasks {
+		t := &archive.Tasks[i]
+		if uid, ok := parents[t.ID]; ok {
+			t.ParentId = ids[uid]
+		}
+	}
+	return &icalTodos{archive: archive, uids: uids, parents: parents}, nil
+}
+
+func setICalProperty(t *apis.Task, p icalProperty, parents map[uint]string) error {
+	switch p.name {
+	case "UID":
+		uid := strings.TrimSpace(p.value)
+		if u, err := apis.ParseUUID(uid); err == nil {
+			t.UUID = u
+		} else if uid != "" {
+			t.UUID = apis.NameUUID(uid)
+		}
+	case "SUMMARY":
+		t.Description = strings.TrimSpace(icalUnescape(p.value))
+	case "DESCRIPTION":
+		for _, d := range strings.Split(icalUnescape(p.value), annotationSeparator) {
+			if d = strings.TrimSpace(d); d != "" {
+				t.Annotations = append(t.Annotations, apis.Annotation{Description: d})
+			}
+		}
+	case "CREATED":
+		created, err := icalTime(p)
+		if err != nil {
+			return fmt.Errorf("invalid CREATED %q", p.value)
+		}
+		t.CreatedAt = created
+	case "LAST-MODIFIED":
+		modified, err := icalTime(p)
+		if err != nil {
+			return fmt.Errorf("invalid LAST-MODIFIED %q", p.value)
+		}
+		if t.UpdatedAt.IsZero() {
+			t.UpdatedAt = modified
+		}
+	case "COMPLETED":
+		completed, err := icalTime(p)
+		if err != nil {
+			return fmt.Errorf("invalid COMPLETED %q", p.value)
+		}
+		t.UpdatedAt = completed
+		if t.Status == apis.Todo {
+			t.State, t.Status = apis.Closed, apis.Done
+		}
+	case "DUE":
+		due, err := icalTime(p)
+		if err != nil {
+			return fmt.Errorf("invalid DUE %q", p.value)
+		}
+		t.Due = &due
+	case "PRIORITY":
+		n, err := strconv.Atoi(strings.TrimSpace(p.value))
+		if err != nil {
+			return fmt.Errorf("invalid PRIORITY %q. use 0 through 9", p.value)
+		}
+		priority, ok := PriorityFromICal(n)
+		if !ok {
+			return fmt.Errorf("invalid PRIORITY %q. use 0 through 9", p.value)
+		}
+		t.Priority = priority
+	case "STATUS":
+		switch strings.ToUpper(strings.TrimSpace(p.value)) {
+		case icalNeedsAction:
+			t.State, t.Status = apis.Open, apis.Todo
+		case icalInProcess:
+			t.State, t.Status = apis.Open, apis.Doing
+		case icalCompleted:
+			t.State, t.Status = apis.Closed, apis.Done
+		case icalCancelled:
+			t.State, t.Status = apis.Closed, apis.Abandoned
+		default:
+			return fmt.Errorf("invalid STATUS %q", p.value)
+		}
+	case "CATEGORIES":
+		names := apis.TagNames(t.Tags)
+		for _, c := range splitText(p.value) {
+			if c = strings.TrimSpace(c); c != "" {
+				names = append(names, c)
+			}
+		}
+		t.Tags = apis.NewTags(names...)
+	case "RRULE":
+		if _, err := apis.RecurrenceRule(p.value); err == nil {
+			t.Recurrence = p.value
+		}
+	case "RELATED-TO":
+		if rel := strings.ToUpper(p.params["RELTYPE"]); rel == "" || rel == "PARENT" {
+			uid := strings.TrimSpace(p.value)
+			if u, err := apis.ParseUUID(uid); err == nil {
+				uid = u
+			} else {
+				uid = apis.NameUUID(uid)
+			}
+			parents[t.ID] = uid
+		}
+	}
+	return nil
+}
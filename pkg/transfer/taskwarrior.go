@@ -0,0 +1,324 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// twDate is the layout of Taskwarrior's dates. They're always UTC.
+const twDate = "20060102T150405Z"
+
+// someday is the wait date of backlog tasks, which Taskwarrior hides from its
+// reports until then
+var someday = time.Date(9999, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// projectTag is the prefix of the tag that holds a Taskwarrior project
+const projectTag = "project:"
+
+// Statuses of Taskwarrior tasks. Recurring tasks are templates that
+// Taskwarrior makes pending tasks from.
+const (
+	twPending   = "pending"
+	twWaiting   = "waiting"
+	twCompleted = "completed"
+	twDeleted   = "deleted"
+	twRecurring = "recurring"
+)
+
+type twTime struct {
+	time.Time
+}
+
+func (t twTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(twDate))
+}
+
+// UnmarshalJSON reads Taskwarrior's dates and, for files that were written by
+// something else, any of the formats parseTime reads
+func (t *twTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(twDate, s)
+	if err != nil {
+		if parsed, err = parseTime(s); err != nil {
+			return fmt.Errorf("invalid date %q", s)
+		}
+	}
+	t.Time = parsed.UTC()
+	return nil
+}
+
+func newTwTime(t time.Time) *twTime {
+	if t.IsZero() {
+		return nil
+	}
+	return &twTime{t}
+}
+
+// twDepends is the UUIDs of the tasks a task depends on. Taskwarrior 2.6 and
+// later write an array, and earlier versions write a comma separated string.
+type twDepends []string
+
+func (d *twDepends) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*d = nil
+		for _, u := range strings.Split(s, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				*d = append(*d, u)
+			}
+		}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(d))
+}
+
+type twAnnotation struct {
+	Entry       *twTime `json:"entry,omitempty"`
+	Description string  `json:"description"`
+}
+
+// twTask is a task as Taskwarrior exports it. Attributes doit has no use for,
+// like urgency and the working set id, are ignored on import.
+type twTask struct {
+	UUID        string         `json:"uuid"`
+	Description string         `json:"description"`
+	Status      string         `json:"status"`
+	Entry       *twTime        `json:"entry,omitempty"`
+	Modified    *twTime        `json:"modified,omitempty"`
+	Start       *twTime        `json:"start,omitempty"`
+	End         *twTime        `json:"end,omitempty"`
+	Due         *twTime        `json:"due,omitempty"`
+	Wait        *twTime        `json:"wait,omitempty"`
+	Priority    string         `json:"priority,omitempty"`
+	Project     string         `json:"project,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Annotations []twAnnotation `json:"annotations,omitempty"`
+	Depends     twDepends      `json:"depends,omitempty"`
+}
+
+// TaskwarriorPriority converts a task priority to a Taskwarrior priority.
+// Priorities of 3 and above are H, 2 is M, 1 is L, and 0 has none.
+func TaskwarriorPriority(p apis.Priority) string {
+	switch {
+	case p == 0:
+		return ""
+	case p == 1:
+		return "L"
+	case p == 2:
+		return "M"
+	}
+	return "H"
+}
+
+// PriorityFromTaskwarrior converts a Taskwarrior priority to a task priority.
+// H is 3, M is 2, L is 1, and none is 0.
+func PriorityFromTaskwarrior(s string) (apis.Priority, bool) {
+	switch strings.ToUpper(s) {
+	case "":
+		return 0, true
+	case "L":
+		return 1, true
+	case "M":
+		return 2, true
+	case "H":
+		return 3, true
+	}
+	return 0, false
+}
+
+func encodeTaskwarrior(w io.Writer, archive *apis.Archive) error {
+	uuids := make(map[uint]string, len(archive.Tasks))
+	for i := range archive.Tasks {
+		uuids[archive.Tasks[i].ID] = archive.Tasks[i].UUID
+	}
+	depends := make(map[uint][]string)
+	for _, d := range archive.Dependencies {
+		if u, ok := uuids[d.BlockerID]; ok {
+			depends[d.TaskID] = append(depends[d.TaskID], u)
+		}
+	}
+
+	tasks := make([]twTask, len(archive.Tasks))
+	for i := range archive.Tasks {
+		tasks[i] = taskwarriorTask(&archive.Tasks[i])
+		tasks[i].Depends = depends[archive.Tasks[i].ID]
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tasks)
+}
+
+func taskwarriorTask(t *apis.Task) twTask {
+	tw := twTask{
+		UUID:        t.UUID,
+		Description: t.Description,
+		Status:      twPending,
+		Entry:       newTwTime(t.CreatedAt),
+		Modified:    newTwTime(t.UpdatedAt),
+		Priority:    TaskwarriorPriority(t.Priority),
+	}
+	if t.Due != nil {
+		tw.Due = &twTime{*t.Due}
+	}
+
+	switch {
+	case t.Status == apis.Abandoned:
+		tw.Status = twDeleted
+		tw.End = newTwTime(t.UpdatedAt)
+	case finished(t):
+		tw.Status = twCompleted
+		tw.End = newTwTime(t.UpdatedAt)
+	case t.Status == apis.Backlog:
+		tw.Status = twWaiting
+		tw.Wait = &twTime{someday}
+	case t.Status == apis.Doing:
+		// Taskwarrior's started tasks have a start date, and doit doesn't
+		// keep one
+		start := t.UpdatedAt
+		if start.IsZero() {
+			start = t.CreatedAt
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+		tw.Start = &twTime{start}
+	}
+
+	for _, tag := range apis.TagNames(t.Tags) {
+		if p := strings.TrimPrefix(tag, projectTag); p != tag && tw.Project == "" {
+			tw.Project = p
+			continue
+		}
+		tw.Tags = append(tw.Tags, strings.Join(strings.Fields(tag), "_"))
+	}
+	for _, a := range t.Annotations {
+		tw.Annotations = append(tw.Annotations, twAnnotation{Entry: newTwTime(a.CreatedAt), Description: a.Description})
+	}
+	return tw
+}
+
+// decodeTaskwarrior reads the output of task export. The tasks get ids by
+// their position so their dependencies can be matched up. Recurring
+// templates are skipped, since the pending tasks made from them stand in for
+// them, and dependencies on tasks that aren't in the file are dropped.
+func decodeTaskwarrior(r io.Reader) (*apis.Archive, error) {
+	var records []twTask
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid taskwarrior export: %w", err)
+	}
+
+	archive := &apis.Archive{Version: apis.ArchiveVersion}
+	ids := make(map[string]uint, len(records))
+	var kept []*twTask
+	for i := range records {
+		tw := &records[i]
+		if tw.Status == twRecurring {
+			continue
+		}
+		task, err := taskFromTaskwarrior(tw)
+		if err != nil {
+			return nil, fmt.Errorf("task %d: %w", i+1, err)
+		}
+		task.ID = uint(len(archive.Tasks) + 1)
+		if task.UUID != "" {
+			if _, ok := ids[task.UUID]; ok {
+				return nil, fmt.Errorf("task %d: uuid %s is repeated", i+1, task.UUID)
+			}
+			ids[task.UUID] = task.ID
+		}
+		archive.Tasks = append(archive.Tasks, *task)
+		kept = append(kept, tw)
+	}
+
+	for i, tw := range kept {
+		for _, u := range tw.Depends {
+			if blocker, ok := ids[strings.ToLower(u)]; ok {
+				archive.Dependencies = append(archive.Dependencies, apis.Dependency{TaskID: archive.Tasks[i].ID, BlockerID: blocker})
+			}
+		}
+	}
+	return archive, nil
+}
+
+func taskFromTaskwarrior(tw *twTask) (*apis.Task, error) {
+	task := &apis.Task{
+		Description: strings.TrimSpace(tw.Description),
+		State:       apis.Open,
+		Status:      apis.Todo,
+	}
+	if tw.UUID != "" {
+		u, err := apis.ParseUUID(tw.UUID)
+		if err != nil {
+			return nil, err
+		}
+		task.UUID = u
+	}
+	if task.Description == "" {
+		return nil, fmt.Errorf("task has no description")
+	}
+
+	p, ok := PriorityFromTaskwarrior(tw.Priority)
+	if !ok {
+		return nil, fmt.Errorf("invalid priority %q. use H, M, or L", tw.Priority)
+	}
+	task.Priority = p
+
+	if tw.Entry != nil {
+		task.CreatedAt = tw.Entry.Time
+	}
+	if tw.Modified != nil {
+		task.UpdatedAt = tw.Modified.Time
+	}
+	if tw.Due != nil {
+		due := tw.Due.Time
+		task.Due = &due
+	}
+
+	switch tw.Status {
+	case twPending, "":
+		if tw.Wait != nil && tw.Wait.After(time.Now()) {
+			task.Status = apis.Backlog
+		} else if tw.Start != nil {
+			task.Status = apis.Doing
+		}
+	case twWaiting:
+		task.Status = apis.Backlog
+	case twCompleted:
+		task.State, task.Status = apis.Closed, apis.Done
+	case twDeleted:
+		task.State, task.Status = apis.Closed, apis.Abandoned
+	default:
+		return nil, fmt.Errorf("invalid status %q", tw.Status)
+	}
+	if tw.End != nil && task.State == apis.Closed {
+		task.UpdatedAt = tw.End.Time
+	}
+
+	tags := tw.Tags
+	if tw.Project != "" {
+		tags = append([]string{projectTag + tw.Project}, tags...)
+	}
+	task.Tags = apis.NewTags(tags...)
+
+	for _, a := range tw.Annotations {
+		annotation := apis.Annotation{Description: a.Description}
+		if a.Entry != nil {
+			annotation.CreatedAt = a.Entry.Time
+		}
+		task.Annotations = append(task.Annotations, annotation)
+	}
+	return task, nil
+}
@@ -0,0 +1,172 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+const todoDate = "2006-01-02"
+
+// TodoTxtPriority converts a task priority to a todo.txt priority letter. It
+// returns 0 for priority 0, which todo.txt leaves unwritten, and A for
+// anything above 26.
+func TodoTxtPriority(p apis.Priority) byte {
+	switch {
+	case p == 0:
+		return 0
+	case p >= 26:
+		return 'A'
+	}
+	return byte('A' + 26 - int(p))
+}
+
+// PriorityFromTodoTxt converts a todo.txt priority letter to a task
+// priority. (A) is 26 and (Z) is 1.
+func PriorityFromTodoTxt(letter byte) (apis.Priority, bool) {
+	if letter < 'A' || letter > 'Z' {
+		return 0, false
+	}
+	return apis.Priority(26 - int(letter-'A')), true
+}
+
+// finished tasks are written with an x
+func finished(t *apis.Task) bool {
+	return t.State == apis.Closed || t.Status == apis.Done || t.Status == apis.Abandoned
+}
+
+func encodeTodoTxt(w io.Writer, tasks []apis.Task) error {
+	bw := bufio.NewWriter(w)
+	for i := range tasks {
+		if _, err := fmt.Fprintln(bw, todoTxtLine(&tasks[i])); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func todoTxtLine(t *apis.Task) string {
+	var parts []string
+	done := finished(t)
+	letter := TodoTxtPriority(t.Priority)
+
+	if done {
+		parts = append(parts, "x")
+		if !t.UpdatedAt.IsZero() {
+			parts = append(parts, t.UpdatedAt.UTC().Format(todoDate))
+		}
+	} else if letter != 0 {
+		parts = append(parts, "("+string(letter)+")")
+	}
+	if !t.CreatedAt.IsZero() {
+		parts = append(parts, t.CreatedAt.UTC().Format(todoDate))
+	}
+
+	parts = append(parts, strings.Join(strings.Fields(t.Description), " "))
+
+	for _, tag := range apis.TagNames(t.Tags) {
+		tag = strings.Join(strings.Fields(tag), "_")
+		if !strings.HasPrefix(tag, "@") {
+			tag = "+" + tag
+		}
+		parts = append(parts, tag)
+	}
+	if t.Due != nil {
+		parts = append(parts, "due:"+t.Due.UTC().Format(todoDate))
+	}
+	if done && letter != 0 {
+		parts = append(parts, "pri:"+string(letter))
+	}
+
+	// the x or its absence implies done or todo
+	if (done && t.Status != apis.Done) || (!done && t.Status != apis.Todo) {
+		parts = append(parts, "status:"+string(t.Status))
+	}
+	return strings.Join(parts, " ")
+}
+
+func decodeTodoTxt(r io.Reader) ([]apis.Task, error) {
+	var tasks []apis.Task
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		task, err := parseTodoTxtLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, scanner.Err()
+}
+
+func parseTodoTxtLine(line string) (*apis.Task, error) {
+	task := &apis.Task{State: apis.Open, Status: apis.Todo}
+	words := strings.Fields(line)
+
+	if len(words) > 0 && words[0] == "x" {
+		task.State, task.Status = apis.Closed, apis.Done
+		words = words[1:]
+		// a finished task has its completion date before its creation date
+		if len(words) > 0 {
+			if d, err := time.Parse(todoDate, words[0]); err == nil {
+				task.UpdatedAt = d
+				words = words[1:]
+			}
+		}
+	}
+
+	if len(words) > 0 && len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' {
+		if p, ok := PriorityFromTodoTxt(words[0][1]); ok {
+			task.Priority = p
+			words = words[1:]
+		}
+	}
+
+	if len(words) > 0 {
+		if d, err := time.Parse(todoDate, words[0]); err == nil {
+			task.CreatedAt = d
+			words = words[1:]
+		}
+	}
+
+	var desc, tags []string
+	for _, w := range words {
+		key, value, isPair := strings.Cut(w, ":")
+		switch {
+		case len(w) > 1 && w[0] == '+':
+			tags = append(tags, w[1:])
+		case len(w) > 1 && w[0] == '@':
+			tags = append(tags, w)
+		case isPair && key == "due" && value != "":
+			due, err := time.Parse(todoDate, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid due date %q. use YYYY-MM-DD", value)
+			}
+			task.Due = &due
+		case isPair && key == "pri" && len(value) == 1:
+			p, ok := PriorityFromTodoTxt(value[0])
+			if !ok {
+				return nil, fmt.Errorf("invalid priority %q. use A through Z", value)
+			}
+			task.Priority = p
+		case isPair && key == "status" && value != "":
+			task.Status = apis.Status(strings.ToLower(value))
+		default:
+			desc = append(desc, w)
+		}
+	}
+
+	task.Description = strings.Join(desc, " ")
+	task.Tags = apis.NewTags(tags...)
+	if task.Description == "" {
+		return nil, fmt.Errorf("task has no description")
+	}
+	return task, nil
+}
@@ -0,0 +1,88 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+// Encode writes the archive in the format. columns picks the CSV columns and
+// is ignored by the other formats. Nil columns are DefaultColumns.
+func Encode(w io.Writer, format apis.Format, archive *apis.Archive, columns []string) error {
+	switch format {
+	case apis.JSONFormat:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(archive)
+	case apis.CSVFormat:
+		return encodeCSV(w, archive.Tasks, columns)
+	case apis.TodoTxtFormat:
+		return encodeTodoTxt(w, archive.Tasks)
+	case apis.TaskwarriorFormat:
+		return encodeTaskwarrior(w, archive)
+	case apis.ICalFormat:
+		return encodeICal(w, archive)
+	}
+	return fmt.Errorf("invalid format %q", format)
+}
+
+// Decode reads tasks in the format. Errors say which line or record is
+// wrong.
+func Decode(r io.Reader, format apis.Format) (*apis.Archive, error) {
+	switch format {
+	case apis.JSONFormat:
+		archive := &apis.Archive{}
+		if err := json.NewDecoder(r).Decode(archive); err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		if archive.Version > apis.ArchiveVersion {
+			return nil, fmt.Errorf("archive version %d is newer than this server reads", archive.Version)
+		}
+		return archive, nil
+	case apis.CSVFormat:
+		tasks, err := decodeCSV(r)
+		if err != nil {
+			return nil, err
+		}
+		return &apis.Archive{Version: apis.ArchiveVersion, Tasks: tasks}, nil
+	case apis.TodoTxtFormat:
+		tasks, err := decodeTodoTxt(r)
+		if err != nil {
+			return nil, err
+		}
+		return &apis.Archive{Version: apis.ArchiveVersion, Tasks: tasks}, nil
+	case apis.TaskwarriorFormat:
+		return decodeTaskwarrior(r)
+	case apis.ICalFormat:
+		return decodeICal(r)
+	}
+	return nil, fmt.Errorf("invalid format %q", format)
+}
+
+// ContentType is the media type of the format
+func ContentType(format apis.Format) string {
+	switch format {
+	case apis.CSVFormat:
+		return "text/csv; charset=utf-8"
+	case apis.TodoTxtFormat:
+		return "text/plain; charset=utf-8"
+	case apis.ICalFormat:
+		return "text/calendar; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Extension is the usual file extension of the format
+func Extension(format apis.Format) string {
+	switch format {
+	case apis.CSVFormat:
+		return ".csv"
+	case apis.TodoTxtFormat:
+		return ".txt"
+	case apis.ICalFormat:
+		return apis.ICalExtension
+	}
+	return ".json"
+}
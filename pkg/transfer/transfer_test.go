@@ -0,0 +1,337 @@
+package transfer
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+)
+
+func day(d int) *time.Time {
+	t := time.Date(2022, 11, d, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func testArchive() *apis.Archive {
+	created := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	return &apis.Archive{
+		Version: apis.ArchiveVersion,
+		Tasks: []apis.Task{
+			{ID: 1, CreatedAt: created, Description: "Fix the build", Status: apis.Doing, State: apis.Open, Priority: 3, Due: day(16), Tags: apis.NewTags("infra", "@work"),
+				Checklist: []apis.ChecklistItem{{Text: "bisect", Done: true}, {Text: "patch"}},
+				Comments:  []apis.Comment{{Description: "flaky on arm"}}},
+			{ID: 2, CreatedAt: created, Description: "Write docs", Status: apis.Todo, State: apis.Open, ParentId: 1, Assignee: apis.User{Username: "bob"}},
+			{ID: 3, CreatedAt: created, UpdatedAt: created, Description: "Drop the old API", Status: apis.Abandoned, State: apis.Closed, Priority: 26},
+		},
+	}
+}
+
+func TestTodoTxtPriority(t *testing.T) {
+	for p := apis.Priority(1); p <= 26; p++ {
+		got, ok := PriorityFromTodoTxt(TodoTxtPriority(p))
+		if !ok || got != p {
+			t.Errorf("priority %d came back as %d", p, got)
+		}
+	}
+	if TodoTxtPriority(0) != 0 || TodoTxtPriority(40) != 'A' || TodoTxtPriority(1) != 'Z' {
+		t.Errorf("unexpected letters for 0, 40, and 1")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	columns, err := ParseColumns("id, desc, due, priority, state, status, tags, assignee, parent, checklist, comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, apis.CSVFormat, testArchive(), columns); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := Decode(&buf, apis.CSVFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testArchive().Tasks
+	for i, got := range archive.Tasks {
+		w := want[i]
+		if got.ID != w.ID || got.Description != w.Description || got.Status != w.Status || got.State != w.State ||
+			got.Priority != w.Priority || got.ParentId != w.ParentId || got.Assignee.Username != w.Assignee.Username {
+			t.Errorf("task %d: got %+v", w.ID, got)
+		}
+		if !reflect.DeepEqual(got.Due, w.Due) {
+			t.Errorf("task %d: got due %v, want %v", w.ID, got.Due, w.Due)
+		}
+		if !reflect.DeepEqual(apis.TagNames(got.Tags), apis.TagNames(w.Tags)) {
+			t.Errorf("task %d: got tags %v", w.ID, apis.TagNames(got.Tags))
+		}
+		if len(got.Checklist) != len(w.Checklist) || len(got.Comments) != len(w.Comments) {
+			t.Errorf("task %d: got checklist %v and comments %v", w.ID, got.Checklist, got.Comments)
+		}
+	}
+}
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, apis.TodoTxtFormat, testArchive(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"(X) 2022-11-01 Fix the build +infra @work due:2022-11-16 status:doing",
+		"2022-11-01 Write docs",
+		"x 2022-11-01 2022-11-01 Drop the old API pri:A status:abandoned",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	archive, err := Decode(&buf, apis.TodoTxtFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, got := range archive.Tasks {
+		w := testArchive().Tasks[i]
+		if got.Description != w.Description || got.Status != w.Status || got.State != w.State || got.Priority != w.Priority ||
+			!got.CreatedAt.Equal(w.CreatedAt) || !reflect.DeepEqual(got.Due, w.Due) {
+			t.Errorf("task %d: got %+v", w.ID, got)
+		}
+	}
+}
+
+func TestTaskwarriorRoundTrip(t *testing.T) {
+	archive := testArchive()
+	for i := range archive.Tasks {
+		archive.Tasks[i].UUID = apis.NewUUID()
+	}
+	archive.Tasks[0].Tags = apis.NewTags("infra", "project:work")
+	archive.Tasks[0].Annotations = []apis.Annotation{{CreatedAt: archive.Tasks[0].CreatedAt, Description: "see the ci logs"}}
+	archive.Tasks[1].Status = apis.Backlog
+	archive.Dependencies = []apis.Dependency{{TaskID: 1, BlockerID: 2}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, apis.TaskwarriorFormat, archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"status": "pending"`, `"start": "`, `"status": "waiting"`, `"status": "deleted"`, `"project": "work"`, `"priority": "H"`, `"entry": "20221101T000000Z"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("export is missing %s:\n%s", want, buf.String())
+		}
+	}
+
+	got, err := Decode(&buf, apis.TaskwarriorFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range got.Tasks {
+		w := archive.Tasks[i]
+		if g.UUID != w.UUID || g.Description != w.Description || g.Status != w.Status || g.State != w.State ||
+			TaskwarriorPriority(g.Priority) != TaskwarriorPriority(w.Priority) || !reflect.DeepEqual(g.Due, w.Due) {
+			t.Errorf("task %d: got %+v", w.ID, g)
+		}
+		gotTags, wantTags := apis.TagNames(g.Tags), apis.TagNames(w.Tags)
+		sort.Strings(gotTags)
+		sort.Strings(wantTags)
+		if !reflect.DeepEqual(gotTags, wantTags) {
+			t.Errorf("task %d: got tags %v", w.ID, apis.TagNames(g.Tags))
+		}
+	}
+	if len(got.Tasks[0].Annotations) != 1 || got.Tasks[0].Annotations[0].Description != "see the ci logs" {
+		t.Errorf("got annotations %+v", got.Tasks[0].Annotations)
+	}
+	if want := []apis.Dependency{{TaskID: 1, BlockerID: 2}}; !reflect.DeepEqual(got.Dependencies, want) {
+		t.Errorf("got dependencies %+v", got.Dependencies)
+	}
+}
+
+func TestDecodeTaskwarrior(t *testing.T) {
+	input := `[
+		{"id": 0, "uuid": "6E2A6B4B-94C8-4E43-9C4A-0B1F7E3A2C10", "description": "Template", "status": "recurring", "recur": "weekly"},
+		{"id": 1, "uuid": "0b6e8f0c-5c1b-4d1e-8d2f-1f0c9e7a3b21", "description": "Pay rent", "status": "pending", "priority": "M",
+		 "due": "20221201T000000Z", "depends": "6e2a6b4b-94c8-4e43-9c4a-0b1f7e3a2c10,9c1d3a4e-2b5f-4c6d-8e7f-0a1b2c3d4e5f"},
+		{"id": 0, "uuid": "9c1d3a4e-2b5f-4c6d-8e7f-0a1b2c3d4e5f", "description": "Sign lease", "status": "completed", "end": "2022-11-20T10:00:00Z"}
+	]`
+	archive, err := Decode(strings.NewReader(input), apis.TaskwarriorFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Tasks) != 2 {
+		t.Fatalf("got %d tasks, want the recurring template skipped", len(archive.Tasks))
+	}
+	rent, lease := archive.Tasks[0], archive.Tasks[1]
+	if rent.Priority != 2 || rent.Status != apis.Todo || rent.Due == nil || !rent.Due.Equal(time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v", rent)
+	}
+	if lease.Status != apis.Done || lease.State != apis.Closed || !lease.UpdatedAt.Equal(time.Date(2022, 11, 20, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v", lease)
+	}
+	if want := []apis.Dependency{{TaskID: rent.ID, BlockerID: lease.ID}}; !reflect.DeepEqual(archive.Dependencies, want) {
+		t.Errorf("got dependencies %+v", archive.Dependencies)
+	}
+}
+
+func TestICalRoundTrip(t *testing.T) {
+	archive := testArchive()
+	for i := range archive.Tasks {
+		archive.Tasks[i].UUID = apis.NewUUID()
+	}
+	archive.Tasks[0].Description = "Fix the build; then, ship it." + strings.Repeat(" très long", 10)
+	archive.Tasks[0].Annotations = []apis.Annotation{{Description: "line one"}, {Description: "line two"}}
+	archive.Tasks[0].Recurrence = "weekly"
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, apis.ICalFormat, archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line isn't folded: %q", line)
+		}
+	}
+	for _, want := range []string{"STATUS:IN-PROCESS", "PRIORITY:1", "DUE:20221116T000000Z", "RRULE:FREQ=WEEKLY", "RELATED-TO;RELTYPE=PARENT:" + archive.Tasks[0].UUID, "STATUS:CANCELLED"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("calendar is missing %s:\n%s", want, buf.String())
+		}
+	}
+
+	got, err := Decode(&buf, apis.ICalFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range got.Tasks {
+		w := archive.Tasks[i]
+		if g.UUID != w.UUID || g.Description != w.Description || g.Status != w.Status || g.State != w.State ||
+			ICalPriority(g.Priority) != ICalPriority(w.Priority) || !reflect.DeepEqual(g.Due, w.Due) || g.ParentId != w.ParentId {
+			t.Errorf("task %d: got %+v", w.ID, g)
+		}
+		if !reflect.DeepEqual(apis.TagNames(g.Tags), apis.TagNames(w.Tags)) {
+			t.Errorf("task %d: got tags %v", w.ID, apis.TagNames(g.Tags))
+		}
+	}
+	if notes := got.Tasks[0].Annotations; len(notes) != 2 || notes[0].Description != "line one" || notes[1].Description != "line two" {
+		t.Errorf("got annotations %+v", notes)
+	}
+	if got.Tasks[0].Recurrence != "FREQ=WEEKLY" {
+		t.Errorf("got recurrence %q", got.Tasks[0].Recurrence)
+	}
+}
+
+func TestDecodeICal(t *testing.T) {
+	input := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:event-1",
+		"SUMMARY:Not a task",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:reminder-1@example.com",
+		"SUMMARY:Call the ",
+		" plumber",
+		"DUE;TZID=Europe/Berlin:20221201T090000",
+		"PRIORITY:7",
+		"CATEGORIES:home,repairs\\, urgent",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"DESCRIPTION:Reminder",
+		"END:VALARM",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:reminder-2@example.com",
+		"SUMMARY:Buy washers",
+		"DUE;VALUE=DATE:20221130",
+		"COMPLETED:20221129T100000Z",
+		"RELATED-TO:reminder-1@example.com",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	archive, err := Decode(strings.NewReader(input), apis.ICalFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(archive.Tasks))
+	}
+	call, buy := archive.Tasks[0], archive.Tasks[1]
+	if call.UUID != apis.NameUUID("reminder-1@example.com") || call.Description != "Call the plumber" || call.Priority != 1 ||
+		!call.Due.Equal(time.Date(2022, 12, 1, 8, 0, 0, 0, time.UTC)) || len(call.Annotations) != 0 {
+		t.Errorf("got %+v", call)
+	}
+	if want := []string{"home", "repairs, urgent"}; !reflect.DeepEqual(apis.TagNames(call.Tags), want) {
+		t.Errorf("got tags %q", apis.TagNames(call.Tags))
+	}
+	if buy.Status != apis.Done || buy.State != apis.Closed || buy.ParentId != call.ID || !buy.Due.Equal(*day(30)) {
+		t.Errorf("got %+v", buy)
+	}
+}
+
+func TestVTodo(t *testing.T) {
+	parent := apis.NewUUID()
+	task := testArchive().Tasks[1]
+	task.UUID = apis.NewUUID()
+
+	var buf bytes.Buffer
+	if err := EncodeVTodo(&buf, &task, parent); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := DecodeVTodo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.UID != task.UUID || todo.Task.UUID != task.UUID || todo.Parent != parent || todo.Task.Description != task.Description {
+		t.Errorf("got %+v", todo)
+	}
+
+	input := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:Reminder-1\r\nSUMMARY:a\r\nRELATED-TO:reminder-0\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	todo, err = DecodeVTodo(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.UID != "Reminder-1" || todo.Task.UUID != apis.NameUUID("Reminder-1") || todo.Parent != apis.NameUUID("reminder-0") {
+		t.Errorf("got %+v", todo)
+	}
+
+	for input, want := range map[string]string{
+		"BEGIN:VCALENDAR\nEND:VCALENDAR\n":                                                                                     "calendar must have one VTODO, not 0",
+		"BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\nEND:VTODO\nEND:VCALENDAR\n":                                                  "VTODO has no UID",
+		"BEGIN:VCALENDAR\nBEGIN:VTODO\nUID:a\nSUMMARY:a\nEND:VTODO\nBEGIN:VTODO\nUID:b\nSUMMARY:b\nEND:VTODO\nEND:VCALENDAR\n": "not 2",
+	} {
+		if _, err := DecodeVTodo(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		format apis.Format
+		input  string
+		err    string
+	}{
+		{apis.CSVFormat, "id,due\n1,\n", "desc column is required"},
+		{apis.CSVFormat, "desc,owner\na,b\n", `invalid column "owner"`},
+		{apis.CSVFormat, "desc,priority\na,1\nb,high\n", `line 3: invalid priority "high"`},
+		{apis.TodoTxtFormat, "one\n\n(A) two due:tomorrow\n", "line 3: invalid due date"},
+		{apis.TodoTxtFormat, "(B) +tag due:2022-11-16\n", "line 1: task has no description"},
+		{apis.JSONFormat, `{"version": 99}`, "newer than this server reads"},
+		{apis.TaskwarriorFormat, `[{"description": "a"}, {"description": "b", "priority": "X"}]`, `task 2: invalid priority "X"`},
+		{apis.TaskwarriorFormat, `[{"description": "a", "uuid": "nope"}]`, `task 1: invalid uuid "nope"`},
+		{apis.TaskwarriorFormat, `[{"description": "a", "status": "snoozed"}]`, `task 1: invalid status "snoozed"`},
+		{apis.ICalFormat, "BEGIN:VTODO\nEND:VTODO\n", "line 1: invalid calendar"},
+		{apis.ICalFormat, "BEGIN:VCALENDAR\nBEGIN:VTODO\nPRIORITY:high\nEND:VTODO\nEND:VCALENDAR\n", `line 3: invalid PRIORITY "high"`},
+		{apis.ICalFormat, "BEGIN:VCALENDAR\nBEGIN:VTODO\nDUE:20221201\nEND:VTODO\nEND:VCALENDAR\n", "line 2: VTODO has no SUMMARY"},
+		{apis.ICalFormat, "BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:a\nEND:VCALENDAR\n", "line 4: END:VCALENDAR doesn't match"},
+	}
+	for _, test := range tests {
+		_, err := Decode(strings.NewReader(test.input), test.format)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %q: got error %v, want %q", test.format, test.input, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// BulkUpdateTasks applies one change to many tasks in a user's list.
+func BulkUpdateTasks(client generic.Client, ownerId uint, update *apis.BulkUpdate) (*apis.BulkResponse, error) {
+	return generic.PostAs[apis.BulkResponse](client, TasksUrl(ownerId)+"/bulk", update)
+}
+
+// BulkDeleteTasks moves many tasks in a user's list to the trash.
+func BulkDeleteTasks(client generic.Client, ownerId uint, ids []uint) (*apis.BulkResponse, error) {
+	return generic.PostAs[apis.BulkResponse](client, TasksUrl(ownerId)+"/bulk/delete", &apis.BulkRequest{IDs: ids})
+}
+
+// BulkRestoreTasks takes many tasks in a user's list out of the trash.
+func BulkRestoreTasks(client generic.Client, ownerId uint, ids []uint) (*apis.BulkResponse, error) {
+	return generic.PostAs[apis.BulkResponse](client, fmt.Sprintf("users/%d/trash/bulk/restore", ownerId), &apis.BulkRequest{IDs: ids})
+}
+
+// toggleMark marks the task or unmarks it if it's already marked.
+func (t *TaskTable) toggleMark(task *TaskModel) {
+	if t.Marked[task.ID] {
+		delete(t.Marked, task.ID)
+	} else {
+		t.Marked[task.ID] = true
+	}
+}
+
+// markShown marks every loaded task the filter matches, including the
+// subtasks of collapsed tasks. If they're all marked already, it unmarks them
+// instead.
+func (t *TaskTable) markShown() {
+	var shown []uint
+	all := true
+	for i := range t.Tasks {
+		if t.Filter == nil || t.Filter.Match(t.Tasks[i].Task) {
+			shown = append(shown, t.Tasks[i].ID)
+			all = all && t.Marked[t.Tasks[i].ID]
+		}
+	}
+	for _, id := range shown {
+		if all {
+			delete(t.Marked, id)
+		} else {
+			t.Marked[id] = true
+		}
+	}
+}
+
+// markedIds returns the ids of the marked tasks that are still in the table.
+func (t *TaskTable) markedIds() []uint {
+	var ids []uint
+	for id := range t.Marked {
+		if t.contains(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// showBulkResults reloads the table after a bulk request and leaves the tasks
+// that failed marked so I can try them again. The failures are listed in a
+// modal.
+func (t *TaskTable) showBulkResults(verb string, resp *apis.BulkResponse) {
+	c := t.CLI
+	if err := t.Reload(); err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+
+	failed := resp.Failed()
+	for _, r := range failed {
+		t.Marked[r.ID] = true
+	}
+	t.Update(false)
+	t.updateTitle()
+
+	if len(failed) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("%s %d of %d tasks.", verb, len(resp.Results)-len(failed), len(resp.Results))}
+	for _, r := range failed {
+		lines = append(lines, fmt.Sprintf("task %d: %s", r.ID, r.Error))
+	}
+	c.newMessageModal("Some tasks weren't changed", strings.Join(lines, "\n"))
+}
+
+// newBulkForm changes every marked task at once. Fields left blank don't
+// change. The tasks can also be deleted from here.
+func (c *CLI) newBulkForm(table *TaskTable) *tview.Form {
+	ids := table.markedIds()
+	update := &apis.BulkUpdate{IDs: ids}
+
+	assignees, err := ListAssignees(c.Client, table.Owner.ID)
+	if err != nil {
+		c.newErrorModal(err.Error())
+		return nil
+	}
+
+	const unchanged = "(unchanged)"
+	statuses := []string{unchanged, "backlog", "todo", "doing", "done", "abandoned"}
+	states := []string{unchanged, "open", "closed"}
+	var priority, addTags, removeTags string
+
+	form := styledForm()
+	form.SetTitle(fmt.Sprintf("Change %d marked tasks", len(ids)))
+	form.AddDropDown("Status", statuses, 0, func(option string, index int) {
+		update.Status = nil
+		if index > 0 {
+			status := apis.Status(option)
+			update.Status = &status
+		}
+	})
+	form.AddDropDown("State", states, 0, func(option string, index int) {
+		update.State = nil
+		if index > 0 {
+			state := apis.State(option)
+			update.State = &state
+		}
+	})
+	form.AddInputField("Priority", "", 3, func(text string, last rune) bool {
+		return text == "" || EnsureInt(text, last)
+	}, func(text string) { priority = text })
+	form.AddInputField("Shift due by", "", 10, nil, func(text string) { update.DueShift = text })
+	form.AddInputField("Add tags", "", 0, nil, func(text string) { addTags = text })
+	form.AddInputField("Remove tags", "", 0, nil, func(text string) { removeTags = text })
+	form.AddDropDown("Assignee", append([]string{unchanged}, usernames(assignees)...), 0, func(option string, index int) {
+		update.AssigneeId = nil
+		if index > 0 && index <= len(assignees) {
+			update.AssigneeId = &assignees[index-1].ID
+		}
+	})
+	form.AddCheckbox("Start or finish blocked tasks", false, func(checked bool) { update.Force = checked })
+
+	done := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+	}
+
+	apply := func() {
+		update.Priority = nil
+		if priority != "" {
+			p, _ := strconv.Atoi(priority)
+			pr := apis.Priority(p)
+			update.Priority = &pr
+		}
+		update.AddTags = apis.TagNames(apis.NewTags(strings.Split(addTags, ",")...))
+		update.RemoveTags = apis.TagNames(apis.NewTags(strings.Split(removeTags, ",")...))
+
+		done()
+		resp, err := BulkUpdateTasks(c.Client, table.Owner.ID, update)
+		if err != nil {
+			c.newErrorModal("Error changing tasks: " + err.Error())
+			return
+		}
+		for _, id := range ids {
+			delete(table.Marked, id)
+		}
+		table.showBulkResults("Changed", resp)
+	}
+
+	del := func() {
+		done()
+		if table.ReadOnly() {
+			c.newErrorModal(table.Owner.Username + " has shared this task list with you in view mode.")
+			return
+		}
+		c.newBulkDeleteModal(table, ids)
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			apply()
+			return nil
+		}
+		return event
+	})
+
+	form.SetCancelFunc(done)
+	form.AddButton("Cancel", done)
+	form.AddButton("Apply", apply)
+	form.AddButton("Delete", del)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 0, 1, true)
+	return form
+}
+
+// newBulkDeleteModal asks before moving the marked tasks to the trash.
+func (c *CLI) newBulkDeleteModal(table *TaskTable, ids []uint) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Delete?")
+	modal.SetText(fmt.Sprintf("Do you want to delete %d marked tasks?", len(ids)))
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"Yes", "No"})
+
+	modal.SetDoneFunc(func(i int, l string) {
+		c.App.SetRoot(c.Root, true)
+		c.App.SetFocus(table.Table)
+		if l != "Yes" {
+			return
+		}
+
+		resp, err := BulkDeleteTasks(c.Client, table.Owner.ID, ids)
+		if err != nil {
+			c.newErrorModal("Error deleting tasks: " + err.Error())
+			return
+		}
+		for _, id := range ids {
+			delete(table.Marked, id)
+		}
+
+		var deleted []uint
+		for _, r := range resp.Results {
+			if r.Status < 300 {
+				deleted = append(deleted, r.ID)
+			}
+		}
+		if len(resp.Failed()) > 0 || len(deleted) == 0 {
+			table.showBulkResults("Deleted", resp)
+			return
+		}
+		if err := table.Reload(); err != nil {
+			c.newErrorModal(err.Error())
+			return
+		}
+		c.newBulkUndoModal(table, deleted)
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
+
+// newBulkUndoModal offers to take tasks I just deleted back out of the trash.
+func (c *CLI) newBulkUndoModal(table *TaskTable, ids []uint) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Deleted")
+	modal.SetText(fmt.Sprintf("Deleted %d tasks", len(ids)))
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"OK", "Undo"})
+
+	modal.SetDoneFunc(func(i int, l string) {
+		c.App.SetRoot(c.Root, true)
+		c.App.SetFocus(table.Table)
+		if l != "Undo" {
+			return
+		}
+		resp, err := BulkRestoreTasks(c.Client, table.Owner.ID, ids)
+		if err != nil {
+			c.newErrorModal("Error restoring tasks: " + err.Error())
+			return
+		}
+		table.showBulkResults("Restored", resp)
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
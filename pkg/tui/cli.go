@@ -1,10 +1,14 @@
 package tui
 
 import (
-	"fmt"
+	"errors"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/filter"
 	generic "github.com/csams/doit/pkg/tui/client"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -12,9 +16,12 @@ import (
 
 type CLI struct {
 	CompletedConfig
-	App  *tview.Application
-	Root *tview.Flex
-	Me   *apis.User
+	App    *tview.Application
+	Root   *tview.Flex
+	Me     *apis.User
+	Tasks  *TaskTable
+	Shares *ShareTable
+	Search *SearchView
 }
 
 func New(cfg CompletedConfig) (*CLI, error) {
@@ -30,15 +37,48 @@ func New(cfg CompletedConfig) (*CLI, error) {
 	}
 	c.Me = me
 
-	table := NewTaskTable(c, me.AssignedTasks)
-	table.SetTitle("Tasks assigned to " + me.Username)
-	c.Root.AddItem(table, 0, 1, true) // (item, fixedSize; 0 means not fixed, proportion, focus?)
+	views, err := ListViews(c.Client, me.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Tasks = NewTaskTable(c, nil)
+	if view := defaultView(views); view != nil {
+		err = c.Tasks.ShowView(me, "", view)
+	} else {
+		err = c.Tasks.Show(me, "", apis.TaskQuery{Assignee: true}, "Tasks assigned to "+me.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Shares = NewShareTable(c)
+	c.Root.AddItem(c.Tasks, 0, 1, true) // (item, fixedSize; 0 means not fixed, proportion, focus?)
 
 	c.App.SetRoot(c.Root, true)
 
 	return c, nil
 }
 
+// showTasks replaces whatever is in the root view with the task table.
+func (c *CLI) showTasks() {
+	c.Root.Clear()
+	c.Root.AddItem(c.Tasks, 0, 1, true)
+	c.App.SetRoot(c.Root, true)
+	c.App.SetFocus(c.Tasks.Table)
+}
+
+// showShares replaces whatever is in the root view with the share table.
+func (c *CLI) showShares() {
+	if err := c.Shares.Refresh(); err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+	c.Root.Clear()
+	c.Root.AddItem(c.Shares, 0, 1, true)
+	c.App.SetRoot(c.Root, true)
+	c.App.SetFocus(c.Shares.Table)
+}
+
 func styledForm() *tview.Form {
 	form := tview.NewForm()
 	form.SetTitleAlign(tview.AlignLeft)
@@ -52,7 +92,7 @@ func styledForm() *tview.Form {
 	return form
 }
 
-func (c *CLI) newTaskForm(table *TaskTable, task *apis.Task, title string, save func(*taskFormData) error) *tview.Form {
+func (c *CLI) newTaskForm(table *TaskTable, task *apis.Task, assignees []apis.User, title string, save func(*taskFormData) error) *tview.Form {
 	formData := formDataFromTask(task)
 
 	form := styledForm()
@@ -60,21 +100,41 @@ func (c *CLI) newTaskForm(table *TaskTable, task *apis.Task, title string, save
 
 	form.AddInputField("Description", formData.Description, 0, nil, func(text string) { formData.Description = text })
 	form.AddInputField("Due", formData.Due, 30, nil, func(text string) { formData.Due = text })
+	form.AddInputField("Repeat", formData.Recurrence, 30, nil, func(text string) { formData.Recurrence = text })
 	form.AddDropDown("State", []string{"open", "closed"}, getStateIndex(formData.State), func(option string, index int) { formData.State = apis.State(option) })
 	form.AddDropDown("Status", []string{"backlog", "todo", "doing", "done", "abandoned"}, getStatusIndex(formData.Status), func(option string, index int) { formData.Status = apis.Status(option) })
 	form.AddInputField("Priority", strconv.Itoa(int(formData.Priority)), 3, EnsureInt, func(text string) {
 		p, _ := strconv.Atoi(text)
 		formData.Priority = apis.Priority(p)
 	})
+	form.AddInputField("Tags", formData.Tags, 0, nil, func(text string) { formData.Tags = text })
+	form.AddInputField("Parent", formData.Parent, 10, EnsureInt, func(text string) { formData.Parent = text })
+	form.AddCheckbox("Close with subtasks", formData.AutoClose, func(checked bool) { formData.AutoClose = checked })
+	form.AddTextArea("Checklist", formData.Checklist, 0, 4, 0, func(text string) { formData.Checklist = text })
 	form.AddCheckbox("Private", formData.Private, func(checked bool) { formData.Private = checked })
+	form.AddDropDown("Assignee", usernames(assignees), getAssigneeIndex(assignees, formData.AssigneeId), func(option string, index int) {
+		if index >= 0 && index < len(assignees) {
+			formData.AssigneeId = assignees[index].ID
+		}
+	})
 
 	doSave := func() {
 		if err := save(formData); err != nil {
 			c.Root.RemoveItem(form)
+			var conflict *conflictError
+			if errors.As(err, &conflict) {
+				c.newConflictModal(table, conflict)
+				return
+			}
+			var blocked *blockedError
+			if errors.As(err, &blocked) {
+				c.newBlockedModal(table, blocked)
+				return
+			}
 			c.newErrorModal("Error saving task: " + err.Error())
 		} else {
 			c.Root.RemoveItem(form)
-			c.App.SetFocus(table.Table)
+			c.App.SetFocus(c.Root)
 			table.Update(false)
 		}
 	}
@@ -89,7 +149,7 @@ func (c *CLI) newTaskForm(table *TaskTable, task *apis.Task, title string, save
 
 	cancel := func() {
 		c.Root.RemoveItem(form)
-		c.App.SetFocus(table.Table)
+		c.App.SetFocus(c.Root)
 	}
 	form.SetCancelFunc(cancel)
 	form.AddButton("Cancel", cancel)
@@ -99,6 +159,119 @@ func (c *CLI) newTaskForm(table *TaskTable, task *apis.Task, title string, save
 	return form
 }
 
+func (c *CLI) newTagFilterForm(table *TaskTable) *tview.Form {
+	tags := strings.Join(append(table.Query.TagsAny, table.Query.TagsAll...), ", ")
+	match := 0
+	if len(table.Query.TagsAll) > 0 {
+		match = 1
+	}
+
+	form := styledForm()
+	form.SetTitle("Filter by tags (leave blank to clear)")
+	form.AddInputField("Tags", tags, 0, nil, func(text string) { tags = text })
+	form.AddDropDown("Match", []string{"any", "all"}, match, func(option string, index int) { match = index })
+
+	apply := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+
+		names := apis.TagNames(apis.NewTags(strings.Split(tags, ",")...))
+		table.Query.TagsAny, table.Query.TagsAll = nil, nil
+		if match == 0 {
+			table.Query.TagsAny = names
+		} else {
+			table.Query.TagsAll = names
+		}
+		if err := table.Reload(); err != nil {
+			c.newErrorModal(err.Error())
+		}
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			apply()
+			return nil
+		}
+		return event
+	})
+
+	cancel := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+	}
+	form.SetCancelFunc(cancel)
+	form.AddButton("Cancel", cancel)
+	form.AddButton("Apply", apply)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 0, 1, true)
+	return form
+}
+
+// newFilterInput filters the loaded tasks as I type an expression. Enter
+// keeps the filter and loads the listing again with the server matching it,
+// so tasks that weren't loaded are found too. Esc puts back the one I had
+// before.
+func (c *CLI) newFilterInput(table *TaskTable) *tview.InputField {
+	const title = "Filter (leave blank to clear)"
+	prevFilter, prevText := table.Filter, table.FilterText
+
+	input := tview.NewInputField().
+		SetLabel("Filter: ").
+		SetLabelColor(tcell.ColorViolet).
+		SetFieldBackgroundColor(tcell.ColorDarkBlue).
+		SetFieldTextColor(tcell.ColorWheat).
+		SetText(table.FilterText)
+	input.SetBorder(true)
+	input.SetTitle(title)
+
+	// valid is false while the text doesn't parse
+	valid := true
+	input.SetChangedFunc(func(text string) {
+		if strings.TrimSpace(text) == "" {
+			table.Filter, table.FilterText = nil, ""
+		} else {
+			expr, err := filter.Parse(text, filter.Env{Now: time.Now(), Username: c.Me.Username})
+			if err != nil {
+				valid = false
+				input.SetTitle(err.Error())
+				return
+			}
+			table.Filter, table.FilterText = expr, strings.TrimSpace(text)
+		}
+		valid = true
+		input.SetTitle(title)
+		table.Update(true)
+		table.updateTitle()
+	})
+
+	done := func() {
+		c.Root.RemoveItem(input)
+		c.App.SetFocus(table.Table)
+		table.Update(true)
+		table.updateTitle()
+	}
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			if !valid {
+				return
+			}
+			done()
+			if table.FilterText != prevText {
+				if err := table.Reload(); err != nil {
+					c.newErrorModal(err.Error())
+				}
+			}
+		case tcell.KeyEsc:
+			table.Filter, table.FilterText = prevFilter, prevText
+			done()
+		}
+	})
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(input, 3, 0, true)
+	return input
+}
+
 func (c *CLI) newDeleteModal(table *TaskTable, orig *TaskModel) *tview.Modal {
 	modal := tview.NewModal()
 	modal.SetTitle("Delete?")
@@ -114,9 +287,11 @@ func (c *CLI) newDeleteModal(table *TaskTable, orig *TaskModel) *tview.Modal {
 	modal.SetDoneFunc(func(i int, l string) {
 		switch l {
 		case "Yes":
-			userId := fmt.Sprintf("%d", c.Me.ID)
-			taskId := fmt.Sprintf("%d", orig.ID)
-			_, err := generic.Delete[apis.Task](c.Client, "users/"+userId+"/tasks/"+taskId)
+			_, err := generic.Delete[apis.Task](c.Client, TaskUrl(orig.Task), generic.IfMatch(orig.ETag()))
+			if generic.IsStatus(err, http.StatusPreconditionFailed) {
+				c.reloadChangedTask(table, orig)
+				return
+			}
 			if err != nil {
 				c.newErrorModal(err.Error())
 				c.Root.RemoveItem(modal)
@@ -127,9 +302,12 @@ func (c *CLI) newDeleteModal(table *TaskTable, orig *TaskModel) *tview.Modal {
 				c.App.SetFocus(table.Table)
 				return
 			}
+			if err = table.refreshParents(orig.Task); err != nil {
+				c.newErrorModal(err.Error())
+				return
+			}
 			table.Update(true)
-			c.App.SetRoot(c.Root, true)
-			c.App.SetFocus(table.Table)
+			c.newUndoModal(table, orig.Task)
 		case "No":
 			cancel()
 		}
@@ -139,6 +317,56 @@ func (c *CLI) newDeleteModal(table *TaskTable, orig *TaskModel) *tview.Modal {
 	return modal
 }
 
+// newUndoModal offers to take a task I just deleted back out of the trash.
+func (c *CLI) newUndoModal(table *TaskTable, task *apis.Task) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Deleted")
+	modal.SetText("Deleted task [" + task.Description + "]")
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"OK", "Undo"})
+
+	back := func() { c.App.SetRoot(c.Root, true); c.App.SetFocus(table.Table) }
+	modal.SetDoneFunc(func(i int, l string) {
+		if l == "Undo" {
+			restored, err := RestoreTask(c.Client, task)
+			if err != nil {
+				c.newErrorModal("Error restoring task: " + err.Error())
+				return
+			}
+			for i := range table.Tasks {
+				table.Tasks[i].LastTouched = false
+			}
+			table.Tasks = append(table.Tasks, TaskModel{Task: restored, LastTouched: true})
+			if err := table.refreshParents(restored); err != nil {
+				c.newErrorModal(err.Error())
+				return
+			}
+			table.Update(true)
+		}
+		back()
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
+
+// reloadChangedTask refreshes a task that changed on the server before I
+// could delete it, so I can see what changed before trying again.
+func (c *CLI) reloadChangedTask(table *TaskTable, task *TaskModel) {
+	current, err := generic.Get[apis.Task](c.Client, TaskUrl(task.Task))
+	if err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+	*task.Task = *current
+	table.Update(false)
+	c.newMessageModal("Changed", "Someone changed this task since it was loaded. Check the changes and delete it again if you still want to.")
+}
+
 type KeyBinding struct {
 	Key         string
 	Description string
@@ -166,6 +394,23 @@ func getStatusIndex(s apis.Status) int {
 	return i
 }
 
+func usernames(users []apis.User) []string {
+	names := make([]string, len(users))
+	for i := range users {
+		names[i] = users[i].Username
+	}
+	return names
+}
+
+func getAssigneeIndex(users []apis.User, id uint) int {
+	for i := range users {
+		if users[i].ID == id {
+			return i
+		}
+	}
+	return 0
+}
+
 func getStateIndex(s apis.State) int {
 	i, found := stateMap[s]
 	if !found {
@@ -16,6 +16,10 @@ type Client struct {
 	Http    *http.Client
 	Tokens  *auth.TokenProvider
 	BaseUrl string
+
+	// AccessToken is a personal access token sent in place of an ID token
+	// from Tokens
+	AccessToken string
 }
 
 func NewClient(h *http.Client, t *auth.TokenProvider, b string) Client {
@@ -30,30 +34,119 @@ var (
 	userAgent = "todo-app-client"
 )
 
+// StatusError is returned when the server responds with a status outside of
+// the 2xx range.
+type StatusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return "Non 200 response: " + e.Status + " " + e.Body
+}
+
+// IsStatus is true if err is a StatusError with the given code.
+func IsStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == code
+}
+
+// RequestOption changes a request before it's sent
+type RequestOption func(*http.Request)
+
+// IfMatch makes the request conditional on the resource still having the
+// given entity tag.
+func IfMatch(etag string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set("If-Match", etag)
+	}
+}
+
+// WithQuery sets a query parameter of the request.
+func WithQuery(key, value string) RequestOption {
+	return func(req *http.Request) {
+		q := req.URL.Query()
+		q.Set(key, value)
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// token is the bearer token of a request
+func (client Client) token() (string, error) {
+	if client.AccessToken != "" {
+		return client.AccessToken, nil
+	}
+	return client.Tokens.GetIdToken()
+}
+
 // Get is a generic http function for unmarshalling a request to json
-func Get[M any](client Client, url string) (*M, error) {
-	return getOrDelete[M](client, "GET", url)
+func Get[M any](client Client, url string, opts ...RequestOption) (*M, error) {
+	return getOrDelete[M](client, "GET", url, opts)
 }
 
 // Delete is a generic http function for deleting a resource and unmarshalling
 // the response to json.
-func Delete[M any](client Client, url string) (*M, error) {
-	return getOrDelete[M](client, "DELETE", url)
+func Delete[M any](client Client, url string, opts ...RequestOption) (*M, error) {
+	return getOrDelete[M](client, "DELETE", url, opts)
 }
 
 // Post is a generic http function for creating a resource and unmarshalling
 // the response to json.
-func Post[M any](client Client, url string, m *M) (*M, error) {
-	return postOrPut(client, "POST", url, m)
+func Post[M any](client Client, url string, m *M, opts ...RequestOption) (*M, error) {
+	return postOrPut(client, "POST", url, m, opts)
+}
+
+// PostAs is like Post for resources that respond with a different type than
+// the one sent.
+func PostAs[R any, M any](client Client, url string, m *M, opts ...RequestOption) (*R, error) {
+	postData, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return send[R](client, "POST", url, "application/json; charset=UTF-8", postData, opts)
 }
 
 // Put is a generic http function for updating a resource and unmarshalling
 // the response to json.
-func Put[M any](client Client, url string, m *M) (*M, error) {
-	return postOrPut(client, "PUT", url, m)
+func Put[M any](client Client, url string, m *M, opts ...RequestOption) (*M, error) {
+	return postOrPut(client, "PUT", url, m, opts)
+}
+
+// Patch is a generic http function for changing part of a resource with a
+// JSON Merge Patch and unmarshalling the response to json.
+func Patch[M any](client Client, url string, patch []byte, opts ...RequestOption) (*M, error) {
+	return send[M](client, "PATCH", url, "application/merge-patch+json", patch, opts)
+}
+
+func getOrDelete[M any](client Client, verb, url string, opts []RequestOption) (*M, error) {
+	data, err := fetch(client, verb, url, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var model M
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// GetRaw fetches a resource that isn't json, like an export, and returns the
+// response body.
+func GetRaw(client Client, url string, opts ...RequestOption) ([]byte, error) {
+	return fetch(client, "GET", url, opts)
+}
+
+// PostRaw sends a body that isn't json, like a file to import, and
+// unmarshals the json response.
+func PostRaw[R any](client Client, url, contentType string, body []byte, opts ...RequestOption) (*R, error) {
+	return send[R](client, "POST", url, contentType, body, opts)
 }
 
-func getOrDelete[M any](client Client, verb, url string) (*M, error) {
+// fetch makes a request without a body and returns the response body
+func fetch(client Client, verb, url string, opts []RequestOption) ([]byte, error) {
 	url = strings.TrimPrefix(url, "/")
 	req, err := http.NewRequest(verb, client.BaseUrl+url, nil)
 	if err != nil {
@@ -63,13 +156,17 @@ func getOrDelete[M any](client Client, verb, url string) (*M, error) {
 	// TODO: would setting agent and bearer go better in a round tripper?
 	req.Header.Set("User-Agent", userAgent)
 
-	token, err := client.Tokens.GetIdToken()
+	token, err := client.token()
 	if err != nil {
 		return nil, err
 	}
 	authHeader := fmt.Sprintf("BEARER %s", token)
 	req.Header.Set("Authorization", authHeader)
 
+	for _, opt := range opts {
+		opt(req)
+	}
+
 	resp, err := client.Http.Do(req)
 
 	if err != nil {
@@ -86,57 +183,60 @@ func getOrDelete[M any](client Client, verb, url string) (*M, error) {
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, errors.New("Non 200 response: " + resp.Status + " " + string(data))
-	}
-
-	var model M
-	if err := json.Unmarshal(data, &model); err != nil {
-		return nil, err
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(data)}
 	}
 
-	return &model, nil
+	return data, nil
 }
 
-// Get is a generic http function for unmarshalling a request to json
-func postOrPut[M any](client Client, verb, url string, m *M) (*M, error) {
-	url = strings.TrimPrefix(url, "/")
-
+func postOrPut[M any](client Client, verb, url string, m *M, opts []RequestOption) (*M, error) {
 	postData, err := json.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(verb, client.BaseUrl+url, bytes.NewBuffer(postData))
+	return send[M](client, verb, url, "application/json; charset=UTF-8", postData, opts)
+}
+
+// send makes a request with a body and unmarshals the json response
+func send[M any](client Client, verb, url, contentType string, body []byte, opts []RequestOption) (*M, error) {
+	url = strings.TrimPrefix(url, "/")
+
+	req, err := http.NewRequest(verb, client.BaseUrl+url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
 
 	// TODO: would setting agent and bearer go better in a round tripper?
 	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("Content-Type", contentType)
 
-	token, err := client.Tokens.GetIdToken()
+	token, err := client.token()
 	if err != nil {
 		return nil, err
 	}
 	authHeader := fmt.Sprintf("BEARER %s", token)
 	req.Header.Set("Authorization", authHeader)
 
-	resp, err := client.Http.Do(req)
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	for _, opt := range opts {
+		opt(req)
 	}
 
+	resp, err := client.Http.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, errors.New("Non 200 response: " + resp.Status + " " + string(data))
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(data)}
 	}
 
 	var model M
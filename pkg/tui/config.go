@@ -45,7 +45,9 @@ func NewConfig(o *Options, log logr.Logger) *Config {
 func (c *Config) Complete() (CompletedConfig, error) {
 	completeAuth := c.Auth.Complete()
 
-	if c.Client.Tokens == nil {
+	// scripts with an access token don't log in
+	c.Client.AccessToken = c.Options.Token
+	if c.Client.Tokens == nil && c.Client.AccessToken == "" {
 		var err error
 		if c.Client.Tokens, err = auth.NewTokenProvider(completeAuth); err != nil {
 			return CompletedConfig{}, err
@@ -0,0 +1,140 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// conflictError is returned when the server rejects a change to a task
+// because someone else changed it first.
+type conflictError struct {
+	// Task is the table's copy of the task the change was based on
+	Task *TaskModel
+
+	// Proposed is the change that was rejected
+	Proposed *apis.Task
+
+	// Current is the task as it is on the server now
+	Current *apis.Task
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("task %d was changed by someone else", e.Task.ID)
+}
+
+// patchTask saves the fields of the proposed task that differ from the
+// table's copy if the task's ETag on the server still matches etag. It
+// returns a conflictError if it doesn't and a blockedError if unfinished tasks
+// block the change.
+func (t *TaskTable) patchTask(task *TaskModel, proposed *apis.Task, etag string, opts ...generic.RequestOption) (*apis.Task, error) {
+	up, err := PatchTask(t.CLI.Client, task.Task, proposed, etag, opts...)
+	if generic.IsStatus(err, http.StatusPreconditionFailed) {
+		current, err := generic.Get[apis.Task](t.CLI.Client, TaskUrl(task.Task))
+		if err != nil {
+			return nil, err
+		}
+		return nil, &conflictError{Task: task, Proposed: proposed, Current: current}
+	}
+	if generic.IsStatus(err, http.StatusConflict) {
+		deps, err := generic.Get[apis.DependencyList](t.CLI.Client, TaskUrl(task.Task)+"/dependencies")
+		if err != nil {
+			return nil, err
+		}
+		blocked := &blockedError{Task: task, Proposed: proposed, ETag: etag}
+		for _, b := range deps.BlockedBy {
+			if b.Unfinished() {
+				blocked.Blockers = append(blocked.Blockers, b)
+			}
+		}
+		return nil, blocked
+	}
+	return up, err
+}
+
+// diff describes the fields that differ between my change and the current
+// version of the task.
+func (e *conflictError) diff() string {
+	var b strings.Builder
+	field := func(name, mine, theirs string) {
+		if mine != theirs {
+			fmt.Fprintf(&b, "%s: %q (mine) vs %q (theirs)\n", name, mine, theirs)
+		}
+	}
+	due := func(t *apis.Task) string {
+		if t.Due == nil {
+			return ""
+		}
+		return t.Due.Format(dateSpec)
+	}
+	mine, theirs := e.Proposed, e.Current
+
+	field("Description", mine.Description, theirs.Description)
+	field("Due", due(mine), due(theirs))
+	field("Repeat", mine.Recurrence, theirs.Recurrence)
+	field("Priority", fmt.Sprint(mine.Priority), fmt.Sprint(theirs.Priority))
+	field("State", string(mine.State), string(theirs.State))
+	field("Status", string(mine.Status), string(theirs.Status))
+	field("Tags", strings.Join(apis.TagNames(mine.Tags), ", "), strings.Join(apis.TagNames(theirs.Tags), ", "))
+	field("Private", privateMap[mine.Private], privateMap[theirs.Private])
+	field("Parent", fmt.Sprint(mine.ParentId), fmt.Sprint(theirs.ParentId))
+	field("Close with subtasks", privateMap[mine.AutoClose], privateMap[theirs.AutoClose])
+	field("Checklist", apis.ChecklistString(mine.Checklist), apis.ChecklistString(theirs.Checklist))
+	if mine.AssigneeId != theirs.AssigneeId {
+		fmt.Fprintf(&b, "Assignee: changed to %s by them\n", theirs.Assignee.Username)
+	}
+	return b.String()
+}
+
+// newConflictModal shows how a rejected change differs from the current
+// version of the task and lets me overwrite it, reload it, or give up.
+func (c *CLI) newConflictModal(table *TaskTable, conflict *conflictError) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Conflict")
+	modal.SetText("Someone changed this task while you were editing it.\n\n" + conflict.diff() +
+		"\nOverwrite applies the fields you changed on top of their version.")
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"Overwrite", "Reload", "Cancel"})
+
+	back := func() { c.App.SetRoot(c.Root, true); c.App.SetFocus(c.Root) }
+	modal.SetDoneFunc(func(i int, l string) {
+		task := conflict.Task
+		switch l {
+		case "Overwrite":
+			up, err := table.patchTask(task, conflict.Proposed, conflict.Current.ETag())
+			var again *conflictError
+			if errors.As(err, &again) {
+				c.newConflictModal(table, again)
+				return
+			}
+			var blocked *blockedError
+			if errors.As(err, &blocked) {
+				c.newBlockedModal(table, blocked)
+				return
+			}
+			if err != nil {
+				c.newErrorModal("Error saving task: " + err.Error())
+				return
+			}
+			*task.Task = *up
+		case "Reload":
+			*task.Task = *conflict.Current
+		}
+		task.LastTouched = true
+		table.Update(false)
+		back()
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
@@ -0,0 +1,301 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// blockedError is returned when the server won't start or finish a task
+// because unfinished tasks block it.
+type blockedError struct {
+	// Task is the table's copy of the task the change was based on
+	Task *TaskModel
+
+	// Proposed is the change that was rejected
+	Proposed *apis.Task
+
+	// ETag is the version of the task the change applies to
+	ETag string
+
+	// Blockers are the unfinished tasks that block it
+	Blockers []apis.Task
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("task %d is blocked by unfinished tasks", e.Task.ID)
+}
+
+// newBlockedModal lists the tasks that block a rejected change and lets me
+// make it anyway.
+func (c *CLI) newBlockedModal(table *TaskTable, blocked *blockedError) *tview.Modal {
+	var b strings.Builder
+	for _, t := range blocked.Blockers {
+		fmt.Fprintf(&b, "%d %s (%s)\n", t.ID, t.Description, t.Status)
+	}
+	if len(blocked.Blockers) == 0 {
+		b.WriteString("Tasks you can't see\n")
+	}
+
+	modal := tview.NewModal()
+	modal.SetTitle("Blocked")
+	modal.SetText("This task is blocked by unfinished tasks.\n\n" + b.String() +
+		"\nForce changes its status anyway.")
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"Force", "Cancel"})
+
+	back := func() { c.App.SetRoot(c.Root, true); c.App.SetFocus(c.Root) }
+	modal.SetDoneFunc(func(i int, l string) {
+		if l == "Force" {
+			task := blocked.Task
+			up, err := table.patchTask(task, blocked.Proposed, blocked.ETag, generic.WithQuery("force", "true"))
+			var conflict *conflictError
+			if errors.As(err, &conflict) {
+				c.newConflictModal(table, conflict)
+				return
+			}
+			if err == nil {
+				err = table.applyUpdate(task, up)
+			}
+			if err != nil {
+				c.newErrorModal("Error saving task: " + err.Error())
+				return
+			}
+			table.Update(false)
+		}
+		back()
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
+
+// DependencyView shows the chain of tasks that block a task and the chain of
+// tasks it blocks.
+type DependencyView struct {
+	*tview.TreeView
+	CLI *CLI
+
+	// Table is the task table the view was opened from
+	Table *TaskTable
+	Task  *TaskModel
+}
+
+func NewDependencyView(c *CLI, table *TaskTable, task *TaskModel) *DependencyView {
+	tree := tview.NewTreeView()
+	tree.SetBorder(true)
+	tree.SetTitle(fmt.Sprintf("Dependencies of task %d", task.ID))
+
+	v := &DependencyView{
+		TreeView: tree,
+		CLI:      c,
+		Table:    table,
+		Task:     task,
+	}
+
+	tree.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			c.showTasks()
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'a':
+			if !v.readOnly() {
+				c.App.SetFocus(c.newBlockerForm(v))
+			}
+			return nil
+		case 'd':
+			if v.readOnly() {
+				return nil
+			}
+			if blocker, ok := tree.GetCurrentNode().GetReference().(*apis.Task); ok {
+				v.removeBlocker(blocker)
+			}
+			return nil
+		case 'r':
+			if err := v.Refresh(); err != nil {
+				c.newErrorModal(err.Error())
+			}
+			return nil
+		case '?':
+			c.newHelp(dependencyViewKeyBindings)
+			return nil
+		case 'q':
+			c.newQuitModal()
+			return nil
+		case 'Q':
+			c.App.Stop()
+			return nil
+		}
+		return event
+	})
+
+	return v
+}
+
+// Refresh loads the dependency tree of the task from the server. Only the
+// tasks that directly block it carry a reference so they can be removed.
+func (v *DependencyView) Refresh() error {
+	tree, err := generic.Get[apis.DependencyTree](v.CLI.Client, TaskUrl(v.Task.Task)+"/dependencies/tree")
+	if err != nil {
+		return err
+	}
+
+	root := dependencyNode(&tree.Task)
+	blockedBy := tview.NewTreeNode("Blocked by").SetColor(tcell.ColorViolet).SetSelectable(false)
+	blocks := tview.NewTreeNode("Blocks").SetColor(tcell.ColorViolet).SetSelectable(false)
+	root.AddChild(blockedBy).AddChild(blocks)
+
+	for i := range tree.BlockedBy {
+		node := addDependencyNodes(blockedBy, &tree.BlockedBy[i])
+		node.SetReference(&tree.BlockedBy[i].Task)
+	}
+	for i := range tree.Blocks {
+		addDependencyNodes(blocks, &tree.Blocks[i])
+	}
+
+	v.SetRoot(root).SetCurrentNode(root)
+	if len(tree.BlockedBy) > 0 {
+		v.SetCurrentNode(blockedBy.GetChildren()[0])
+	}
+	return nil
+}
+
+func dependencyNode(task *apis.Task) *tview.TreeNode {
+	text := fmt.Sprintf("%d %s (%s)", task.ID, task.Description, task.Status)
+	color := tcell.ColorWheat
+	if task.Blocked {
+		text = blockedMarker + text
+		color = blockedColor
+	}
+	return tview.NewTreeNode(text).SetColor(color)
+}
+
+func addDependencyNodes(parent *tview.TreeNode, dep *apis.DependencyNode) *tview.TreeNode {
+	node := dependencyNode(&dep.Task)
+	if dep.Repeated {
+		node.SetText(node.GetText() + " (see above)")
+	}
+	parent.AddChild(node)
+	for i := range dep.Children {
+		addDependencyNodes(node, &dep.Children[i])
+	}
+	return node
+}
+
+// readOnly reports whether the task's blockers can't be changed from here and
+// tells the user why.
+func (v *DependencyView) readOnly() bool {
+	if v.Table.ReadOnly() {
+		v.CLI.newErrorModal(v.Table.Owner.Username + " has shared this task list with you in view mode.")
+		return true
+	}
+	return false
+}
+
+// changed takes the server's copy of the task after its blockers change,
+// since that changes its version, and reloads the tree.
+func (v *DependencyView) changed(up *apis.Task) error {
+	*v.Task.Task = *up
+	v.Table.Update(false)
+	return v.Refresh()
+}
+
+func (v *DependencyView) addBlocker(blockerId uint) error {
+	url := TaskUrl(v.Task.Task) + "/dependencies"
+	up, err := generic.PostAs[apis.Task](v.CLI.Client, url, &apis.DependencyRequest{BlockerId: blockerId})
+	if err != nil {
+		return err
+	}
+	return v.changed(up)
+}
+
+func (v *DependencyView) removeBlocker(blocker *apis.Task) {
+	url := fmt.Sprintf("%s/dependencies/%d", TaskUrl(v.Task.Task), blocker.ID)
+	up, err := generic.Delete[apis.Task](v.CLI.Client, url)
+	if err == nil {
+		err = v.changed(up)
+	}
+	if err != nil {
+		v.CLI.newErrorModal(err.Error())
+	}
+}
+
+func (c *CLI) newBlockerForm(v *DependencyView) *tview.Form {
+	var blockerId string
+
+	form := styledForm()
+	form.SetTitle("Add blocker")
+	form.AddInputField("Task ID", "", 10, EnsureInt, func(text string) { blockerId = text })
+
+	doSave := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(v)
+		id, err := strconv.ParseUint(blockerId, 10, 0)
+		if err == nil {
+			err = v.addBlocker(uint(id))
+		}
+		if err != nil {
+			c.newErrorModal("Error adding blocker: " + err.Error())
+		}
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			doSave()
+			return nil
+		}
+		return event
+	})
+
+	cancel := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(v)
+	}
+	form.SetCancelFunc(cancel)
+	form.AddButton("Cancel", cancel)
+	form.AddButton("Save", doSave)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 7, 0, true)
+	return form
+}
+
+// showDependencies replaces whatever is in the root view with the dependency
+// tree of a task from the table.
+func (c *CLI) showDependencies(table *TaskTable, task *TaskModel) {
+	v := NewDependencyView(c, table, task)
+	if err := v.Refresh(); err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+	c.Root.Clear()
+	c.Root.AddItem(v, 0, 1, true)
+	c.App.SetRoot(c.Root, true)
+	c.App.SetFocus(v)
+}
+
+var (
+	blockedMarker = "⊘ "
+	blockedColor  = tcell.ColorIndianRed
+
+	dependencyViewKeyBindings = []KeyBinding{
+		{"a", "Add a task that blocks this one"},
+		{"d", "Remove the selected blocker"},
+		{"r", "Reload dependencies"},
+		{"<Esc>", "Back to tasks"},
+		{"q", "Quit with prompt"},
+		{"Q", "Quit Immediately"},
+		{"?", "Show this help"},
+	}
+)
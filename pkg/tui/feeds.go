@@ -0,0 +1,34 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+)
+
+// FeedsUrl is the path to my calendar feeds of a user's list relative to the
+// server address
+func FeedsUrl(ownerId uint) string {
+	return fmt.Sprintf("users/%d/feeds", ownerId)
+}
+
+// ListFeeds fetches the calendar feeds I've made of a user's list.
+func ListFeeds(client generic.Client, ownerId uint) ([]apis.Feed, error) {
+	feeds, err := generic.Get[apis.FeedList](client, FeedsUrl(ownerId))
+	if err != nil {
+		return nil, err
+	}
+	return feeds.Feeds, nil
+}
+
+// CreateFeed makes a calendar feed of a user's list. The feed that comes back
+// has its URL, which can't be fetched again.
+func CreateFeed(client generic.Client, feed *apis.Feed) (*apis.Feed, error) {
+	return generic.Post[apis.Feed](client, FeedsUrl(feed.OwnerId), feed)
+}
+
+// DeleteFeed revokes a calendar feed.
+func DeleteFeed(client generic.Client, ownerId, feedId uint) (*apis.Feed, error) {
+	return generic.Delete[apis.Feed](client, fmt.Sprintf("%s/%d", FeedsUrl(ownerId), feedId))
+}
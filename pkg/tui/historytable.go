@@ -0,0 +1,92 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// HistoryTable is the read only history pane of a TaskDetail
+type HistoryTable struct {
+	*tview.Table
+	Detail  *TaskDetail
+	Changes []apis.Change
+}
+
+func NewHistoryTable(d *TaskDetail) *HistoryTable {
+	table := tview.NewTable().
+		SetFixed(1, 0).
+		SetSelectable(true, false).
+		SetSeparator(tview.Borders.Vertical)
+	table.SetBorder(true)
+	table.SetTitle("History")
+
+	ht := &HistoryTable{
+		Table:  table,
+		Detail: d,
+	}
+
+	table.SetInputCapture(d.handleKey)
+
+	return ht
+}
+
+// Refresh loads the history of the detail view's task from the server.
+func (t *HistoryTable) Refresh() error {
+	list, err := generic.Get[apis.ChangeList](t.Detail.CLI.Client, t.Detail.taskUrl()+"/history")
+	if err != nil {
+		return err
+	}
+	t.Changes = list.Changes
+	t.Update()
+	return nil
+}
+
+func (t *HistoryTable) Update() {
+	table := t.Table
+	t.Clear()
+
+	for c, h := range historyTableHeaders {
+		table.SetCell(0, c,
+			tview.NewTableCell(h).
+				SetTextColor(tcell.ColorViolet).
+				SetSelectable(false).
+				SetAlign(tview.AlignLeft).SetExpansion(1))
+	}
+
+	// newest first so the latest change is in view
+	for i := range t.Changes {
+		change := &t.Changes[len(t.Changes)-1-i]
+		r := i + 1
+
+		var actor string
+		if change.Actor != nil {
+			actor = change.Actor.Username
+		}
+
+		table.SetCell(r, 0, tview.NewTableCell(change.CreatedAt.Format(dateSpec)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(r, 1, tview.NewTableCell(actor).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(r, 2, tview.NewTableCell(string(change.Action)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(r, 3, tview.NewTableCell(describeFields(change.Fields)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(4))
+	}
+}
+
+// describeFields summarizes field changes on one line
+func describeFields(fields []apis.FieldChange) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		parts = append(parts, fmt.Sprintf("%s: %q -> %q", f.Field, f.Before, f.After))
+	}
+	return strings.Join(parts, "; ")
+}
+
+var historyTableHeaders = []string{
+	"When",
+	"Who",
+	"Action",
+	"Changes",
+}
@@ -0,0 +1,343 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Note is what the detail view needs from a comment or an annotation
+type Note struct {
+	ID          uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Author      string
+	Description string
+}
+
+// noteKind adapts comments and annotations to the NoteTable so both panes
+// share the same code.
+type noteKind interface {
+	// Name is the singular, lower case name of the kind, like "comment"
+	Name() string
+
+	// OpenToViewers is true if users with view access may add notes
+	OpenToViewers() bool
+
+	List(c generic.Client, taskUrl string) ([]Note, error)
+	Create(c generic.Client, taskUrl string, desc string) (*Note, error)
+	Update(c generic.Client, taskUrl string, note *Note) (*Note, error)
+	Delete(c generic.Client, taskUrl string, note *Note) error
+}
+
+type commentKind struct{}
+
+func (commentKind) Name() string {
+	return "comment"
+}
+
+func (commentKind) OpenToViewers() bool {
+	return true
+}
+
+func (commentKind) List(c generic.Client, taskUrl string) ([]Note, error) {
+	list, err := generic.Get[apis.CommentList](c, taskUrl+"/comments")
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]Note, len(list.Comments))
+	for i := range list.Comments {
+		notes[i] = *noteFromComment(&list.Comments[i])
+	}
+	return notes, nil
+}
+
+func (commentKind) Create(c generic.Client, taskUrl string, desc string) (*Note, error) {
+	comment, err := generic.Post(c, taskUrl+"/comments", &apis.Comment{Description: desc})
+	if err != nil {
+		return nil, err
+	}
+	return noteFromComment(comment), nil
+}
+
+func (commentKind) Update(c generic.Client, taskUrl string, note *Note) (*Note, error) {
+	url := fmt.Sprintf("%s/comments/%d", taskUrl, note.ID)
+	comment, err := generic.Put(c, url, &apis.Comment{ID: note.ID, Description: note.Description})
+	if err != nil {
+		return nil, err
+	}
+	return noteFromComment(comment), nil
+}
+
+func (commentKind) Delete(c generic.Client, taskUrl string, note *Note) error {
+	_, err := generic.Delete[apis.Comment](c, fmt.Sprintf("%s/comments/%d", taskUrl, note.ID))
+	return err
+}
+
+func noteFromComment(c *apis.Comment) *Note {
+	note := &Note{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Description: c.Description}
+	if c.Author != nil {
+		note.Author = c.Author.Username
+	}
+	return note
+}
+
+type annotationKind struct{}
+
+func (annotationKind) Name() string {
+	return "annotation"
+}
+
+func (annotationKind) OpenToViewers() bool {
+	return false
+}
+
+func (annotationKind) List(c generic.Client, taskUrl string) ([]Note, error) {
+	list, err := generic.Get[apis.AnnotationList](c, taskUrl+"/annotations")
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]Note, len(list.Annotations))
+	for i := range list.Annotations {
+		notes[i] = *noteFromAnnotation(&list.Annotations[i])
+	}
+	return notes, nil
+}
+
+func (annotationKind) Create(c generic.Client, taskUrl string, desc string) (*Note, error) {
+	annotation, err := generic.Post(c, taskUrl+"/annotations", &apis.Annotation{Description: desc})
+	if err != nil {
+		return nil, err
+	}
+	return noteFromAnnotation(annotation), nil
+}
+
+func (annotationKind) Update(c generic.Client, taskUrl string, note *Note) (*Note, error) {
+	url := fmt.Sprintf("%s/annotations/%d", taskUrl, note.ID)
+	annotation, err := generic.Put(c, url, &apis.Annotation{ID: note.ID, Description: note.Description})
+	if err != nil {
+		return nil, err
+	}
+	return noteFromAnnotation(annotation), nil
+}
+
+func (annotationKind) Delete(c generic.Client, taskUrl string, note *Note) error {
+	_, err := generic.Delete[apis.Annotation](c, fmt.Sprintf("%s/annotations/%d", taskUrl, note.ID))
+	return err
+}
+
+func noteFromAnnotation(a *apis.Annotation) *Note {
+	return &Note{ID: a.ID, CreatedAt: a.CreatedAt, UpdatedAt: a.UpdatedAt, Description: a.Description}
+}
+
+// NoteTable is one of the comment or annotation panes of a TaskDetail
+type NoteTable struct {
+	*tview.Table
+	Detail *TaskDetail
+	Kind   noteKind
+	Notes  []Note
+}
+
+func NewNoteTable(d *TaskDetail, kind noteKind, title string) *NoteTable {
+	table := tview.NewTable().
+		SetFixed(1, 0).
+		SetSelectable(true, false).
+		SetSeparator(tview.Borders.Vertical)
+	table.SetBorder(true)
+	table.SetTitle(title)
+
+	nt := &NoteTable{
+		Table:  table,
+		Detail: d,
+		Kind:   kind,
+	}
+
+	table.SetSelectedFunc(func(row, col int) {
+		if note := nt.selected(); note != nil {
+			nt.editNote(note)
+		}
+	})
+
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 'n':
+			nt.newNote()
+			return nil
+		case 'd':
+			if nt.readOnly() {
+				return nil
+			}
+			if note := nt.selected(); note != nil {
+				d.CLI.newNoteDeleteModal(nt, note)
+			}
+			return nil
+		}
+		return d.handleKey(event)
+	})
+
+	return nt
+}
+
+// Refresh loads the notes of the detail view's task from the server.
+func (t *NoteTable) Refresh() error {
+	notes, err := t.Kind.List(t.Detail.CLI.Client, t.Detail.taskUrl())
+	if err != nil {
+		return err
+	}
+	t.Notes = notes
+	t.Update()
+	return nil
+}
+
+func (t *NoteTable) Update() {
+	table := t.Table
+	notes := t.Notes
+	t.Clear()
+
+	for c, h := range noteTableHeaders {
+		table.SetCell(0, c,
+			tview.NewTableCell(h).
+				SetTextColor(tcell.ColorViolet).
+				SetSelectable(false).
+				SetAlign(tview.AlignLeft).SetExpansion(1))
+	}
+
+	// oldest first so a thread reads top to bottom
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+	})
+
+	for r := range notes {
+		note := &notes[r]
+		r = r + 1
+
+		table.SetCell(r, 0, tview.NewTableCell(note.CreatedAt.Format(dateSpec)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetReference(note))
+		table.SetCell(r, 1, tview.NewTableCell(note.Author).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(r, 2, tview.NewTableCell(note.Description).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(4))
+	}
+}
+
+// readOnly is like TaskDetail.readOnly but lets viewers through when they
+// may add notes of this kind. The server decides whether they may change a
+// particular note.
+func (t *NoteTable) readOnly() bool {
+	if t.Kind.OpenToViewers() {
+		return false
+	}
+	return t.Detail.readOnly()
+}
+
+func (t *NoteTable) selected() *Note {
+	row, _ := t.GetSelection()
+	ref := t.GetCell(row, 0).GetReference()
+	if ref == nil {
+		return nil
+	}
+	return ref.(*Note)
+}
+
+func (t *NoteTable) newNote() {
+	d := t.Detail
+	if t.readOnly() {
+		return
+	}
+	form := d.CLI.newNoteForm(t, &Note{}, "Add "+t.Kind.Name(), func(note *Note) error {
+		_, err := t.Kind.Create(d.CLI.Client, d.taskUrl(), note.Description)
+		return err
+	})
+	d.CLI.App.SetFocus(form)
+}
+
+func (t *NoteTable) editNote(orig *Note) {
+	d := t.Detail
+	if t.readOnly() {
+		return
+	}
+	form := d.CLI.newNoteForm(t, orig, "Edit "+t.Kind.Name(), func(note *Note) error {
+		_, err := t.Kind.Update(d.CLI.Client, d.taskUrl(), note)
+		return err
+	})
+	d.CLI.App.SetFocus(form)
+}
+
+func (c *CLI) newNoteForm(table *NoteTable, orig *Note, title string, save func(*Note) error) *tview.Form {
+	note := *orig
+
+	form := styledForm()
+	form.SetTitle(title)
+	form.AddTextArea("Text", note.Description, 0, 5, 0, func(text string) { note.Description = text })
+
+	doSave := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+		if err := save(&note); err != nil {
+			c.newErrorModal("Error saving " + table.Kind.Name() + ": " + err.Error())
+			return
+		}
+		if err := table.Detail.Refresh(); err != nil {
+			c.newErrorModal(err.Error())
+		}
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			doSave()
+			return nil
+		}
+		return event
+	})
+
+	cancel := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+	}
+	form.SetCancelFunc(cancel)
+	form.AddButton("Cancel", cancel)
+	form.AddButton("Save", doSave)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 0, 1, true)
+	return form
+}
+
+func (c *CLI) newNoteDeleteModal(table *NoteTable, note *Note) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Delete?")
+	modal.SetText("Do you want to delete " + table.Kind.Name() + " [" + note.Description + "]")
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"Yes", "No"})
+
+	back := func() { c.App.SetRoot(c.Root, true); c.App.SetFocus(table.Table) }
+	modal.SetDoneFunc(func(i int, l string) {
+		switch l {
+		case "Yes":
+			if err := table.Kind.Delete(c.Client, table.Detail.taskUrl(), note); err != nil {
+				c.newErrorModal(err.Error())
+				return
+			}
+			back()
+			if err := table.Detail.Refresh(); err != nil {
+				c.newErrorModal(err.Error())
+			}
+		case "No":
+			back()
+		}
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
+
+var noteTableHeaders = []string{
+	"Created",
+	"Author",
+	"Text",
+}
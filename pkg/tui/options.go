@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"os"
+
 	"github.com/csams/doit/pkg/auth"
 	"github.com/spf13/pflag"
 )
@@ -9,6 +11,9 @@ type Options struct {
 	Auth           *auth.Options `mapstructure:"auth"`
 	Address        string        `mapstructure:"addr"`
 	InsecureClient bool          `mapstructure:"insecure-client"`
+
+	// Token is a personal access token to use instead of logging in
+	Token string `mapstructure:"token"`
 }
 
 func NewOptions() *Options {
@@ -22,6 +27,7 @@ func NewOptions() *Options {
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.String("client.addr", "http://localhost:9090", "the URL at which the application is hosted")
 	fs.Bool("client.insecure-client", false, "the URL at which the application is hosted")
+	fs.String("client.token", "", "a personal access token to use instead of logging in. defaults to $DOIT_TOKEN")
 
 	o.Auth.AddFlags(fs, "client.auth")
 }
@@ -33,5 +39,8 @@ func (o *Options) Validate() []error {
 }
 
 func (o *Options) Complete() error {
+	if o.Token == "" {
+		o.Token = os.Getenv("DOIT_TOKEN")
+	}
 	return o.Auth.Complete()
 }
@@ -0,0 +1,249 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Search fetches the tasks, comments, and annotations matching a query from
+// every list I can see.
+func Search(client generic.Client, query apis.SearchQuery) ([]apis.SearchResult, error) {
+	results, err := generic.Get[apis.SearchResults](client, "search?"+query.Values().Encode())
+	if err != nil {
+		return nil, err
+	}
+	return results.Results, nil
+}
+
+// SearchView searches as I type and shows the results below the search field.
+type SearchView struct {
+	*tview.Flex
+	CLI     *CLI
+	Input   *tview.InputField
+	Table   *tview.Table
+	Results []apis.SearchResult
+
+	// seq numbers the searches so results that arrive after a newer search
+	// started are dropped
+	seq int
+}
+
+func NewSearchView(c *CLI) *SearchView {
+	input := tview.NewInputField().
+		SetLabel("Search: ").
+		SetLabelColor(tcell.ColorViolet).
+		SetFieldBackgroundColor(tcell.ColorDarkBlue).
+		SetFieldTextColor(tcell.ColorWheat)
+	input.SetBorder(true)
+
+	table := tview.NewTable().
+		SetFixed(1, 0).
+		SetSelectable(true, false).
+		SetSeparator(tview.Borders.Vertical)
+	table.SetBorder(true)
+	table.SetTitle("Results")
+
+	v := &SearchView{
+		Flex:  tview.NewFlex(),
+		CLI:   c,
+		Input: input,
+		Table: table,
+	}
+	v.SetDirection(tview.FlexRow).
+		AddItem(input, 3, 0, true).
+		AddItem(table, 0, 1, false)
+
+	input.SetChangedFunc(v.search)
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			c.showTasks()
+			return nil
+		case tcell.KeyEnter, tcell.KeyDown, tcell.KeyTab:
+			if len(v.Results) > 0 {
+				c.App.SetFocus(table)
+			}
+			return nil
+		}
+		return event
+	})
+
+	table.SetSelectedFunc(func(row, col int) {
+		if ref, ok := table.GetCell(row, 0).GetReference().(*apis.SearchResult); ok {
+			v.open(ref)
+		}
+	})
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc || event.Key() == tcell.KeyTab {
+			c.App.SetFocus(input)
+			return nil
+		}
+		switch event.Rune() {
+		case '/':
+			c.App.SetFocus(input)
+			return nil
+		case '?':
+			c.newHelp(searchViewKeyBindings)
+			return nil
+		case 'q':
+			c.newQuitModal()
+			return nil
+		case 'Q':
+			c.App.Stop()
+			return nil
+		}
+		return event
+	})
+
+	return v
+}
+
+// search runs a search for the text in the background and shows its results
+// if no newer search has started by the time they arrive.
+func (v *SearchView) search(text string) {
+	v.seq++
+	seq := v.seq
+
+	query := apis.SearchQuery{Text: text}
+	if len(query.Terms()) == 0 {
+		v.setResults(nil, nil)
+		return
+	}
+
+	go func() {
+		results, err := Search(v.CLI.Client, query)
+		v.CLI.App.QueueUpdateDraw(func() {
+			if seq == v.seq {
+				v.setResults(results, err)
+			}
+		})
+	}()
+}
+
+func (v *SearchView) setResults(results []apis.SearchResult, err error) {
+	v.Results = results
+	table := v.Table
+	table.Clear()
+
+	if err != nil {
+		table.SetTitle("Results (" + err.Error() + ")")
+		return
+	}
+	table.SetTitle(fmt.Sprintf("Results (%d)", len(results)))
+
+	for c, h := range searchTableHeaders {
+		table.SetCell(0, c,
+			tview.NewTableCell(h).
+				SetTextColor(tcell.ColorViolet).
+				SetSelectable(false).
+				SetAlign(tview.AlignLeft).SetExpansion(1))
+	}
+
+	for r := range results {
+		result := &results[r]
+		row := r + 1
+		task := &result.Task
+
+		table.SetCell(row, 0, tview.NewTableCell(task.Owner.Username).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetReference(result))
+		table.SetCell(row, 1, tview.NewTableCell(fmt.Sprintf("%d", task.ID)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(row, 2, tview.NewTableCell(tview.Escape(task.Description)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(2))
+		table.SetCell(row, 3, tview.NewTableCell(result.Kind).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(row, 4, tview.NewTableCell(highlightSnippet(result.Snippet)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(4))
+	}
+	table.Select(1, 0).ScrollToBeginning()
+}
+
+// highlightSnippet turns the server's highlight markers into tview colors.
+func highlightSnippet(snippet string) string {
+	snippet = tview.Escape(snippet)
+	snippet = strings.ReplaceAll(snippet, apis.HighlightStart, "[yellow::b]")
+	return strings.ReplaceAll(snippet, apis.HighlightEnd, "[-::-]")
+}
+
+// open shows the list the result's task is in and the task's details.
+func (v *SearchView) open(result *apis.SearchResult) {
+	c := v.CLI
+	if err := v.showList(&result.Task); err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+
+	table := c.Tasks
+	task := table.find(result.Task.ID)
+	if task == nil {
+		c.showTasks()
+		c.newErrorModal(fmt.Sprintf("Task %d isn't in the list anymore.", result.Task.ID))
+		return
+	}
+
+	// make sure the task's row is visible when I go back to the table
+	seen := make(map[uint]bool)
+	for id := task.ParentId; id != 0 && !seen[id]; {
+		seen[id] = true
+		parent := table.find(id)
+		if parent == nil {
+			break
+		}
+		delete(table.Collapsed, id)
+		id = parent.ParentId
+	}
+	task.LastTouched = true
+	table.Update(true)
+
+	c.showTaskDetail(table, task)
+}
+
+// showList loads the list that a task is in into the task table.
+func (v *SearchView) showList(task *apis.Task) error {
+	c := v.CLI
+	if task.OwnerId == c.Me.ID {
+		return c.Tasks.Show(c.Me, "", apis.TaskQuery{}, "Tasks owned by "+c.Me.Username)
+	}
+
+	from, err := generic.Get[apis.ShareList](c.Client, sharesUrl(c.Me.ID)+"/from")
+	if err != nil {
+		return err
+	}
+	for i := range from.Shares {
+		if from.Shares[i].OwnerUserId == task.OwnerId {
+			return c.Tasks.ShowShared(&from.Shares[i])
+		}
+	}
+	return fmt.Errorf("%s no longer shares their list with you", task.Owner.Username)
+}
+
+// showSearch replaces whatever is in the root view with the search view. It
+// keeps the last search so I can go back to its results.
+func (c *CLI) showSearch() {
+	if c.Search == nil {
+		c.Search = NewSearchView(c)
+	}
+	c.Root.Clear()
+	c.Root.AddItem(c.Search, 0, 1, true)
+	c.App.SetRoot(c.Root, true)
+	c.App.SetFocus(c.Search.Input)
+}
+
+var (
+	searchTableHeaders = []string{
+		"List",
+		"Task",
+		"Description",
+		"Match",
+		"Snippet",
+	}
+
+	searchViewKeyBindings = []KeyBinding{
+		{"<Enter>", "Open the task of the selected result"},
+		{"/", "Back to the search field"},
+		{"<Esc>", "Back to the search field, or to tasks from there"},
+		{"q", "Quit with prompt"},
+		{"Q", "Quit Immediately"},
+		{"?", "Show this help"},
+	}
+)
@@ -0,0 +1,296 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ShareTable shows the users I've shared my task list with and the users
+// who have shared their task lists with me.
+type ShareTable struct {
+	*tview.Table
+	CLI    *CLI
+	Shares []ShareModel
+}
+
+type ShareModel struct {
+	*apis.Share
+
+	// Outgoing is true if I'm the owner of the shared list
+	Outgoing bool
+}
+
+func sharesUrl(userId uint) string {
+	return fmt.Sprintf("users/%d/shares", userId)
+}
+
+func NewShareTable(c *CLI) *ShareTable {
+	table := tview.NewTable().
+		SetFixed(1, 1).
+		SetSelectable(true, false).
+		SetSeparator(tview.Borders.Vertical)
+	table.SetBorder(true)
+	table.SetTitle("Shared task lists")
+
+	st := &ShareTable{
+		CLI:   c,
+		Table: table,
+	}
+
+	table.SetSelectedFunc(func(row, col int) {
+		ref := table.GetCell(row, 0).GetReference()
+		if ref == nil {
+			return
+		}
+		share := ref.(*ShareModel)
+		if share.Outgoing {
+			st.editShare(share)
+			return
+		}
+		if err := c.Tasks.ShowShared(share.Share); err != nil {
+			c.newErrorModal(err.Error())
+			return
+		}
+		c.showTasks()
+	})
+
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			c.showTasks()
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'n':
+			orig := &apis.Share{Policy: apis.Policy{Mode: apis.View}}
+			form := c.newShareForm(st, orig, "Share my tasks", true, func(req *apis.ShareRequest) error {
+				_, err := generic.Post(c.Client, sharesUrl(c.Me.ID), req)
+				return err
+			})
+			c.App.SetFocus(form)
+			return nil
+		case 'd':
+			row, _ := table.GetSelection()
+			ref := table.GetCell(row, 0).GetReference()
+			if ref == nil {
+				return nil
+			}
+			share := ref.(*ShareModel)
+			if !share.Outgoing {
+				c.newErrorModal("Only " + share.OwnerUsername + " can revoke access to their task list.")
+				return nil
+			}
+			c.newRevokeModal(st, share)
+			return nil
+		case 'r':
+			if err := st.Refresh(); err != nil {
+				c.newErrorModal(err.Error())
+			}
+			return nil
+		case 't':
+			c.showTasks()
+			return nil
+		case '?':
+			c.newHelp(shareTableKeyBindings)
+			return nil
+		case 'q':
+			c.newQuitModal()
+			return nil
+		case 'Q':
+			c.App.Stop()
+			return nil
+		}
+
+		return event
+	})
+
+	return st
+}
+
+func (t *ShareTable) editShare(share *ShareModel) {
+	form := t.CLI.newShareForm(t, share.Share, "Change access for "+share.DelegateUsername, false, func(req *apis.ShareRequest) error {
+		url := fmt.Sprintf("%s/%d", sharesUrl(t.CLI.Me.ID), share.DelegateUserId)
+		_, err := generic.Put(t.CLI.Client, url, req)
+		return err
+	})
+	t.CLI.App.SetFocus(form)
+}
+
+// Refresh reloads both directions of sharing from the server.
+func (t *ShareTable) Refresh() error {
+	with, err := generic.Get[apis.ShareList](t.CLI.Client, sharesUrl(t.CLI.Me.ID)+"/with")
+	if err != nil {
+		return err
+	}
+
+	from, err := generic.Get[apis.ShareList](t.CLI.Client, sharesUrl(t.CLI.Me.ID)+"/from")
+	if err != nil {
+		return err
+	}
+
+	model := make([]ShareModel, 0, len(with.Shares)+len(from.Shares))
+	for i := range with.Shares {
+		model = append(model, ShareModel{Share: &with.Shares[i], Outgoing: true})
+	}
+	for i := range from.Shares {
+		model = append(model, ShareModel{Share: &from.Shares[i], Outgoing: false})
+	}
+	t.Shares = model
+	t.Update()
+	return nil
+}
+
+func (t *ShareTable) Update() {
+	table := t.Table
+	shares := t.Shares
+	t.Clear()
+
+	for c, h := range shareTableHeaders {
+		table.SetCell(0, c,
+			tview.NewTableCell(h).
+				SetTextColor(tcell.ColorViolet).
+				SetSelectable(false).
+				SetAlign(tview.AlignLeft).SetExpansion(1))
+	}
+
+	// outgoing shares first and then by username
+	sort.SliceStable(shares, func(i, j int) bool {
+		if shares[i].Outgoing != shares[j].Outgoing {
+			return shares[i].Outgoing
+		}
+		return shares[i].otherUsername() < shares[j].otherUsername()
+	})
+
+	for r := range shares {
+		share := &shares[r]
+		r = r + 1
+
+		table.SetCell(r, 0, tview.NewTableCell(directionMap[share.Outgoing]).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetReference(share))
+		table.SetCell(r, 1, tview.NewTableCell(share.otherUsername()).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(2))
+		table.SetCell(r, 2, tview.NewTableCell(string(share.Mode)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		table.SetCell(r, 3, tview.NewTableCell(share.CreatedAt.Format(dateSpec)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+	}
+}
+
+// otherUsername is the user on the other side of the share from me
+func (s *ShareModel) otherUsername() string {
+	if s.Outgoing {
+		return s.DelegateUsername
+	}
+	return s.OwnerUsername
+}
+
+func (c *CLI) newShareForm(table *ShareTable, share *apis.Share, title string, askUsername bool, save func(*apis.ShareRequest) error) *tview.Form {
+	req := &apis.ShareRequest{Username: share.DelegateUsername, Mode: share.Mode}
+
+	form := styledForm()
+	form.SetTitle(title)
+
+	if askUsername {
+		form.AddInputField("Username", req.Username, 30, nil, func(text string) { req.Username = text })
+	}
+	form.AddDropDown("Mode", policyModes, getPolicyModeIndex(req.Mode), func(option string, index int) { req.Mode = apis.PolicyMode(option) })
+
+	doSave := func() {
+		if err := save(req); err != nil {
+			c.Root.RemoveItem(form)
+			c.newErrorModal("Error saving share: " + err.Error())
+			return
+		}
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+		if err := table.Refresh(); err != nil {
+			c.newErrorModal(err.Error())
+		}
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			doSave()
+			return nil
+		}
+		return event
+	})
+
+	cancel := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+	}
+	form.SetCancelFunc(cancel)
+	form.AddButton("Cancel", cancel)
+	form.AddButton("Save", doSave)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 0, 1, true)
+	return form
+}
+
+func (c *CLI) newRevokeModal(table *ShareTable, share *ShareModel) *tview.Modal {
+	modal := tview.NewModal()
+	modal.SetTitle("Revoke?")
+	modal.SetText("Do you want to stop sharing your tasks with [" + share.DelegateUsername + "]")
+	modal.SetBackgroundColor(tcell.ColorDarkBlue)
+	modal.SetTextColor(tcell.ColorWheat)
+	modal.SetButtonBackgroundColor(tcell.ColorDarkViolet)
+	modal.SetButtonTextColor(tcell.ColorWheat)
+
+	modal.AddButtons([]string{"Yes", "No"})
+
+	back := func() { c.App.SetRoot(c.Root, true); c.App.SetFocus(table.Table) }
+	modal.SetDoneFunc(func(i int, l string) {
+		switch l {
+		case "Yes":
+			url := fmt.Sprintf("%s/%d", sharesUrl(c.Me.ID), share.DelegateUserId)
+			if _, err := generic.Delete[apis.Share](c.Client, url); err != nil {
+				c.newErrorModal(err.Error())
+				return
+			}
+			back()
+			if err := table.Refresh(); err != nil {
+				c.newErrorModal(err.Error())
+			}
+		case "No":
+			back()
+		}
+	})
+	c.App.SetRoot(modal, false)
+	c.App.SetFocus(modal)
+	return modal
+}
+
+var (
+	policyModes = []string{string(apis.View), string(apis.ViewAndUpdate)}
+
+	directionMap = map[bool]string{true: "shared with", false: "shared from"}
+
+	shareTableHeaders = []string{
+		"Direction",
+		"User",
+		"Mode",
+		"Since",
+	}
+
+	shareTableKeyBindings = []KeyBinding{
+		{"n", "Share my tasks with someone"},
+		{"<Enter>", "Change access or open a list shared with me"},
+		{"d", "Revoke access to my tasks"},
+		{"r", "Reload shares"},
+		{"t", "Back to tasks"},
+		{"q", "Quit with prompt"},
+		{"Q", "Quit Immediately"},
+		{"?", "Show this help"},
+	}
+)
+
+func getPolicyModeIndex(m apis.PolicyMode) int {
+	for i, mode := range policyModes {
+		if mode == string(m) {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,235 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// TaskDetail shows the fields of a single task along with its comment thread,
+// its annotations, and its history.
+type TaskDetail struct {
+	*tview.Flex
+	CLI *CLI
+
+	// Table is the task table the detail view was opened from
+	Table *TaskTable
+	Task  *TaskModel
+
+	Fields      *tview.TextView
+	Comments    *NoteTable
+	Annotations *NoteTable
+	History     *HistoryTable
+
+	// panes are the tables <Tab> cycles through, and active is the index of
+	// the one that has focus
+	panes  []*tview.Table
+	active int
+}
+
+func NewTaskDetail(c *CLI, table *TaskTable, task *TaskModel) *TaskDetail {
+	fields := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(true)
+	fields.SetBorder(true)
+	fields.SetTitleAlign(tview.AlignLeft)
+
+	d := &TaskDetail{
+		Flex:   tview.NewFlex(),
+		CLI:    c,
+		Table:  table,
+		Task:   task,
+		Fields: fields,
+	}
+	d.Comments = NewNoteTable(d, commentKind{}, "Comments")
+	d.Annotations = NewNoteTable(d, annotationKind{}, "Annotations")
+	d.History = NewHistoryTable(d)
+	d.panes = []*tview.Table{d.Comments.Table, d.Annotations.Table, d.History.Table}
+
+	notes := tview.NewFlex().
+		AddItem(d.Comments, 0, 1, true).
+		AddItem(d.Annotations, 0, 1, false)
+
+	d.SetDirection(tview.FlexRow).
+		AddItem(fields, 14, 0, false).
+		AddItem(notes, 0, 1, true).
+		AddItem(d.History, 0, 1, false)
+
+	return d
+}
+
+// Refresh reloads the comments, annotations, and history of the task.
+func (d *TaskDetail) Refresh() error {
+	if err := d.Comments.Refresh(); err != nil {
+		return err
+	}
+	if err := d.Annotations.Refresh(); err != nil {
+		return err
+	}
+	return d.History.Refresh()
+}
+
+// Draw renders the task's fields each time so edits made through the task
+// form show up without any extra bookkeeping.
+func (d *TaskDetail) Draw(screen tcell.Screen) {
+	d.updateFields()
+	d.Flex.Draw(screen)
+}
+
+// Focus gives focus to whichever pane was last active.
+func (d *TaskDetail) Focus(delegate func(p tview.Primitive)) {
+	delegate(d.panes[d.active])
+}
+
+func (d *TaskDetail) switchPane(step int) {
+	d.panes[d.active].SetBorderColor(tcell.ColorWhite)
+	d.active = (d.active + step + len(d.panes)) % len(d.panes)
+	d.panes[d.active].SetBorderColor(tcell.ColorViolet)
+	d.CLI.App.SetFocus(d.panes[d.active])
+}
+
+// handleKey handles the keys every pane shares.
+func (d *TaskDetail) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	c := d.CLI
+	switch event.Key() {
+	case tcell.KeyEsc:
+		c.showTasks()
+		return nil
+	case tcell.KeyTab:
+		d.switchPane(1)
+		return nil
+	case tcell.KeyBacktab:
+		d.switchPane(-1)
+		return nil
+	}
+
+	switch event.Rune() {
+	case 'e':
+		d.editTask()
+		return nil
+	case 'r':
+		if err := d.Refresh(); err != nil {
+			c.newErrorModal(err.Error())
+		}
+		return nil
+	case '?':
+		c.newHelp(taskDetailKeyBindings)
+		return nil
+	case 'q':
+		c.newQuitModal()
+		return nil
+	case 'Q':
+		c.App.Stop()
+		return nil
+	}
+	return event
+}
+
+func (d *TaskDetail) taskUrl() string {
+	return TaskUrl(d.Task.Task)
+}
+
+// readOnly reports whether the task can't be changed from here and tells the
+// user why.
+func (d *TaskDetail) readOnly() bool {
+	if d.Table.ReadOnly() {
+		d.CLI.newErrorModal(d.Table.Owner.Username + " has shared this task list with you in view mode.")
+		return true
+	}
+	return false
+}
+
+func (d *TaskDetail) editTask() {
+	d.Table.editTask(d.Task)
+}
+
+func (d *TaskDetail) updateFields() {
+	task := d.Task.Task
+
+	var due string
+	if task.Due != nil {
+		due = task.Due.Format(dateSpec)
+	}
+
+	var series string
+	if task.SeriesId != 0 {
+		series = fmt.Sprintf("%d", task.SeriesId)
+	}
+
+	var parent string
+	if task.ParentId != 0 {
+		parent = fmt.Sprintf("%d", task.ParentId)
+		if task.AutoClose {
+			parent += " (closes with its subtasks)"
+		}
+	} else if task.AutoClose {
+		parent = "none (closes with its subtasks)"
+	}
+
+	var subtasks string
+	if task.Progress != nil {
+		subtasks = fmt.Sprintf("%d of %d done (%d%%)", task.Progress.Done, task.Progress.Total, task.Progress.Percent)
+	}
+
+	var b strings.Builder
+	field := func(name, value string) {
+		fmt.Fprintf(&b, "[violet]%-12s[wheat]%s\n", name+":", tview.Escape(value))
+	}
+	field("Description", task.Description)
+	field("Due", due)
+	field("Repeat", task.Recurrence)
+	field("Priority", fmt.Sprintf("%d", task.Priority))
+	field("State", string(task.State))
+	field("Status", string(task.Status))
+	field("Tags", strings.Join(apis.TagNames(task.Tags), ", "))
+	field("Private", privateMap[task.Private])
+	field("Assignee", task.Assignee.Username)
+	field("Series", series)
+	field("Parent", parent)
+	field("Subtasks", subtasks)
+	for i, item := range task.Checklist {
+		if i == 0 {
+			field("Checklist", item.String())
+		} else {
+			fmt.Fprintf(&b, "%-12s[wheat]%s\n", "", tview.Escape(item.String()))
+		}
+	}
+	field("Created", task.CreatedAt.Format(dateSpec))
+	field("Updated", task.UpdatedAt.Format(dateSpec))
+
+	// the border takes two more lines
+	d.ResizeItem(d.Fields, strings.Count(b.String(), "\n")+2, 0)
+	d.Fields.SetTitle(fmt.Sprintf("Task %d", task.ID))
+	d.Fields.SetText(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// showTaskDetail replaces whatever is in the root view with the details of a
+// task from the table.
+func (c *CLI) showTaskDetail(table *TaskTable, task *TaskModel) {
+	d := NewTaskDetail(c, table, task)
+	d.panes[d.active].SetBorderColor(tcell.ColorViolet)
+	if err := d.Refresh(); err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+	c.Root.Clear()
+	c.Root.AddItem(d, 0, 1, true)
+	c.App.SetRoot(c.Root, true)
+	c.App.SetFocus(d)
+}
+
+var taskDetailKeyBindings = []KeyBinding{
+	{"n", "Add a comment or annotation"},
+	{"<Enter>", "Edit the selected comment or annotation"},
+	{"d", "Delete the selected comment or annotation"},
+	{"e", "Edit the task"},
+	{"<Tab>", "Switch between comments, annotations, and history"},
+	{"r", "Reload comments, annotations, and history"},
+	{"<Esc>", "Back to tasks"},
+	{"q", "Quit with prompt"},
+	{"Q", "Quit Immediately"},
+	{"?", "Show this help"},
+}
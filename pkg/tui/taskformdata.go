@@ -1,6 +1,9 @@
 package tui
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/araddon/dateparse"
@@ -14,11 +17,25 @@ type taskFormData struct {
 	Status      apis.Status
 	Priority    apis.Priority
 	Private     bool
+	Tags        string
+	AssigneeId  uint
+	Recurrence  string
+
+	// Parent is the id of the task this is a subtask of. It's empty for top
+	// level tasks.
+	Parent    string
+	AutoClose bool
+
+	// Checklist has an item per line, prefixed with [x] if it's done
+	Checklist string
 }
 
 func (d *taskFormData) ApplyTo(t *apis.Task) error {
 	var due *time.Time
-	if d.Due != "" {
+	if t.Due != nil && d.Due == t.Due.Format(dateSpec) {
+		// keep the original so formatting doesn't change it
+		due = t.Due
+	} else if d.Due != "" {
 		if dueDate, err := dateparse.ParseLocal(d.Due); err != nil {
 			return err
 		} else {
@@ -31,15 +48,42 @@ func (d *taskFormData) ApplyTo(t *apis.Task) error {
 	t.Status = d.Status
 	t.Priority = d.Priority
 	t.Private = d.Private
+	t.Tags = apis.NewTags(strings.Split(d.Tags, ",")...)
+	t.AssigneeId = d.AssigneeId
+	t.Recurrence = strings.TrimSpace(d.Recurrence)
+
+	t.ParentId = 0
+	if parent := strings.TrimSpace(d.Parent); parent != "" {
+		id, err := strconv.ParseUint(parent, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid parent: %s", parent)
+		}
+		t.ParentId = uint(id)
+	}
+	t.AutoClose = d.AutoClose
+
+	t.Checklist = nil
+	for _, line := range strings.Split(d.Checklist, "\n") {
+		if strings.TrimSpace(line) != "" {
+			t.Checklist = append(t.Checklist, apis.ParseChecklistItem(line))
+		}
+	}
 
 	return nil
 }
 
 func formDataFromTask(task *apis.Task) *taskFormData {
-	fmtString := "2006-01-02 15:04:05 MST"
 	var due string
 	if task.Due != nil {
-		due = task.Due.Format(fmtString)
+		due = task.Due.Format(dateSpec)
+	}
+	var parent string
+	if task.ParentId != 0 {
+		parent = strconv.FormatUint(uint64(task.ParentId), 10)
+	}
+	checklist := make([]string, len(task.Checklist))
+	for i, item := range task.Checklist {
+		checklist[i] = item.String()
 	}
 	return &taskFormData{
 		Description: task.Description,
@@ -48,5 +92,11 @@ func formDataFromTask(task *apis.Task) *taskFormData {
 		Status:      task.Status,
 		Priority:    task.Priority,
 		Private:     task.Private,
+		Tags:        strings.Join(apis.TagNames(task.Tags), ", "),
+		AssigneeId:  task.AssigneeId,
+		Recurrence:  task.Recurrence,
+		Parent:      parent,
+		AutoClose:   task.AutoClose,
+		Checklist:   strings.Join(checklist, "\n"),
 	}
 }
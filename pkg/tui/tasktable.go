@@ -1,13 +1,17 @@
 package tui
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/filter"
 	generic "github.com/csams/doit/pkg/tui/client"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -16,28 +20,286 @@ type TaskTable struct {
 	*tview.Table
 	CLI   *CLI
 	Tasks []TaskModel
+
+	// Owner is the user whose task list is shown
+	Owner *apis.User
+
+	// Mode is the access Owner has granted me. It's empty for my own list.
+	Mode apis.PolicyMode
+
+	// Query selects the tasks from Owner's list that are shown
+	Query apis.TaskQuery
+
+	// Title describes the listing without any filters
+	Title string
+
+	// Collapsed holds the ids of tasks whose subtasks are hidden
+	Collapsed map[uint]bool
+
+	// View is the saved view shown, if any. Its query is in Query.
+	View *apis.SavedView
+
+	// Filter is an expression the server matches the listing against on top
+	// of Query. It also hides tasks the table gains later that it doesn't
+	// match. FilterText is the expression it was parsed from.
+	Filter     filter.Expr
+	FilterText string
+
+	// NextPageToken fetches the tasks after those loaded. It's empty once
+	// the whole listing is loaded.
+	NextPageToken string
+
+	// Marked holds the ids of tasks marked for a bulk change
+	Marked map[uint]bool
+
+	// loading is true while a page loads for a change of selection, so the
+	// rows it adds don't load another
+	loading bool
+}
+
+// ReadOnly is true if the list has been shared with me in view mode.
+func (t *TaskTable) ReadOnly() bool {
+	return t.Mode == apis.View
+}
+
+// TasksUrl is the path to a user's task list relative to the server address
+func TasksUrl(ownerId uint) string {
+	return fmt.Sprintf("users/%d/tasks", ownerId)
+}
+
+// TaskUrl is the path to a task relative to the server address
+func TaskUrl(task *apis.Task) string {
+	return fmt.Sprintf("%s/%d", TasksUrl(task.OwnerId), task.ID)
+}
+
+// TrashUrl is the url of a deleted task in its owner's trash
+func TrashUrl(task *apis.Task) string {
+	return fmt.Sprintf("users/%d/trash/%d", task.OwnerId, task.ID)
+}
+
+// RestoreTask takes a deleted task out of the trash.
+func RestoreTask(client generic.Client, task *apis.Task) (*apis.Task, error) {
+	return generic.Post[apis.Task](client, TrashUrl(task)+"/restore", nil)
+}
+
+// PatchTask sends the fields of proposed that differ from orig as a JSON Merge
+// Patch. The server only applies it if the task's ETag still matches etag.
+func PatchTask(client generic.Client, orig, proposed *apis.Task, etag string, opts ...generic.RequestOption) (*apis.Task, error) {
+	before, err := json.Marshal(orig)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := json.Marshal(proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.CreateMergePatch(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]generic.RequestOption{generic.IfMatch(etag)}, opts...)
+	return generic.Patch[apis.Task](client, TaskUrl(orig), patch, opts...)
 }
 
+// ListTaskPage fetches the page of a task listing the query's PageToken
+// names, or the first page without one.
+func ListTaskPage(client generic.Client, ownerId uint, query apis.TaskQuery) (*apis.TaskList, error) {
+	return generic.Get[apis.TaskList](client, TasksUrl(ownerId)+"?"+query.Values().Encode())
+}
+
+// ListTasks fetches every page of a task listing.
+func ListTasks(client generic.Client, ownerId uint, query apis.TaskQuery) ([]apis.Task, error) {
+	var tasks []apis.Task
+	for {
+		taskList, err := ListTaskPage(client, ownerId, query)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, taskList.Tasks...)
+		if taskList.NextPageToken == "" {
+			return tasks, nil
+		}
+		query.PageToken = taskList.NextPageToken
+	}
+}
+
+// ListAssignees fetches the users that tasks in a user's list may be
+// assigned to.
+func ListAssignees(client generic.Client, ownerId uint) ([]apis.User, error) {
+	users, err := generic.Get[apis.UserList](client, fmt.Sprintf("users/%d/assignees", ownerId))
+	if err != nil {
+		return nil, err
+	}
+	return users.Users, nil
+}
+
+// addNextInstance adds the task the server created when a recurring task was
+// completed.
+func (t *TaskTable) addNextInstance(done *apis.Task) error {
+	tasks, err := ListTasks(t.CLI.Client, done.OwnerId, apis.TaskQuery{Series: done.SeriesId, States: []apis.State{apis.Open}})
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		if !t.contains(tasks[i].ID) {
+			t.Tasks = append(t.Tasks, TaskModel{Task: &tasks[i]})
+		}
+	}
+	return nil
+}
+
+func (t *TaskTable) contains(id uint) bool {
+	return t.find(id) != nil
+}
+
+func (t *TaskTable) find(id uint) *TaskModel {
+	for i := range t.Tasks {
+		if t.Tasks[i].ID == id {
+			return &t.Tasks[i]
+		}
+	}
+	return nil
+}
+
+// refreshParents reloads the parents of a subtask that are in the table, since
+// changing the subtask changes their progress and may close them.
+func (t *TaskTable) refreshParents(task *apis.Task) error {
+	seen := make(map[uint]bool)
+	for id := task.ParentId; id != 0 && !seen[id]; {
+		seen[id] = true
+		parent := t.find(id)
+		if parent == nil {
+			return nil
+		}
+		current, err := generic.Get[apis.Task](t.CLI.Client, TaskUrl(parent.Task))
+		if err != nil {
+			return err
+		}
+		*parent.Task = *current
+		id = current.ParentId
+	}
+	return nil
+}
+
+// editTask opens the task form. Tasks assigned to me can be opened even in a
+// list shared in view mode, but the server only accepts changes to their
+// status and state.
 func (t *TaskTable) editTask(task *TaskModel) {
-	form := t.CLI.newTaskForm(t, task.Task, "Edit task", func(formData *taskFormData) error {
+	title := "Edit task"
+	if t.ReadOnly() {
+		if task.AssigneeId != t.CLI.Me.ID {
+			t.CLI.newErrorModal(t.Owner.Username + " has shared this task list with you in view mode.")
+			return
+		}
+		title = "Update task (only status and state can change)"
+	}
+
+	assignees, err := ListAssignees(t.CLI.Client, task.OwnerId)
+	if err != nil {
+		t.CLI.newErrorModal(err.Error())
+		return
+	}
+
+	form := t.CLI.newTaskForm(t, task.Task, assignees, title, func(formData *taskFormData) error {
 		proposedTask := *task.Task
 		err := formData.ApplyTo(&proposedTask)
 		if err != nil {
 			return err
 		}
-		userId := fmt.Sprintf("%d", t.CLI.Me.ID)
-		taskId := fmt.Sprintf("%d", task.ID)
-		up, err := generic.Put(t.CLI.Client, "users/"+userId+"/tasks/"+taskId, &proposedTask)
+		up, err := t.patchTask(task, &proposedTask, task.ETag())
 		if err != nil {
 			return err
 		}
-		*task.Task = *up
-		task.LastTouched = true
-		return nil
+		return t.applyUpdate(task, up)
 	})
 	t.CLI.App.SetFocus(form)
 }
 
+// applyUpdate replaces the table's copy of a task with the server's copy after
+// a change. Completing a recurring task adds the next task in its series, and
+// the task's old and new parents are reloaded.
+func (t *TaskTable) applyUpdate(task *TaskModel, up *apis.Task) error {
+	completed := task.Status != apis.Done && up.Status == apis.Done && up.Recurrence != ""
+	orig := *task.Task
+	*task.Task = *up
+	task.LastTouched = true
+	if err := t.refreshParents(&orig); err != nil {
+		return err
+	}
+	if up.ParentId != orig.ParentId {
+		if err := t.refreshParents(up); err != nil {
+			return err
+		}
+	}
+	if completed {
+		return t.addNextInstance(up)
+	}
+	return nil
+}
+
+// createTask opens the form for a new task in the list. If parent isn't nil the
+// new task is one of its subtasks.
+func (t *TaskTable) createTask(parent *TaskModel) {
+	c := t.CLI
+	if t.ReadOnly() {
+		c.newErrorModal(t.Owner.Username + " has shared this task list with you in view mode.")
+		return
+	}
+	assignees, err := ListAssignees(c.Client, t.Owner.ID)
+	if err != nil {
+		c.newErrorModal(err.Error())
+		return
+	}
+	day := 24 * time.Hour
+	due := time.Now().Add(day).Round(day)
+	row, _ := t.GetSelection()
+	ref := t.GetCell(row, 0).GetReference()
+	orig := &apis.Task{State: apis.Open, Status: apis.Backlog, Due: &due, AssigneeId: t.Owner.ID}
+	title := "Create task"
+	if parent != nil {
+		orig.ParentId = parent.ID
+		title = fmt.Sprintf("Create subtask of task %d", parent.ID)
+	}
+	form := c.newTaskForm(t, orig, assignees, title, func(formData *taskFormData) error {
+		task := &apis.Task{}
+		err := formData.ApplyTo(task)
+		if err != nil {
+			return err
+		}
+		up, err := generic.Post(c.Client, TasksUrl(t.Owner.ID), task)
+		if err != nil {
+			return err
+		}
+		if ref != nil {
+			prev := ref.(*TaskModel)
+			prev.LastTouched = false
+		}
+		t.Tasks = append(t.Tasks, TaskModel{Task: up, LastTouched: true})
+		if up.ParentId != 0 {
+			delete(t.Collapsed, up.ParentId)
+		}
+		return t.refreshParents(up)
+	})
+	c.App.SetFocus(form)
+}
+
+// setCollapsed hides or shows the subtasks of a task.
+func (t *TaskTable) setCollapsed(task *TaskModel, collapsed bool) {
+	if collapsed {
+		t.Collapsed[task.ID] = true
+	} else {
+		delete(t.Collapsed, task.ID)
+	}
+	for i := range t.Tasks {
+		t.Tasks[i].LastTouched = false
+	}
+	task.LastTouched = true
+	t.Update(true)
+}
+
 type TaskModel struct {
 	*apis.Task
 	LastTouched bool
@@ -51,8 +313,11 @@ func NewTaskTable(c *CLI, tasks []apis.Task) *TaskTable {
 	table.SetBorder(true)
 
 	tt := &TaskTable{
-		CLI:   c,
-		Table: table,
+		CLI:       c,
+		Table:     table,
+		Owner:     c.Me,
+		Collapsed: make(map[uint]bool),
+		Marked:    make(map[uint]bool),
 	}
 
 	tt.SetTasks(tasks)
@@ -62,8 +327,18 @@ func NewTaskTable(c *CLI, tasks []apis.Task) *TaskTable {
 		if ref == nil {
 			return
 		}
-		task := ref.(*TaskModel)
-		tt.editTask(task)
+		c.showTaskDetail(tt, ref.(*TaskModel))
+	})
+
+	// reaching the last row loads the next page
+	table.SetSelectionChangedFunc(func(row, col int) {
+		if tt.NextPageToken != "" && !tt.loading && row == table.GetRowCount()-1 {
+			tt.loading = true
+			defer func() { tt.loading = false }()
+			if err := tt.LoadMore(); err != nil {
+				c.newErrorModal(err.Error())
+			}
+		}
 	})
 
 	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -74,30 +349,97 @@ func NewTaskTable(c *CLI, tasks []apis.Task) *TaskTable {
 
 		switch event.Rune() {
 		case 'a':
-			userId := fmt.Sprintf("%d", c.Me.ID)
-			taskList, err := generic.Get[apis.TaskList](c.Client, "users/"+userId+"/tasks?assignee=1")
-			if err != nil {
+			if err := tt.Show(c.Me, "", apis.TaskQuery{Assignee: true}, "Tasks assigned to "+c.Me.Username); err != nil {
 				c.newErrorModal(err.Error())
-				return nil
 			}
-			tt.SetTasks(taskList.Tasks)
-			tt.SetTitle("Tasks assigned to " + c.Me.Username)
 			return nil
 		case 'o':
-			userId := fmt.Sprintf("%d", c.Me.ID)
-			taskList, err := generic.Get[apis.TaskList](c.Client, "users/"+userId+"/tasks")
-			if err != nil {
+			if err := tt.Show(c.Me, "", apis.TaskQuery{}, "Tasks owned by "+c.Me.Username); err != nil {
+				c.newErrorModal(err.Error())
+			}
+			return nil
+		case 's':
+			c.showShares()
+			return nil
+		case 'e':
+			row, _ := table.GetSelection()
+			ref := table.GetCell(row, 0).GetReference()
+			if ref != nil {
+				tt.editTask(ref.(*TaskModel))
+			}
+			return nil
+		case 'b':
+			row, _ := table.GetSelection()
+			ref := table.GetCell(row, 0).GetReference()
+			if ref != nil {
+				c.showDependencies(tt, ref.(*TaskModel))
+			}
+			return nil
+		case '/':
+			c.showSearch()
+			return nil
+		case 't':
+			form := c.newTagFilterForm(tt)
+			c.App.SetFocus(form)
+			return nil
+		case 'f':
+			input := c.newFilterInput(tt)
+			c.App.SetFocus(input)
+			return nil
+		case 'v':
+			if tt.Owner.ID != c.Me.ID {
+				c.newErrorModal("Views can only be saved from your own list.")
+				return nil
+			}
+			form := c.newSaveViewForm(tt)
+			c.App.SetFocus(form)
+			return nil
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			if err := tt.selectView(int(event.Rune() - '0')); err != nil {
+				c.newErrorModal(err.Error())
+			}
+			return nil
+
+		case ' ':
+			row, _ := table.GetSelection()
+			ref := table.GetCell(row, 0).GetReference()
+			if ref != nil {
+				tt.toggleMark(ref.(*TaskModel))
+				tt.Update(false)
+				tt.updateTitle()
+				if row+1 < table.GetRowCount() {
+					table.Select(row+1, 0)
+				}
+			}
+			return nil
+		case 'L':
+			if err := tt.LoadMore(); err != nil {
 				c.newErrorModal(err.Error())
+			}
+			return nil
+		case 'm':
+			tt.markShown()
+			tt.Update(false)
+			tt.updateTitle()
+			return nil
+		case 'B':
+			if len(tt.markedIds()) == 0 {
+				c.newErrorModal("Mark tasks with <space> or m first.")
 				return nil
 			}
-			tt.SetTasks(taskList.Tasks)
-			tt.SetTitle("Tasks owned by " + c.Me.Username)
+			if form := c.newBulkForm(tt); form != nil {
+				c.App.SetFocus(form)
+			}
 			return nil
 
 		case '?':
 			c.newHelp(taskTableKeyBindings)
 			return nil
 		case 'd':
+			if tt.ReadOnly() {
+				c.newErrorModal(tt.Owner.Username + " has shared this task list with you in view mode.")
+				return nil
+			}
 			row, _ := table.GetSelection()
 			ref := table.GetCell(row, 0).GetReference()
 			if ref != nil {
@@ -107,30 +449,21 @@ func NewTaskTable(c *CLI, tasks []apis.Task) *TaskTable {
 			}
 			return nil
 		case 'n':
-			day := 24 * time.Hour
-			due := time.Now().Add(day).Round(day)
+			tt.createTask(nil)
+			return nil
+		case 'c':
 			row, _ := table.GetSelection()
 			ref := table.GetCell(row, 0).GetReference()
-			orig := &apis.Task{State: apis.Open, Status: apis.Backlog, Due: &due}
-			form := c.newTaskForm(tt, orig, "Create task", func(formData *taskFormData) error {
-				t := &apis.Task{}
-				err := formData.ApplyTo(t)
-				if err != nil {
-					return err
-				}
-				userId := fmt.Sprintf("%d", c.Me.ID)
-				up, err := generic.Post(c.Client, "users/"+userId+"/tasks", t)
-				if err != nil {
-					return err
-				}
-				if ref != nil {
-					prev := ref.(*TaskModel)
-					prev.LastTouched = false
-				}
-				tt.Tasks = append(tt.Tasks, TaskModel{Task: up, LastTouched: true})
-				return nil
-			})
-			c.App.SetFocus(form)
+			if ref != nil {
+				tt.createTask(ref.(*TaskModel))
+			}
+			return nil
+		case '+', '-':
+			row, _ := table.GetSelection()
+			ref := table.GetCell(row, 0).GetReference()
+			if ref != nil {
+				tt.setCollapsed(ref.(*TaskModel), event.Rune() == '-')
+			}
 			return nil
 		case 'q':
 			c.newQuitModal()
@@ -158,6 +491,114 @@ func (t *TaskTable) SetTasks(tasks []apis.Task) {
 	t.Update(true)
 }
 
+// page fetches a page of the owner's tasks that match the query and the
+// table's filter.
+func (t *TaskTable) page(ownerId uint, query apis.TaskQuery, token string) (*apis.TaskList, error) {
+	query.Filter = andFilters(query.Filter, t.FilterText)
+	query.PageToken = token
+	return ListTaskPage(t.CLI.Client, ownerId, query)
+}
+
+// Show loads the first page of a listing of the owner's tasks into the table.
+func (t *TaskTable) Show(owner *apis.User, mode apis.PolicyMode, query apis.TaskQuery, title string) error {
+	list, err := t.page(owner.ID, query, "")
+	if err != nil {
+		return err
+	}
+
+	t.Owner, t.Mode, t.Query, t.Title = owner, mode, query, title
+	t.View = nil
+	t.Marked = make(map[uint]bool)
+	t.NextPageToken = list.NextPageToken
+	t.SetTasks(list.Tasks)
+	t.updateTitle()
+	return nil
+}
+
+// LoadMore adds the next page of the listing to the table. The selected task
+// stays selected. It does nothing once the whole listing is loaded.
+func (t *TaskTable) LoadMore() error {
+	if t.NextPageToken == "" {
+		return nil
+	}
+	list, err := t.page(t.Owner.ID, t.Query, t.NextPageToken)
+	if err != nil {
+		return err
+	}
+	for i := range list.Tasks {
+		if !t.contains(list.Tasks[i].ID) {
+			t.Tasks = append(t.Tasks, TaskModel{Task: &list.Tasks[i]})
+		}
+	}
+	t.NextPageToken = list.NextPageToken
+
+	row, _ := t.GetSelection()
+	selected := t.GetCell(row, 0).GetReference()
+	t.Update(false)
+	t.updateTitle()
+	for r := 1; selected != nil && r < t.GetRowCount(); r++ {
+		if t.GetCell(r, 0).GetReference() == selected {
+			t.Select(r, 0)
+			break
+		}
+	}
+	return nil
+}
+
+// Reload fetches the current listing again, as many tasks as were loaded.
+// The view and marks are kept.
+func (t *TaskTable) Reload() error {
+	view, marked, loaded := t.View, t.Marked, len(t.Tasks)
+	if err := t.Show(t.Owner, t.Mode, t.Query, t.Title); err != nil {
+		return err
+	}
+	for len(t.Tasks) < loaded && t.NextPageToken != "" {
+		if err := t.LoadMore(); err != nil {
+			return err
+		}
+	}
+	t.Marked = marked
+	if view != nil {
+		t.setView(view)
+	}
+	t.Update(false)
+	t.updateTitle()
+	return nil
+}
+
+// ShowShared replaces the tasks in the table with those of a list someone has
+// shared with me.
+func (t *TaskTable) ShowShared(share *apis.Share) error {
+	owner := &apis.User{ID: share.OwnerUserId, Username: share.OwnerUsername}
+	return t.Show(owner, share.Mode, apis.TaskQuery{}, "Tasks owned by "+share.OwnerUsername)
+}
+
+func (t *TaskTable) updateTitle() {
+	title := t.Title
+	if t.ReadOnly() {
+		title += " (view only)"
+	}
+	if len(t.Query.TagsAny) > 0 {
+		title += " [any of " + strings.Join(t.Query.TagsAny, ", ") + "]"
+	}
+	if len(t.Query.TagsAll) > 0 {
+		title += " [all of " + strings.Join(t.Query.TagsAll, ", ") + "]"
+	}
+	if t.View != nil {
+		title += " - " + t.View.Name
+	}
+	if t.Filter != nil {
+		title += " [" + t.FilterText + "]"
+	}
+	if t.NextPageToken != "" {
+		title += fmt.Sprintf(" (first %d, L for more)", len(t.Tasks))
+	}
+	if n := len(t.markedIds()); n > 0 {
+		title += fmt.Sprintf(" (%d marked)", n)
+	}
+	t.SetTitle(title)
+}
+
 func (t *TaskTable) Update(clear bool) {
 	table := t.Table
 	tasks := t.Tasks
@@ -166,9 +607,10 @@ func (t *TaskTable) Update(clear bool) {
 	}
 
 	// add table header
-	for c, h := range taskTableHeaders {
+	columns := t.columns()
+	for c, col := range columns {
 		table.SetCell(0, c,
-			tview.NewTableCell(h).
+			tview.NewTableCell(taskTableHeaders[col]).
 				SetTextColor(tcell.ColorViolet).
 				SetSelectable(false).
 				SetAlign(tview.AlignLeft).SetExpansion(1))
@@ -193,9 +635,15 @@ func (t *TaskTable) Update(clear bool) {
 		return statusOrder[tasks[i].Status] < statusOrder[tasks[j].Status]
 	})
 
-	// add tasks to the table
-	for r := range tasks {
-		task := &tasks[r]
+	// a listing with a sort order keeps it
+	if len(t.Query.Sort) > 0 {
+		sortTasks(tasks, t.Query.Sort)
+	}
+
+	// add tasks to the table with subtasks under their parents
+	rows := t.treeRows()
+	for r, row := range rows {
+		task := row.Task
 		r = r + 1
 
 		priority := fmt.Sprintf("%d", task.Priority)
@@ -206,19 +654,114 @@ func (t *TaskTable) Update(clear bool) {
 			due = task.Due.Format(dateSpec)
 		}
 
-		// id := fmt.Sprintf("%d", task.ID)
-		table.SetCell(r, 0, tview.NewTableCell(string(createdAt)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetReference(task))
-		table.SetCell(r, 1, tview.NewTableCell(task.Description).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft).SetExpansion(4))
-		table.SetCell(r, 2, tview.NewTableCell(due).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
-		table.SetCell(r, 3, tview.NewTableCell(priority).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
-		table.SetCell(r, 4, tview.NewTableCell(string(task.State)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
-		table.SetCell(r, 5, tview.NewTableCell(string(task.Status)).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
-		table.SetCell(r, 6, tview.NewTableCell(privateMap[task.Private]).SetTextColor(tcell.ColorWheat).SetAlign(tview.AlignLeft))
+		desc, descColor := task.Description, tcell.ColorWheat
+		if task.Blocked {
+			desc, descColor = blockedMarker+desc, blockedColor
+		}
+		if task.Progress != nil {
+			desc += fmt.Sprintf(" [%d/%d]", task.Progress.Done, task.Progress.Total)
+		}
+		switch {
+		case !row.HasSubtasks:
+			desc = "  " + desc
+		case t.Collapsed[task.ID]:
+			desc = collapsedMarker + desc
+		default:
+			desc = expandedMarker + desc
+		}
+		desc = strings.Repeat(subtaskIndent, row.Depth) + desc
+
+		// cells are in the order of apis.ViewColumns
+		cells := []*tview.TableCell{
+			tview.NewTableCell(string(createdAt)).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(desc).SetTextColor(descColor).SetExpansion(4),
+			tview.NewTableCell(due).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(priority).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(string(task.State)).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(string(task.Status)).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(strings.Join(apis.TagNames(task.Tags), ", ")).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(privateMap[task.Private]).SetTextColor(tcell.ColorWheat),
+			tview.NewTableCell(task.Assignee.Username).SetTextColor(tcell.ColorWheat),
+		}
+		for c, col := range columns {
+			cell := cells[col].SetAlign(tview.AlignLeft)
+			if t.Marked[task.ID] {
+				cell.SetBackgroundColor(markedColor)
+			}
+			table.SetCell(r, c, cell)
+		}
+		// the first column holds the task for the key handlers
+		table.GetCell(r, 0).SetReference(task)
 
 		if task.LastTouched {
 			table.Select(r, 0)
 		}
 	}
+
+	// drop rows left over from tasks that are now hidden
+	for table.GetRowCount() > len(rows)+1 {
+		table.RemoveRow(table.GetRowCount() - 1)
+	}
+}
+
+// taskRow is a task in the order the table shows it.
+type taskRow struct {
+	Task        *TaskModel
+	Depth       int
+	HasSubtasks bool
+}
+
+// treeRows puts the subtasks of each task right after it in their sorted
+// order, leaving out those of collapsed tasks and those the filter doesn't
+// match. Tasks whose parent isn't shown are shown at the top level.
+func (t *TaskTable) treeRows() []taskRow {
+	shown := make(map[uint]bool, len(t.Tasks))
+	for i := range t.Tasks {
+		if t.Filter == nil || t.Filter.Match(t.Tasks[i].Task) {
+			shown[t.Tasks[i].ID] = true
+		}
+	}
+
+	children := make(map[uint][]*TaskModel)
+	var roots []*TaskModel
+	for i := range t.Tasks {
+		task := &t.Tasks[i]
+		if !shown[task.ID] {
+			continue
+		}
+		if task.ParentId != 0 && task.ParentId != task.ID && shown[task.ParentId] {
+			children[task.ParentId] = append(children[task.ParentId], task)
+		} else {
+			roots = append(roots, task)
+		}
+	}
+
+	rows := make([]taskRow, 0, len(t.Tasks))
+	seen := make(map[uint]bool, len(t.Tasks))
+	var add func(task *TaskModel, depth int)
+	add = func(task *TaskModel, depth int) {
+		if seen[task.ID] {
+			return
+		}
+		seen[task.ID] = true
+		rows = append(rows, taskRow{Task: task, Depth: depth, HasSubtasks: len(children[task.ID]) > 0})
+		if t.Collapsed[task.ID] {
+			return
+		}
+		for _, child := range children[task.ID] {
+			add(child, depth+1)
+		}
+	}
+	for _, task := range roots {
+		add(task, 0)
+	}
+	// tasks in a cycle have no root
+	for i := range t.Tasks {
+		if shown[t.Tasks[i].ID] {
+			add(&t.Tasks[i], 0)
+		}
+	}
+	return rows
 }
 
 func (t *TaskTable) Remove(task *apis.Task) error {
@@ -248,6 +791,12 @@ var (
 
 	privateMap = map[bool]string{true: "✓", false: "✗"}
 
+	subtaskIndent   = "  "
+	collapsedMarker = "▸ "
+	expandedMarker  = "▾ "
+
+	markedColor = tcell.ColorDarkSlateGray
+
 	statusOrder = map[apis.Status]int{
 		apis.Doing:     0,
 		apis.Todo:      1,
@@ -263,14 +812,32 @@ var (
 		"Priority",
 		"State",
 		"Status",
+		"Tags",
 		"Private",
+		"Assignee",
 	}
 
 	taskTableKeyBindings = []KeyBinding{
 		{"n", "Create a new Task"},
-		{"<Enter>", "Edit the selected task"},
+		{"c", "Create a subtask of the selected task"},
+		{"+", "Show the subtasks of the selected task"},
+		{"-", "Hide the subtasks of the selected task"},
+		{"<Enter>", "Show the selected task with its comments and annotations"},
+		{"e", "Edit the selected task"},
+		{"b", "Show the tasks that block the selected task and that it blocks"},
 		{"o", "See tasks I own"},
 		{"a", "See tasks assigned to me"},
+		{"s", "Manage shared task lists"},
+		{"t", "Filter tasks by tag"},
+		{"f", "Filter the tasks with an expression like status:doing and due<+2d"},
+		{"L", "Load the next page of tasks. Scrolling to the last task does too"},
+		{"v", "Save the listing and its filter as a view"},
+		{"1-9", "Show a saved view of the list, in order by name"},
+		{"0", "Show the list without a view"},
+		{"<Space>", "Mark or unmark the selected task for a bulk change"},
+		{"m", "Mark every task the filter shows, or unmark them if they're all marked"},
+		{"B", "Change or delete the marked tasks at once"},
+		{"/", "Search tasks, comments, and annotations in every list I can see"},
 		{"q", "Quit with prompt"},
 		{"Q", "Quit Immediately"},
 		{"?", "Show this help"},
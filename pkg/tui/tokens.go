@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+)
+
+// TokensUrl is the path to my personal access tokens relative to the server
+// address
+const TokensUrl = "me/tokens"
+
+// ListTokens fetches my personal access tokens.
+func ListTokens(client generic.Client) ([]apis.AccessToken, error) {
+	tokens, err := generic.Get[apis.AccessTokenList](client, TokensUrl)
+	if err != nil {
+		return nil, err
+	}
+	return tokens.Tokens, nil
+}
+
+// CreateToken makes a personal access token. The token that comes back holds
+// the secret, which can't be fetched again.
+func CreateToken(client generic.Client, token *apis.AccessToken) (*apis.AccessToken, error) {
+	return generic.Post[apis.AccessToken](client, TokensUrl, token)
+}
+
+// RevokeToken deletes a personal access token so it stops working.
+func RevokeToken(client generic.Client, tokenId uint) (*apis.AccessToken, error) {
+	return generic.Delete[apis.AccessToken](client, fmt.Sprintf("%s/%d", TokensUrl, tokenId))
+}
@@ -0,0 +1,28 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/csams/doit/pkg/apis"
+	"github.com/csams/doit/pkg/transfer"
+	generic "github.com/csams/doit/pkg/tui/client"
+)
+
+// ExportTasks fetches a user's task list in the format. columns picks the CSV
+// columns and may be empty for the default ones.
+func ExportTasks(client generic.Client, ownerId uint, format apis.Format, columns string) ([]byte, error) {
+	opts := []generic.RequestOption{generic.WithQuery("format", string(format))}
+	if columns != "" {
+		opts = append(opts, generic.WithQuery("columns", columns))
+	}
+	return generic.GetRaw(client, fmt.Sprintf("users/%d/export", ownerId), opts...)
+}
+
+// ImportTasks adds the tasks in data to a user's task list. With dryRun set
+// the server only reports what it would do.
+func ImportTasks(client generic.Client, ownerId uint, format apis.Format, data []byte, dryRun bool) (*apis.ImportResult, error) {
+	return generic.PostRaw[apis.ImportResult](client, fmt.Sprintf("users/%d/import", ownerId), transfer.ContentType(format), data,
+		generic.WithQuery("format", string(format)),
+		generic.WithQuery("dry_run", strconv.FormatBool(dryRun)))
+}
@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/csams/doit/pkg/apis"
+	generic "github.com/csams/doit/pkg/tui/client"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ViewsUrl is the path to a user's saved views relative to the server address
+func ViewsUrl(ownerId uint) string {
+	return fmt.Sprintf("users/%d/views", ownerId)
+}
+
+// ListViews fetches a user's saved views. For lists shared with me, those are
+// the views the owner shared.
+func ListViews(client generic.Client, ownerId uint) ([]apis.SavedView, error) {
+	views, err := generic.Get[apis.SavedViewList](client, ViewsUrl(ownerId))
+	if err != nil {
+		return nil, err
+	}
+	return views.Views, nil
+}
+
+// CreateView saves a new view in my list.
+func CreateView(client generic.Client, view *apis.SavedView) (*apis.SavedView, error) {
+	return generic.Post[apis.SavedView](client, ViewsUrl(view.OwnerId), view)
+}
+
+// defaultView returns the view I've chosen to open with, if there is one.
+func defaultView(views []apis.SavedView) *apis.SavedView {
+	for i := range views {
+		if views[i].Default {
+			return &views[i]
+		}
+	}
+	return nil
+}
+
+// ShowView loads a saved view of the owner's list into the table.
+func (t *TaskTable) ShowView(owner *apis.User, mode apis.PolicyMode, view *apis.SavedView) error {
+	query, err := view.Query()
+	if err != nil {
+		return err
+	}
+
+	title := "Tasks owned by " + owner.Username
+	if view.Assigned {
+		title = "Tasks assigned to " + t.CLI.Me.Username
+	}
+	if err := t.Show(owner, mode, query, title); err != nil {
+		return err
+	}
+	t.setView(view)
+	return nil
+}
+
+// setView shows the columns of the view and names it in the title. nil goes
+// back to all of the columns.
+func (t *TaskTable) setView(view *apis.SavedView) {
+	t.View = view
+	t.Update(true)
+	t.updateTitle()
+}
+
+// selectView opens the nth view of the list in the table, counting from 1. 0
+// goes back to the list without a view.
+func (t *TaskTable) selectView(n int) error {
+	if n == 0 {
+		title := "Tasks owned by " + t.Owner.Username
+		if t.View != nil && t.View.Assigned {
+			title = "Tasks assigned to " + t.CLI.Me.Username
+		}
+		return t.Show(t.Owner, t.Mode, apis.TaskQuery{Assignee: t.Query.Assignee}, title)
+	}
+
+	views, err := ListViews(t.CLI.Client, t.Owner.ID)
+	if err != nil {
+		return err
+	}
+	if n > len(views) {
+		return fmt.Errorf("there are only %d views of this list", len(views))
+	}
+	return t.ShowView(t.Owner, t.Mode, &views[n-1])
+}
+
+// columns returns the indexes into apis.ViewColumns of the columns to show.
+func (t *TaskTable) columns() []int {
+	if t.View == nil || len(t.View.Columns) == 0 {
+		all := make([]int, len(apis.ViewColumns))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	var cols []int
+	for _, name := range t.View.Columns {
+		for i, c := range apis.ViewColumns {
+			if c == name {
+				cols = append(cols, i)
+			}
+		}
+	}
+	return cols
+}
+
+// sortTasks orders tasks by the keys the same way the server does. Tasks
+// without a due date sort last in either direction.
+func sortTasks(tasks []TaskModel, keys []apis.SortKey) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		for _, k := range keys {
+			var c int
+			switch k.Field {
+			case "id":
+				c = compareInts(int64(a.ID), int64(b.ID))
+			case "created":
+				c = compareInts(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+			case "updated":
+				c = compareInts(a.UpdatedAt.UnixNano(), b.UpdatedAt.UnixNano())
+			case "due":
+				switch {
+				case a.Due == nil && b.Due == nil:
+				case a.Due == nil:
+					return false
+				case b.Due == nil:
+					return true
+				default:
+					c = compareInts(a.Due.UnixNano(), b.Due.UnixNano())
+				}
+			case "priority":
+				c = compareInts(int64(a.Priority), int64(b.Priority))
+			case "status":
+				c = strings.Compare(string(a.Status), string(b.Status))
+			case "state":
+				c = strings.Compare(string(a.State), string(b.State))
+			case "description":
+				c = strings.Compare(a.Description, b.Description)
+			}
+			if k.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// newSaveViewForm saves the listing in the table, along with its filter, as
+// a view of my list.
+func (c *CLI) newSaveViewForm(table *TaskTable) *tview.Form {
+	view := &apis.SavedView{
+		OwnerId:  c.Me.ID,
+		Assigned: table.Query.Assignee,
+		Sort:     sortString(table.Query.Sort),
+	}
+
+	// the view keeps the filter of the view it was made from
+	var viewFilter string
+	if table.View != nil {
+		view.Columns = table.View.Columns
+		view.Shared = table.View.Shared
+		viewFilter = table.View.Filter
+	}
+	view.Filter = andFilters(viewFilter, table.FilterText)
+
+	columns := strings.Join(view.Columns, ", ")
+
+	form := styledForm()
+	form.SetTitle("Save view")
+	form.AddInputField("Name", "", 0, nil, func(text string) { view.Name = text })
+	form.AddInputField("Filter", view.Filter, 0, nil, func(text string) { view.Filter = text })
+	form.AddInputField("Sort", view.Sort, 0, nil, func(text string) { view.Sort = text })
+	form.AddInputField("Columns", columns, 0, nil, func(text string) { columns = text })
+	form.AddCheckbox("Shared", view.Shared, func(checked bool) { view.Shared = checked })
+	form.AddCheckbox("Open at start", false, func(checked bool) { view.Default = checked })
+
+	save := func() {
+		view.Columns = nil
+		for _, col := range strings.Split(columns, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				view.Columns = append(view.Columns, col)
+			}
+		}
+
+		saved, err := CreateView(c.Client, view)
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+		if err != nil {
+			c.newErrorModal("Error saving view: " + err.Error())
+			return
+		}
+
+		// the view has the filter now
+		table.Filter, table.FilterText = nil, ""
+		if err := table.ShowView(c.Me, "", saved); err != nil {
+			c.newErrorModal(err.Error())
+		}
+	}
+
+	form.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			save()
+			return nil
+		}
+		return event
+	})
+
+	cancel := func() {
+		c.Root.RemoveItem(form)
+		c.App.SetFocus(table.Table)
+	}
+	form.SetCancelFunc(cancel)
+	form.AddButton("Cancel", cancel)
+	form.AddButton("Save", save)
+
+	c.Root.SetDirection(tview.FlexRow).AddItem(form, 0, 1, true)
+	return form
+}
+
+func sortString(keys []apis.SortKey) string {
+	strs := make([]string, len(keys))
+	for i, k := range keys {
+		strs[i] = k.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// andFilters joins filter expressions into one that matches what all of them
+// do. Empty ones are left out.
+func andFilters(filters ...string) string {
+	var nonEmpty []string
+	for _, f := range filters {
+		if f != "" {
+			nonEmpty = append(nonEmpty, f)
+		}
+	}
+	if len(nonEmpty) > 1 {
+		return "(" + strings.Join(nonEmpty, ") and (") + ")"
+	}
+	return strings.Join(nonEmpty, "")
+}